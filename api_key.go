@@ -0,0 +1,52 @@
+package userion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Common errors returned by the APIKeyManager
+var (
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+	ErrAPIKeyExpired  = errors.New("API key expired")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// APIKey is a named, non-interactive credential of a user. The secret part
+// of the key is only returned once, when the key is created.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Visible part of the key, to tell keys apart
+	Scopes     []string   `json:"scopes,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key was granted a scope. Keys without scopes
+// are unrestricted.
+func (k *APIKey) HasScope(scope string) bool {
+	if len(k.Scopes) == 0 {
+		return true
+	}
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyManager defines the interface for managing personal access tokens
+type APIKeyManager interface {
+	AutoMigrate() error
+	CreateAPIKey(userID, name string, scopes []string, ttl time.Duration) (*APIKey, string, error)
+	ListAPIKeys(userID string) ([]APIKey, error)
+	RevokeAPIKey(id string) error
+	AuthenticateAPIKey(key string) (*User, *APIKey, error)
+}
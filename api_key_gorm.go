@@ -0,0 +1,238 @@
+package userion
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Default settings of GormAPIKeyManager
+const (
+	DefaultAPIKeyPrefix = "uak"
+	// apiKeyLookupSize is the number of random bytes in the visible part of a key
+	apiKeyLookupSize = 8
+	// apiKeyTouchInterval limits how often LastUsedAt is written
+	apiKeyTouchInterval = time.Minute
+)
+
+// GormAPIKeyModel represents the GORM-specific database model for API keys
+type GormAPIKeyModel struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primaryKey;"`
+	UserID     uuid.UUID      `gorm:"type:uuid;not null;index"`
+	Name       string         `gorm:"not null"`
+	Prefix     string         `gorm:"type:varchar(64);unique;not null"`
+	KeyHash    string         `gorm:"type:varchar(64);not null"`
+	Scopes     datatypes.JSON `gorm:"type:json;default:'[]'"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	RevokedAt  *time.Time
+}
+
+// ToAPIKey converts a GormAPIKeyModel to an APIKey business model
+func (g *GormAPIKeyModel) ToAPIKey() *APIKey {
+	var scopes []string
+	if len(g.Scopes) > 0 {
+		_ = json.Unmarshal([]byte(g.Scopes), &scopes)
+	}
+
+	return &APIKey{
+		ID:         g.ID,
+		UserID:     g.UserID,
+		Name:       g.Name,
+		Prefix:     g.Prefix,
+		Scopes:     scopes,
+		ExpiresAt:  g.ExpiresAt,
+		LastUsedAt: g.LastUsedAt,
+		CreatedAt:  g.CreatedAt,
+		RevokedAt:  g.RevokedAt,
+	}
+}
+
+// GormAPIKeyManager is the GORM implementation of APIKeyManager
+type GormAPIKeyManager struct {
+	db          *gorm.DB
+	tableName   string
+	userManager UserManager
+
+	prefix string
+
+	now func() time.Time
+}
+
+// APIKeyOption configures optional behaviour of a GormAPIKeyManager
+type APIKeyOption func(*GormAPIKeyManager)
+
+// WithAPIKeyPrefix sets the prefix identifying keys of this application, which
+// helps secret scanners recognize leaked keys
+func WithAPIKeyPrefix(prefix string) APIKeyOption {
+	return func(m *GormAPIKeyManager) {
+		m.prefix = prefix
+	}
+}
+
+// NewGormAPIKeyManager initializes a new APIKeyManager
+func NewGormAPIKeyManager(db *gorm.DB, tableName string, userManager UserManager, opts ...APIKeyOption) APIKeyManager {
+	m := &GormAPIKeyManager{
+		db:          db,
+		tableName:   tableName,
+		userManager: userManager,
+		prefix:      DefaultAPIKeyPrefix,
+		now:         time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// AutoMigrate creates or updates the database schema for API keys
+func (m *GormAPIKeyManager) AutoMigrate() error {
+	return m.db.Table(m.tableName).AutoMigrate(&GormAPIKeyModel{})
+}
+
+// CreateAPIKey creates a key for the user and returns it together with the
+// full key to show once. A zero ttl creates a key that does not expire.
+func (m *GormAPIKeyManager) CreateAPIKey(userID, name string, scopes []string, ttl time.Duration) (*APIKey, string, error) {
+	user, err := m.userManager.GetUserByID(userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	lookup := make([]byte, apiKeyLookupSize)
+	if _, err := rand.Read(lookup); err != nil {
+		return nil, "", err
+	}
+	secret, err := GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The visible prefix locates the record; the whole key is compared by hash
+	prefix := m.prefix + "_" + hex.EncodeToString(lookup)
+	key := prefix + "_" + secret
+
+	if scopes == nil {
+		scopes = []string{}
+	}
+	scopeData, err := json.Marshal(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := m.now()
+	gormKey := &GormAPIKeyModel{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   HashToken(key),
+		Scopes:    datatypes.JSON(scopeData),
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		gormKey.ExpiresAt = &expiresAt
+	}
+
+	if err := m.db.Table(m.tableName).Create(gormKey).Error; err != nil {
+		return nil, "", err
+	}
+
+	return gormKey.ToAPIKey(), key, nil
+}
+
+// ListAPIKeys returns the keys of a user that have not been revoked, newest first
+func (m *GormAPIKeyManager) ListAPIKeys(userID string) ([]APIKey, error) {
+	var gormKeys []GormAPIKeyModel
+	err := m.db.Table(m.tableName).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").
+		Find(&gormKeys).Error
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]APIKey, len(gormKeys))
+	for i := range gormKeys {
+		keys[i] = *gormKeys[i].ToAPIKey()
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes a key by its ID
+func (m *GormAPIKeyManager) RevokeAPIKey(id string) error {
+	result := m.db.Table(m.tableName).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", m.now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns the owner of a valid key together with the key,
+// whose scopes the caller should check. The owner must be enabled and active.
+func (m *GormAPIKeyManager) AuthenticateAPIKey(key string) (*User, *APIKey, error) {
+	// Keys look like <prefix>_<lookup>_<secret>; the secret may contain "_"
+	lookupEnd := len(m.prefix) + 1 + 2*apiKeyLookupSize
+	if !strings.HasPrefix(key, m.prefix+"_") || len(key) <= lookupEnd || key[lookupEnd] != '_' {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var gormKey GormAPIKeyModel
+	if err := m.db.Table(m.tableName).Where("prefix = ?", key[:lookupEnd]).First(&gormKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(HashToken(key)), []byte(gormKey.KeyHash)) != 1 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if gormKey.RevokedAt != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	now := m.now()
+	if gormKey.ExpiresAt != nil && !now.Before(*gormKey.ExpiresAt) {
+		return nil, nil, ErrAPIKeyExpired
+	}
+
+	user, err := m.userManager.GetUserByID(gormKey.UserID.String())
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+	if !user.Enabled {
+		return nil, nil, ErrUserDisabled
+	}
+	if user.Status != UserStatusActive {
+		return nil, nil, ErrUserNotActive
+	}
+
+	// Avoid a write on every request
+	if gormKey.LastUsedAt == nil || now.Sub(*gormKey.LastUsedAt) >= apiKeyTouchInterval {
+		if err := m.db.Table(m.tableName).Where("id = ?", gormKey.ID).Update("last_used_at", now).Error; err != nil {
+			return nil, nil, err
+		}
+		gormKey.LastUsedAt = &now
+	}
+
+	return user, gormKey.ToAPIKey(), nil
+}
@@ -0,0 +1,113 @@
+package userion
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupAPIKeyManagerGorm creates an APIKeyManager for tests
+func setupAPIKeyManagerGorm(t *testing.T) (*GormAPIKeyManager, UserManager, *gorm.DB) {
+	userManager, db := setupTestDBGorm(t)
+
+	tableName := "api_keys_test_" + uuid.New().String()[:8]
+	apiKeyManager := NewGormAPIKeyManager(db, tableName, userManager).(*GormAPIKeyManager)
+	err := apiKeyManager.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	return apiKeyManager, userManager, db
+}
+
+// TestCreateAPIKey_Gorm tests creating and authenticating with API keys
+func TestCreateAPIKey_Gorm(t *testing.T) {
+	apiKeyManager, userManager, db := setupAPIKeyManagerGorm(t)
+	user := createTestUser(t, userManager)
+
+	apiKey, key, err := apiKeyManager.CreateAPIKey(user.ID.String(), "CI", []string{"repo:read"}, 0)
+	assert.NoError(t, err, "CreateAPIKey should not error with valid user ID")
+	assert.Equal(t, "CI", apiKey.Name)
+	assert.True(t, strings.HasPrefix(key, apiKey.Prefix+"_"), "The key should start with its visible prefix")
+	assert.True(t, strings.HasPrefix(apiKey.Prefix, DefaultAPIKeyPrefix+"_"))
+	assert.Nil(t, apiKey.ExpiresAt, "Keys without TTL should not expire")
+
+	// Verify only the hash is stored
+	var count int64
+	db.Table(apiKeyManager.tableName).Where("key_hash = ?", HashToken(key)).Count(&count)
+	assert.Equal(t, int64(1), count, "Key hash should be stored")
+
+	owner, authenticated, err := apiKeyManager.AuthenticateAPIKey(key)
+	assert.NoError(t, err, "AuthenticateAPIKey should not error with valid key")
+	assert.Equal(t, user.ID, owner.ID)
+	assert.Equal(t, apiKey.ID, authenticated.ID)
+	assert.NotNil(t, authenticated.LastUsedAt, "Last use should be recorded")
+	assert.True(t, authenticated.HasScope("repo:read"))
+	assert.False(t, authenticated.HasScope("repo:write"))
+
+	// Wrong secrets with a valid prefix are rejected
+	_, _, err = apiKeyManager.AuthenticateAPIKey(apiKey.Prefix + "_wrong-secret")
+	assert.Equal(t, ErrInvalidAPIKey, err)
+	_, _, err = apiKeyManager.AuthenticateAPIKey("not-a-key")
+	assert.Equal(t, ErrInvalidAPIKey, err)
+
+	_, _, err = apiKeyManager.CreateAPIKey(uuid.New().String(), "CI", nil, 0)
+	assert.Equal(t, ErrUserNotFound, err, "CreateAPIKey should error with unknown user")
+}
+
+// TestAPIKeyExpiryAndRevocation_Gorm tests expired and revoked keys
+func TestAPIKeyExpiryAndRevocation_Gorm(t *testing.T) {
+	apiKeyManager, userManager, _ := setupAPIKeyManagerGorm(t)
+	user := createTestUser(t, userManager)
+
+	expiring, expiringKey, err := apiKeyManager.CreateAPIKey(user.ID.String(), "Temporary", nil, time.Hour)
+	require.NoError(t, err)
+	assert.NotNil(t, expiring.ExpiresAt)
+	assert.True(t, expiring.HasScope("anything"), "Keys without scopes should be unrestricted")
+
+	apiKeyManager.now = func() time.Time { return time.Now().Add(time.Hour) }
+	_, _, err = apiKeyManager.AuthenticateAPIKey(expiringKey)
+	assert.Equal(t, ErrAPIKeyExpired, err, "Expired keys should be rejected")
+	apiKeyManager.now = time.Now
+
+	other, otherKey, err := apiKeyManager.CreateAPIKey(user.ID.String(), "Laptop", nil, 0)
+	require.NoError(t, err)
+
+	keys, err := apiKeyManager.ListAPIKeys(user.ID.String())
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2, "Both keys should be listed")
+
+	assert.NoError(t, apiKeyManager.RevokeAPIKey(other.ID.String()))
+	assert.Equal(t, ErrAPIKeyNotFound, apiKeyManager.RevokeAPIKey(other.ID.String()), "Revoking twice should error")
+	_, _, err = apiKeyManager.AuthenticateAPIKey(otherKey)
+	assert.Equal(t, ErrInvalidAPIKey, err, "Revoked keys should be rejected")
+
+	keys, err = apiKeyManager.ListAPIKeys(user.ID.String())
+	require.NoError(t, err)
+	require.Len(t, keys, 1, "Revoked keys should not be listed")
+	assert.Equal(t, expiring.ID, keys[0].ID)
+}
+
+// TestAPIKeyOwnerState_Gorm tests that only enabled and active users authenticate
+func TestAPIKeyOwnerState_Gorm(t *testing.T) {
+	apiKeyManager, userManager, _ := setupAPIKeyManagerGorm(t)
+	user := createTestUser(t, userManager)
+
+	_, key, err := apiKeyManager.CreateAPIKey(user.ID.String(), "CI", nil, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Status": UserStatusSuspended}))
+	_, _, err = apiKeyManager.AuthenticateAPIKey(key)
+	assert.Equal(t, ErrUserNotActive, err, "Keys of suspended users should be rejected")
+
+	require.NoError(t, userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Status": UserStatusActive}))
+	_, _, err = apiKeyManager.AuthenticateAPIKey(key)
+	assert.NoError(t, err)
+
+	require.NoError(t, userManager.DisableUserByID(user.ID.String()))
+	_, _, err = apiKeyManager.AuthenticateAPIKey(key)
+	assert.Equal(t, ErrUserDisabled, err, "Keys of disabled users should be rejected")
+}
@@ -0,0 +1,144 @@
+package userion
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// bloomFilterMagic identifies serialized bloom filters
+var bloomFilterMagic = [4]byte{'U', 'B', 'F', '1'}
+
+// ErrInvalidBloomFilter is returned when a serialized bloom filter cannot be read
+var ErrInvalidBloomFilter = errors.New("invalid bloom filter")
+
+// Limits of a bloom filter. 2^36 bits (8 GiB) hold billions of digests;
+// larger headers of a serialized filter are rejected as corrupt.
+const (
+	MaxBloomFilterBits   = 1 << 36
+	MaxBloomFilterHashes = 64
+)
+
+// bloomFilterReadChunk is the number of words allocated at a time while
+// reading a filter, so truncated input fails before a large allocation
+const bloomFilterReadChunk = 1 << 20
+
+// BloomFilter is a compact probabilistic set of SHA-1 digests. It never
+// reports a false negative and reports false positives at a configurable rate.
+type BloomFilter struct {
+	bits   []uint64
+	size   uint64 // number of bits
+	hashes uint32 // number of hash functions
+}
+
+// NewBloomFilter creates a filter sized for n entries at the given false positive rate
+func NewBloomFilter(n int, falsePositiveRate float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.001
+	}
+
+	size := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	size = min(max(size, 1), MaxBloomFilterBits)
+	hashes := uint32(min(MaxBloomFilterHashes, math.Max(1, math.Round(float64(size)/float64(n)*math.Ln2))))
+
+	return &BloomFilter{
+		bits:   make([]uint64, (size+63)/64),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+// positions derives the bit positions of a digest using double hashing.
+// SHA-1 digests are uniformly distributed, so their bytes are used directly.
+func (f *BloomFilter) positions(digest []byte, fn func(pos uint64) bool) bool {
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16]) | 1
+
+	for i := uint32(0); i < f.hashes; i++ {
+		if !fn((h1 + uint64(i)*h2) % f.size) {
+			return false
+		}
+	}
+	return true
+}
+
+// Add inserts a SHA-1 digest into the filter
+func (f *BloomFilter) Add(digest []byte) {
+	f.positions(digest, func(pos uint64) bool {
+		f.bits[pos/64] |= 1 << (pos % 64)
+		return true
+	})
+}
+
+// Contains reports whether a SHA-1 digest is possibly in the filter
+func (f *BloomFilter) Contains(digest []byte) bool {
+	return f.positions(digest, func(pos uint64) bool {
+		return f.bits[pos/64]&(1<<(pos%64)) != 0
+	})
+}
+
+// WriteTo serializes the filter
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, 16)
+	copy(header, bloomFilterMagic[:])
+	binary.BigEndian.PutUint64(header[4:12], f.size)
+	binary.BigEndian.PutUint32(header[12:16], f.hashes)
+	if _, err := bw.Write(header); err != nil {
+		return 0, err
+	}
+
+	word := make([]byte, 8)
+	for _, b := range f.bits {
+		binary.BigEndian.PutUint64(word, b)
+		if _, err := bw.Write(word); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+
+	return int64(len(header) + 8*len(f.bits)), nil
+}
+
+// ReadBloomFilter deserializes a filter written by WriteTo
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBloomFilter, err)
+	}
+	if [4]byte(header[0:4]) != bloomFilterMagic {
+		return nil, ErrInvalidBloomFilter
+	}
+
+	f := &BloomFilter{
+		size:   binary.BigEndian.Uint64(header[4:12]),
+		hashes: binary.BigEndian.Uint32(header[12:16]),
+	}
+	if f.size == 0 || f.size > MaxBloomFilterBits || f.hashes == 0 || f.hashes > MaxBloomFilterHashes {
+		return nil, ErrInvalidBloomFilter
+	}
+
+	words := (f.size + 63) / 64
+	f.bits = make([]uint64, 0, min(words, bloomFilterReadChunk))
+	word := make([]byte, 8)
+	for uint64(len(f.bits)) < words {
+		if _, err := io.ReadFull(br, word); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBloomFilter, err)
+		}
+		f.bits = append(f.bits, binary.BigEndian.Uint64(word))
+	}
+
+	return f, nil
+}
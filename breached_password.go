@@ -0,0 +1,195 @@
+package userion
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BreachedPasswordChecker reports whether a password appears in known breaches
+type BreachedPasswordChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// rangeFilePattern matches HIBP-style range file names, e.g. 5BAA6 or 5BAA6.txt
+var rangeFilePattern = regexp.MustCompile(`^[0-9A-Fa-f]{5}(\.txt)?$`)
+
+// RangeCorpusChecker looks passwords up in a local directory of HIBP-style
+// range files. Each file is named after the first 5 hex characters of a SHA-1
+// hash and holds one "SUFFIX:COUNT" line per breached hash.
+type RangeCorpusChecker struct {
+	dir      string
+	minCount int
+}
+
+// NewRangeCorpusChecker creates a checker over a range file directory.
+// Hashes seen fewer than minCount times are ignored.
+func NewRangeCorpusChecker(dir string, minCount int) *RangeCorpusChecker {
+	return &RangeCorpusChecker{
+		dir:      dir,
+		minCount: minCount,
+	}
+}
+
+// IsBreached reads the range file of the password's hash prefix
+func (c *RangeCorpusChecker) IsBreached(password string) (bool, error) {
+	digest := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(digest[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	var file *os.File
+	var err error
+	for _, name := range []string{prefix, prefix + ".txt", strings.ToLower(prefix), strings.ToLower(prefix) + ".txt"} {
+		file, err = os.Open(filepath.Join(c.dir, name))
+		if err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, count, ok := parseRangeLine(scanner.Text())
+		if ok && strings.EqualFold(lineSuffix, suffix) {
+			return count >= c.minCount, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// parseRangeLine splits a "SUFFIX:COUNT" line
+func parseRangeLine(line string) (string, int, bool) {
+	suffix, countText, found := strings.Cut(strings.TrimSpace(line), ":")
+	if !found || len(suffix) != 35 {
+		return "", 0, false
+	}
+
+	count, err := strconv.Atoi(countText)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return suffix, count, true
+}
+
+// ScanRangeCorpus calls fn with every SHA-1 digest in a range file directory
+// seen at least minCount times
+func ScanRangeCorpus(dir string, minCount int, fn func(digest []byte) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !rangeFilePattern.MatchString(entry.Name()) {
+			continue
+		}
+
+		prefix := entry.Name()[:5]
+		if err := scanRangeFile(filepath.Join(dir, entry.Name()), prefix, minCount, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanRangeFile calls fn with every digest of a single range file
+func scanRangeFile(path string, prefix string, minCount int, fn func(digest []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		suffix, count, ok := parseRangeLine(scanner.Text())
+		if !ok || count < minCount {
+			continue
+		}
+
+		digest, err := hex.DecodeString(prefix + suffix)
+		if err != nil {
+			return fmt.Errorf("invalid hash in %s: %w", path, err)
+		}
+		if err := fn(digest); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// BuildBloomFilter builds a bloom filter from a range file directory
+func BuildBloomFilter(dir string, minCount int, falsePositiveRate float64) (*BloomFilter, error) {
+	// Count entries first so the filter can be sized
+	n := 0
+	err := ScanRangeCorpus(dir, minCount, func(digest []byte) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	filter := NewBloomFilter(n, falsePositiveRate)
+	err = ScanRangeCorpus(dir, minCount, func(digest []byte) error {
+		filter.Add(digest)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// BloomFilterChecker checks passwords against a bloom filter of breached
+// SHA-1 hashes. Rare false positives reject a password that is not breached.
+type BloomFilterChecker struct {
+	filter *BloomFilter
+}
+
+// NewBloomFilterChecker creates a checker over a bloom filter
+func NewBloomFilterChecker(filter *BloomFilter) *BloomFilterChecker {
+	return &BloomFilterChecker{
+		filter: filter,
+	}
+}
+
+// LoadBloomFilterChecker reads a bloom filter file and creates a checker over it
+func LoadBloomFilterChecker(path string) (*BloomFilterChecker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	filter, err := ReadBloomFilter(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBloomFilterChecker(filter), nil
+}
+
+// IsBreached tests the password's SHA-1 hash against the filter
+func (c *BloomFilterChecker) IsBreached(password string) (bool, error) {
+	digest := sha1.Sum([]byte(password))
+	return c.filter.Contains(digest[:]), nil
+}
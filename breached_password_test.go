@@ -0,0 +1,161 @@
+package userion
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCorpus writes a range file directory containing the given passwords
+func writeTestCorpus(t *testing.T, counts map[string]int) string {
+	dir := t.TempDir()
+
+	files := make(map[string][]string)
+	for password, count := range counts {
+		digest := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(digest[:]))
+		files[hash[:5]] = append(files[hash[:5]], fmt.Sprintf("%s:%d", hash[5:], count))
+	}
+
+	for prefix, lines := range files {
+		// Add an unrelated entry to every file
+		lines = append(lines, strings.Repeat("0", 35)+":7")
+		err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(strings.Join(lines, "\r\n")), 0o644)
+		require.NoError(t, err)
+	}
+
+	return dir
+}
+
+// TestRangeCorpusChecker tests lookups in a range file directory
+func TestRangeCorpusChecker(t *testing.T) {
+	dir := writeTestCorpus(t, map[string]int{"password123": 1000, "rarepassword": 1})
+
+	checker := NewRangeCorpusChecker(dir, 1)
+	breached, err := checker.IsBreached("password123")
+	assert.NoError(t, err)
+	assert.True(t, breached, "Password in the corpus should be breached")
+
+	breached, err = checker.IsBreached("not-in-the-corpus")
+	assert.NoError(t, err)
+	assert.False(t, breached, "Password outside the corpus should not be breached")
+
+	// Test the minimum count threshold
+	checker = NewRangeCorpusChecker(dir, 10)
+	breached, err = checker.IsBreached("rarepassword")
+	assert.NoError(t, err)
+	assert.False(t, breached, "Rare password should be ignored below the threshold")
+}
+
+// TestBloomFilterChecker tests building, serializing and querying a bloom filter
+func TestBloomFilterChecker(t *testing.T) {
+	dir := writeTestCorpus(t, map[string]int{"password123": 1000, "letmein": 50, "rarepassword": 1})
+
+	filter, err := BuildBloomFilter(dir, 2, 0.0001)
+	require.NoError(t, err)
+
+	// Round trip through the serialized form
+	var buf bytes.Buffer
+	_, err = filter.WriteTo(&buf)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "breached.bloom")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+
+	checker, err := LoadBloomFilterChecker(path)
+	require.NoError(t, err)
+
+	for _, password := range []string{"password123", "letmein"} {
+		breached, err := checker.IsBreached(password)
+		assert.NoError(t, err)
+		assert.True(t, breached, "%s should be breached", password)
+	}
+
+	breached, _ := checker.IsBreached("rarepassword")
+	assert.False(t, breached, "Entries below the threshold should not be in the filter")
+	breached, _ = checker.IsBreached("correct horse battery staple")
+	assert.False(t, breached, "Unknown password should not be in the filter")
+
+	// Test reading an invalid filter
+	_, err = ReadBloomFilter(strings.NewReader("not a filter at all"))
+	assert.ErrorIs(t, err, ErrInvalidBloomFilter)
+
+	// Test a truncated header
+	_, err = ReadBloomFilter(bytes.NewReader(buf.Bytes()[:10]))
+	assert.ErrorIs(t, err, ErrInvalidBloomFilter)
+
+	// Test a truncated bit array
+	_, err = ReadBloomFilter(bytes.NewReader(buf.Bytes()[:buf.Len()-4]))
+	assert.ErrorIs(t, err, ErrInvalidBloomFilter)
+}
+
+// TestReadBloomFilter_Limits tests that oversized headers are rejected
+func TestReadBloomFilter_Limits(t *testing.T) {
+	header := func(size uint64, hashes uint32) []byte {
+		data := make([]byte, 16)
+		copy(data, bloomFilterMagic[:])
+		binary.BigEndian.PutUint64(data[4:12], size)
+		binary.BigEndian.PutUint32(data[12:16], hashes)
+		return data
+	}
+
+	for name, data := range map[string][]byte{
+		"overflowing size": header(math.MaxUint64, 3),
+		"huge size":        header(MaxBloomFilterBits+1, 3),
+		"huge hashes":      header(1024, math.MaxUint32),
+		"zero hashes":      header(1024, 0),
+	} {
+		_, err := ReadBloomFilter(bytes.NewReader(data))
+		assert.ErrorIs(t, err, ErrInvalidBloomFilter, name)
+	}
+
+	// A valid header without the promised bits fails without allocating them
+	_, err := ReadBloomFilter(bytes.NewReader(header(MaxBloomFilterBits, 3)))
+	assert.ErrorIs(t, err, ErrInvalidBloomFilter)
+}
+
+// TestBreachedPassword_Gorm tests the breached password check in the user manager
+func TestBreachedPassword_Gorm(t *testing.T) {
+	dir := writeTestCorpus(t, map[string]int{"password123": 1000, "hunter22": 10})
+
+	userManager, _ := setupTestDBGorm(t)
+	userManager.(*GormUserManager).breachChecker = NewRangeCorpusChecker(dir, 1)
+
+	// Test creating a user with a breached password
+	user := &User{
+		Name:     "Breached User",
+		Username: "breacheduser",
+		Email:    "breached@example.com",
+		Password: "password123",
+		Phone:    "1231231234",
+	}
+	err := userManager.CreateUser(user)
+	var policyErr *PasswordPolicyError
+	require.True(t, errors.As(err, &policyErr), "CreateUser should return a PasswordPolicyError")
+	assert.True(t, policyErr.Has(PasswordBreached))
+
+	user.Password = "unbreached-password"
+	err = userManager.CreateUser(user)
+	require.NoError(t, err)
+
+	// Test updating to a breached password
+	err = userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Password": "hunter22"})
+	assert.ErrorIs(t, err, ErrWeakPassword, "UpdateUserByID should reject a breached password")
+
+	// Test resetting to a breached password
+	token, err := userManager.RequestPasswordReset(user.Email)
+	require.NoError(t, err)
+	err = userManager.ResetPassword(token, "hunter22")
+	assert.ErrorIs(t, err, ErrWeakPassword, "ResetPassword should reject a breached password")
+}
@@ -0,0 +1,174 @@
+package userion
+
+import (
+	"errors"
+	"math"
+)
+
+// errInvalidCBOR is returned for malformed or unsupported CBOR input
+var errInvalidCBOR = errors.New("invalid CBOR")
+
+// cborMaxDepth bounds nesting so hostile input cannot exhaust the stack
+const cborMaxDepth = 16
+
+// decodeCBOR decodes the first CBOR item (RFC 8949) in data and returns it
+// together with the number of bytes consumed. Only what WebAuthn needs is
+// supported: integers become int64, byte strings []byte, text strings string,
+// arrays []interface{} and maps map[interface{}]interface{}.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := &cborDecoder{data: data}
+	value, err := d.decode(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, d.offset, nil
+}
+
+// cborDecoder reads CBOR items from a byte slice
+type cborDecoder struct {
+	data   []byte
+	offset int
+}
+
+// header reads the initial byte and argument of an item
+func (d *cborDecoder) header() (byte, uint64, error) {
+	if d.offset >= len(d.data) {
+		return 0, 0, errInvalidCBOR
+	}
+	initial := d.data[d.offset]
+	d.offset++
+
+	major := initial >> 5
+	info := initial & 0x1f
+
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		// Indefinite lengths are not used by authenticators
+		return 0, 0, errInvalidCBOR
+	}
+
+	if d.offset+size > len(d.data) {
+		return 0, 0, errInvalidCBOR
+	}
+	var arg uint64
+	for _, b := range d.data[d.offset : d.offset+size] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.offset += size
+
+	return major, arg, nil
+}
+
+// decode reads one item
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errInvalidCBOR
+	}
+
+	start := d.offset
+	major, arg, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0: // unsigned integer
+		if arg > math.MaxInt64 {
+			return nil, errInvalidCBOR
+		}
+		return int64(arg), nil
+
+	case 1: // negative integer
+		if arg > math.MaxInt64 {
+			return nil, errInvalidCBOR
+		}
+		return -1 - int64(arg), nil
+
+	case 2, 3: // byte and text strings
+		if arg > uint64(len(d.data)-d.offset) {
+			return nil, errInvalidCBOR
+		}
+		value := d.data[d.offset : d.offset+int(arg)]
+		d.offset += int(arg)
+		if major == 3 {
+			return string(value), nil
+		}
+		return append([]byte(nil), value...), nil
+
+	case 4: // array
+		if arg > uint64(len(d.data)-d.offset) {
+			return nil, errInvalidCBOR
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+
+	case 5: // map
+		if arg > uint64(len(d.data)-d.offset) {
+			return nil, errInvalidCBOR
+		}
+		items := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, errInvalidCBOR
+			}
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items[key] = value
+		}
+		return items, nil
+
+	case 7: // simple values
+		switch d.data[start] {
+		case 0xf4:
+			return false, nil
+		case 0xf5:
+			return true, nil
+		case 0xf6, 0xf7:
+			return nil, nil
+		}
+		return nil, errInvalidCBOR
+
+	default:
+		// Tags are not used by authenticators
+		return nil, errInvalidCBOR
+	}
+}
+
+// cborMap decodes data that must consist of exactly one CBOR map
+func cborMap(data []byte) (map[interface{}]interface{}, error) {
+	value, n, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := value.(map[interface{}]interface{})
+	if !ok || n != len(data) {
+		return nil, errInvalidCBOR
+	}
+	return m, nil
+}
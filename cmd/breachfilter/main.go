@@ -0,0 +1,68 @@
+// Command breachfilter builds a compact bloom filter from a local directory
+// of HIBP-style SHA-1 range files, for use with userion.LoadBloomFilterChecker.
+//
+// Usage:
+//
+//	breachfilter -corpus ./pwned-ranges -out breached.bloom [-fp 0.001] [-min-count 1]
+//	breachfilter -filter breached.bloom -check "password123"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/weedbox/userion"
+)
+
+func main() {
+	corpus := flag.String("corpus", "", "directory of HIBP-style range files to build the filter from")
+	out := flag.String("out", "breached.bloom", "path of the bloom filter to write")
+	falsePositiveRate := flag.Float64("fp", 0.001, "false positive rate of the filter")
+	minCount := flag.Int("min-count", 1, "ignore hashes seen fewer times than this")
+	filterPath := flag.String("filter", "", "bloom filter to check a password against")
+	check := flag.String("check", "", "password to check against -filter")
+	flag.Parse()
+
+	switch {
+	case *filterPath != "" && *check != "":
+		checker, err := userion.LoadBloomFilterChecker(*filterPath)
+		if err != nil {
+			log.Fatalf("failed to load filter: %v", err)
+		}
+
+		breached, _ := checker.IsBreached(*check)
+		if breached {
+			fmt.Println("breached")
+			os.Exit(1)
+		}
+		fmt.Println("not found")
+
+	case *corpus != "":
+		filter, err := userion.BuildBloomFilter(*corpus, *minCount, *falsePositiveRate)
+		if err != nil {
+			log.Fatalf("failed to build filter: %v", err)
+		}
+
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("failed to create %s: %v", *out, err)
+		}
+
+		size, err := filter.WriteTo(file)
+		if err != nil {
+			file.Close()
+			log.Fatalf("failed to write filter: %v", err)
+		}
+		if err := file.Close(); err != nil {
+			log.Fatalf("failed to write filter: %v", err)
+		}
+
+		fmt.Printf("wrote %s (%d bytes)\n", *out, size)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,64 @@
+package userion
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// IssueEmailVerification creates a single-use token proving ownership of the
+// user's current email address. Issuing a new token invalidates older ones.
+func (m *GormUserManager) IssueEmailVerification(userID string) (string, error) {
+	var gormUser GormUserModel
+	if err := m.users(m.db).Select("id", "email").Where("id = ?", userID).First(&gormUser).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrUserNotFound
+		}
+		return "", err
+	}
+
+	var token string
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = m.issueToken(tx, gormUser.ID, tokenPurposeEmailVerification, gormUser.Email, m.emailVerificationTTL)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConfirmEmail consumes an email verification token and marks the email as
+// verified. Inactive users are activated unless disabled by option.
+func (m *GormUserManager) ConfirmEmail(token string) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		record, err := m.consumeToken(tx, token, tokenPurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		var gormUser GormUserModel
+		if err := m.users(tx).Select("id", "email", "status").Where("id = ?", record.UserID).First(&gormUser).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+
+		// The token only proves ownership of the address it was sent to
+		if gormUser.Email != record.Subject {
+			return ErrInvalidToken
+		}
+
+		updates := map[string]interface{}{
+			"email_verified_at": *record.UsedAt,
+		}
+		if m.activateOnEmailConfirm && gormUser.Status == UserStatusInactive {
+			updates["status"] = UserStatusActive
+		}
+
+		return m.users(tx).Where("id = ?", gormUser.ID).Updates(updates).Error
+	})
+}
@@ -0,0 +1,110 @@
+package userion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIssueEmailVerification_Gorm tests the IssueEmailVerification method
+func TestIssueEmailVerification_Gorm(t *testing.T) {
+	userManager, db := setupTestDBGorm(t)
+	user := createTestUser(t, userManager)
+	m := userManager.(*GormUserManager)
+
+	token, err := userManager.IssueEmailVerification(user.ID.String())
+	assert.NoError(t, err, "IssueEmailVerification should not error with valid ID")
+	assert.NotEmpty(t, token, "Token should be returned")
+
+	// Verify only the hash is stored
+	var record GormUserTokenModel
+	err = db.Table(m.tokenTableName()).Where("user_id = ?", user.ID).First(&record).Error
+	require.NoError(t, err)
+	assert.Equal(t, HashToken(token), record.TokenHash, "Token hash should be stored")
+	assert.NotEqual(t, token, record.TokenHash, "Plain token should not be stored")
+
+	// Test issuing for a non-existent user
+	_, err = userManager.IssueEmailVerification(uuid.New().String())
+	assert.Equal(t, ErrUserNotFound, err, "IssueEmailVerification should return ErrUserNotFound with invalid ID")
+}
+
+// TestConfirmEmail_Gorm tests the ConfirmEmail method
+func TestConfirmEmail_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	user := createTestUser(t, userManager)
+	err := userManager.SetUserStatusByID(user.ID.String(), UserStatusInactive)
+	require.NoError(t, err)
+
+	token, err := userManager.IssueEmailVerification(user.ID.String())
+	require.NoError(t, err)
+
+	err = userManager.ConfirmEmail(token)
+	assert.NoError(t, err, "ConfirmEmail should not error with valid token")
+
+	// Verify email is marked verified and user activated
+	confirmedUser, err := userManager.GetUserByID(user.ID.String())
+	require.NoError(t, err)
+	assert.NotNil(t, confirmedUser.EmailVerifiedAt, "EmailVerifiedAt should be set")
+	assert.Equal(t, UserStatusActive, confirmedUser.Status, "User should be activated")
+
+	// Test the token is single-use
+	err = userManager.ConfirmEmail(token)
+	assert.Equal(t, ErrInvalidToken, err, "ConfirmEmail should reject a used token")
+
+	// Test with an unknown token
+	err = userManager.ConfirmEmail("unknown-token")
+	assert.Equal(t, ErrInvalidToken, err, "ConfirmEmail should reject an unknown token")
+}
+
+// TestConfirmEmail_Rules_Gorm tests expiry, reissue and email change handling
+func TestConfirmEmail_Rules_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	user := createTestUser(t, userManager)
+	m := userManager.(*GormUserManager)
+
+	// Test an expired token
+	token, err := userManager.IssueEmailVerification(user.ID.String())
+	require.NoError(t, err)
+	m.now = func() time.Time { return time.Now().Add(DefaultEmailVerificationTTL + time.Minute) }
+	err = userManager.ConfirmEmail(token)
+	assert.Equal(t, ErrTokenExpired, err, "ConfirmEmail should reject an expired token")
+	m.now = time.Now
+
+	// Test that reissuing invalidates the previous token
+	oldToken, err := userManager.IssueEmailVerification(user.ID.String())
+	require.NoError(t, err)
+	newToken, err := userManager.IssueEmailVerification(user.ID.String())
+	require.NoError(t, err)
+	err = userManager.ConfirmEmail(oldToken)
+	assert.Equal(t, ErrInvalidToken, err, "ConfirmEmail should reject a superseded token")
+
+	// Test that a token does not verify a changed email address
+	err = userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Email": "changed@example.com"})
+	require.NoError(t, err)
+	err = userManager.ConfirmEmail(newToken)
+	assert.Equal(t, ErrInvalidToken, err, "ConfirmEmail should reject a token issued for another email")
+
+	unverifiedUser, err := userManager.GetUserByID(user.ID.String())
+	require.NoError(t, err)
+	assert.Nil(t, unverifiedUser.EmailVerifiedAt, "EmailVerifiedAt should not be set")
+}
+
+// TestConfirmEmail_KeepsStatus_Gorm tests that confirmation does not change non-inactive statuses
+func TestConfirmEmail_KeepsStatus_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	user := createTestUser(t, userManager)
+	err := userManager.SetUserStatusByID(user.ID.String(), UserStatusSuspended)
+	require.NoError(t, err)
+
+	token, err := userManager.IssueEmailVerification(user.ID.String())
+	require.NoError(t, err)
+	err = userManager.ConfirmEmail(token)
+	require.NoError(t, err)
+
+	confirmedUser, err := userManager.GetUserByID(user.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, UserStatusSuspended, confirmedUser.Status, "Suspended user should stay suspended")
+}
@@ -0,0 +1,32 @@
+package userion
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType identifies a user lifecycle event
+type EventType string
+
+const (
+	// EventPasswordResetRequested is emitted when a password reset token is issued
+	EventPasswordResetRequested EventType = "password_reset_requested"
+	// EventPasswordReset is emitted when a password is reset with a token
+	EventPasswordReset EventType = "password_reset"
+	// EventPasswordChanged is emitted when a password is set through an update
+	EventPasswordChanged EventType = "password_changed"
+	// EventUserDisabled is emitted when a user is disabled
+	EventUserDisabled EventType = "user_disabled"
+)
+
+// Event describes something that happened to a user
+type Event struct {
+	Type   EventType `json:"type"`
+	UserID uuid.UUID `json:"user_id"`
+	Time   time.Time `json:"time"`
+}
+
+// EventHandler receives events emitted by a user manager. Handlers are called
+// synchronously after the change has been committed.
+type EventHandler func(event Event)
@@ -0,0 +1,73 @@
+package userion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Common errors returned by the FederatedIdentityManager
+var (
+	ErrExternalIdentityNotFound = errors.New("external identity not found")
+	ErrExternalIdentityLinked   = errors.New("external identity already linked")
+	ErrExternalEmailNotVerified = errors.New("external identity has no verified email")
+
+	// Unlinking would leave the user without any way to sign in
+	ErrLastLoginMethod = errors.New("cannot remove the last login method")
+)
+
+// UnusablePassword is stored for users who cannot sign in with a password,
+// such as users provisioned from an external identity. It is treated as an
+// already hashed password by CreateUser and never matches a real hash.
+const UnusablePassword = "!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!"
+
+// HasUsablePassword reports whether the user can sign in with a password
+func HasUsablePassword(user *User) bool {
+	return user.Password != "" && user.Password != UnusablePassword
+}
+
+// LoginMethodChecker reports whether a user has a way to sign in that does
+// not involve a password, such as a registered passkey
+type LoginMethodChecker interface {
+	HasLoginMethod(userID string) (bool, error)
+}
+
+// ExternalClaims are the verified claims of a user authenticated by an
+// external OAuth or OpenID Connect provider
+type ExternalClaims struct {
+	Provider          string                 `json:"provider"` // e.g. "google" or "github"
+	Subject           string                 `json:"sub"`      // Stable user ID at the provider
+	Email             string                 `json:"email,omitempty"`
+	EmailVerified     bool                   `json:"email_verified"`
+	Name              string                 `json:"name,omitempty"`
+	PreferredUsername string                 `json:"preferred_username,omitempty"`
+	Phone             string                 `json:"phone_number,omitempty"`
+	PhoneVerified     bool                   `json:"phone_number_verified"`
+	Raw               map[string]interface{} `json:"raw,omitempty"` // Complete claims as received
+}
+
+// ExternalIdentity links a user to an account at an external provider
+type ExternalIdentity struct {
+	ID          uuid.UUID              `json:"id"`
+	UserID      uuid.UUID              `json:"user_id"`
+	Provider    string                 `json:"provider"`
+	Subject     string                 `json:"subject"`
+	Email       string                 `json:"email,omitempty"`
+	Claims      map[string]interface{} `json:"claims,omitempty"` // Snapshot from the latest sign-in
+	CreatedAt   time.Time              `json:"created_at"`
+	LastLoginAt *time.Time             `json:"last_login_at,omitempty"`
+}
+
+// FederatedIdentityManager defines the interface for linking users to
+// identities at external providers
+type FederatedIdentityManager interface {
+	LoginMethodChecker
+
+	AutoMigrate() error
+	FindUserByExternalIdentity(provider, subject string) (*User, error)
+	SignInWithExternalIdentity(claims *ExternalClaims) (*User, error)
+	LinkExternalIdentity(userID string, claims *ExternalClaims) (*ExternalIdentity, error)
+	UnlinkExternalIdentity(userID, provider, subject string) error
+	ListExternalIdentities(userID string) ([]ExternalIdentity, error)
+}
@@ -0,0 +1,397 @@
+package userion
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// usernameAttempts is how many suffixed usernames are tried when provisioning
+// a user whose preferred username is taken
+const usernameAttempts = 5
+
+// GormExternalIdentityModel represents the GORM-specific database model for
+// external identities. Provider and subject are unique together.
+type GormExternalIdentityModel struct {
+	ID          uuid.UUID      `gorm:"type:uuid;primaryKey;"`
+	UserID      uuid.UUID      `gorm:"type:uuid;not null;index"`
+	Provider    string         `gorm:"type:varchar(64);not null"`
+	Subject     string         `gorm:"type:varchar(255);not null"`
+	Email       string         `gorm:"not null;default:''"`
+	Claims      datatypes.JSON `gorm:"type:json;default:'{}'"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime"`
+	LastLoginAt *time.Time
+}
+
+// ToExternalIdentity converts a GormExternalIdentityModel to an ExternalIdentity business model
+func (g *GormExternalIdentityModel) ToExternalIdentity() *ExternalIdentity {
+	claims := make(map[string]interface{})
+	if len(g.Claims) > 0 {
+		if err := json.Unmarshal([]byte(g.Claims), &claims); err != nil {
+			claims = make(map[string]interface{})
+		}
+	}
+
+	return &ExternalIdentity{
+		ID:          g.ID,
+		UserID:      g.UserID,
+		Provider:    g.Provider,
+		Subject:     g.Subject,
+		Email:       g.Email,
+		Claims:      claims,
+		CreatedAt:   g.CreatedAt,
+		LastLoginAt: g.LastLoginAt,
+	}
+}
+
+// GormFederatedIdentityManager is the GORM implementation of FederatedIdentityManager
+type GormFederatedIdentityManager struct {
+	db          *gorm.DB
+	tableName   string
+	userManager UserManager
+
+	linkByVerifiedEmail bool
+	loginMethodCheckers []LoginMethodChecker
+
+	now func() time.Time
+}
+
+// FederatedIdentityOption configures optional behaviour of a GormFederatedIdentityManager
+type FederatedIdentityOption func(*GormFederatedIdentityManager)
+
+// WithLinkByVerifiedEmail lets SignInWithExternalIdentity link an unknown
+// external identity to an existing user with the same email, provided both
+// the provider and this system have verified the address (disabled by default)
+func WithLinkByVerifiedEmail(link bool) FederatedIdentityOption {
+	return func(m *GormFederatedIdentityManager) {
+		m.linkByVerifiedEmail = link
+	}
+}
+
+// WithLoginMethodChecker registers another way of signing in, such as a
+// WebAuthnManager, that counts when unlinking the last external identity
+func WithLoginMethodChecker(checker LoginMethodChecker) FederatedIdentityOption {
+	return func(m *GormFederatedIdentityManager) {
+		m.loginMethodCheckers = append(m.loginMethodCheckers, checker)
+	}
+}
+
+// NewGormFederatedIdentityManager initializes a new FederatedIdentityManager
+func NewGormFederatedIdentityManager(db *gorm.DB, tableName string, userManager UserManager, opts ...FederatedIdentityOption) FederatedIdentityManager {
+	m := &GormFederatedIdentityManager{
+		db:          db,
+		tableName:   tableName,
+		userManager: userManager,
+		now:         time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// AutoMigrate creates or updates the database schema for external identities
+func (m *GormFederatedIdentityManager) AutoMigrate() error {
+	if err := m.db.Table(m.tableName).AutoMigrate(&GormExternalIdentityModel{}); err != nil {
+		return err
+	}
+	return migrateUniqueIndex(m.db, &GormExternalIdentityModel{}, m.tableName, "idx_"+m.tableName+"_provider_subject", "", "provider", "subject")
+}
+
+// getIdentity retrieves the identity of a provider and subject
+func (m *GormFederatedIdentityManager) getIdentity(provider, subject string) (*GormExternalIdentityModel, error) {
+	var record GormExternalIdentityModel
+	if err := m.db.Table(m.tableName).Where("provider = ? AND subject = ?", provider, subject).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExternalIdentityNotFound
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// FindUserByExternalIdentity returns the user linked to an identity at a provider
+func (m *GormFederatedIdentityManager) FindUserByExternalIdentity(provider, subject string) (*User, error) {
+	record, err := m.getIdentity(provider, subject)
+	if err != nil {
+		return nil, err
+	}
+	return m.userManager.GetUserByID(record.UserID.String())
+}
+
+// SignInWithExternalIdentity returns the user linked to the identity of
+// verified claims and refreshes the claims snapshot. Unknown identities are
+// provisioned just in time: a new user without a usable password is created
+// from the claims, which requires a verified email address. A verified phone
+// number is taken over as well. Disabled users get ErrUserDisabled.
+func (m *GormFederatedIdentityManager) SignInWithExternalIdentity(claims *ExternalClaims) (*User, error) {
+	record, err := m.getIdentity(claims.Provider, claims.Subject)
+	if err == nil {
+		user, err := m.userManager.GetUserByID(record.UserID.String())
+		if err != nil {
+			return nil, err
+		}
+		if !user.Enabled {
+			return nil, ErrUserDisabled
+		}
+
+		snapshot, err := claimsSnapshot(claims)
+		if err != nil {
+			return nil, err
+		}
+		err = m.db.Table(m.tableName).Where("id = ?", record.ID).Updates(map[string]interface{}{
+			"email":         claims.Email,
+			"claims":        snapshot,
+			"last_login_at": m.now(),
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+
+		return user, nil
+	}
+	if !errors.Is(err, ErrExternalIdentityNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrExternalEmailNotVerified
+	}
+
+	user, err := m.provisionUser(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	if _, err := m.link(user.ID, claims, &now); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// provisionUser returns the user an unknown identity signs in as, creating
+// one unless an existing user may be linked by email
+func (m *GormFederatedIdentityManager) provisionUser(claims *ExternalClaims) (*User, error) {
+	existing, err := m.userManager.GetUserByEmail(claims.Email)
+	if err == nil {
+		if m.linkByVerifiedEmail && existing.EmailVerifiedAt != nil {
+			if !existing.Enabled {
+				return nil, ErrUserDisabled
+			}
+			return existing, nil
+		}
+		return nil, ErrUserAlreadyExists
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	username, err := m.availableUsername(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = username
+	}
+
+	verifiedAt := m.now()
+	user := &User{
+		Name:            name,
+		Username:        username,
+		Email:           claims.Email,
+		Password:        UnusablePassword,
+		Enabled:         true,
+		Status:          UserStatusActive,
+		EmailVerifiedAt: &verifiedAt,
+	}
+	// Unverified numbers could belong to someone else and collide with their account
+	if claims.Phone != "" && claims.PhoneVerified {
+		user.Phone = claims.Phone
+		user.PhoneVerifiedAt = &verifiedAt
+	}
+	if err := m.userManager.CreateUser(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// availableUsername picks an unused username for a provisioned user, based on
+// the preferred username or the local part of the email address
+func (m *GormFederatedIdentityManager) availableUsername(claims *ExternalClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	if base == "" {
+		base = claims.Provider + "-" + claims.Subject
+	}
+
+	candidate := base
+	for attempt := 0; attempt < usernameAttempts; attempt++ {
+		_, err := m.userManager.GetUserByUsername(candidate)
+		if errors.Is(err, ErrUserNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		suffix, err := GenerateNumericCode(4)
+		if err != nil {
+			return "", err
+		}
+		candidate = base + "-" + suffix
+	}
+
+	return "", ErrUserAlreadyExists
+}
+
+// claimsSnapshot encodes the raw claims for storage
+func claimsSnapshot(claims *ExternalClaims) (datatypes.JSON, error) {
+	raw := claims.Raw
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(data), nil
+}
+
+// link stores a new identity of a user
+func (m *GormFederatedIdentityManager) link(userID uuid.UUID, claims *ExternalClaims, lastLoginAt *time.Time) (*GormExternalIdentityModel, error) {
+	snapshot, err := claimsSnapshot(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &GormExternalIdentityModel{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Provider:    claims.Provider,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		Claims:      snapshot,
+		CreatedAt:   m.now(),
+		LastLoginAt: lastLoginAt,
+	}
+	if err := m.db.Table(m.tableName).Create(record).Error; err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// LinkExternalIdentity links the identity of verified claims to an existing
+// user, e.g. from the account settings of a signed-in user
+func (m *GormFederatedIdentityManager) LinkExternalIdentity(userID string, claims *ExternalClaims) (*ExternalIdentity, error) {
+	user, err := m.userManager.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.getIdentity(claims.Provider, claims.Subject)
+	if err == nil {
+		return nil, ErrExternalIdentityLinked
+	}
+	if !errors.Is(err, ErrExternalIdentityNotFound) {
+		return nil, err
+	}
+
+	record, err := m.link(user.ID, claims, nil)
+	if err != nil {
+		return nil, err
+	}
+	return record.ToExternalIdentity(), nil
+}
+
+// UnlinkExternalIdentity removes an identity from a user. The last identity
+// of a user without a usable password or another login method is kept.
+func (m *GormFederatedIdentityManager) UnlinkExternalIdentity(userID, provider, subject string) error {
+	var record GormExternalIdentityModel
+	err := m.db.Table(m.tableName).Where("user_id = ? AND provider = ? AND subject = ?", userID, provider, subject).First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrExternalIdentityNotFound
+		}
+		return err
+	}
+
+	remains, err := m.hasOtherLoginMethod(&record)
+	if err != nil {
+		return err
+	}
+	if !remains {
+		return ErrLastLoginMethod
+	}
+
+	return m.db.Table(m.tableName).Where("id = ?", record.ID).Delete(&GormExternalIdentityModel{}).Error
+}
+
+// hasOtherLoginMethod reports whether the user of an identity can still sign
+// in once it is removed
+func (m *GormFederatedIdentityManager) hasOtherLoginMethod(record *GormExternalIdentityModel) (bool, error) {
+	var count int64
+	if err := m.db.Table(m.tableName).Where("user_id = ? AND id <> ?", record.UserID, record.ID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	user, err := m.userManager.GetUserByID(record.UserID.String())
+	if err != nil {
+		return false, err
+	}
+	if HasUsablePassword(user) {
+		return true, nil
+	}
+
+	for _, checker := range m.loginMethodCheckers {
+		ok, err := checker.HasLoginMethod(record.UserID.String())
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// ListExternalIdentities returns the identities linked to a user in the order they were linked
+func (m *GormFederatedIdentityManager) ListExternalIdentities(userID string) ([]ExternalIdentity, error) {
+	var records []GormExternalIdentityModel
+	if err := m.db.Table(m.tableName).Where("user_id = ?", userID).Order("created_at").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	identities := make([]ExternalIdentity, len(records))
+	for i := range records {
+		identities[i] = *records[i].ToExternalIdentity()
+	}
+	return identities, nil
+}
+
+// HasLoginMethod reports whether a user has linked an external identity,
+// implementing LoginMethodChecker
+func (m *GormFederatedIdentityManager) HasLoginMethod(userID string) (bool, error) {
+	var count int64
+	err := m.db.Table(m.tableName).Where("user_id = ?", userID).Count(&count).Error
+	return count > 0, err
+}
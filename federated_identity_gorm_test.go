@@ -0,0 +1,173 @@
+package userion
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFederatedIdentityManagerGorm creates a FederatedIdentityManager backed by a UserManager
+func setupFederatedIdentityManagerGorm(t *testing.T, opts ...FederatedIdentityOption) (*GormFederatedIdentityManager, UserManager) {
+	userManager, db := setupTestDBGorm(t)
+
+	tableName := "identities_test_" + uuid.New().String()[:8]
+	identityManager := NewGormFederatedIdentityManager(db, tableName, userManager, opts...).(*GormFederatedIdentityManager)
+	err := identityManager.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	return identityManager, userManager
+}
+
+// googleClaims returns verified claims of a Google account
+func googleClaims(subject, email string) *ExternalClaims {
+	return &ExternalClaims{
+		Provider:      "google",
+		Subject:       subject,
+		Email:         email,
+		EmailVerified: true,
+		Name:          "Jane Doe",
+		Raw: map[string]interface{}{
+			"sub":   subject,
+			"email": email,
+		},
+	}
+}
+
+// staticLoginMethod is a LoginMethodChecker with a fixed answer
+type staticLoginMethod bool
+
+func (s staticLoginMethod) HasLoginMethod(userID string) (bool, error) {
+	return bool(s), nil
+}
+
+// TestSignInWithExternalIdentity_Provisioning_Gorm tests just-in-time user creation
+func TestSignInWithExternalIdentity_Provisioning_Gorm(t *testing.T) {
+	identityManager, userManager := setupFederatedIdentityManagerGorm(t)
+
+	user, err := identityManager.SignInWithExternalIdentity(googleClaims("g-1", "jane@example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "jane", user.Username, "The username should be derived from the email")
+	assert.Equal(t, "Jane Doe", user.Name)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.False(t, HasUsablePassword(user))
+	assert.Equal(t, ErrInvalidPassword, userManager.VerifyPasswordByID(user.ID.String(), UnusablePassword))
+
+	// Signing in again returns the linked user and refreshes the snapshot
+	claims := googleClaims("g-1", "jane@example.com")
+	claims.Raw["locale"] = "en"
+	again, err := identityManager.SignInWithExternalIdentity(claims)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+
+	identities, err := identityManager.ListExternalIdentities(user.ID.String())
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	assert.Equal(t, "en", identities[0].Claims["locale"])
+	assert.NotNil(t, identities[0].LastLoginAt)
+
+	found, err := identityManager.FindUserByExternalIdentity("google", "g-1")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, found.ID)
+	_, err = identityManager.FindUserByExternalIdentity("github", "g-1")
+	assert.Equal(t, ErrExternalIdentityNotFound, err)
+
+	// A second user without phone number, whose username is taken
+	other, err := identityManager.SignInWithExternalIdentity(googleClaims("g-2", "jane@other.example.com"))
+	require.NoError(t, err)
+	assert.NotEqual(t, "jane", other.Username)
+	assert.Contains(t, other.Username, "jane-")
+
+	// Disabled users cannot sign in through a linked identity
+	require.NoError(t, userManager.DisableUserByID(user.ID.String()))
+	_, err = identityManager.SignInWithExternalIdentity(googleClaims("g-1", "jane@example.com"))
+	assert.Equal(t, ErrUserDisabled, err, "Disabled users should not sign in")
+}
+
+// TestSignInWithExternalIdentity_Verification_Gorm tests that unverified or conflicting emails are refused
+func TestSignInWithExternalIdentity_Verification_Gorm(t *testing.T) {
+	identityManager, userManager := setupFederatedIdentityManagerGorm(t)
+	existing := createTestUser(t, userManager)
+
+	claims := googleClaims("g-1", "new@example.com")
+	claims.EmailVerified = false
+	_, err := identityManager.SignInWithExternalIdentity(claims)
+	assert.Equal(t, ErrExternalEmailNotVerified, err)
+
+	// Accounts are not taken over through an email address by default
+	_, err = identityManager.SignInWithExternalIdentity(googleClaims("g-2", existing.Email))
+	assert.Equal(t, ErrUserAlreadyExists, err)
+}
+
+// TestSignInWithExternalIdentity_LinkByEmail_Gorm tests linking to users with the same verified email
+func TestSignInWithExternalIdentity_LinkByEmail_Gorm(t *testing.T) {
+	identityManager, userManager := setupFederatedIdentityManagerGorm(t, WithLinkByVerifiedEmail(true))
+	existing := createTestUser(t, userManager)
+
+	_, err := identityManager.SignInWithExternalIdentity(googleClaims("g-1", existing.Email))
+	assert.Equal(t, ErrUserAlreadyExists, err, "An unverified local address should not be linked")
+
+	token, err := userManager.IssueEmailVerification(existing.ID.String())
+	require.NoError(t, err)
+	require.NoError(t, userManager.ConfirmEmail(token))
+
+	user, err := identityManager.SignInWithExternalIdentity(googleClaims("g-1", existing.Email))
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, user.ID)
+}
+
+// TestLinkExternalIdentity_Gorm tests linking identities to existing users
+func TestLinkExternalIdentity_Gorm(t *testing.T) {
+	identityManager, userManager := setupFederatedIdentityManagerGorm(t)
+	users := createGroupTestUsers(t, userManager, 2)
+
+	identity, err := identityManager.LinkExternalIdentity(users[0].ID.String(), &ExternalClaims{Provider: "github", Subject: "42"})
+	require.NoError(t, err)
+	assert.Equal(t, users[0].ID, identity.UserID)
+	assert.Nil(t, identity.LastLoginAt)
+
+	_, err = identityManager.LinkExternalIdentity(users[1].ID.String(), &ExternalClaims{Provider: "github", Subject: "42"})
+	assert.Equal(t, ErrExternalIdentityLinked, err)
+	_, err = identityManager.LinkExternalIdentity(uuid.New().String(), &ExternalClaims{Provider: "github", Subject: "43"})
+	assert.Equal(t, ErrUserNotFound, err)
+
+	user, err := identityManager.SignInWithExternalIdentity(&ExternalClaims{Provider: "github", Subject: "42"})
+	require.NoError(t, err, "Linked identities need no verified email")
+	assert.Equal(t, users[0].ID, user.ID)
+
+	ok, err := identityManager.HasLoginMethod(users[0].ID.String())
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = identityManager.HasLoginMethod(users[1].ID.String())
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+// TestUnlinkExternalIdentity_Gorm tests that the last login method cannot be unlinked
+func TestUnlinkExternalIdentity_Gorm(t *testing.T) {
+	identityManager, userManager := setupFederatedIdentityManagerGorm(t)
+
+	user, err := identityManager.SignInWithExternalIdentity(googleClaims("g-1", "jane@example.com"))
+	require.NoError(t, err)
+	userID := user.ID.String()
+
+	_, err = identityManager.LinkExternalIdentity(userID, &ExternalClaims{Provider: "github", Subject: "42"})
+	require.NoError(t, err)
+
+	assert.Equal(t, ErrExternalIdentityNotFound, identityManager.UnlinkExternalIdentity(userID, "github", "43"))
+	require.NoError(t, identityManager.UnlinkExternalIdentity(userID, "github", "42"))
+	assert.Equal(t, ErrLastLoginMethod, identityManager.UnlinkExternalIdentity(userID, "google", "g-1"))
+
+	// Another login method, such as a passkey, allows unlinking
+	identityManager.loginMethodCheckers = []LoginMethodChecker{staticLoginMethod(false), staticLoginMethod(true)}
+	require.NoError(t, identityManager.UnlinkExternalIdentity(userID, "google", "g-1"))
+	identityManager.loginMethodCheckers = nil
+
+	// So does setting a password
+	_, err = identityManager.LinkExternalIdentity(userID, &ExternalClaims{Provider: "github", Subject: "42"})
+	require.NoError(t, err)
+	require.NoError(t, userManager.UpdateUserByID(userID, map[string]interface{}{"Password": "newpassword123"}))
+	require.NoError(t, identityManager.UnlinkExternalIdentity(userID, "github", "42"))
+	assert.NoError(t, userManager.VerifyPasswordByID(userID, "newpassword123"))
+}
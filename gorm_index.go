@@ -0,0 +1,31 @@
+package userion
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migrateUniqueIndex creates a unique index on columns of table unless it
+// exists. GORM derives index names from the model rather than the table, so
+// managers with configurable table names create composite indexes here with
+// names that include the table. A non-empty where makes it a partial index.
+func migrateUniqueIndex(db *gorm.DB, model interface{}, table, name, where string, columns ...string) error {
+	if db.Table(table).Migrator().HasIndex(model, name) {
+		return nil
+	}
+
+	placeholders := make([]string, len(columns))
+	values := []interface{}{clause.Column{Name: name}, clause.Table{Name: table}}
+	for i, column := range columns {
+		placeholders[i] = "?"
+		values = append(values, clause.Column{Name: column})
+	}
+
+	sql := "CREATE UNIQUE INDEX ? ON ? (" + strings.Join(placeholders, ", ") + ")"
+	if where != "" {
+		sql += " WHERE " + where
+	}
+	return db.Exec(sql, values...).Error
+}
@@ -0,0 +1,57 @@
+package userion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Common errors returned by the GroupManager
+var (
+	ErrGroupNotFound      = errors.New("group not found")
+	ErrGroupAlreadyExists = errors.New("group already exists")
+	ErrGroupCycle         = errors.New("group nesting would create a cycle")
+)
+
+// FilterGroup is the ListUsers filter key selecting the direct and indirect
+// members of a group ID. It requires WithGroupResolver.
+const FilterGroup = "group"
+
+// Group is a named set of users, such as a team or department. Groups may
+// contain other groups, whose members then belong to the parent as well.
+type Group struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GroupResolver resolves effective group membership for ListUsers
+type GroupResolver interface {
+	EffectiveMemberIDs(groupID string) ([]uuid.UUID, error)
+}
+
+// GroupManager defines the interface for managing groups and their members
+type GroupManager interface {
+	GroupResolver
+
+	AutoMigrate() error
+
+	CreateGroup(name, description string) (*Group, error)
+	GetGroupByID(id string) (*Group, error)
+	GetGroupByName(name string) (*Group, error)
+	UpdateGroupByID(id string, data map[string]interface{}) error
+	DeleteGroupByID(id string) error
+	ListGroups(limit, offset int) ([]Group, error)
+
+	AddMember(groupID, userID string) error
+	RemoveMember(groupID, userID string) error
+	ListMemberIDs(groupID string) ([]uuid.UUID, error)
+	IsMember(groupID, userID string) (bool, error)
+	ListUserGroups(userID string) ([]Group, error)
+
+	AddSubgroup(parentID, childID string) error
+	RemoveSubgroup(parentID, childID string) error
+	ListSubgroups(groupID string) ([]Group, error)
+}
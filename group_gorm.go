@@ -0,0 +1,371 @@
+package userion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GormGroupModel represents the GORM-specific database model for groups
+type GormGroupModel struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	Name        string    `gorm:"unique;not null"`
+	Description string
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+// ToGroup converts a GormGroupModel to a Group business model
+func (g *GormGroupModel) ToGroup() *Group {
+	return &Group{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+		CreatedAt:   g.CreatedAt,
+	}
+}
+
+// GormGroupMemberModel makes a user a direct member of a group
+type GormGroupMemberModel struct {
+	GroupID   uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// GormSubgroupModel nests a child group in a parent group
+type GormSubgroupModel struct {
+	ParentID  uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	ChildID   uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// GormGroupManager is the GORM implementation of GroupManager
+type GormGroupManager struct {
+	db        *gorm.DB
+	tableName string
+
+	now func() time.Time
+}
+
+// NewGormGroupManager initializes a new GroupManager. The table name is used
+// for groups and as the prefix of the membership tables.
+func NewGormGroupManager(db *gorm.DB, tableName string) GroupManager {
+	return &GormGroupManager{
+		db:        db,
+		tableName: tableName,
+		now:       time.Now,
+	}
+}
+
+// memberTableName returns the name of the table holding direct memberships
+func (m *GormGroupManager) memberTableName() string {
+	return m.tableName + "_members"
+}
+
+// subgroupTableName returns the name of the table holding nested groups
+func (m *GormGroupManager) subgroupTableName() string {
+	return m.tableName + "_subgroups"
+}
+
+// AutoMigrate creates or updates the database schema for groups and memberships
+func (m *GormGroupManager) AutoMigrate() error {
+	if err := m.db.Table(m.tableName).AutoMigrate(&GormGroupModel{}); err != nil {
+		return err
+	}
+	if err := m.db.Table(m.memberTableName()).AutoMigrate(&GormGroupMemberModel{}); err != nil {
+		return err
+	}
+	return m.db.Table(m.subgroupTableName()).AutoMigrate(&GormSubgroupModel{})
+}
+
+// CreateGroup creates a group with a unique name
+func (m *GormGroupManager) CreateGroup(name, description string) (*Group, error) {
+	var count int64
+	if err := m.db.Table(m.tableName).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrGroupAlreadyExists
+	}
+
+	gormGroup := &GormGroupModel{
+		ID:          uuid.New(),
+		Name:        name,
+		Description: description,
+		CreatedAt:   m.now(),
+	}
+	if err := m.db.Table(m.tableName).Create(gormGroup).Error; err != nil {
+		return nil, err
+	}
+
+	return gormGroup.ToGroup(), nil
+}
+
+// getGroup retrieves a group by a column value
+func (m *GormGroupManager) getGroup(column string, value interface{}) (*GormGroupModel, error) {
+	var gormGroup GormGroupModel
+	if err := m.db.Table(m.tableName).Where(column+" = ?", value).First(&gormGroup).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+	return &gormGroup, nil
+}
+
+// GetGroupByID retrieves a group by ID
+func (m *GormGroupManager) GetGroupByID(id string) (*Group, error) {
+	gormGroup, err := m.getGroup("id", id)
+	if err != nil {
+		return nil, err
+	}
+	return gormGroup.ToGroup(), nil
+}
+
+// GetGroupByName retrieves a group by name
+func (m *GormGroupManager) GetGroupByName(name string) (*Group, error) {
+	gormGroup, err := m.getGroup("name", name)
+	if err != nil {
+		return nil, err
+	}
+	return gormGroup.ToGroup(), nil
+}
+
+// UpdateGroupByID updates the name or description of a group
+func (m *GormGroupManager) UpdateGroupByID(id string, data map[string]interface{}) error {
+	if name, ok := data["name"]; ok {
+		var count int64
+		if err := m.db.Table(m.tableName).Where("name = ? AND id <> ?", name, id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrGroupAlreadyExists
+		}
+	}
+
+	result := m.db.Table(m.tableName).Where("id = ?", id).Updates(data)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// DeleteGroupByID removes a group together with its memberships and nesting
+func (m *GormGroupManager) DeleteGroupByID(id string) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Table(m.tableName).Where("id = ?", id).Delete(&GormGroupModel{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrGroupNotFound
+		}
+
+		if err := tx.Table(m.memberTableName()).Where("group_id = ?", id).Delete(&GormGroupMemberModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(m.subgroupTableName()).Where("parent_id = ? OR child_id = ?", id, id).Delete(&GormSubgroupModel{}).Error
+	})
+}
+
+// ListGroups returns groups ordered by name
+func (m *GormGroupManager) ListGroups(limit, offset int) ([]Group, error) {
+	var gormGroups []GormGroupModel
+	if err := m.db.Table(m.tableName).Order("name").Limit(limit).Offset(offset).Find(&gormGroups).Error; err != nil {
+		return nil, err
+	}
+	return toGroups(gormGroups), nil
+}
+
+// AddMember makes a user a direct member of a group. Adding twice is not an error.
+func (m *GormGroupManager) AddMember(groupID, userID string) error {
+	gormGroup, err := m.getGroup("id", groupID)
+	if err != nil {
+		return err
+	}
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	var count int64
+	if err := m.db.Table(m.memberTableName()).Where("group_id = ? AND user_id = ?", gormGroup.ID, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	member := &GormGroupMemberModel{GroupID: gormGroup.ID, UserID: id, CreatedAt: m.now()}
+	return m.db.Table(m.memberTableName()).Create(member).Error
+}
+
+// RemoveMember removes a direct member from a group
+func (m *GormGroupManager) RemoveMember(groupID, userID string) error {
+	return m.db.Table(m.memberTableName()).Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&GormGroupMemberModel{}).Error
+}
+
+// ListMemberIDs returns the IDs of the direct members of a group
+func (m *GormGroupManager) ListMemberIDs(groupID string) ([]uuid.UUID, error) {
+	if _, err := m.getGroup("id", groupID); err != nil {
+		return nil, err
+	}
+
+	ids := []uuid.UUID{}
+	err := m.db.Table(m.memberTableName()).Where("group_id = ?", groupID).Order("created_at").Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// EffectiveMemberIDs returns the IDs of the members of a group and of all
+// groups nested in it, implementing GroupResolver
+func (m *GormGroupManager) EffectiveMemberIDs(groupID string) ([]uuid.UUID, error) {
+	gormGroup, err := m.getGroup("id", groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	groupIDs, err := m.walk([]uuid.UUID{gormGroup.ID}, "parent_id", "child_id")
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []uuid.UUID{}
+	err = m.db.Table(m.memberTableName()).Distinct("user_id").Where("group_id IN ?", groupIDs).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// IsMember reports whether a user belongs to a group directly or through a nested group
+func (m *GormGroupManager) IsMember(groupID, userID string) (bool, error) {
+	groups, err := m.ListUserGroups(userID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, group := range groups {
+		if group.ID.String() == groupID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListUserGroups returns the groups a user belongs to directly or through
+// nested groups, ordered by name
+func (m *GormGroupManager) ListUserGroups(userID string) ([]Group, error) {
+	var direct []uuid.UUID
+	if err := m.db.Table(m.memberTableName()).Where("user_id = ?", userID).Pluck("group_id", &direct).Error; err != nil {
+		return nil, err
+	}
+
+	groupIDs, err := m.walk(direct, "child_id", "parent_id")
+	if err != nil {
+		return nil, err
+	}
+
+	var gormGroups []GormGroupModel
+	if len(groupIDs) > 0 {
+		if err := m.db.Table(m.tableName).Where("id IN ?", groupIDs).Order("name").Find(&gormGroups).Error; err != nil {
+			return nil, err
+		}
+	}
+	return toGroups(gormGroups), nil
+}
+
+// AddSubgroup nests a child group in a parent group
+func (m *GormGroupManager) AddSubgroup(parentID, childID string) error {
+	parent, err := m.getGroup("id", parentID)
+	if err != nil {
+		return err
+	}
+	child, err := m.getGroup("id", childID)
+	if err != nil {
+		return err
+	}
+
+	// The new link closes a cycle if the parent is already nested in the child
+	descendants, err := m.walk([]uuid.UUID{child.ID}, "parent_id", "child_id")
+	if err != nil {
+		return err
+	}
+	for _, id := range descendants {
+		if id == parent.ID {
+			return ErrGroupCycle
+		}
+	}
+
+	var count int64
+	if err := m.db.Table(m.subgroupTableName()).Where("parent_id = ? AND child_id = ?", parent.ID, child.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	link := &GormSubgroupModel{ParentID: parent.ID, ChildID: child.ID, CreatedAt: m.now()}
+	return m.db.Table(m.subgroupTableName()).Create(link).Error
+}
+
+// RemoveSubgroup removes a child group from a parent group
+func (m *GormGroupManager) RemoveSubgroup(parentID, childID string) error {
+	return m.db.Table(m.subgroupTableName()).Where("parent_id = ? AND child_id = ?", parentID, childID).Delete(&GormSubgroupModel{}).Error
+}
+
+// ListSubgroups returns the groups directly nested in a group
+func (m *GormGroupManager) ListSubgroups(groupID string) ([]Group, error) {
+	var gormGroups []GormGroupModel
+	err := m.db.Table(m.tableName).
+		Where("id IN (?)", m.db.Table(m.subgroupTableName()).Select("child_id").Where("parent_id = ?", groupID)).
+		Order("name").
+		Find(&gormGroups).Error
+	if err != nil {
+		return nil, err
+	}
+	return toGroups(gormGroups), nil
+}
+
+// walk follows nesting links from the start groups, from column to column,
+// and returns the start groups together with every group reached
+func (m *GormGroupManager) walk(start []uuid.UUID, from, to string) ([]uuid.UUID, error) {
+	seen := make(map[uuid.UUID]struct{}, len(start))
+	result := make([]uuid.UUID, 0, len(start))
+	frontier := make([]uuid.UUID, 0, len(start))
+	for _, id := range start {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			result = append(result, id)
+			frontier = append(frontier, id)
+		}
+	}
+
+	// Follow one level of nesting per query
+	for len(frontier) > 0 {
+		var next []uuid.UUID
+		if err := m.db.Table(m.subgroupTableName()).Where(from+" IN ?", frontier).Pluck(to, &next).Error; err != nil {
+			return nil, err
+		}
+
+		frontier = frontier[:0]
+		for _, id := range next {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				result = append(result, id)
+				frontier = append(frontier, id)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// toGroups converts GORM models to Group business models
+func toGroups(gormGroups []GormGroupModel) []Group {
+	groups := make([]Group, len(gormGroups))
+	for i := range gormGroups {
+		groups[i] = *gormGroups[i].ToGroup()
+	}
+	return groups
+}
@@ -0,0 +1,198 @@
+package userion
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupGroupManagerGorm creates a GroupManager registered as the group resolver of a UserManager
+func setupGroupManagerGorm(t *testing.T) (*GormGroupManager, UserManager, *gorm.DB) {
+	userManager, db := setupTestDBGorm(t)
+
+	tableName := "groups_test_" + uuid.New().String()[:8]
+	groupManager := NewGormGroupManager(db, tableName).(*GormGroupManager)
+	err := groupManager.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	userManager.(*GormUserManager).groupResolver = groupManager
+
+	return groupManager, userManager, db
+}
+
+// createGroupTestUsers creates n users with distinct usernames, emails and phones
+func createGroupTestUsers(t *testing.T, userManager UserManager, n int) []*User {
+	users := make([]*User, n)
+	for i := range users {
+		users[i] = &User{
+			Name:     fmt.Sprintf("Group User %d", i),
+			Username: fmt.Sprintf("groupuser%d", i),
+			Email:    fmt.Sprintf("groupuser%d@example.com", i),
+			Password: "password123",
+			Phone:    fmt.Sprintf("555000%d", i),
+			Enabled:  true,
+			Status:   UserStatusActive,
+		}
+		require.NoError(t, userManager.CreateUser(users[i]))
+	}
+	return users
+}
+
+// TestGroupCRUD_Gorm tests creating, reading, updating and deleting groups
+func TestGroupCRUD_Gorm(t *testing.T) {
+	groupManager, _, _ := setupGroupManagerGorm(t)
+
+	group, err := groupManager.CreateGroup("engineering", "All engineers")
+	assert.NoError(t, err, "CreateGroup should not error with a new name")
+	_, err = groupManager.CreateGroup("engineering", "")
+	assert.Equal(t, ErrGroupAlreadyExists, err)
+
+	found, err := groupManager.GetGroupByID(group.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, "All engineers", found.Description)
+	found, err = groupManager.GetGroupByName("engineering")
+	assert.NoError(t, err)
+	assert.Equal(t, group.ID, found.ID)
+
+	_, err = groupManager.CreateGroup("sales", "")
+	require.NoError(t, err)
+	assert.Equal(t, ErrGroupAlreadyExists, groupManager.UpdateGroupByID(group.ID.String(), map[string]interface{}{"name": "sales"}))
+	assert.NoError(t, groupManager.UpdateGroupByID(group.ID.String(), map[string]interface{}{"name": "r-and-d"}))
+	found, err = groupManager.GetGroupByID(group.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "r-and-d", found.Name)
+
+	groups, err := groupManager.ListGroups(10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 2)
+
+	assert.NoError(t, groupManager.DeleteGroupByID(group.ID.String()))
+	assert.Equal(t, ErrGroupNotFound, groupManager.DeleteGroupByID(group.ID.String()))
+	_, err = groupManager.GetGroupByID(group.ID.String())
+	assert.Equal(t, ErrGroupNotFound, err)
+	assert.Equal(t, ErrGroupNotFound, groupManager.UpdateGroupByID(group.ID.String(), map[string]interface{}{"description": "x"}))
+}
+
+// TestGroupMembership_Gorm tests direct and nested membership
+func TestGroupMembership_Gorm(t *testing.T) {
+	groupManager, userManager, _ := setupGroupManagerGorm(t)
+	users := createGroupTestUsers(t, userManager, 3)
+
+	company, err := groupManager.CreateGroup("company", "")
+	require.NoError(t, err)
+	engineering, err := groupManager.CreateGroup("engineering", "")
+	require.NoError(t, err)
+	backend, err := groupManager.CreateGroup("backend", "")
+	require.NoError(t, err)
+
+	require.NoError(t, groupManager.AddSubgroup(company.ID.String(), engineering.ID.String()))
+	require.NoError(t, groupManager.AddSubgroup(engineering.ID.String(), backend.ID.String()))
+
+	require.NoError(t, groupManager.AddMember(backend.ID.String(), users[0].ID.String()))
+	require.NoError(t, groupManager.AddMember(backend.ID.String(), users[0].ID.String()), "Adding twice should not error")
+	require.NoError(t, groupManager.AddMember(engineering.ID.String(), users[1].ID.String()))
+	require.NoError(t, groupManager.AddMember(company.ID.String(), users[2].ID.String()))
+
+	direct, err := groupManager.ListMemberIDs(engineering.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{users[1].ID}, direct)
+
+	effective, err := groupManager.EffectiveMemberIDs(company.ID.String())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []uuid.UUID{users[0].ID, users[1].ID, users[2].ID}, effective, "Members of nested groups should be included")
+
+	effective, err = groupManager.EffectiveMemberIDs(engineering.ID.String())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []uuid.UUID{users[0].ID, users[1].ID}, effective)
+
+	isMember, err := groupManager.IsMember(company.ID.String(), users[0].ID.String())
+	assert.NoError(t, err)
+	assert.True(t, isMember, "Membership should be transitive")
+	isMember, err = groupManager.IsMember(backend.ID.String(), users[1].ID.String())
+	assert.NoError(t, err)
+	assert.False(t, isMember, "Membership should not flow into nested groups")
+
+	groups, err := groupManager.ListUserGroups(users[0].ID.String())
+	assert.NoError(t, err)
+	require.Len(t, groups, 3)
+	assert.Equal(t, "backend", groups[0].Name)
+
+	subgroups, err := groupManager.ListSubgroups(company.ID.String())
+	assert.NoError(t, err)
+	require.Len(t, subgroups, 1)
+	assert.Equal(t, engineering.ID, subgroups[0].ID)
+
+	// Removing links and members
+	require.NoError(t, groupManager.RemoveSubgroup(engineering.ID.String(), backend.ID.String()))
+	isMember, err = groupManager.IsMember(company.ID.String(), users[0].ID.String())
+	assert.NoError(t, err)
+	assert.False(t, isMember, "Removing a subgroup should end indirect membership")
+
+	require.NoError(t, groupManager.RemoveMember(company.ID.String(), users[2].ID.String()))
+	effective, err = groupManager.EffectiveMemberIDs(company.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{users[1].ID}, effective)
+}
+
+// TestGroupCycles_Gorm tests cycle detection for nested groups
+func TestGroupCycles_Gorm(t *testing.T) {
+	groupManager, _, _ := setupGroupManagerGorm(t)
+
+	a, err := groupManager.CreateGroup("a", "")
+	require.NoError(t, err)
+	b, err := groupManager.CreateGroup("b", "")
+	require.NoError(t, err)
+	c, err := groupManager.CreateGroup("c", "")
+	require.NoError(t, err)
+
+	require.NoError(t, groupManager.AddSubgroup(a.ID.String(), b.ID.String()))
+	require.NoError(t, groupManager.AddSubgroup(b.ID.String(), c.ID.String()))
+
+	assert.Equal(t, ErrGroupCycle, groupManager.AddSubgroup(c.ID.String(), a.ID.String()), "Indirect cycles should be rejected")
+	assert.Equal(t, ErrGroupCycle, groupManager.AddSubgroup(a.ID.String(), a.ID.String()), "Self nesting should be rejected")
+	assert.NoError(t, groupManager.AddSubgroup(a.ID.String(), c.ID.String()), "Diamonds are not cycles")
+}
+
+// TestListUsersByGroup_Gorm tests the FilterGroup filter of ListUsers
+func TestListUsersByGroup_Gorm(t *testing.T) {
+	groupManager, userManager, _ := setupGroupManagerGorm(t)
+	users := createGroupTestUsers(t, userManager, 3)
+
+	parent, err := groupManager.CreateGroup("parent", "")
+	require.NoError(t, err)
+	child, err := groupManager.CreateGroup("child", "")
+	require.NoError(t, err)
+	empty, err := groupManager.CreateGroup("empty", "")
+	require.NoError(t, err)
+	require.NoError(t, groupManager.AddSubgroup(parent.ID.String(), child.ID.String()))
+	require.NoError(t, groupManager.AddMember(parent.ID.String(), users[0].ID.String()))
+	require.NoError(t, groupManager.AddMember(child.ID.String(), users[1].ID.String()))
+
+	listed, err := userManager.ListUsers(10, 0, map[string]interface{}{FilterGroup: parent.ID.String()}, "username", false)
+	assert.NoError(t, err, "ListUsers should support the group filter")
+	require.Len(t, listed, 2, "Direct and nested members should be listed")
+	assert.Equal(t, users[0].ID, listed[0].ID)
+	assert.Equal(t, users[1].ID, listed[1].ID)
+
+	// Combined with other filters
+	listed, err = userManager.ListUsers(10, 0, map[string]interface{}{FilterGroup: parent.ID, "username": users[1].Username}, "", false)
+	assert.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, users[1].ID, listed[0].ID)
+
+	listed, err = userManager.ListUsers(10, 0, map[string]interface{}{FilterGroup: empty.ID.String()}, "", false)
+	assert.NoError(t, err)
+	assert.Empty(t, listed, "Empty groups should list no users")
+
+	_, err = userManager.ListUsers(10, 0, map[string]interface{}{FilterGroup: uuid.New().String()}, "", false)
+	assert.Equal(t, ErrGroupNotFound, err)
+
+	// Without a resolver the filter cannot be used
+	userManager.(*GormUserManager).groupResolver = nil
+	_, err = userManager.ListUsers(10, 0, map[string]interface{}{FilterGroup: parent.ID.String()}, "", false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,293 @@
+package grpcapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/weedbox/userion"
+	"google.golang.org/grpc"
+)
+
+// Client is a UserManager backed by a remote userion gRPC service. Errors
+// of the service are returned as the userion errors they stand for, so
+// errors.Is(err, userion.ErrUserNotFound) works as with a local manager.
+//
+// Users returned by the client carry no password hash or salt.
+type Client struct {
+	client  UserManagerClient
+	timeout time.Duration
+}
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// WithTimeout bounds the duration of every call. By default calls are only
+// bounded by the connection's own settings.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// NewClient returns a UserManager calling the service over conn. Credentials
+// are attached with the connection's dial options, e.g.
+// grpc.WithPerRPCCredentials.
+func NewClient(conn grpc.ClientConnInterface, opts ...ClientOption) *Client {
+	c := &Client{client: NewUserManagerClient(conn)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+var _ userion.UserManager = (*Client)(nil)
+
+// context returns the context of a call
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(context.Background(), c.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// AutoMigrate does nothing; the service migrates its own database
+func (c *Client) AutoMigrate() error {
+	return nil
+}
+
+// CreateUser creates a user and fills in the ID, status and other fields
+// the service assigned
+func (c *Client) CreateUser(user *userion.User) error {
+	p, err := userToProto(user, true)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.CreateUser(ctx, &CreateUserRequest{User: p})
+	if err != nil {
+		return fromStatus(err)
+	}
+	created, err := userFromProto(resp.GetUser())
+	if err != nil {
+		return err
+	}
+
+	// The caller keeps the password it set rather than learning the hash
+	created.Password, created.Salt = user.Password, user.Salt
+	*user = *created
+	return nil
+}
+
+// getUser returns the user named by ref
+func (c *Client) getUser(ref *UserRef) (*userion.User, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.GetUser(ctx, &GetUserRequest{User: ref})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return userFromProto(resp.GetUser())
+}
+
+// GetUserByID retrieves a user by ID
+func (c *Client) GetUserByID(id string) (*userion.User, error) {
+	return c.getUser(&UserRef{Selector: &UserRef_Id{Id: id}})
+}
+
+// GetUserByUsername retrieves a user by username
+func (c *Client) GetUserByUsername(username string) (*userion.User, error) {
+	return c.getUser(&UserRef{Selector: &UserRef_Username{Username: username}})
+}
+
+// GetUserByEmail retrieves a user by email
+func (c *Client) GetUserByEmail(email string) (*userion.User, error) {
+	return c.getUser(&UserRef{Selector: &UserRef_Email{Email: email}})
+}
+
+// updateUser updates fields of the user named by ref
+func (c *Client) updateUser(ref *UserRef, updatedData map[string]interface{}) error {
+	values, err := valuesToProto(updatedData)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err = c.client.UpdateUser(ctx, &UpdateUserRequest{User: ref, UpdatedData: values})
+	return fromStatus(err)
+}
+
+// UpdateUserByID updates user fields by ID
+func (c *Client) UpdateUserByID(id string, updatedData map[string]interface{}) error {
+	return c.updateUser(&UserRef{Selector: &UserRef_Id{Id: id}}, updatedData)
+}
+
+// UpdateUserByUsername updates user fields by username
+func (c *Client) UpdateUserByUsername(username string, updatedData map[string]interface{}) error {
+	return c.updateUser(&UserRef{Selector: &UserRef_Username{Username: username}}, updatedData)
+}
+
+// UpdateUserByEmail updates user fields by email
+func (c *Client) UpdateUserByEmail(email string, updatedData map[string]interface{}) error {
+	return c.updateUser(&UserRef{Selector: &UserRef_Email{Email: email}}, updatedData)
+}
+
+// deleteUser deletes the user named by ref
+func (c *Client) deleteUser(ref *UserRef) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.client.DeleteUser(ctx, &DeleteUserRequest{User: ref})
+	return fromStatus(err)
+}
+
+// DeleteUserByID deletes a user by ID
+func (c *Client) DeleteUserByID(id string) error {
+	return c.deleteUser(&UserRef{Selector: &UserRef_Id{Id: id}})
+}
+
+// DeleteUserByUsername deletes a user by username
+func (c *Client) DeleteUserByUsername(username string) error {
+	return c.deleteUser(&UserRef{Selector: &UserRef_Username{Username: username}})
+}
+
+// DeleteUserByEmail deletes a user by email
+func (c *Client) DeleteUserByEmail(email string) error {
+	return c.deleteUser(&UserRef{Selector: &UserRef_Email{Email: email}})
+}
+
+// verifyPassword verifies the password of the user named by ref
+func (c *Client) verifyPassword(ref *UserRef, password string) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.client.VerifyPassword(ctx, &VerifyPasswordRequest{User: ref, Password: password})
+	return fromStatus(err)
+}
+
+// VerifyPasswordByUsername verifies the password of a user by username
+func (c *Client) VerifyPasswordByUsername(username, password string) error {
+	return c.verifyPassword(&UserRef{Selector: &UserRef_Username{Username: username}}, password)
+}
+
+// VerifyPasswordByEmail verifies the password of a user by email
+func (c *Client) VerifyPasswordByEmail(email, password string) error {
+	return c.verifyPassword(&UserRef{Selector: &UserRef_Email{Email: email}}, password)
+}
+
+// VerifyPasswordByID verifies the password of a user by ID
+func (c *Client) VerifyPasswordByID(id string, password string) error {
+	return c.verifyPassword(&UserRef{Selector: &UserRef_Id{Id: id}}, password)
+}
+
+// ListUsers retrieves a list of users. The service only accepts filters on
+// username, email, phone, name, status, enabled, tenant_id and
+// userion.FilterGroup, and ordering by created_at, username, email, name or
+// status.
+func (c *Client) ListUsers(limit, offset int, filters map[string]interface{}, orderBy string, desc bool) ([]userion.User, error) {
+	values, err := valuesToProto(filters)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.ListUsers(ctx, &ListUsersRequest{
+		Limit:   int32(limit),
+		Offset:  int32(offset),
+		Filters: values,
+		OrderBy: orderBy,
+		Desc:    desc,
+	})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+
+	users := make([]userion.User, 0, len(resp.GetUsers()))
+	for _, p := range resp.GetUsers() {
+		user, err := userFromProto(p)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, nil
+}
+
+// EnableUserByID enables a user by ID
+func (c *Client) EnableUserByID(id string) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.client.EnableUser(ctx, &EnableUserRequest{Id: id})
+	return fromStatus(err)
+}
+
+// DisableUserByID disables a user by ID
+func (c *Client) DisableUserByID(id string) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.client.DisableUser(ctx, &DisableUserRequest{Id: id})
+	return fromStatus(err)
+}
+
+// setUserStatus sets the status of the user named by ref
+func (c *Client) setUserStatus(ref *UserRef, userStatus userion.UserStatus) error {
+	p := statusToProto(userStatus)
+	if p == UserStatus_USER_STATUS_UNSPECIFIED {
+		return invalidArgument("unknown status %q", userStatus)
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.client.SetUserStatus(ctx, &SetUserStatusRequest{User: ref, Status: p})
+	return fromStatus(err)
+}
+
+// SetUserStatusByID updates the user status by ID
+func (c *Client) SetUserStatusByID(id string, userStatus userion.UserStatus) error {
+	return c.setUserStatus(&UserRef{Selector: &UserRef_Id{Id: id}}, userStatus)
+}
+
+// SetUserStatusByUsername updates the user status by username
+func (c *Client) SetUserStatusByUsername(username string, userStatus userion.UserStatus) error {
+	return c.setUserStatus(&UserRef{Selector: &UserRef_Username{Username: username}}, userStatus)
+}
+
+// SetUserStatusByEmail updates the user status by email
+func (c *Client) SetUserStatusByEmail(email string, userStatus userion.UserStatus) error {
+	return c.setUserStatus(&UserRef{Selector: &UserRef_Email{Email: email}}, userStatus)
+}
+
+// IssueEmailVerification issues a token confirming the email of a user
+func (c *Client) IssueEmailVerification(userID string) (string, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.IssueEmailVerification(ctx, &IssueEmailVerificationRequest{UserId: userID})
+	if err != nil {
+		return "", fromStatus(err)
+	}
+	return resp.GetToken(), nil
+}
+
+// ConfirmEmail confirms an email with a verification token
+func (c *Client) ConfirmEmail(token string) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.client.ConfirmEmail(ctx, &ConfirmEmailRequest{Token: token})
+	return fromStatus(err)
+}
+
+// RequestPasswordReset issues a password reset token
+func (c *Client) RequestPasswordReset(email string) (string, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.RequestPasswordReset(ctx, &RequestPasswordResetRequest{Email: email})
+	if err != nil {
+		return "", fromStatus(err)
+	}
+	return resp.GetToken(), nil
+}
+
+// ResetPassword sets a new password with a reset token
+func (c *Client) ResetPassword(token, newPassword string) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.client.ResetPassword(ctx, &ResetPasswordRequest{Token: token, NewPassword: newPassword})
+	return fromStatus(err)
+}
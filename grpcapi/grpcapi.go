@@ -0,0 +1,294 @@
+// Package grpcapi serves a UserManager over gRPC and provides a client that
+// implements UserManager on top of it, so services written in any language
+// can manage users. The service is defined in user_manager.proto.
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative user_manager.proto
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weedbox/userion"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ErrorDomain is the domain of the google.rpc.ErrorInfo detail attached to
+// errors of the userion service
+const ErrorDomain = "userion"
+
+// errorCodes maps userion errors to gRPC status codes and ErrorInfo
+// reasons, which the client maps back to the same errors
+var errorCodes = []struct {
+	err    error
+	code   codes.Code
+	reason string
+}{
+	{userion.ErrUserNotFound, codes.NotFound, "USER_NOT_FOUND"},
+	{userion.ErrUserAlreadyExists, codes.AlreadyExists, "USER_ALREADY_EXISTS"},
+	{userion.ErrInvalidPassword, codes.Unauthenticated, "INVALID_PASSWORD"},
+	{userion.ErrInvalidToken, codes.Unauthenticated, "INVALID_TOKEN"},
+	{userion.ErrTokenExpired, codes.Unauthenticated, "TOKEN_EXPIRED"},
+	{userion.ErrUserDisabled, codes.PermissionDenied, "USER_DISABLED"},
+	{userion.ErrUserNotActive, codes.PermissionDenied, "USER_NOT_ACTIVE"},
+	{userion.ErrCrossTenantAccess, codes.PermissionDenied, "CROSS_TENANT_ACCESS"},
+	{userion.ErrWeakPassword, codes.InvalidArgument, "WEAK_PASSWORD"},
+	{userion.ErrPasswordExpired, codes.FailedPrecondition, "PASSWORD_EXPIRED"},
+	{userion.ErrPasswordChangeRequired, codes.FailedPrecondition, "PASSWORD_CHANGE_REQUIRED"},
+	{userion.ErrMFARequired, codes.FailedPrecondition, "MFA_REQUIRED"},
+}
+
+// toStatus converts an error of the UserManager to a gRPC status error.
+// Unexpected errors are not disclosed.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	for _, mapping := range errorCodes {
+		if errors.Is(err, mapping.err) {
+			st, detailErr := status.New(mapping.code, mapping.err.Error()).WithDetails(&errdetails.ErrorInfo{
+				Reason: mapping.reason,
+				Domain: ErrorDomain,
+			})
+			if detailErr != nil {
+				return status.Error(mapping.code, mapping.err.Error())
+			}
+			return st.Err()
+		}
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+// fromStatus converts a gRPC status error back to the userion error it was
+// created from. Other errors are returned unchanged.
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || err == nil {
+		return err
+	}
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.Domain != ErrorDomain {
+			continue
+		}
+		for _, mapping := range errorCodes {
+			if info.Reason == mapping.reason {
+				return mapping.err
+			}
+		}
+	}
+	// Servers that do not attach details still use the documented codes
+	switch st.Code() {
+	case codes.NotFound:
+		return userion.ErrUserNotFound
+	case codes.AlreadyExists:
+		return userion.ErrUserAlreadyExists
+	}
+	return err
+}
+
+// invalidArgument returns an InvalidArgument status error
+func invalidArgument(format string, args ...interface{}) error {
+	return status.Errorf(codes.InvalidArgument, format, args...)
+}
+
+// statusToProto converts a user status; unknown statuses are unspecified
+func statusToProto(s userion.UserStatus) UserStatus {
+	switch s {
+	case userion.UserStatusActive:
+		return UserStatus_USER_STATUS_ACTIVE
+	case userion.UserStatusSuspended:
+		return UserStatus_USER_STATUS_SUSPENDED
+	case userion.UserStatusLocked:
+		return UserStatus_USER_STATUS_LOCKED
+	case userion.UserStatusInactive:
+		return UserStatus_USER_STATUS_INACTIVE
+	}
+	return UserStatus_USER_STATUS_UNSPECIFIED
+}
+
+// statusFromProto converts a user status; unspecified is returned as ""
+func statusFromProto(s UserStatus) userion.UserStatus {
+	switch s {
+	case UserStatus_USER_STATUS_ACTIVE:
+		return userion.UserStatusActive
+	case UserStatus_USER_STATUS_SUSPENDED:
+		return userion.UserStatusSuspended
+	case UserStatus_USER_STATUS_LOCKED:
+		return userion.UserStatusLocked
+	case UserStatus_USER_STATUS_INACTIVE:
+		return userion.UserStatusInactive
+	}
+	return ""
+}
+
+// userToProto converts a user. The password and salt are only included
+// for users about to be created.
+func userToProto(user *userion.User, secrets bool) (*User, error) {
+	p := &User{
+		TenantId:           user.TenantID,
+		Name:               user.Name,
+		Username:           user.Username,
+		Email:              user.Email,
+		Phone:              user.Phone,
+		Enabled:            user.Enabled,
+		Status:             statusToProto(user.Status),
+		EmailVerifiedAt:    timestampToProto(user.EmailVerifiedAt),
+		PhoneVerifiedAt:    timestampToProto(user.PhoneVerifiedAt),
+		PasswordChangedAt:  timestampToProto(user.PasswordChangedAt),
+		MustChangePassword: user.MustChangePassword,
+	}
+	if user.ID != uuid.Nil {
+		p.Id = user.ID.String()
+	}
+	if !user.CreatedAt.IsZero() {
+		p.CreatedAt = timestamppb.New(user.CreatedAt)
+	}
+	if secrets {
+		p.Password = user.Password
+		p.Salt = user.Salt
+	}
+	if user.Data != nil {
+		data, err := structpb.NewStruct(user.Data)
+		if err != nil {
+			return nil, err
+		}
+		p.Data = data
+	}
+	return p, nil
+}
+
+// userFromProto converts a user
+func userFromProto(p *User) (*userion.User, error) {
+	if p == nil {
+		return nil, invalidArgument("user is required")
+	}
+	user := &userion.User{
+		TenantID:           p.TenantId,
+		Name:               p.Name,
+		Username:           p.Username,
+		Email:              p.Email,
+		Password:           p.Password,
+		Salt:               p.Salt,
+		Phone:              p.Phone,
+		Enabled:            p.Enabled,
+		Status:             statusFromProto(p.Status),
+		EmailVerifiedAt:    timestampFromProto(p.EmailVerifiedAt),
+		PhoneVerifiedAt:    timestampFromProto(p.PhoneVerifiedAt),
+		PasswordChangedAt:  timestampFromProto(p.PasswordChangedAt),
+		MustChangePassword: p.MustChangePassword,
+	}
+	if p.Id != "" {
+		id, err := uuid.Parse(p.Id)
+		if err != nil {
+			return nil, invalidArgument("invalid user ID %q", p.Id)
+		}
+		user.ID = id
+	}
+	if p.CreatedAt != nil {
+		user.CreatedAt = p.CreatedAt.AsTime()
+	}
+	if p.Data != nil {
+		user.Data = p.Data.AsMap()
+	}
+	return user, nil
+}
+
+// timestampToProto converts an optional time
+func timestampToProto(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// timestampFromProto converts an optional timestamp
+func timestampFromProto(t *timestamppb.Timestamp) *time.Time {
+	if t == nil {
+		return nil
+	}
+	value := t.AsTime()
+	return &value
+}
+
+// valueToProto converts a field value of an update or filter
+func valueToProto(v interface{}) (*Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return &Value{Kind: &Value_NullValue{}}, nil
+	case string:
+		return &Value{Kind: &Value_StringValue{StringValue: v}}, nil
+	case userion.UserStatus:
+		return &Value{Kind: &Value_StringValue{StringValue: string(v)}}, nil
+	case bool:
+		return &Value{Kind: &Value_BoolValue{BoolValue: v}}, nil
+	case int:
+		return &Value{Kind: &Value_IntValue{IntValue: int64(v)}}, nil
+	case int32:
+		return &Value{Kind: &Value_IntValue{IntValue: int64(v)}}, nil
+	case int64:
+		return &Value{Kind: &Value_IntValue{IntValue: v}}, nil
+	case float64:
+		return &Value{Kind: &Value_DoubleValue{DoubleValue: v}}, nil
+	case time.Time:
+		return &Value{Kind: &Value_TimestampValue{TimestampValue: timestamppb.New(v)}}, nil
+	case *time.Time:
+		if v == nil {
+			return &Value{Kind: &Value_NullValue{}}, nil
+		}
+		return &Value{Kind: &Value_TimestampValue{TimestampValue: timestamppb.New(*v)}}, nil
+	case uuid.UUID:
+		return &Value{Kind: &Value_StringValue{StringValue: v.String()}}, nil
+	case map[string]interface{}:
+		s, err := structpb.NewStruct(v)
+		if err != nil {
+			return nil, err
+		}
+		return &Value{Kind: &Value_StructValue{StructValue: s}}, nil
+	}
+	return nil, fmt.Errorf("grpcapi: unsupported value of type %T", v)
+}
+
+// valueFromProto converts a field value of an update or filter
+func valueFromProto(v *Value) interface{} {
+	switch kind := v.GetKind().(type) {
+	case *Value_StringValue:
+		return kind.StringValue
+	case *Value_BoolValue:
+		return kind.BoolValue
+	case *Value_IntValue:
+		return kind.IntValue
+	case *Value_DoubleValue:
+		return kind.DoubleValue
+	case *Value_TimestampValue:
+		return kind.TimestampValue.AsTime()
+	case *Value_StructValue:
+		return kind.StructValue.AsMap()
+	}
+	return nil
+}
+
+// valuesToProto converts the values of an update or filter map
+func valuesToProto(values map[string]interface{}) (map[string]*Value, error) {
+	if values == nil {
+		return nil, nil
+	}
+	result := make(map[string]*Value, len(values))
+	for key, v := range values {
+		value, err := valueToProto(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
@@ -0,0 +1,286 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/weedbox/userion"
+)
+
+// updatableFields are the keys UpdateUser accepts. Only field names are
+// accepted, since the UserManager hashes "Password" and encodes "Data" by
+// field name. Identifiers, salts and timestamps maintained by the
+// UserManager cannot be set remotely.
+var updatableFields = map[string]bool{
+	"Name": true, "Username": true, "Email": true, "Phone": true,
+	"Password": true, "Data": true, "Enabled": true, "Status": true,
+	"TenantID": true, "EmailVerifiedAt": true, "PhoneVerifiedAt": true,
+	"MustChangePassword": true,
+}
+
+// filterColumns are the columns ListUsers may filter by
+var filterColumns = map[string]bool{
+	"username": true, "email": true, "phone": true, "name": true,
+	"status": true, "enabled": true, "tenant_id": true,
+	userion.FilterGroup: true,
+}
+
+// orderColumns are the columns ListUsers may order by
+var orderColumns = map[string]bool{
+	"": true, "created_at": true, "username": true, "email": true, "name": true, "status": true,
+}
+
+// Server serves a UserManager over gRPC. Authenticate callers with an
+// interceptor, as every operation of the UserManager is available.
+type Server struct {
+	UnimplementedUserManagerServer
+
+	userManager userion.UserManager
+}
+
+// NewServer returns the gRPC service of a UserManager. Register it with
+// RegisterUserManagerServer.
+func NewServer(userManager userion.UserManager) *Server {
+	return &Server{userManager: userManager}
+}
+
+// CreateUser creates a user
+func (s *Server) CreateUser(ctx context.Context, req *CreateUserRequest) (*CreateUserResponse, error) {
+	user, err := userFromProto(req.GetUser())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userManager.CreateUser(user); err != nil {
+		return nil, toStatus(err)
+	}
+	created, err := s.userManager.GetUserByID(user.ID.String())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	p, err := userToProto(created, false)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &CreateUserResponse{User: p}, nil
+}
+
+// getUser returns the user named by ref
+func (s *Server) getUser(ref *UserRef) (*userion.User, error) {
+	var user *userion.User
+	var err error
+	switch selector := ref.GetSelector().(type) {
+	case *UserRef_Id:
+		user, err = s.userManager.GetUserByID(selector.Id)
+	case *UserRef_Username:
+		user, err = s.userManager.GetUserByUsername(selector.Username)
+	case *UserRef_Email:
+		user, err = s.userManager.GetUserByEmail(selector.Email)
+	default:
+		return nil, invalidArgument("user is required")
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return user, nil
+}
+
+// GetUser returns a user
+func (s *Server) GetUser(ctx context.Context, req *GetUserRequest) (*GetUserResponse, error) {
+	user, err := s.getUser(req.GetUser())
+	if err != nil {
+		return nil, err
+	}
+	p, err := userToProto(user, false)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &GetUserResponse{User: p}, nil
+}
+
+// UpdateUser updates fields of a user. "Enabled" goes through
+// EnableUserByID and DisableUserByID, so the manager reports the change.
+func (s *Server) UpdateUser(ctx context.Context, req *UpdateUserRequest) (*UpdateUserResponse, error) {
+	if len(req.GetUpdatedData()) == 0 {
+		return nil, invalidArgument("updated_data is required")
+	}
+	updatedData := make(map[string]interface{}, len(req.GetUpdatedData()))
+	for key, value := range req.GetUpdatedData() {
+		if !updatableFields[key] {
+			return nil, invalidArgument("field %q cannot be updated", key)
+		}
+		updatedData[key] = valueFromProto(value)
+	}
+	var enabled *bool
+	if value, ok := updatedData["Enabled"]; ok {
+		b, ok := value.(bool)
+		if !ok {
+			return nil, invalidArgument("Enabled must be a boolean")
+		}
+		enabled = &b
+		delete(updatedData, "Enabled")
+	}
+
+	user, err := s.getUser(req.GetUser())
+	if err != nil {
+		return nil, err
+	}
+	id := user.ID.String()
+	if len(updatedData) > 0 {
+		if err := s.userManager.UpdateUserByID(id, updatedData); err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	if enabled != nil && *enabled != user.Enabled {
+		if *enabled {
+			err = s.userManager.EnableUserByID(id)
+		} else {
+			err = s.userManager.DisableUserByID(id)
+		}
+		if err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	return &UpdateUserResponse{}, nil
+}
+
+// DeleteUser deletes a user
+func (s *Server) DeleteUser(ctx context.Context, req *DeleteUserRequest) (*DeleteUserResponse, error) {
+	var err error
+	switch selector := req.GetUser().GetSelector().(type) {
+	case *UserRef_Id:
+		err = s.userManager.DeleteUserByID(selector.Id)
+	case *UserRef_Username:
+		err = s.userManager.DeleteUserByUsername(selector.Username)
+	case *UserRef_Email:
+		err = s.userManager.DeleteUserByEmail(selector.Email)
+	default:
+		return nil, invalidArgument("user is required")
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &DeleteUserResponse{}, nil
+}
+
+// VerifyPassword verifies the password of a user
+func (s *Server) VerifyPassword(ctx context.Context, req *VerifyPasswordRequest) (*VerifyPasswordResponse, error) {
+	var err error
+	switch selector := req.GetUser().GetSelector().(type) {
+	case *UserRef_Id:
+		err = s.userManager.VerifyPasswordByID(selector.Id, req.GetPassword())
+	case *UserRef_Username:
+		err = s.userManager.VerifyPasswordByUsername(selector.Username, req.GetPassword())
+	case *UserRef_Email:
+		err = s.userManager.VerifyPasswordByEmail(selector.Email, req.GetPassword())
+	default:
+		return nil, invalidArgument("user is required")
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &VerifyPasswordResponse{}, nil
+}
+
+// ListUsers lists users
+func (s *Server) ListUsers(ctx context.Context, req *ListUsersRequest) (*ListUsersResponse, error) {
+	if !orderColumns[req.GetOrderBy()] {
+		return nil, invalidArgument("cannot order by %q", req.GetOrderBy())
+	}
+	var filters map[string]interface{}
+	if len(req.GetFilters()) > 0 {
+		filters = make(map[string]interface{}, len(req.GetFilters()))
+		for key, value := range req.GetFilters() {
+			if !filterColumns[key] {
+				return nil, invalidArgument("cannot filter by %q", key)
+			}
+			filters[key] = valueFromProto(value)
+		}
+	}
+
+	users, err := s.userManager.ListUsers(int(req.GetLimit()), int(req.GetOffset()), filters, req.GetOrderBy(), req.GetDesc())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &ListUsersResponse{Users: make([]*User, 0, len(users))}
+	for i := range users {
+		p, err := userToProto(&users[i], false)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		resp.Users = append(resp.Users, p)
+	}
+	return resp, nil
+}
+
+// EnableUser enables a user
+func (s *Server) EnableUser(ctx context.Context, req *EnableUserRequest) (*EnableUserResponse, error) {
+	if err := s.userManager.EnableUserByID(req.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &EnableUserResponse{}, nil
+}
+
+// DisableUser disables a user
+func (s *Server) DisableUser(ctx context.Context, req *DisableUserRequest) (*DisableUserResponse, error) {
+	if err := s.userManager.DisableUserByID(req.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &DisableUserResponse{}, nil
+}
+
+// SetUserStatus sets the status of a user
+func (s *Server) SetUserStatus(ctx context.Context, req *SetUserStatusRequest) (*SetUserStatusResponse, error) {
+	userStatus := statusFromProto(req.GetStatus())
+	if userStatus == "" {
+		return nil, invalidArgument("status is required")
+	}
+
+	var err error
+	switch selector := req.GetUser().GetSelector().(type) {
+	case *UserRef_Id:
+		err = s.userManager.SetUserStatusByID(selector.Id, userStatus)
+	case *UserRef_Username:
+		err = s.userManager.SetUserStatusByUsername(selector.Username, userStatus)
+	case *UserRef_Email:
+		err = s.userManager.SetUserStatusByEmail(selector.Email, userStatus)
+	default:
+		return nil, invalidArgument("user is required")
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &SetUserStatusResponse{}, nil
+}
+
+// IssueEmailVerification issues a token confirming the email of a user
+func (s *Server) IssueEmailVerification(ctx context.Context, req *IssueEmailVerificationRequest) (*IssueEmailVerificationResponse, error) {
+	token, err := s.userManager.IssueEmailVerification(req.GetUserId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &IssueEmailVerificationResponse{Token: token}, nil
+}
+
+// ConfirmEmail confirms an email with a verification token
+func (s *Server) ConfirmEmail(ctx context.Context, req *ConfirmEmailRequest) (*ConfirmEmailResponse, error) {
+	if err := s.userManager.ConfirmEmail(req.GetToken()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &ConfirmEmailResponse{}, nil
+}
+
+// RequestPasswordReset issues a password reset token
+func (s *Server) RequestPasswordReset(ctx context.Context, req *RequestPasswordResetRequest) (*RequestPasswordResetResponse, error) {
+	token, err := s.userManager.RequestPasswordReset(req.GetEmail())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &RequestPasswordResetResponse{Token: token}, nil
+}
+
+// ResetPassword sets a new password with a reset token
+func (s *Server) ResetPassword(ctx context.Context, req *ResetPasswordRequest) (*ResetPasswordResponse, error) {
+	if err := s.userManager.ResetPassword(req.GetToken(), req.GetNewPassword()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &ResetPasswordResponse{}, nil
+}
@@ -0,0 +1,219 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weedbox/userion"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupClient serves a new user manager over an in-memory connection and
+// returns a client of it along with the raw service client
+func setupClient(t *testing.T, opts ...userion.GormUserManagerOption) (*Client, UserManagerClient) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to database")
+	t.Cleanup(func() {
+		sqlDB, err := db.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	userManager := userion.NewGormUserManager(db, "users_test_"+uuid.New().String()[:8], opts...)
+	require.NoError(t, userManager.AutoMigrate(), "Failed to migrate database")
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	RegisterUserManagerServer(server, NewServer(userManager))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return NewClient(conn), NewUserManagerClient(conn)
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	client, _ := setupClient(t)
+
+	user := &userion.User{
+		Username: "alice",
+		Email:    "alice@example.com",
+		Password: "S3cure!Passw0rd",
+		Name:     "Alice",
+		Data:     map[string]interface{}{"team": "blue"},
+	}
+	require.NoError(t, client.CreateUser(user))
+	assert.NotEqual(t, uuid.Nil, user.ID)
+	assert.False(t, user.CreatedAt.IsZero())
+	assert.Equal(t, "S3cure!Passw0rd", user.Password)
+
+	fetched, err := client.GetUserByUsername("alice")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, fetched.ID)
+	assert.Equal(t, "Alice", fetched.Name)
+	assert.Equal(t, "blue", fetched.Data["team"])
+	assert.Empty(t, fetched.Password)
+	assert.Empty(t, fetched.Salt)
+
+	require.NoError(t, client.VerifyPasswordByEmail("alice@example.com", "S3cure!Passw0rd"))
+
+	require.NoError(t, client.UpdateUserByID(user.ID.String(), map[string]interface{}{"Name": "Alice Smith"}))
+	fetched, err = client.GetUserByID(user.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "Alice Smith", fetched.Name)
+
+	require.NoError(t, client.SetUserStatusByEmail("alice@example.com", userion.UserStatusSuspended))
+	require.NoError(t, client.DisableUserByID(user.ID.String()))
+	fetched, err = client.GetUserByEmail("alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, userion.UserStatusSuspended, fetched.Status)
+	assert.False(t, fetched.Enabled)
+
+	users, err := client.ListUsers(10, 0, map[string]interface{}{"status": userion.UserStatusSuspended}, "username", false)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, user.ID, users[0].ID)
+
+	require.NoError(t, client.DeleteUserByUsername("alice"))
+	_, err = client.GetUserByID(user.ID.String())
+	assert.ErrorIs(t, err, userion.ErrUserNotFound)
+}
+
+func TestClientErrors(t *testing.T) {
+	client, _ := setupClient(t)
+
+	user := &userion.User{Username: "bob", Email: "bob@example.com", Password: "S3cure!Passw0rd"}
+	require.NoError(t, client.CreateUser(user))
+
+	err := client.CreateUser(&userion.User{Username: "bob", Email: "other@example.com", Password: "S3cure!Passw0rd"})
+	assert.ErrorIs(t, err, userion.ErrUserAlreadyExists)
+
+	err = client.VerifyPasswordByUsername("bob", "wrong")
+	assert.ErrorIs(t, err, userion.ErrInvalidPassword)
+
+	err = client.VerifyPasswordByUsername("nobody", "wrong")
+	assert.ErrorIs(t, err, userion.ErrUserNotFound)
+
+	err = client.ConfirmEmail("bogus")
+	assert.ErrorIs(t, err, userion.ErrInvalidToken)
+
+	err = client.SetUserStatusByID(user.ID.String(), "unknown")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerStatusCodes(t *testing.T) {
+	_, raw := setupClient(t)
+	ctx := context.Background()
+
+	_, err := raw.GetUser(ctx, &GetUserRequest{User: &UserRef{Selector: &UserRef_Username{Username: "nobody"}}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	created, err := raw.CreateUser(ctx, &CreateUserRequest{User: &User{
+		Username: "carol",
+		Email:    "carol@example.com",
+		Password: "S3cure!Passw0rd",
+	}})
+	require.NoError(t, err)
+	assert.Empty(t, created.GetUser().GetPassword())
+	assert.Empty(t, created.GetUser().GetSalt())
+	assert.Equal(t, UserStatus_USER_STATUS_INACTIVE, created.GetUser().GetStatus())
+
+	_, err = raw.CreateUser(ctx, &CreateUserRequest{User: &User{
+		Username: "carol",
+		Email:    "carol@example.com",
+		Password: "S3cure!Passw0rd",
+	}})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	ref := &UserRef{Selector: &UserRef_Username{Username: "carol"}}
+	_, err = raw.VerifyPassword(ctx, &VerifyPasswordRequest{User: ref, Password: "wrong"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = raw.GetUser(ctx, &GetUserRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = raw.UpdateUser(ctx, &UpdateUserRequest{User: ref, UpdatedData: map[string]*Value{
+		"Salt": {Kind: &Value_StringValue{StringValue: "x"}},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = raw.ListUsers(ctx, &ListUsersRequest{Filters: map[string]*Value{
+		"password": {Kind: &Value_StringValue{StringValue: "x"}},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = raw.ListUsers(ctx, &ListUsersRequest{OrderBy: "password"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = raw.SetUserStatus(ctx, &SetUserStatusRequest{User: ref})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestServerUpdateUser tests that updates go through the manager's handling
+// of passwords, data and the enabled flag
+func TestServerUpdateUser(t *testing.T) {
+	var events []userion.Event
+	client, raw := setupClient(t, userion.WithEventHandler(func(event userion.Event) {
+		events = append(events, event)
+	}))
+	ctx := context.Background()
+
+	user := &userion.User{Username: "dave", Email: "dave@example.com", Password: "S3cure!Passw0rd"}
+	require.NoError(t, client.CreateUser(user))
+	ref := &UserRef{Selector: &UserRef_Username{Username: "dave"}}
+	update := func(key string, value *Value) error {
+		_, err := raw.UpdateUser(ctx, &UpdateUserRequest{User: ref, UpdatedData: map[string]*Value{key: value}})
+		return err
+	}
+
+	for _, key := range []string{"password", "data", "enabled", "email_verified_at"} {
+		err := update(key, &Value{Kind: &Value_StringValue{StringValue: "x"}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "Column names should be rejected: %s", key)
+	}
+	require.NoError(t, client.VerifyPasswordByUsername("dave", "S3cure!Passw0rd"))
+
+	require.NoError(t, update("Password", &Value{Kind: &Value_StringValue{StringValue: "N3w!Passw0rd#1"}}))
+	require.NoError(t, client.VerifyPasswordByUsername("dave", "N3w!Passw0rd#1"), "Passwords should be hashed")
+	assert.Equal(t, userion.EventPasswordChanged, events[len(events)-1].Type)
+
+	data, err := structpb.NewStruct(map[string]interface{}{"team": "red"})
+	require.NoError(t, err)
+	require.NoError(t, update("Data", &Value{Kind: &Value_StructValue{StructValue: data}}))
+	fetched, err := client.GetUserByUsername("dave")
+	require.NoError(t, err)
+	assert.Equal(t, "red", fetched.Data["team"])
+
+	require.NoError(t, update("Enabled", &Value{Kind: &Value_BoolValue{BoolValue: false}}))
+	fetched, err = client.GetUserByUsername("dave")
+	require.NoError(t, err)
+	assert.False(t, fetched.Enabled)
+	assert.Equal(t, userion.EventUserDisabled, events[len(events)-1].Type, "Disabling should be reported")
+
+	require.NoError(t, update("Enabled", &Value{Kind: &Value_BoolValue{BoolValue: true}}))
+	fetched, err = client.GetUserByUsername("dave")
+	require.NoError(t, err)
+	assert.True(t, fetched.Enabled)
+
+	err = update("Enabled", &Value{Kind: &Value_StringValue{StringValue: "no"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,269 @@
+package userion
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Signing algorithms supported for JWTs
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmES256 = "ES256"
+	AlgorithmRS256 = "RS256"
+)
+
+// ErrUnsupportedAlgorithm is returned for signing algorithms other than EdDSA, ES256 and RS256
+var ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+// SigningKey is a private key used to sign JWTs
+type SigningKey struct {
+	ID        string // Key ID, published as "kid"
+	Algorithm string
+	Signer    crypto.Signer
+	CreatedAt time.Time
+}
+
+// GenerateSigningKey creates a new random key for the given algorithm
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch algorithm {
+	case AlgorithmEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case AlgorithmES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	id, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:        id[:16],
+		Algorithm: algorithm,
+		Signer:    signer,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// PublicKey returns the public half of the key
+func (k *SigningKey) PublicKey() crypto.PublicKey {
+	return k.Signer.Public()
+}
+
+// JWTKeySet resolves the public key used to verify a JWT
+type JWTKeySet interface {
+	VerificationKey(kid string) (algorithm string, key crypto.PublicKey, err error)
+}
+
+// jwtHeader is the JOSE header of a JWT
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// SignJWT encodes and signs claims with the key
+func SignJWT(key *SigningKey, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(jwtHeader{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	signature, err := signJWS(key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// signJWS produces the JWS signature of the signing input
+func signJWS(key *SigningKey, input []byte) ([]byte, error) {
+	switch key.Algorithm {
+	case AlgorithmEdDSA:
+		privateKey, ok := key.Signer.(ed25519.PrivateKey)
+		if !ok {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		return ed25519.Sign(privateKey, input), nil
+
+	case AlgorithmES256:
+		privateKey, ok := key.Signer.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		digest := sha256.Sum256(input)
+		r, s, err := ecdsa.Sign(rand.Reader, privateKey, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS uses the fixed-size concatenation of r and s
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+
+	case AlgorithmRS256:
+		privateKey, ok := key.Signer.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		digest := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+// verifyJWS checks a JWS signature against a public key
+func verifyJWS(algorithm string, key crypto.PublicKey, input, signature []byte) bool {
+	switch algorithm {
+	case AlgorithmEdDSA:
+		publicKey, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(publicKey, input, signature)
+
+	case AlgorithmES256:
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(input)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(publicKey, digest[:], r, s)
+
+	case AlgorithmRS256:
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+
+	default:
+		return false
+	}
+}
+
+// VerifyJWT checks the signature of a JWT against the key set and validates
+// its exp and nbf claims. Tokens without exp never expire and are rejected.
+// It returns ErrInvalidToken or ErrTokenExpired.
+func VerifyJWT(token string, keys JWTKeySet, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	algorithm, key, err := keys.VerificationKey(header.KeyID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	// The key decides the algorithm, never the token
+	if algorithm != header.Algorithm {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !verifyJWS(algorithm, key, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := make(map[string]interface{})
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	exp, ok := NumericDateClaim(claims, "exp")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if !now.Before(exp) {
+		return nil, ErrTokenExpired
+	}
+	if nbf, ok := NumericDateClaim(claims, "nbf"); ok && now.Before(nbf) {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// NumericDateClaim reads a time claim such as exp or iat from verified claims
+func NumericDateClaim(claims map[string]interface{}, name string) (time.Time, bool) {
+	switch value := claims[name].(type) {
+	case json.Number:
+		seconds, err := value.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(seconds, 0), true
+	case float64:
+		return time.Unix(int64(value), 0), true
+	case int64:
+		return time.Unix(value, 0), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// AudienceClaim reports whether the aud claim, a string or an array, contains the audience
+func AudienceClaim(claims map[string]interface{}, audience string) bool {
+	switch value := claims["aud"].(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, v := range value {
+			if s, ok := v.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
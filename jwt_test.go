@@ -0,0 +1,94 @@
+package userion
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSignAndVerifyJWT tests signing and verifying with every supported algorithm
+func TestSignAndVerifyJWT(t *testing.T) {
+	now := time.Now()
+
+	for _, algorithm := range []string{AlgorithmEdDSA, AlgorithmES256, AlgorithmRS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := GenerateSigningKey(algorithm)
+			require.NoError(t, err, "GenerateSigningKey should not error")
+			ring := NewKeyRing(key)
+
+			token, err := ring.Sign(map[string]interface{}{
+				"sub": "user-1",
+				"exp": now.Add(time.Minute).Unix(),
+			})
+			require.NoError(t, err, "Sign should not error")
+
+			claims, err := VerifyJWT(token, ring, now)
+			assert.NoError(t, err, "VerifyJWT should accept a valid token")
+			assert.Equal(t, "user-1", claims["sub"])
+
+			// Verifiers only need the JWKS document
+			data, err := json.Marshal(ring.JWKS())
+			require.NoError(t, err)
+			var jwks JWKSet
+			require.NoError(t, json.Unmarshal(data, &jwks))
+			_, err = VerifyJWT(token, &jwks, now)
+			assert.NoError(t, err, "VerifyJWT should accept a token checked against the JWKS")
+
+			_, err = VerifyJWT(token, ring, now.Add(time.Minute))
+			assert.Equal(t, ErrTokenExpired, err, "VerifyJWT should reject an expired token")
+
+			// Tampering with the payload breaks the signature
+			parts := strings.Split(token, ".")
+			tampered, _ := json.Marshal(map[string]interface{}{"sub": "user-2", "exp": now.Add(time.Minute).Unix()})
+			parts[1] = base64.RawURLEncoding.EncodeToString(tampered)
+			_, err = VerifyJWT(strings.Join(parts, "."), ring, now)
+			assert.Equal(t, ErrInvalidToken, err, "VerifyJWT should reject a tampered token")
+		})
+	}
+
+	_, err := GenerateSigningKey("HS256")
+	assert.Equal(t, ErrUnsupportedAlgorithm, err, "GenerateSigningKey should reject unsupported algorithms")
+}
+
+// TestKeyRingRotation tests that rotated keys keep verifying until retired
+func TestKeyRingRotation(t *testing.T) {
+	now := time.Now()
+	ring := NewKeyRing()
+
+	_, err := ring.Sign(map[string]interface{}{})
+	assert.Equal(t, ErrKeyNotFound, err, "Sign should error without an active key")
+
+	oldKey, err := ring.Rotate(AlgorithmEdDSA)
+	require.NoError(t, err)
+	oldToken, err := ring.Sign(map[string]interface{}{"sub": "user-1", "exp": now.Add(time.Minute).Unix()})
+	require.NoError(t, err)
+
+	newKey, err := ring.Rotate(AlgorithmES256)
+	require.NoError(t, err)
+	active, err := ring.ActiveKey()
+	require.NoError(t, err)
+	assert.Equal(t, newKey.ID, active.ID, "Rotate should activate the new key")
+	assert.Len(t, ring.JWKS().Keys, 2, "JWKS should publish both keys")
+
+	_, err = VerifyJWT(oldToken, ring, now)
+	assert.NoError(t, err, "Tokens signed with a previous key should still verify")
+
+	assert.Equal(t, ErrActiveKey, ring.Retire(newKey.ID), "The active key cannot be retired")
+	assert.NoError(t, ring.Retire(oldKey.ID), "Retire should remove an inactive key")
+	assert.Equal(t, ErrKeyNotFound, ring.Retire(oldKey.ID), "Retiring twice should error")
+
+	_, err = VerifyJWT(oldToken, ring, now)
+	assert.Equal(t, ErrInvalidToken, err, "Tokens signed with a retired key should not verify")
+	assert.Len(t, ring.JWKS().Keys, 1, "JWKS should not publish retired keys")
+
+	// Test a token without expiry
+	eternal, err := ring.Sign(map[string]interface{}{"sub": "user-1"})
+	require.NoError(t, err)
+	_, err = VerifyJWT(eternal, ring, now)
+	assert.Equal(t, ErrInvalidToken, err, "Tokens without exp should not verify")
+}
@@ -0,0 +1,262 @@
+package userion
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sync"
+)
+
+// Errors returned by the KeyRing
+var (
+	ErrKeyNotFound = errors.New("key not found")
+	ErrActiveKey   = errors.New("cannot retire the active key")
+)
+
+// JWK is a public JSON Web Key as published in a JWKS document
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// NewJWK describes a public key as a JWK
+func NewJWK(kid, algorithm string, key crypto.PublicKey) (JWK, error) {
+	jwk := JWK{
+		Use:       "sig",
+		KeyID:     kid,
+		Algorithm: algorithm,
+	}
+
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return JWK{}, ErrUnsupportedAlgorithm
+		}
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		jwk.KeyType = "EC"
+		jwk.Curve = "P-256"
+		jwk.X = base64.RawURLEncoding.EncodeToString(x)
+		jwk.Y = base64.RawURLEncoding.EncodeToString(y)
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	default:
+		return JWK{}, ErrUnsupportedAlgorithm
+	}
+
+	return jwk, nil
+}
+
+// PublicKey decodes the key material of the JWK
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.KeyType {
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || j.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		return ed25519.PublicKey(x), nil
+
+	case "EC":
+		x, errX := base64.RawURLEncoding.DecodeString(j.X)
+		y, errY := base64.RawURLEncoding.DecodeString(j.Y)
+		if errX != nil || errY != nil || j.Curve != "P-256" {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		return key, nil
+
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(j.N)
+		e, errE := base64.RawURLEncoding.DecodeString(j.E)
+		if errN != nil || errE != nil {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+// JWKSet is a JWKS document listing the public keys verifiers may trust
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// VerificationKey finds a key by ID, implementing JWTKeySet. A token
+// without key ID matches the only key of a set with a single key.
+func (s *JWKSet) VerificationKey(kid string) (string, crypto.PublicKey, error) {
+	for _, jwk := range s.Keys {
+		if jwk.KeyID == kid || (kid == "" && len(s.Keys) == 1) {
+			key, err := jwk.PublicKey()
+			if err != nil {
+				return "", nil, err
+			}
+			return jwk.algorithm(), key, nil
+		}
+	}
+	return "", nil, ErrKeyNotFound
+}
+
+// algorithm returns the alg of the JWK, which is optional, or else the
+// algorithm this package uses for its key type
+func (j JWK) algorithm() string {
+	if j.Algorithm != "" {
+		return j.Algorithm
+	}
+
+	switch j.KeyType {
+	case "OKP":
+		return AlgorithmEdDSA
+	case "EC":
+		return AlgorithmES256
+	case "RSA":
+		return AlgorithmRS256
+	default:
+		return ""
+	}
+}
+
+// KeyRing holds the signing keys of an issuer. New tokens are signed with the
+// active key while older keys remain available for verification until retired.
+type KeyRing struct {
+	mu     sync.RWMutex
+	keys   []*SigningKey
+	active *SigningKey
+}
+
+// NewKeyRing creates a key ring. The last key given becomes the active one.
+func NewKeyRing(keys ...*SigningKey) *KeyRing {
+	r := &KeyRing{}
+	for _, key := range keys {
+		r.Add(key)
+	}
+	return r
+}
+
+// Add puts a key on the ring and makes it the active signing key
+func (r *KeyRing) Add(key *SigningKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = append(r.keys, key)
+	r.active = key
+}
+
+// Rotate generates a new key for the algorithm and makes it the active one
+func (r *KeyRing) Rotate(algorithm string) (*SigningKey, error) {
+	key, err := GenerateSigningKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Add(key)
+	return key, nil
+}
+
+// Retire removes a key so that tokens signed with it no longer verify.
+// The active key cannot be retired.
+func (r *KeyRing) Retire(kid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active != nil && r.active.ID == kid {
+		return ErrActiveKey
+	}
+
+	for i, key := range r.keys {
+		if key.ID == kid {
+			r.keys = append(r.keys[:i], r.keys[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrKeyNotFound
+}
+
+// ActiveKey returns the key new tokens are signed with
+func (r *KeyRing) ActiveKey() (*SigningKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.active == nil {
+		return nil, ErrKeyNotFound
+	}
+	return r.active, nil
+}
+
+// Keys returns all keys on the ring, oldest first
+func (r *KeyRing) Keys() []*SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]*SigningKey, len(r.keys))
+	copy(keys, r.keys)
+	return keys
+}
+
+// VerificationKey finds a key by ID, implementing JWTKeySet
+func (r *KeyRing) VerificationKey(kid string) (string, crypto.PublicKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.ID == kid {
+			return key.Algorithm, key.PublicKey(), nil
+		}
+	}
+	return "", nil, ErrKeyNotFound
+}
+
+// Sign signs claims with the active key
+func (r *KeyRing) Sign(claims map[string]interface{}) (string, error) {
+	key, err := r.ActiveKey()
+	if err != nil {
+		return "", err
+	}
+	return SignJWT(key, claims)
+}
+
+// JWKS returns the JWKS document of all public keys on the ring
+func (r *KeyRing) JWKS() *JWKSet {
+	set := &JWKSet{Keys: []JWK{}}
+	for _, key := range r.Keys() {
+		jwk, err := NewJWK(key.ID, key.Algorithm, key.PublicKey())
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,250 @@
+package ldap
+
+import (
+	"errors"
+	"io"
+)
+
+// errInvalidBER is returned for malformed or unsupported BER input
+var errInvalidBER = errors.New("invalid BER")
+
+// maxMessageSize bounds the size of a message read from the network so a
+// hostile peer cannot exhaust memory
+const maxMessageSize = 16 << 20
+
+// berMaxDepth bounds nesting so hostile input cannot exhaust the stack
+const berMaxDepth = 32
+
+// BER identifier classes (X.690 section 8.1.2.2)
+const (
+	classUniversal   byte = 0x00
+	classApplication byte = 0x40
+	classContext     byte = 0x80
+)
+
+// Universal tags used by LDAP
+const (
+	tagBoolean     = 1
+	tagInteger     = 2
+	tagOctetString = 4
+	tagNull        = 5
+	tagEnumerated  = 10
+	tagSequence    = 16
+	tagSet         = 17
+)
+
+// berPacket is a decoded BER element (X.690). Only definite lengths and
+// tags below 31 are supported, which covers every element of LDAPv3.
+type berPacket struct {
+	class       byte
+	constructed bool
+	tag         int
+	value       []byte       // Content of primitive elements
+	children    []*berPacket // Elements of constructed elements
+}
+
+// is reports whether the packet has the class and tag
+func (p *berPacket) is(class byte, tag int) bool {
+	return p.class == class && p.tag == tag
+}
+
+// child returns the i-th element of a constructed packet
+func (p *berPacket) child(i int) (*berPacket, error) {
+	if !p.constructed || i >= len(p.children) {
+		return nil, errInvalidBER
+	}
+	return p.children[i], nil
+}
+
+// integer decodes the content as a two's complement integer
+func (p *berPacket) integer() (int64, error) {
+	if p.constructed || len(p.value) == 0 || len(p.value) > 8 {
+		return 0, errInvalidBER
+	}
+	value := int64(int8(p.value[0]))
+	for _, b := range p.value[1:] {
+		value = value<<8 | int64(b)
+	}
+	return value, nil
+}
+
+// boolean decodes the content as a boolean
+func (p *berPacket) boolean() (bool, error) {
+	if p.constructed || len(p.value) != 1 {
+		return false, errInvalidBER
+	}
+	return p.value[0] != 0, nil
+}
+
+// str returns the content of a primitive packet as a string
+func (p *berPacket) str() (string, error) {
+	if p.constructed {
+		return "", errInvalidBER
+	}
+	return string(p.value), nil
+}
+
+// encode returns the DER-style encoding of the packet
+func (p *berPacket) encode() []byte {
+	content := p.value
+	if p.constructed {
+		content = nil
+		for _, child := range p.children {
+			content = append(content, child.encode()...)
+		}
+	}
+
+	identifier := p.class | byte(p.tag)
+	if p.constructed {
+		identifier |= 0x20
+	}
+
+	out := []byte{identifier}
+	out = append(out, encodeLength(len(content))...)
+	return append(out, content...)
+}
+
+// encodeLength encodes a definite length in the short or long form
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+	var digits []byte
+	for n := length; n > 0; n >>= 8 {
+		digits = append([]byte{byte(n)}, digits...)
+	}
+	return append([]byte{0x80 | byte(len(digits))}, digits...)
+}
+
+// readPacket reads one complete element from r
+func readPacket(r io.Reader) (*berPacket, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := int(header[1])
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		// Indefinite lengths are not allowed in LDAP (RFC 4511 section 5.1)
+		if size == 0 || size > 4 {
+			return nil, errInvalidBER
+		}
+		digits := make([]byte, size)
+		if _, err := io.ReadFull(r, digits); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range digits {
+			length = length<<8 | int(b)
+		}
+		header = append(header[:1], encodeLength(length)...)
+	}
+	if length > maxMessageSize {
+		return nil, errInvalidBER
+	}
+
+	data := make([]byte, len(header)+length)
+	copy(data, header)
+	if _, err := io.ReadFull(r, data[len(header):]); err != nil {
+		return nil, err
+	}
+
+	packet, _, err := decodePacket(data, 0)
+	return packet, err
+}
+
+// decodePacket decodes the first element in data and returns it together with
+// the number of bytes consumed
+func decodePacket(data []byte, depth int) (*berPacket, int, error) {
+	if depth > berMaxDepth || len(data) < 2 {
+		return nil, 0, errInvalidBER
+	}
+
+	identifier := data[0]
+	if identifier&0x1f == 0x1f {
+		return nil, 0, errInvalidBER
+	}
+	packet := &berPacket{
+		class:       identifier & 0xc0,
+		constructed: identifier&0x20 != 0,
+		tag:         int(identifier & 0x1f),
+	}
+
+	offset := 2
+	length := int(data[1])
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 4 || len(data) < offset+size {
+			return nil, 0, errInvalidBER
+		}
+		length = 0
+		for _, b := range data[offset : offset+size] {
+			length = length<<8 | int(b)
+		}
+		offset += size
+	}
+	if length < 0 || len(data)-offset < length {
+		return nil, 0, errInvalidBER
+	}
+
+	content := data[offset : offset+length]
+	if !packet.constructed {
+		packet.value = content
+		return packet, offset + length, nil
+	}
+
+	for len(content) > 0 {
+		child, n, err := decodePacket(content, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		packet.children = append(packet.children, child)
+		content = content[n:]
+	}
+	return packet, offset + length, nil
+}
+
+// newConstructed returns a constructed packet
+func newConstructed(class byte, tag int, children ...*berPacket) *berPacket {
+	return &berPacket{class: class, constructed: true, tag: tag, children: children}
+}
+
+// newPrimitive returns a primitive packet
+func newPrimitive(class byte, tag int, value []byte) *berPacket {
+	return &berPacket{class: class, tag: tag, value: value}
+}
+
+// newSequence returns a universal SEQUENCE
+func newSequence(children ...*berPacket) *berPacket {
+	return newConstructed(classUniversal, tagSequence, children...)
+}
+
+// newOctetString returns a universal OCTET STRING
+func newOctetString(s string) *berPacket {
+	return newPrimitive(classUniversal, tagOctetString, []byte(s))
+}
+
+// newBoolean returns a universal BOOLEAN
+func newBoolean(b bool) *berPacket {
+	if b {
+		return newPrimitive(classUniversal, tagBoolean, []byte{0xff})
+	}
+	return newPrimitive(classUniversal, tagBoolean, []byte{0x00})
+}
+
+// newInteger returns an INTEGER, or another element with integer content
+func newInteger(class byte, tag int, value int64) *berPacket {
+	content := []byte{byte(value)}
+	for value >>= 8; value != 0 && value != -1; value >>= 8 {
+		content = append([]byte{byte(value)}, content...)
+	}
+	// Keep the sign bit of the leading byte consistent with the value
+	if value == 0 && content[0]&0x80 != 0 {
+		content = append([]byte{0x00}, content...)
+	}
+	if value == -1 && content[0]&0x80 == 0 {
+		content = append([]byte{0xff}, content...)
+	}
+	return newPrimitive(class, tag, content)
+}
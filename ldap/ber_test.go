@@ -0,0 +1,54 @@
+package ldap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBERInteger tests the two's complement encoding of integers
+func TestBERInteger(t *testing.T) {
+	cases := map[int64][]byte{
+		0:    {0x02, 0x01, 0x00},
+		127:  {0x02, 0x01, 0x7f},
+		128:  {0x02, 0x02, 0x00, 0x80},
+		256:  {0x02, 0x02, 0x01, 0x00},
+		-1:   {0x02, 0x01, 0xff},
+		-128: {0x02, 0x01, 0x80},
+		-129: {0x02, 0x02, 0xff, 0x7f},
+	}
+	for value, encoded := range cases {
+		packet := newInteger(classUniversal, tagInteger, value)
+		assert.Equal(t, encoded, packet.encode(), "%d", value)
+
+		decoded, _, err := decodePacket(encoded, 0)
+		require.NoError(t, err)
+		n, err := decoded.integer()
+		require.NoError(t, err)
+		assert.Equal(t, value, n)
+	}
+}
+
+// TestBERRoundTrip tests reading constructed packets with long lengths
+func TestBERRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	packet := newSequence(newOctetString(long), newBoolean(true), newConstructed(classApplication, opBindRequest))
+
+	read, err := readPacket(bytes.NewReader(packet.encode()))
+	require.NoError(t, err)
+	require.Len(t, read.children, 3)
+	s, _ := read.children[0].str()
+	assert.Equal(t, long, s)
+	b, _ := read.children[1].boolean()
+	assert.True(t, b)
+	assert.True(t, read.children[2].is(classApplication, opBindRequest))
+
+	_, err = readPacket(bytes.NewReader([]byte{0x30, 0x80, 0x00, 0x00}))
+	assert.ErrorIs(t, err, errInvalidBER, "Indefinite lengths should be rejected")
+
+	_, _, err = decodePacket([]byte{0x30, 0x05, 0x04, 0x10, 0x00}, 0)
+	assert.ErrorIs(t, err, errInvalidBER, "Truncated children should be rejected")
+}
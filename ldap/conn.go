@@ -0,0 +1,255 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+)
+
+// ErrUnauthenticatedBind is returned when binding with a name but without a
+// password, which many servers accept as an anonymous bind (RFC 4513
+// section 5.1.2)
+var ErrUnauthenticatedBind = errors.New("ldap: bind without password")
+
+// DefaultTimeout bounds dialing and each operation
+const DefaultTimeout = 10 * time.Second
+
+// Conn is a connection to a directory server. Operations are performed one
+// at a time; a Conn must not be used concurrently.
+type Conn struct {
+	conn    net.Conn
+	timeout time.Duration
+	nextID  int64
+}
+
+// Dial connects to the server at an ldap:// or ldaps:// URL. The TLS
+// configuration is used for ldaps:// and StartTLS.
+func Dial(rawURL string, tlsConfig *tls.Config, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	host := u.Host
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, tlsClientConfig(tlsConfig, u.Hostname()))
+	default:
+		return nil, errors.New("ldap: unsupported URL scheme " + u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{conn: conn, timeout: timeout}, nil
+}
+
+// tlsClientConfig returns a configuration verifying the server name
+func tlsClientConfig(config *tls.Config, serverName string) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = serverName
+	}
+	return config
+}
+
+// StartTLS upgrades the connection to TLS (RFC 4511 section 4.14)
+func (c *Conn) StartTLS(config *tls.Config) error {
+	op := newConstructed(classApplication, opExtendedRequest, newPrimitive(classContext, 0, []byte(oidStartTLS)))
+	response, _, err := c.roundTrip(op)
+	if err != nil {
+		return err
+	}
+	if !response.is(classApplication, opExtendedResponse) {
+		return errInvalidBER
+	}
+	if err := parseResult(response); err != nil {
+		return err
+	}
+
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	tlsConn := tls.Client(c.conn, tlsClientConfig(config, host))
+	if err := tlsConn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	return nil
+}
+
+// Bind authenticates with a simple bind (RFC 4511 section 4.2). An empty
+// name and password bind anonymously.
+func (c *Conn) Bind(dn, password string) error {
+	if dn != "" && password == "" {
+		return ErrUnauthenticatedBind
+	}
+
+	op := newConstructed(classApplication, opBindRequest,
+		newInteger(classUniversal, tagInteger, protocolVersion),
+		newOctetString(dn),
+		newPrimitive(classContext, 0, []byte(password)),
+	)
+	response, _, err := c.roundTrip(op)
+	if err != nil {
+		return err
+	}
+	if !response.is(classApplication, opBindResponse) {
+		return errInvalidBER
+	}
+	return parseResult(response)
+}
+
+// Search performs a search and returns the matching entries. Referrals are
+// ignored. With a page size, pages are requested until the server has
+// returned every entry.
+func (c *Conn) Search(request *SearchRequest) ([]*Entry, error) {
+	filter := request.Filter
+	if filter == "" {
+		filter = "(objectClass=*)"
+	}
+	compiled, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := newSequence()
+	for _, attribute := range request.Attributes {
+		attributes.children = append(attributes.children, newOctetString(attribute))
+	}
+
+	op := newConstructed(classApplication, opSearchRequest,
+		newOctetString(request.BaseDN),
+		newInteger(classUniversal, tagEnumerated, int64(request.Scope)),
+		newInteger(classUniversal, tagEnumerated, 0), // neverDerefAliases
+		newInteger(classUniversal, tagInteger, int64(request.SizeLimit)),
+		newInteger(classUniversal, tagInteger, int64(request.TimeLimit)),
+		newBoolean(false),
+		compiled,
+		attributes,
+	)
+
+	var entries []*Entry
+	var cookie []byte
+	for {
+		var controls []*berPacket
+		if request.PageSize > 0 {
+			controls = append(controls, newPagedResultsControl(request.PageSize, cookie))
+		}
+
+		id, err := c.send(op, controls...)
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			response, responseControls, err := c.receive(id)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case response.is(classApplication, opSearchResultEntry):
+				entry, err := parseEntry(response)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, entry)
+				continue
+			case response.is(classApplication, opSearchResultReference):
+				continue
+			case !response.is(classApplication, opSearchResultDone):
+				return nil, errInvalidBER
+			}
+
+			if err := parseResult(response); err != nil {
+				return nil, err
+			}
+
+			cookie = nil
+			if value, ok := findControl(responseControls, oidPagedResults); ok && request.PageSize > 0 {
+				if _, cookie, err = parsePagedResultsValue(value); err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+
+		// Servers without paging support return everything at once
+		if len(cookie) == 0 {
+			return entries, nil
+		}
+	}
+}
+
+// Close sends an unbind request and closes the connection
+func (c *Conn) Close() error {
+	_, _ = c.send(newPrimitive(classApplication, opUnbindRequest, nil))
+	return c.conn.Close()
+}
+
+// roundTrip sends a request and receives its single response
+func (c *Conn) roundTrip(op *berPacket) (*berPacket, []*berPacket, error) {
+	id, err := c.send(op)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.receive(id)
+}
+
+// send writes a request and returns its message ID
+func (c *Conn) send(op *berPacket, controls ...*berPacket) (int64, error) {
+	c.nextID++
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	_, err := c.conn.Write(newMessage(c.nextID, op, controls...).encode())
+	return c.nextID, err
+}
+
+// receive reads the next response to the request with the message ID.
+// Unsolicited notifications, such as a notice of disconnection, end the
+// connection.
+func (c *Conn) receive(id int64) (*berPacket, []*berPacket, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, nil, err
+	}
+	packet, err := readPacket(c.conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	responseID, op, controls, err := parseMessage(packet)
+	if err != nil {
+		return nil, nil, err
+	}
+	if responseID == 0 {
+		if err := parseResult(op); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errors.New("ldap: unsolicited notification")
+	}
+	if responseID != id {
+		return nil, nil, errInvalidBER
+	}
+	return op, controls, nil
+}
@@ -0,0 +1,96 @@
+// Package ldap authenticates users against an LDAP directory such as Active
+// Directory or OpenLDAP and keeps userion users in sync with its entries.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/weedbox/userion"
+)
+
+var (
+	// ErrInvalidCredentials is returned when the username is unknown to the
+	// directory or the password is rejected by it
+	ErrInvalidCredentials = errors.New("ldap: invalid credentials")
+	// ErrAmbiguousEntry is returned when a username matches several entries
+	ErrAmbiguousEntry = errors.New("ldap: username matches several entries")
+	// ErrMissingAttribute is returned for entries lacking a mapped attribute
+	// that users require
+	ErrMissingAttribute = errors.New("ldap: entry lacks a required attribute")
+	// ErrUserConflict is returned when a local user not synced from the
+	// directory already has the username or email of an entry
+	ErrUserConflict = errors.New("ldap: local user conflicts with directory entry")
+	// ErrEmptyDirectory is returned when a sync finds no entries although
+	// users were synced before, which usually means a misconfiguration
+	ErrEmptyDirectory = errors.New("ldap: directory search returned no entries")
+)
+
+// DefaultUserFilter selects the entries that are users
+const DefaultUserFilter = "(objectClass=person)"
+
+// DefaultPageSize is the number of entries requested per page during a sync
+const DefaultPageSize = 500
+
+// AttributeMap names the directory attributes mapped to User fields
+type AttributeMap struct {
+	Username string // Login name, e.g. uid or sAMAccountName
+	Email    string
+	Name     string
+	Phone    string // Optional; phones are unique per tenant, so map a personal number such as mobile
+	UniqueID string // Attribute that survives renames, e.g. entryUUID or objectGUID
+}
+
+// DefaultAttributeMap maps the attributes of OpenLDAP and other RFC 4519 directories
+var DefaultAttributeMap = AttributeMap{
+	Username: "uid",
+	Email:    "mail",
+	Name:     "cn",
+	UniqueID: "entryUUID",
+}
+
+// ActiveDirectoryAttributeMap maps the attributes of Active Directory
+var ActiveDirectoryAttributeMap = AttributeMap{
+	Username: "sAMAccountName",
+	Email:    "mail",
+	Name:     "displayName",
+	UniqueID: "objectGUID",
+}
+
+// Config configures the connection to the directory
+type Config struct {
+	URL       string // ldap://host:389 or ldaps://host:636
+	StartTLS  bool   // Upgrade ldap:// connections with StartTLS
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+
+	// Service account used to search the directory; anonymous if empty
+	BindDN       string
+	BindPassword string
+
+	BaseDN     string
+	UserFilter string // Defaults to DefaultUserFilter
+	Attributes AttributeMap
+	PageSize   int // Defaults to DefaultPageSize
+}
+
+// SyncResult summarizes a directory sync
+type SyncResult struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	Disabled  int
+	Errors    []error // Entries that could not be synced
+}
+
+// Directory defines the interface of the LDAP authentication backend
+type Directory interface {
+	userion.LoginMethodChecker
+
+	AutoMigrate() error
+	Authenticate(username, password string) (*userion.User, error)
+	Sync() (*SyncResult, error)
+	RunSync(ctx context.Context, interval time.Duration, report func(*SyncResult, error))
+}
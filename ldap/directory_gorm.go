@@ -0,0 +1,506 @@
+package ldap
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/weedbox/userion"
+	"gorm.io/gorm"
+)
+
+// GormDirectoryLinkModel links a user to the directory entry it was synced from
+type GormDirectoryLinkModel struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey;"`
+	UserID     uuid.UUID  `gorm:"type:uuid;unique;not null"`
+	UniqueID   string     `gorm:"type:varchar(255);unique;not null"`
+	DN         string     `gorm:"not null"`
+	SyncedAt   time.Time  `gorm:"not null"`
+	DisabledAt *time.Time // Set when the user was disabled because the entry disappeared
+	CreatedAt  time.Time  `gorm:"autoCreateTime"`
+}
+
+// GormDirectory is the GORM implementation of Directory
+type GormDirectory struct {
+	db          *gorm.DB
+	tableName   string
+	userManager userion.UserManager
+	config      Config
+
+	linkExistingUsers bool
+	mfaChecker        userion.MFAChecker
+
+	now func() time.Time
+}
+
+// Option configures optional behaviour of a GormDirectory
+type Option func(*GormDirectory)
+
+// WithLinkExistingUsers links entries to local users with the same username
+// or email instead of reporting ErrUserConflict. Enable it only when the
+// directory is trusted to own those accounts.
+func WithLinkExistingUsers(link bool) Option {
+	return func(d *GormDirectory) {
+		d.linkExistingUsers = link
+	}
+}
+
+// WithMFAChecker makes Authenticate return userion.ErrMFARequired for users
+// who have enrolled a second factor
+func WithMFAChecker(checker userion.MFAChecker) Option {
+	return func(d *GormDirectory) {
+		d.mfaChecker = checker
+	}
+}
+
+// NewGormDirectory initializes a new Directory storing its links to users in tableName
+func NewGormDirectory(db *gorm.DB, tableName string, userManager userion.UserManager, config Config, opts ...Option) Directory {
+	if config.UserFilter == "" {
+		config.UserFilter = DefaultUserFilter
+	}
+	if config.Attributes == (AttributeMap{}) {
+		config.Attributes = DefaultAttributeMap
+	}
+	if config.PageSize <= 0 {
+		config.PageSize = DefaultPageSize
+	}
+
+	d := &GormDirectory{
+		db:          db,
+		tableName:   tableName,
+		userManager: userManager,
+		config:      config,
+		now:         time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// AutoMigrate creates or updates the database schema for directory links
+func (d *GormDirectory) AutoMigrate() error {
+	return d.db.Table(d.tableName).AutoMigrate(&GormDirectoryLinkModel{})
+}
+
+// connect opens a connection bound as the service account
+func (d *GormDirectory) connect() (*Conn, error) {
+	conn, err := Dial(d.config.URL, d.config.TLSConfig, d.config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.config.StartTLS {
+		if err := conn.StartTLS(d.config.TLSConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if d.config.BindDN != "" {
+		if err := conn.Bind(d.config.BindDN, d.config.BindPassword); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// searchRequest returns a subtree search for users matching the filter
+func (d *GormDirectory) searchRequest(filter string) *SearchRequest {
+	attributes := []string{}
+	for _, attribute := range []string{
+		d.config.Attributes.Username,
+		d.config.Attributes.Email,
+		d.config.Attributes.Name,
+		d.config.Attributes.Phone,
+		d.config.Attributes.UniqueID,
+	} {
+		if attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+
+	return &SearchRequest{
+		BaseDN:     d.config.BaseDN,
+		Scope:      ScopeWholeSubtree,
+		Filter:     filter,
+		Attributes: attributes,
+	}
+}
+
+// Authenticate verifies a username and password by binding as the user's
+// entry, then creates or updates the local user from the entry
+func (d *GormDirectory) Authenticate(username, password string) (*userion.User, error) {
+	// An empty password would be accepted as an anonymous bind
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	request := d.searchRequest("(&" + d.config.UserFilter + "(" + d.config.Attributes.Username + "=" + EscapeFilter(username) + "))")
+	request.SizeLimit = 2
+	entries, err := conn.Search(request)
+	var ldapErr *Error
+	if errors.As(err, &ldapErr) && ldapErr.ResultCode == ResultSizeLimitExceeded {
+		return nil, ErrAmbiguousEntry
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrInvalidCredentials
+	}
+	if len(entries) > 1 {
+		return nil, ErrAmbiguousEntry
+	}
+
+	if err := conn.Bind(entries[0].DN, password); err != nil {
+		if errors.As(err, &ldapErr) && ldapErr.ResultCode == ResultInvalidCredentials {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	user, _, err := d.upsert(entries[0])
+	if err != nil {
+		return nil, err
+	}
+	if !user.Enabled {
+		return nil, userion.ErrUserDisabled
+	}
+
+	if d.mfaChecker != nil {
+		enabled, err := d.mfaChecker.MFAEnabled(user.ID.String())
+		if err != nil {
+			return nil, err
+		}
+		if enabled {
+			return nil, userion.ErrMFARequired
+		}
+	}
+
+	return user, nil
+}
+
+// Sync creates and updates users from every entry matching the user filter
+// and disables synced users whose entry is gone. Users are enabled again if
+// their entry comes back. Entries that cannot be synced are reported in the
+// result without stopping the sync.
+func (d *GormDirectory) Sync() (*SyncResult, error) {
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	request := d.searchRequest(d.config.UserFilter)
+	request.PageSize = d.config.PageSize
+	entries, err := conn.Search(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []GormDirectoryLinkModel
+	if err := d.db.Table(d.tableName).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	// Disabling every user because of a wrong base DN or filter would lock everyone out
+	if len(entries) == 0 && len(links) > 0 {
+		return nil, ErrEmptyDirectory
+	}
+
+	result := &SyncResult{}
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if uniqueID := d.uniqueID(entry); uniqueID != "" {
+			seen[uniqueID] = true
+		}
+
+		_, outcome, err := d.upsert(entry)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %w", entry.DN, err))
+			continue
+		}
+		switch outcome {
+		case outcomeCreated:
+			result.Created++
+		case outcomeUpdated:
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	}
+
+	for _, link := range links {
+		if seen[link.UniqueID] || link.DisabledAt != nil {
+			continue
+		}
+
+		err := d.userManager.DisableUserByID(link.UserID.String())
+		if errors.Is(err, userion.ErrUserNotFound) {
+			if err := d.db.Table(d.tableName).Where("id = ?", link.ID).Delete(&GormDirectoryLinkModel{}).Error; err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %w", link.DN, err))
+			continue
+		}
+
+		if err := d.db.Table(d.tableName).Where("id = ?", link.ID).Update("disabled_at", d.now()).Error; err != nil {
+			return nil, err
+		}
+		result.Disabled++
+	}
+
+	return result, nil
+}
+
+// RunSync syncs immediately and then at every interval until the context is
+// done. Each outcome is passed to report, which may be nil.
+func (d *GormDirectory) RunSync(ctx context.Context, interval time.Duration, report func(*SyncResult, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := d.Sync()
+		if report != nil {
+			report(result, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HasLoginMethod reports whether the user can sign in with the directory
+func (d *GormDirectory) HasLoginMethod(userID string) (bool, error) {
+	var count int64
+	if err := d.db.Table(d.tableName).Where("user_id = ? AND disabled_at IS NULL", userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Outcomes of syncing a single entry
+const (
+	outcomeUnchanged = iota
+	outcomeCreated
+	outcomeUpdated
+)
+
+// uniqueID returns the stable identifier of an entry. Binary values such as
+// objectGUID are hex encoded. Without a unique ID attribute the DN is used,
+// so renamed entries are treated as new ones.
+func (d *GormDirectory) uniqueID(entry *Entry) string {
+	if d.config.Attributes.UniqueID == "" {
+		return entry.DN
+	}
+	value := entry.Value(d.config.Attributes.UniqueID)
+	if !utf8.ValidString(value) {
+		return hex.EncodeToString([]byte(value))
+	}
+	return value
+}
+
+// upsert creates or updates the user of an entry
+func (d *GormDirectory) upsert(entry *Entry) (*userion.User, int, error) {
+	uniqueID := d.uniqueID(entry)
+	username := entry.Value(d.config.Attributes.Username)
+	email := entry.Value(d.config.Attributes.Email)
+	if uniqueID == "" || username == "" || email == "" {
+		return nil, 0, ErrMissingAttribute
+	}
+
+	var link GormDirectoryLinkModel
+	err := d.db.Table(d.tableName).Where("unique_id = ?", uniqueID).First(&link).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, err
+	}
+
+	var user *userion.User
+	if err == nil {
+		user, err = d.userManager.GetUserByID(link.UserID.String())
+		if errors.Is(err, userion.ErrUserNotFound) {
+			// The user was deleted locally; sync the entry as a new one
+			if err := d.db.Table(d.tableName).Where("id = ?", link.ID).Delete(&GormDirectoryLinkModel{}).Error; err != nil {
+				return nil, 0, err
+			}
+			link = GormDirectoryLinkModel{}
+		} else if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	outcome := outcomeUnchanged
+	if user == nil {
+		user, err = d.matchExistingUser(username, email)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if user == nil {
+			user, err = d.createUser(entry, username, email)
+			if err != nil {
+				return nil, 0, err
+			}
+			outcome = outcomeCreated
+		} else {
+			outcome = outcomeUpdated
+		}
+
+		link = GormDirectoryLinkModel{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			UniqueID:  uniqueID,
+			DN:        entry.DN,
+			SyncedAt:  d.now(),
+			CreatedAt: d.now(),
+		}
+		if err := d.db.Table(d.tableName).Create(&link).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+
+	changed, err := d.updateUser(user, entry, username, email)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if link.DisabledAt != nil {
+		if err := d.userManager.EnableUserByID(user.ID.String()); err != nil {
+			return nil, 0, err
+		}
+		user.Enabled = true
+		changed = true
+	}
+
+	err = d.db.Table(d.tableName).Where("id = ?", link.ID).Updates(map[string]interface{}{
+		"dn":          entry.DN,
+		"synced_at":   d.now(),
+		"disabled_at": nil,
+	}).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if changed && outcome == outcomeUnchanged {
+		outcome = outcomeUpdated
+	}
+	return user, outcome, nil
+}
+
+// matchExistingUser returns the unlinked local user with the username or
+// email of an entry, if linking is allowed
+func (d *GormDirectory) matchExistingUser(username, email string) (*userion.User, error) {
+	user, err := d.userManager.GetUserByUsername(username)
+	if errors.Is(err, userion.ErrUserNotFound) {
+		user, err = d.userManager.GetUserByEmail(email)
+	}
+	if errors.Is(err, userion.ErrUserNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !d.linkExistingUsers {
+		return nil, ErrUserConflict
+	}
+
+	var count int64
+	if err := d.db.Table(d.tableName).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrUserConflict
+	}
+	return user, nil
+}
+
+// createUser provisions a user for an entry. The password is unusable since
+// the directory verifies it.
+func (d *GormDirectory) createUser(entry *Entry, username, email string) (*userion.User, error) {
+	name := entry.Value(d.config.Attributes.Name)
+	if name == "" {
+		name = username
+	}
+
+	// The directory is the authority for the addresses it holds
+	verifiedAt := d.now()
+	user := &userion.User{
+		Name:            name,
+		Username:        username,
+		Email:           email,
+		Phone:           entry.Value(d.config.Attributes.Phone),
+		Password:        userion.UnusablePassword,
+		Enabled:         true,
+		Status:          userion.UserStatusActive,
+		EmailVerifiedAt: &verifiedAt,
+	}
+	if err := d.userManager.CreateUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// updateUser copies changed attributes of an entry to its user
+func (d *GormDirectory) updateUser(user *userion.User, entry *Entry, username, email string) (bool, error) {
+	changes := map[string]interface{}{}
+
+	if username != user.Username {
+		if _, err := d.userManager.GetUserByUsername(username); err == nil {
+			return false, ErrUserConflict
+		} else if !errors.Is(err, userion.ErrUserNotFound) {
+			return false, err
+		}
+		changes["Username"] = username
+	}
+	if email != user.Email {
+		if _, err := d.userManager.GetUserByEmail(email); err == nil {
+			return false, ErrUserConflict
+		} else if !errors.Is(err, userion.ErrUserNotFound) {
+			return false, err
+		}
+		changes["Email"] = email
+		changes["EmailVerifiedAt"] = d.now()
+	}
+	if name := entry.Value(d.config.Attributes.Name); name != "" && name != user.Name {
+		changes["Name"] = name
+	}
+	if phone := entry.Value(d.config.Attributes.Phone); d.config.Attributes.Phone != "" && phone != user.Phone {
+		changes["Phone"] = phone
+		changes["PhoneVerifiedAt"] = nil
+	}
+
+	if len(changes) == 0 {
+		return false, nil
+	}
+	if err := d.userManager.UpdateUserByID(user.ID.String(), changes); err != nil {
+		return false, err
+	}
+
+	updated, err := d.userManager.GetUserByID(user.ID.String())
+	if err != nil {
+		return false, err
+	}
+	*user = *updated
+	return true, nil
+}
@@ -0,0 +1,256 @@
+package ldap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weedbox/userion"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	testBaseDN     = "ou=people,dc=example,dc=com"
+	testServiceDN  = "cn=sync,dc=example,dc=com"
+	testServicePW  = "service-secret"
+	testUserPW     = "directory-secret"
+	testJaneDN     = "uid=jdoe,ou=people,dc=example,dc=com"
+	testJaneUnique = "6f1c9b2e-1a3d-4c5e-8f70-9a1b2c3d4e5f"
+)
+
+// personEntry returns a directory entry for a person
+func personEntry(dn, uniqueID, uid, mail, cn string) *Entry {
+	return &Entry{
+		DN: dn,
+		Attributes: []*Attribute{
+			{Name: "objectClass", Values: []string{"top", "person", "inetOrgPerson"}},
+			{Name: "entryUUID", Values: []string{uniqueID}},
+			{Name: "uid", Values: []string{uid}},
+			{Name: "mail", Values: []string{mail}},
+			{Name: "cn", Values: []string{cn}},
+		},
+	}
+}
+
+// setupDirectoryGorm creates a directory backed by a test server holding a
+// service account and one person
+func setupDirectoryGorm(t *testing.T, opts ...Option) (*GormDirectory, userion.UserManager, *testServer) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to database")
+	t.Cleanup(func() {
+		sqlDB, err := db.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	suffix := uuid.New().String()[:8]
+	userManager := userion.NewGormUserManager(db, "users_test_"+suffix)
+	require.NoError(t, userManager.AutoMigrate(), "Failed to migrate database")
+
+	server := newTestServer(t)
+	server.add(&Entry{DN: testServiceDN}, testServicePW)
+	jane := personEntry(testJaneDN, testJaneUnique, "jdoe", "jane@example.com", "Jane Doe")
+	jane.Attributes = append(jane.Attributes, &Attribute{Name: "mobile", Values: []string{"+15551234567"}})
+	server.add(jane, testUserPW)
+
+	directory := NewGormDirectory(db, "ldap_links_test_"+suffix, userManager, Config{
+		URL:          server.url(),
+		BindDN:       testServiceDN,
+		BindPassword: testServicePW,
+		BaseDN:       testBaseDN,
+		Attributes: AttributeMap{
+			Username: "uid",
+			Email:    "mail",
+			Name:     "cn",
+			Phone:    "mobile",
+			UniqueID: "entryUUID",
+		},
+	}, opts...).(*GormDirectory)
+	require.NoError(t, directory.AutoMigrate(), "Failed to migrate database")
+
+	return directory, userManager, server
+}
+
+// TestAuthenticate_Gorm tests signing in with directory credentials
+func TestAuthenticate_Gorm(t *testing.T) {
+	directory, userManager, _ := setupDirectoryGorm(t)
+
+	_, err := directory.Authenticate("jdoe", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = directory.Authenticate("jdoe", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "Empty passwords must not reach the server as anonymous binds")
+
+	_, err = directory.Authenticate("nobody", testUserPW)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = directory.Authenticate("*", testUserPW)
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "Usernames should be escaped in the filter")
+
+	user, err := directory.Authenticate("jdoe", testUserPW)
+	require.NoError(t, err)
+	assert.Equal(t, "jdoe", user.Username)
+	assert.Equal(t, "jane@example.com", user.Email)
+	assert.Equal(t, "Jane Doe", user.Name)
+	assert.Equal(t, "+15551234567", user.Phone)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.False(t, userion.HasUsablePassword(user), "The directory should verify passwords")
+
+	err = userManager.VerifyPasswordByUsername("jdoe", testUserPW)
+	assert.Error(t, err, "Directory passwords should not be stored locally")
+
+	again, err := directory.Authenticate("jdoe", testUserPW)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID, "The entry should stay linked to the same user")
+
+	ok, err := directory.HasLoginMethod(user.ID.String())
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	require.NoError(t, userManager.DisableUserByID(user.ID.String()))
+	_, err = directory.Authenticate("jdoe", testUserPW)
+	assert.ErrorIs(t, err, userion.ErrUserDisabled, "Users disabled locally should stay disabled")
+}
+
+// TestAuthenticateAmbiguous_Gorm tests usernames matching several entries
+func TestAuthenticateAmbiguous_Gorm(t *testing.T) {
+	directory, _, server := setupDirectoryGorm(t)
+	server.add(personEntry("uid=jdoe,ou=contractors,ou=people,dc=example,dc=com", uuid.New().String(), "jdoe", "jdoe@contractor.com", "John Doe"), testUserPW)
+
+	_, err := directory.Authenticate("jdoe", testUserPW)
+	assert.ErrorIs(t, err, ErrAmbiguousEntry)
+}
+
+// TestAuthenticateConflict_Gorm tests entries matching unlinked local users
+func TestAuthenticateConflict_Gorm(t *testing.T) {
+	directory, userManager, _ := setupDirectoryGorm(t)
+	local := &userion.User{Username: "jdoe", Email: "jdoe@local.test", Password: "password123"}
+	require.NoError(t, userManager.CreateUser(local))
+
+	_, err := directory.Authenticate("jdoe", testUserPW)
+	assert.ErrorIs(t, err, ErrUserConflict)
+
+	directory.linkExistingUsers = true
+	user, err := directory.Authenticate("jdoe", testUserPW)
+	require.NoError(t, err)
+	assert.Equal(t, local.ID, user.ID)
+	assert.Equal(t, "jane@example.com", user.Email, "Linked users should be updated from the entry")
+}
+
+// TestSync_Gorm tests creating, updating and disabling users from the directory
+func TestSync_Gorm(t *testing.T) {
+	directory, userManager, server := setupDirectoryGorm(t)
+	directory.config.PageSize = 2
+	server.add(personEntry("uid=bob,ou=people,dc=example,dc=com", uuid.New().String(), "bob", "bob@example.com", "Bob"), testUserPW)
+	server.add(personEntry("uid=carol,ou=people,dc=example,dc=com", uuid.New().String(), "carol", "carol@example.com", "Carol"), testUserPW)
+	server.add(&Entry{DN: "uid=nomail,ou=people,dc=example,dc=com", Attributes: []*Attribute{
+		{Name: "objectClass", Values: []string{"person"}},
+		{Name: "entryUUID", Values: []string{uuid.New().String()}},
+		{Name: "uid", Values: []string{"nomail"}},
+	}}, "")
+
+	result, err := directory.Sync()
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Created)
+	require.Len(t, result.Errors, 1)
+	assert.ErrorIs(t, result.Errors[0], ErrMissingAttribute)
+
+	result, err = directory.Sync()
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Unchanged)
+
+	// Renames keep the link through the unique ID
+	server.remove(testJaneDN)
+	server.add(personEntry("uid=jsmith,ou=people,dc=example,dc=com", testJaneUnique, "jsmith", "jane.smith@example.com", "Jane Smith"), testUserPW)
+	server.remove("uid=bob,ou=people,dc=example,dc=com")
+
+	result, err = directory.Sync()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Updated)
+	assert.Equal(t, 1, result.Disabled)
+	assert.Equal(t, 1, result.Unchanged)
+
+	jane, err := userManager.GetUserByUsername("jsmith")
+	require.NoError(t, err)
+	assert.Equal(t, "jane.smith@example.com", jane.Email)
+	assert.Equal(t, "Jane Smith", jane.Name)
+
+	bob, err := userManager.GetUserByUsername("bob")
+	require.NoError(t, err)
+	assert.False(t, bob.Enabled, "Users whose entry is gone should be disabled")
+	ok, err := directory.HasLoginMethod(bob.ID.String())
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Returning entries enable their users again
+	var bobLink GormDirectoryLinkModel
+	require.NoError(t, directory.db.Table(directory.tableName).Where("user_id = ?", bob.ID).First(&bobLink).Error)
+	server.add(personEntry("uid=bob,ou=people,dc=example,dc=com", bobLink.UniqueID, "bob", "bob@example.com", "Bob"), testUserPW)
+
+	result, err = directory.Sync()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Updated)
+	bob, err = userManager.GetUserByID(bob.ID.String())
+	require.NoError(t, err)
+	assert.True(t, bob.Enabled)
+}
+
+// TestSyncEmptyDirectory_Gorm tests that an empty search result disables nobody
+func TestSyncEmptyDirectory_Gorm(t *testing.T) {
+	directory, userManager, _ := setupDirectoryGorm(t)
+
+	_, err := directory.Sync()
+	require.NoError(t, err)
+
+	directory.config.UserFilter = "(objectClass=nonexistent)"
+	_, err = directory.Sync()
+	assert.ErrorIs(t, err, ErrEmptyDirectory)
+
+	user, err := userManager.GetUserByUsername("jdoe")
+	require.NoError(t, err)
+	assert.True(t, user.Enabled)
+}
+
+// TestSyncWrongServiceCredentials_Gorm tests that bind failures are reported
+func TestSyncWrongServiceCredentials_Gorm(t *testing.T) {
+	directory, _, _ := setupDirectoryGorm(t)
+	directory.config.BindPassword = "wrong"
+
+	_, err := directory.Sync()
+	var ldapErr *Error
+	require.ErrorAs(t, err, &ldapErr)
+	assert.Equal(t, ResultInvalidCredentials, ldapErr.ResultCode)
+}
+
+// TestRunSync_Gorm tests periodic syncing
+func TestRunSync_Gorm(t *testing.T) {
+	directory, _, server := setupDirectoryGorm(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan *SyncResult, 10)
+	done := make(chan struct{})
+	go func() {
+		directory.RunSync(ctx, 10*time.Millisecond, func(result *SyncResult, err error) {
+			if err == nil {
+				results <- result
+			}
+		})
+		close(done)
+	}()
+
+	first := <-results
+	assert.Equal(t, 1, first.Created)
+	second := <-results
+	assert.Equal(t, 1, second.Unchanged)
+	cancel()
+	<-done
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.GreaterOrEqual(t, server.searches, 2)
+}
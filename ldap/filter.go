@@ -0,0 +1,382 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidFilter is returned for search filters that cannot be parsed
+var ErrInvalidFilter = errors.New("ldap: invalid search filter")
+
+// Filter choice tags (RFC 4511 section 4.5.1.7)
+const (
+	filterAnd            = 0
+	filterOr             = 1
+	filterNot            = 2
+	filterEquality       = 3
+	filterSubstrings     = 4
+	filterGreaterOrEqual = 5
+	filterLessOrEqual    = 6
+	filterPresent        = 7
+	filterApprox         = 8
+	filterExtensible     = 9
+)
+
+// Substring choice tags
+const (
+	substringInitial = 0
+	substringAny     = 1
+	substringFinal   = 2
+)
+
+// EscapeFilter escapes a value for use in a search filter (RFC 4515
+// section 3). Values taken from user input must always be escaped.
+func EscapeFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\', '*', '(', ')', 0:
+			b.WriteByte('\\')
+			b.WriteByte("0123456789abcdef"[c>>4])
+			b.WriteByte("0123456789abcdef"[c&0x0f])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// compileFilter converts the string representation of a filter to its BER encoding
+func compileFilter(filter string) (*berPacket, error) {
+	p := &filterParser{input: filter}
+	packet, err := p.filter(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.offset != len(p.input) {
+		return nil, ErrInvalidFilter
+	}
+	return packet, nil
+}
+
+// filterParser parses the string representation of a filter
+type filterParser struct {
+	input  string
+	offset int
+}
+
+// filter parses "(" filtercomp ")"
+func (p *filterParser) filter(depth int) (*berPacket, error) {
+	if depth > berMaxDepth || !p.consume('(') {
+		return nil, ErrInvalidFilter
+	}
+	if p.offset >= len(p.input) {
+		return nil, ErrInvalidFilter
+	}
+
+	var packet *berPacket
+	var err error
+	switch p.input[p.offset] {
+	case '&':
+		p.offset++
+		packet, err = p.list(filterAnd, depth)
+	case '|':
+		p.offset++
+		packet, err = p.list(filterOr, depth)
+	case '!':
+		p.offset++
+		var inner *berPacket
+		if inner, err = p.filter(depth + 1); err == nil {
+			packet = newConstructed(classContext, filterNot, inner)
+		}
+	default:
+		packet, err = p.item()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.consume(')') {
+		return nil, ErrInvalidFilter
+	}
+	return packet, nil
+}
+
+// list parses the filters of an and or or
+func (p *filterParser) list(tag int, depth int) (*berPacket, error) {
+	packet := newConstructed(classContext, tag)
+	for p.offset < len(p.input) && p.input[p.offset] == '(' {
+		inner, err := p.filter(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		packet.children = append(packet.children, inner)
+	}
+	return packet, nil
+}
+
+// item parses a simple, presence or substring assertion
+func (p *filterParser) item() (*berPacket, error) {
+	end := strings.IndexByte(p.input[p.offset:], ')')
+	if end < 0 {
+		return nil, ErrInvalidFilter
+	}
+	item := p.input[p.offset : p.offset+end]
+	p.offset += end
+
+	equals := strings.IndexByte(item, '=')
+	if equals <= 0 {
+		return nil, ErrInvalidFilter
+	}
+	attribute := item[:equals]
+	value := item[equals+1:]
+
+	tag := filterEquality
+	switch attribute[len(attribute)-1] {
+	case '>':
+		tag = filterGreaterOrEqual
+	case '<':
+		tag = filterLessOrEqual
+	case '~':
+		tag = filterApprox
+	case ':':
+		return extensibleMatch(attribute[:len(attribute)-1], value)
+	}
+	if tag != filterEquality {
+		attribute = attribute[:len(attribute)-1]
+	}
+	if !validAttributeDescription(attribute) {
+		return nil, ErrInvalidFilter
+	}
+
+	if tag == filterEquality && value == "*" {
+		return newPrimitive(classContext, filterPresent, []byte(attribute)), nil
+	}
+
+	if tag == filterEquality && strings.Contains(value, "*") {
+		parts := strings.Split(value, "*")
+		substrings := newSequence()
+		for i, part := range parts {
+			if part == "" {
+				if i == 0 || i == len(parts)-1 {
+					continue
+				}
+				return nil, ErrInvalidFilter
+			}
+			unescaped, err := unescapeFilterValue(part)
+			if err != nil {
+				return nil, err
+			}
+			choice := substringAny
+			if i == 0 {
+				choice = substringInitial
+			} else if i == len(parts)-1 {
+				choice = substringFinal
+			}
+			substrings.children = append(substrings.children, newPrimitive(classContext, choice, []byte(unescaped)))
+		}
+		return newConstructed(classContext, filterSubstrings, newOctetString(attribute), substrings), nil
+	}
+
+	unescaped, err := unescapeFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return newConstructed(classContext, tag, newOctetString(attribute), newOctetString(unescaped)), nil
+}
+
+// extensibleMatch encodes an attr[:dn][:rule]:=value assertion as a
+// MatchingRuleAssertion (RFC 4511 section 4.5.1.7.7)
+func extensibleMatch(description, value string) (*berPacket, error) {
+	parts := strings.Split(description, ":")
+	attribute := parts[0]
+	dnAttributes := false
+	rule := ""
+	for _, part := range parts[1:] {
+		switch {
+		case part == "dn" && !dnAttributes && rule == "":
+			dnAttributes = true
+		case rule == "" && validAttributeDescription(part):
+			rule = part
+		default:
+			return nil, ErrInvalidFilter
+		}
+	}
+	if attribute == "" && rule == "" || attribute != "" && !validAttributeDescription(attribute) {
+		return nil, ErrInvalidFilter
+	}
+
+	unescaped, err := unescapeFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	packet := newConstructed(classContext, filterExtensible)
+	if rule != "" {
+		packet.children = append(packet.children, newPrimitive(classContext, 1, []byte(rule)))
+	}
+	if attribute != "" {
+		packet.children = append(packet.children, newPrimitive(classContext, 2, []byte(attribute)))
+	}
+	packet.children = append(packet.children, newPrimitive(classContext, 3, []byte(unescaped)))
+	if dnAttributes {
+		packet.children = append(packet.children, newPrimitive(classContext, 4, []byte{0xff}))
+	}
+	return packet, nil
+}
+
+// consume advances past the expected byte
+func (p *filterParser) consume(c byte) bool {
+	if p.offset < len(p.input) && p.input[p.offset] == c {
+		p.offset++
+		return true
+	}
+	return false
+}
+
+// validAttributeDescription reports whether s is an attribute name or OID,
+// optionally with options
+func validAttributeDescription(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == ';') {
+			return false
+		}
+	}
+	return true
+}
+
+// unescapeFilterValue decodes the \XX escapes of an assertion value
+func unescapeFilterValue(value string) (string, error) {
+	if !strings.ContainsAny(value, "\\()") {
+		return value, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '(', ')':
+			return "", ErrInvalidFilter
+		case '\\':
+			if i+2 >= len(value) {
+				return "", ErrInvalidFilter
+			}
+			high, okHigh := hexDigit(value[i+1])
+			low, okLow := hexDigit(value[i+2])
+			if !okHigh || !okLow {
+				return "", ErrInvalidFilter
+			}
+			b.WriteByte(high<<4 | low)
+			i += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// hexDigit decodes a hexadecimal digit
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// matchFilter evaluates a compiled filter against an entry. Values are
+// compared case-insensitively, as with the caseIgnoreMatch rule that applies
+// to the attributes of inetOrgPerson. Extensible matches evaluate to false.
+func matchFilter(filter *berPacket, entry *Entry) bool {
+	if filter.class != classContext {
+		return false
+	}
+
+	switch filter.tag {
+	case filterAnd:
+		for _, child := range filter.children {
+			if !matchFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range filter.children {
+			if matchFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return len(filter.children) == 1 && !matchFilter(filter.children[0], entry)
+	case filterPresent:
+		if strings.EqualFold(string(filter.value), "objectClass") {
+			return true
+		}
+		return len(entry.Values(string(filter.value))) > 0
+	case filterEquality, filterApprox, filterGreaterOrEqual, filterLessOrEqual:
+		if len(filter.children) != 2 {
+			return false
+		}
+		name, _ := filter.children[0].str()
+		assertion, _ := filter.children[1].str()
+		assertion = strings.ToLower(assertion)
+		for _, value := range entry.Values(name) {
+			value = strings.ToLower(value)
+			switch {
+			case filter.tag == filterGreaterOrEqual && value >= assertion,
+				filter.tag == filterLessOrEqual && value <= assertion,
+				(filter.tag == filterEquality || filter.tag == filterApprox) && value == assertion:
+				return true
+			}
+		}
+		return false
+	case filterSubstrings:
+		if len(filter.children) != 2 {
+			return false
+		}
+		name, _ := filter.children[0].str()
+		for _, value := range entry.Values(name) {
+			if matchSubstrings(strings.ToLower(value), filter.children[1].children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// matchSubstrings reports whether value matches the initial, any and final
+// components in order
+func matchSubstrings(value string, components []*berPacket) bool {
+	for i, component := range components {
+		substring := strings.ToLower(string(component.value))
+		switch component.tag {
+		case substringInitial:
+			if i != 0 || !strings.HasPrefix(value, substring) {
+				return false
+			}
+			value = value[len(substring):]
+		case substringFinal:
+			if i != len(components)-1 || !strings.HasSuffix(value, substring) {
+				return false
+			}
+			value = value[:len(value)-len(substring)]
+		default:
+			index := strings.Index(value, substring)
+			if index < 0 {
+				return false
+			}
+			value = value[index+len(substring):]
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEscapeFilter tests escaping of assertion values
+func TestEscapeFilter(t *testing.T) {
+	assert.Equal(t, "jdoe", EscapeFilter("jdoe"))
+	assert.Equal(t, `\2a\29\28uid=\2a`, EscapeFilter("*)(uid=*"))
+	assert.Equal(t, `a\5cb\28c\29\00`, EscapeFilter("a\\b(c)\x00"))
+}
+
+// TestCompileFilter tests the BER encoding of filters
+func TestCompileFilter(t *testing.T) {
+	packet, err := compileFilter("(&(objectClass=person)(!(uid=admin))(|(mail=*@example.com)(cn=J*n*e)))")
+	require.NoError(t, err)
+	assert.Equal(t, filterAnd, packet.tag)
+	require.Len(t, packet.children, 3)
+
+	equality := packet.children[0]
+	assert.Equal(t, filterEquality, equality.tag)
+	assert.Equal(t, "objectClass", string(equality.children[0].value))
+	assert.Equal(t, "person", string(equality.children[1].value))
+
+	assert.Equal(t, filterNot, packet.children[1].tag)
+
+	or := packet.children[2]
+	assert.Equal(t, filterOr, or.tag)
+	substrings := or.children[0].children[1].children
+	require.Len(t, substrings, 1)
+	assert.Equal(t, substringFinal, substrings[0].tag)
+	assert.Equal(t, "@example.com", string(substrings[0].value))
+
+	substrings = or.children[1].children[1].children
+	require.Len(t, substrings, 3)
+	assert.Equal(t, []int{substringInitial, substringAny, substringFinal}, []int{substrings[0].tag, substrings[1].tag, substrings[2].tag})
+
+	packet, err = compileFilter("(uid=*)")
+	require.NoError(t, err)
+	assert.Equal(t, filterPresent, packet.tag)
+
+	packet, err = compileFilter("(uid=" + EscapeFilter("*)(uid=*") + ")")
+	require.NoError(t, err)
+	assert.Equal(t, filterEquality, packet.tag, "Escaped values should not change the filter structure")
+	assert.Equal(t, "*)(uid=*", string(packet.children[1].value))
+
+	packet, err = compileFilter("(uidNumber>=1000)")
+	require.NoError(t, err)
+	assert.Equal(t, filterGreaterOrEqual, packet.tag)
+
+	packet, err = compileFilter("(userAccountControl:1.2.840.113556.1.4.803:=2)")
+	require.NoError(t, err)
+	assert.Equal(t, filterExtensible, packet.tag)
+	require.Len(t, packet.children, 3)
+	assert.Equal(t, "1.2.840.113556.1.4.803", string(packet.children[0].value))
+	assert.Equal(t, "userAccountControl", string(packet.children[1].value))
+	assert.Equal(t, "2", string(packet.children[2].value))
+
+	packet, err = compileFilter("(ou:dn:=people)")
+	require.NoError(t, err)
+	require.Len(t, packet.children, 3)
+	assert.Equal(t, 4, packet.children[2].tag, "dnAttributes should be set")
+
+	for _, invalid := range []string{"", "uid=jdoe", "(uid=jdoe", "(uid=jdoe))", "(=jdoe)", "(uid=a\\2)", "(:=jdoe)", "(uid:a:b:=jdoe)", "(uid=a**b)"} {
+		_, err := compileFilter(invalid)
+		assert.ErrorIs(t, err, ErrInvalidFilter, invalid)
+	}
+}
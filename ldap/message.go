@@ -0,0 +1,257 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// protocolVersion is the LDAP version spoken by the client and the server
+const protocolVersion = 3
+
+// Protocol operation tags (RFC 4511 section 4.2 onward)
+const (
+	opBindRequest           = 0
+	opBindResponse          = 1
+	opUnbindRequest         = 2
+	opSearchRequest         = 3
+	opSearchResultEntry     = 4
+	opSearchResultDone      = 5
+	opSearchResultReference = 19
+	opExtendedRequest       = 23
+	opExtendedResponse      = 24
+)
+
+// Result codes (RFC 4511 appendix A)
+const (
+	ResultSuccess                = 0
+	ResultOperationsError        = 1
+	ResultProtocolError          = 2
+	ResultTimeLimitExceeded      = 3
+	ResultSizeLimitExceeded      = 4
+	ResultAuthMethodNotSupported = 7
+	ResultUnavailableCritical    = 12
+	ResultNoSuchObject           = 32
+	ResultInvalidDNSyntax        = 34
+	ResultInvalidCredentials     = 49
+	ResultInsufficientAccess     = 50
+	ResultBusy                   = 51
+	ResultUnavailable            = 52
+	ResultUnwillingToPerform     = 53
+	ResultOther                  = 80
+)
+
+// Search scopes (RFC 4511 section 4.5.1.2)
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+)
+
+// OIDs of the extensions and controls in use
+const (
+	oidStartTLS              = "1.3.6.1.4.1.1466.20037"
+	oidNoticeOfDisconnection = "1.3.6.1.4.1.1466.20036"
+	oidPagedResults          = "1.2.840.113556.1.4.319"
+)
+
+// Error is an unsuccessful result returned by a directory server
+type Error struct {
+	ResultCode int
+	MatchedDN  string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("ldap: result code %d: %s", e.ResultCode, e.Message)
+	}
+	return fmt.Sprintf("ldap: result code %d", e.ResultCode)
+}
+
+// SearchRequest describes a search operation
+type SearchRequest struct {
+	BaseDN     string
+	Scope      int
+	Filter     string   // RFC 4515 string representation, e.g. "(uid=jdoe)"
+	Attributes []string // Attributes to return; all user attributes if empty
+	SizeLimit  int      // Maximum number of entries; 0 for no limit
+	TimeLimit  int      // Maximum seconds the server may spend; 0 for no limit
+	PageSize   int      // Page size for the simple paged results control; 0 disables paging
+}
+
+// Attribute is an attribute of a directory entry with its values
+type Attribute struct {
+	Name   string
+	Values []string
+}
+
+// Entry is a directory entry returned by a search
+type Entry struct {
+	DN         string
+	Attributes []*Attribute
+}
+
+// Values returns the values of an attribute. Attribute names are matched
+// case-insensitively.
+func (e *Entry) Values(name string) []string {
+	for _, attribute := range e.Attributes {
+		if strings.EqualFold(attribute.Name, name) {
+			return attribute.Values
+		}
+	}
+	return nil
+}
+
+// Value returns the first value of an attribute, or "" if it has none
+func (e *Entry) Value(name string) string {
+	values := e.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// newMessage wraps a protocol operation in an LDAPMessage
+func newMessage(id int64, op *berPacket, controls ...*berPacket) *berPacket {
+	message := newSequence(newInteger(classUniversal, tagInteger, id), op)
+	if len(controls) > 0 {
+		message.children = append(message.children, newConstructed(classContext, 0, controls...))
+	}
+	return message
+}
+
+// parseMessage returns the message ID, protocol operation and controls of an LDAPMessage
+func parseMessage(message *berPacket) (int64, *berPacket, []*berPacket, error) {
+	if !message.is(classUniversal, tagSequence) || len(message.children) < 2 {
+		return 0, nil, nil, errInvalidBER
+	}
+	id, err := message.children[0].integer()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	op := message.children[1]
+	if op.class != classApplication {
+		return 0, nil, nil, errInvalidBER
+	}
+
+	var controls []*berPacket
+	if len(message.children) > 2 && message.children[2].is(classContext, 0) {
+		controls = message.children[2].children
+	}
+	return id, op, controls, nil
+}
+
+// newResult returns an LDAPResult with the operation tag (RFC 4511 section 4.1.9)
+func newResult(tag int, resultCode int, matchedDN, message string, extra ...*berPacket) *berPacket {
+	result := newConstructed(classApplication, tag,
+		newInteger(classUniversal, tagEnumerated, int64(resultCode)),
+		newOctetString(matchedDN),
+		newOctetString(message),
+	)
+	result.children = append(result.children, extra...)
+	return result
+}
+
+// parseResult returns the error an LDAPResult reports, or nil on success
+func parseResult(op *berPacket) error {
+	if !op.constructed || len(op.children) < 3 {
+		return errInvalidBER
+	}
+	code, err := op.children[0].integer()
+	if err != nil {
+		return err
+	}
+	if code == ResultSuccess {
+		return nil
+	}
+	matchedDN, _ := op.children[1].str()
+	message, _ := op.children[2].str()
+	return &Error{ResultCode: int(code), MatchedDN: matchedDN, Message: message}
+}
+
+// newControl returns a Control (RFC 4511 section 4.1.11)
+func newControl(oid string, critical bool, value []byte) *berPacket {
+	control := newSequence(newOctetString(oid))
+	if critical {
+		control.children = append(control.children, newBoolean(true))
+	}
+	if value != nil {
+		control.children = append(control.children, newPrimitive(classUniversal, tagOctetString, value))
+	}
+	return control
+}
+
+// findControl returns the value of the control with the OID
+func findControl(controls []*berPacket, oid string) ([]byte, bool) {
+	for _, control := range controls {
+		if len(control.children) == 0 {
+			continue
+		}
+		if controlOID, _ := control.children[0].str(); controlOID != oid {
+			continue
+		}
+		last := control.children[len(control.children)-1]
+		if len(control.children) > 1 && last.is(classUniversal, tagOctetString) {
+			return last.value, true
+		}
+		return nil, true
+	}
+	return nil, false
+}
+
+// newPagedResultsControl returns the simple paged results control (RFC 2696)
+func newPagedResultsControl(size int, cookie []byte) *berPacket {
+	value := newSequence(
+		newInteger(classUniversal, tagInteger, int64(size)),
+		newPrimitive(classUniversal, tagOctetString, cookie),
+	)
+	return newControl(oidPagedResults, false, value.encode())
+}
+
+// parsePagedResultsValue returns the size and cookie of a paged results control value
+func parsePagedResultsValue(value []byte) (int, []byte, error) {
+	packet, _, err := decodePacket(value, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !packet.is(classUniversal, tagSequence) || len(packet.children) != 2 {
+		return 0, nil, errInvalidBER
+	}
+	size, err := packet.children[0].integer()
+	if err != nil {
+		return 0, nil, err
+	}
+	return int(size), packet.children[1].value, nil
+}
+
+// parseEntry decodes a SearchResultEntry (RFC 4511 section 4.5.2)
+func parseEntry(op *berPacket) (*Entry, error) {
+	if len(op.children) != 2 || !op.children[1].constructed {
+		return nil, errInvalidBER
+	}
+	dn, err := op.children[0].str()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{DN: dn}
+	for _, partial := range op.children[1].children {
+		if len(partial.children) != 2 {
+			return nil, errInvalidBER
+		}
+		name, err := partial.children[0].str()
+		if err != nil {
+			return nil, err
+		}
+		attribute := &Attribute{Name: name}
+		for _, value := range partial.children[1].children {
+			s, err := value.str()
+			if err != nil {
+				return nil, err
+			}
+			attribute.Values = append(attribute.Values, s)
+		}
+		entry.Attributes = append(entry.Attributes, attribute)
+	}
+	return entry, nil
+}
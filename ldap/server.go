@@ -0,0 +1,669 @@
+package ldap
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weedbox/userion"
+)
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("ldap: server closed")
+
+// DefaultIdleTimeout is how long the server keeps idle connections open
+const DefaultIdleTimeout = 5 * time.Minute
+
+// scanBatchSize is the number of users listed at a time for searches that
+// cannot use a lookup by uid, mail or telephoneNumber
+const scanBatchSize = 500
+
+// inetOrgPersonClasses are the object classes of user entries
+var inetOrgPersonClasses = []string{"top", "person", "organizationalPerson", "inetOrgPerson"}
+
+// Server is a read-only LDAPv3 server presenting the users of a UserManager
+// as inetOrgPerson entries named uid=<username>,<base DN>
+type Server struct {
+	userManager userion.UserManager
+	baseDN      string
+
+	serviceAccounts map[string]string // Normalized DN to password hash
+	anonymousSearch bool
+	tlsConfig       *tls.Config
+	idleTimeout     time.Duration
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// ServerOption configures optional behaviour of a Server
+type ServerOption func(*Server)
+
+// WithServiceAccount adds an account that may bind and search without being
+// a user, as appliances commonly do before binding as the signing-in user
+func WithServiceAccount(dn, password string) ServerOption {
+	return func(s *Server) {
+		s.serviceAccounts[normalizeDN(dn)] = userion.HashToken(password)
+	}
+}
+
+// WithAnonymousSearch allows searches without binding first
+func WithAnonymousSearch(allow bool) ServerOption {
+	return func(s *Server) {
+		s.anonymousSearch = allow
+	}
+}
+
+// WithServerTLSConfig enables the StartTLS extended operation
+func WithServerTLSConfig(config *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
+
+// WithIdleTimeout sets how long idle connections are kept open
+func WithIdleTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
+}
+
+// NewServer initializes a Server presenting the users of userManager below baseDN
+func NewServer(userManager userion.UserManager, baseDN string, opts ...ServerOption) *Server {
+	s := &Server{
+		userManager:     userManager,
+		baseDN:          baseDN,
+		serviceAccounts: map[string]string{},
+		idleTimeout:     DefaultIdleTimeout,
+		listeners:       map[net.Listener]struct{}{},
+		conns:           map[net.Conn]struct{}{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ListenAndServe listens on the TCP address and serves connections. Wrap the
+// listener with tls.NewListener and use Serve for ldaps://.
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on the listener until Close is called
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+		return ErrServerClosed
+	}
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, listener)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go s.serve(conn)
+	}
+}
+
+// Close stops the listeners and closes open connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// session is the state of a connection
+type session struct {
+	conn          net.Conn
+	authenticated bool // Bound as a user or service account
+	tls           bool
+}
+
+// serve handles the requests of a connection one at a time
+func (s *Server) serve(conn net.Conn) {
+	sess := &session{conn: conn}
+	_, sess.tls = conn.(*tls.Conn)
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		sess.conn.Close()
+	}()
+
+	for {
+		if err := sess.conn.SetReadDeadline(time.Now().Add(s.idleTimeout)); err != nil {
+			return
+		}
+		packet, err := readPacket(sess.conn)
+		if err != nil {
+			return
+		}
+
+		id, op, controls, err := parseMessage(packet)
+		if err != nil || id <= 0 {
+			// A malformed message ends the session (RFC 4511 section 4.1.1)
+			s.write(sess, noticeOfDisconnection("malformed message"))
+			return
+		}
+
+		var responses []*berPacket
+		switch op.tag {
+		case opBindRequest:
+			responses = append(responses, newMessage(id, s.bind(sess, op)))
+		case opSearchRequest:
+			responses = s.search(sess, id, op, controls)
+		case opUnbindRequest:
+			return
+		case opExtendedRequest:
+			if s.startTLS(sess, id, op) {
+				continue
+			}
+			responses = append(responses, newMessage(id, newResult(opExtendedResponse, ResultProtocolError, "", "unsupported extended operation")))
+		case 16: // AbandonRequest has no response
+			continue
+		case 6, 8, 10, 12, 14:
+			// Modify, add, delete, modify DN and compare are answered with the next tag
+			responses = append(responses, newMessage(id, newResult(op.tag+1, ResultUnwillingToPerform, "", "the directory is read-only")))
+		default:
+			s.write(sess, noticeOfDisconnection("unsupported operation"))
+			return
+		}
+
+		for _, response := range responses {
+			if !s.write(sess, response) {
+				return
+			}
+		}
+	}
+}
+
+// noticeOfDisconnection returns the unsolicited notification sent before
+// the server ends a session (RFC 4511 section 4.4.1)
+func noticeOfDisconnection(message string) *berPacket {
+	name := newPrimitive(classContext, 10, []byte(oidNoticeOfDisconnection))
+	return newMessage(0, newResult(opExtendedResponse, ResultProtocolError, "", message, name))
+}
+
+// write sends a message and reports whether it succeeded
+func (s *Server) write(sess *session, message *berPacket) bool {
+	if err := sess.conn.SetWriteDeadline(time.Now().Add(s.idleTimeout)); err != nil {
+		return false
+	}
+	_, err := sess.conn.Write(message.encode())
+	return err == nil
+}
+
+// startTLS handles the StartTLS extended operation and reports whether the
+// request was one
+func (s *Server) startTLS(sess *session, id int64, op *berPacket) bool {
+	if len(op.children) == 0 || !op.children[0].is(classContext, 0) || string(op.children[0].value) != oidStartTLS {
+		return false
+	}
+
+	name := newPrimitive(classContext, 10, []byte(oidStartTLS))
+	if s.tlsConfig == nil || sess.tls {
+		s.write(sess, newMessage(id, newResult(opExtendedResponse, ResultUnavailable, "", "StartTLS is not available", name)))
+		return true
+	}
+	if !s.write(sess, newMessage(id, newResult(opExtendedResponse, ResultSuccess, "", "", name))) {
+		return true
+	}
+
+	tlsConn := tls.Server(sess.conn, s.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		sess.conn.Close()
+		return true
+	}
+	sess.conn = tlsConn
+	sess.tls = true
+	// Binds made before the upgrade do not carry over (RFC 4513 section 3.1.3)
+	sess.authenticated = false
+	return true
+}
+
+// bind verifies a simple bind against the service accounts or the password
+// of the user named by the DN
+func (s *Server) bind(sess *session, op *berPacket) *berPacket {
+	sess.authenticated = false
+
+	if len(op.children) != 3 {
+		return newResult(opBindResponse, ResultProtocolError, "", "malformed bind request")
+	}
+	if version, err := op.children[0].integer(); err != nil || version != protocolVersion {
+		return newResult(opBindResponse, ResultProtocolError, "", "only LDAPv3 is supported")
+	}
+	dn, _ := op.children[1].str()
+	if !op.children[2].is(classContext, 0) {
+		return newResult(opBindResponse, ResultAuthMethodNotSupported, "", "only simple binds are supported")
+	}
+	password := string(op.children[2].value)
+
+	if dn == "" && password == "" {
+		return newResult(opBindResponse, ResultSuccess, "", "")
+	}
+	if password == "" {
+		return newResult(opBindResponse, ResultUnwillingToPerform, "", "unauthenticated binds are not allowed")
+	}
+
+	if hash, ok := s.serviceAccounts[normalizeDN(dn)]; ok {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(userion.HashToken(password))) != 1 {
+			return newResult(opBindResponse, ResultInvalidCredentials, "", "")
+		}
+		sess.authenticated = true
+		return newResult(opBindResponse, ResultSuccess, "", "")
+	}
+
+	username, ok := s.usernameFromDN(dn)
+	if !ok {
+		return newResult(opBindResponse, ResultInvalidCredentials, "", "")
+	}
+
+	err := s.userManager.VerifyPasswordByUsername(username, password)
+	if err == nil {
+		var user *userion.User
+		if user, err = s.userManager.GetUserByUsername(username); err == nil && (!user.Enabled || user.Status != userion.UserStatusActive) {
+			err = userion.ErrUserDisabled
+		}
+	}
+	switch {
+	case err == nil:
+		sess.authenticated = true
+		return newResult(opBindResponse, ResultSuccess, "", "")
+	case errors.Is(err, userion.ErrPasswordExpired), errors.Is(err, userion.ErrPasswordChangeRequired):
+		return newResult(opBindResponse, ResultInvalidCredentials, "", "password must be changed")
+	case errors.Is(err, userion.ErrInvalidPassword), errors.Is(err, userion.ErrUserNotFound),
+		errors.Is(err, userion.ErrUserDisabled), errors.Is(err, userion.ErrMFARequired):
+		return newResult(opBindResponse, ResultInvalidCredentials, "", "")
+	default:
+		return newResult(opBindResponse, ResultOther, "", "internal error")
+	}
+}
+
+// search answers a search request with the matching user entries
+func (s *Server) search(sess *session, id int64, op *berPacket, controls []*berPacket) []*berPacket {
+	done := func(code int, message string, extra ...*berPacket) *berPacket {
+		return newMessage(id, newResult(opSearchResultDone, code, "", message), extra...)
+	}
+
+	if len(op.children) != 8 {
+		return []*berPacket{done(ResultProtocolError, "malformed search request")}
+	}
+	baseDN, _ := op.children[0].str()
+	scope, _ := op.children[1].integer()
+	sizeLimit, _ := op.children[3].integer()
+	typesOnly, _ := op.children[5].boolean()
+	filter := op.children[6]
+	var requested []string
+	for _, attribute := range op.children[7].children {
+		name, _ := attribute.str()
+		requested = append(requested, name)
+	}
+
+	// The root DSE may be read before binding (RFC 4512 section 5.1)
+	if baseDN == "" && scope == ScopeBaseObject {
+		rootDSE := &Entry{Attributes: []*Attribute{
+			{Name: "objectClass", Values: []string{"top"}},
+			{Name: "namingContexts", Values: []string{s.baseDN}},
+			{Name: "supportedLDAPVersion", Values: []string{"3"}},
+			{Name: "supportedExtension", Values: s.supportedExtensions()},
+			{Name: "supportedControl", Values: []string{oidPagedResults}},
+		}}
+		if !matchFilter(filter, rootDSE) {
+			return []*berPacket{done(ResultSuccess, "")}
+		}
+		return []*berPacket{newMessage(id, encodeEntry(rootDSE, requested, typesOnly)), done(ResultSuccess, "")}
+	}
+
+	if !sess.authenticated && !s.anonymousSearch {
+		return []*berPacket{done(ResultInsufficientAccess, "bind required")}
+	}
+
+	entries, code := s.searchEntries(baseDN, int(scope), filter)
+	if code != ResultSuccess {
+		return []*berPacket{done(code, "")}
+	}
+
+	// Pages are addressed by the offset carried in the cookie
+	var doneControls []*berPacket
+	if value, ok := findControl(controls, oidPagedResults); ok {
+		size, cookie, err := parsePagedResultsValue(value)
+		if err != nil {
+			return []*berPacket{done(ResultProtocolError, "malformed paged results control")}
+		}
+		offset := 0
+		if len(cookie) > 0 {
+			if offset, err = strconv.Atoi(string(cookie)); err != nil || offset < 0 || offset > len(entries) {
+				return []*berPacket{done(ResultProtocolError, "invalid paged results cookie")}
+			}
+		}
+		if size <= 0 {
+			// A size of zero abandons the paged search (RFC 2696 section 3)
+			return []*berPacket{done(ResultSuccess, "", newPagedResultsControl(0, nil))}
+		}
+
+		// Clamped first so huge sizes cannot overflow the end of the page
+		size = min(size, len(entries)-offset)
+		var next []byte
+		end := offset + size
+		if end < len(entries) {
+			next = []byte(strconv.Itoa(end))
+		}
+		entries = entries[offset:end]
+		doneControls = append(doneControls, newPagedResultsControl(0, next))
+	}
+
+	var responses []*berPacket
+	for i, entry := range entries {
+		if sizeLimit > 0 && i >= int(sizeLimit) {
+			return append(responses, done(ResultSizeLimitExceeded, ""))
+		}
+		responses = append(responses, newMessage(id, encodeEntry(entry, requested, typesOnly)))
+	}
+	return append(responses, done(ResultSuccess, "", doneControls...))
+}
+
+// supportedExtensions lists the extended operations the server offers
+func (s *Server) supportedExtensions() []string {
+	if s.tlsConfig == nil {
+		return []string{}
+	}
+	return []string{oidStartTLS}
+}
+
+// searchEntries returns the user entries in scope that match the filter
+func (s *Server) searchEntries(baseDN string, scope int, filter *berPacket) ([]*Entry, int) {
+	base := normalizeDN(baseDN)
+	suffix := normalizeDN(s.baseDN)
+
+	var users []userion.User
+	var err error
+	switch {
+	case base == suffix || strings.HasSuffix(suffix, ","+base):
+		// The container itself is not an entry; only its users are in scope
+		if scope == ScopeBaseObject || scope == ScopeSingleLevel && base != suffix {
+			return nil, ResultSuccess
+		}
+		users, err = s.candidates(filter)
+	default:
+		username, ok := s.usernameFromDN(baseDN)
+		if !ok {
+			return nil, ResultNoSuchObject
+		}
+		user, lookupErr := s.userManager.GetUserByUsername(username)
+		if errors.Is(lookupErr, userion.ErrUserNotFound) {
+			return nil, ResultNoSuchObject
+		}
+		if scope == ScopeSingleLevel {
+			return nil, ResultSuccess
+		}
+		if lookupErr == nil {
+			users = []userion.User{*user}
+		}
+		err = lookupErr
+	}
+	if err != nil {
+		return nil, ResultOther
+	}
+
+	var entries []*Entry
+	for i := range users {
+		entry := s.userEntry(&users[i])
+		if matchFilter(filter, entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, ResultSuccess
+}
+
+// candidates returns the users that may match the filter, looking them up
+// by uid, mail or telephoneNumber when the filter requires one of them. Like
+// the user manager, these lookups are exact rather than case-insensitive.
+func (s *Server) candidates(filter *berPacket) ([]userion.User, error) {
+	if filter.is(classContext, filterAnd) {
+		for _, child := range filter.children {
+			if child.is(classContext, filterEquality) {
+				return s.candidates(child)
+			}
+		}
+	}
+
+	if filter.is(classContext, filterEquality) && len(filter.children) == 2 {
+		name, _ := filter.children[0].str()
+		value, _ := filter.children[1].str()
+
+		var user *userion.User
+		var err error
+		switch strings.ToLower(name) {
+		case "uid":
+			user, err = s.userManager.GetUserByUsername(value)
+		case "mail":
+			user, err = s.userManager.GetUserByEmail(value)
+		case "telephonenumber":
+			return s.userManager.ListUsers(scanBatchSize, 0, map[string]interface{}{"phone": value}, "username", false)
+		default:
+			return s.allUsers()
+		}
+		if errors.Is(err, userion.ErrUserNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []userion.User{*user}, nil
+	}
+
+	return s.allUsers()
+}
+
+// allUsers lists every user in batches
+func (s *Server) allUsers() ([]userion.User, error) {
+	var users []userion.User
+	for offset := 0; ; offset += scanBatchSize {
+		batch, err := s.userManager.ListUsers(scanBatchSize, offset, nil, "username", false)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, batch...)
+		if len(batch) < scanBatchSize {
+			return users, nil
+		}
+	}
+}
+
+// userEntry presents a user as an inetOrgPerson entry
+func (s *Server) userEntry(user *userion.User) *Entry {
+	name := user.Name
+	if name == "" {
+		name = user.Username
+	}
+	// person requires a surname; use the last word of the name
+	fields := strings.Fields(name)
+	surname := name
+	if len(fields) > 0 {
+		surname = fields[len(fields)-1]
+	}
+
+	entry := &Entry{
+		DN: "uid=" + escapeDNValue(user.Username) + "," + s.baseDN,
+		Attributes: []*Attribute{
+			{Name: "objectClass", Values: inetOrgPersonClasses},
+			{Name: "uid", Values: []string{user.Username}},
+			{Name: "cn", Values: []string{name}},
+			{Name: "sn", Values: []string{surname}},
+			{Name: "displayName", Values: []string{name}},
+			{Name: "entryUUID", Values: []string{user.ID.String()}},
+		},
+	}
+	if user.Email != "" {
+		entry.Attributes = append(entry.Attributes, &Attribute{Name: "mail", Values: []string{user.Email}})
+	}
+	if user.Phone != "" {
+		entry.Attributes = append(entry.Attributes, &Attribute{Name: "telephoneNumber", Values: []string{user.Phone}})
+	}
+	return entry
+}
+
+// encodeEntry returns the SearchResultEntry of an entry with the requested
+// attributes: all for none or "*", none for "1.1"
+func encodeEntry(entry *Entry, requested []string, typesOnly bool) *berPacket {
+	all := len(requested) == 0 || containsFold(requested, "*")
+
+	attributes := newSequence()
+	for _, attribute := range entry.Attributes {
+		if !all && !containsFold(requested, attribute.Name) {
+			continue
+		}
+		values := newConstructed(classUniversal, tagSet)
+		if !typesOnly {
+			for _, value := range attribute.Values {
+				values.children = append(values.children, newOctetString(value))
+			}
+		}
+		attributes.children = append(attributes.children, newSequence(newOctetString(attribute.Name), values))
+	}
+	return newConstructed(classApplication, opSearchResultEntry, newOctetString(entry.DN), attributes)
+}
+
+// usernameFromDN returns the username of a DN of the form uid=<username>,<base DN>
+func (s *Server) usernameFromDN(dn string) (string, bool) {
+	rdn, rest, ok := splitRDN(dn)
+	if !ok || normalizeDN(rest) != normalizeDN(s.baseDN) {
+		return "", false
+	}
+	attribute, value, ok := strings.Cut(rdn, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(attribute), "uid") {
+		return "", false
+	}
+	return unescapeDNValue(strings.TrimSpace(value))
+}
+
+// splitRDN splits a DN into its first RDN and the rest, honouring escapes
+func splitRDN(dn string) (string, string, bool) {
+	for i := 0; i < len(dn); i++ {
+		switch dn[i] {
+		case '\\':
+			i++
+		case ',':
+			return dn[:i], dn[i+1:], true
+		case '+':
+			// Multi-valued RDNs never name users
+			return "", "", false
+		}
+	}
+	return "", "", false
+}
+
+// normalizeDN lower-cases a DN and removes spaces around separators so DNs
+// can be compared
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		attribute, value, ok := strings.Cut(part, "=")
+		if ok {
+			part = strings.TrimSpace(attribute) + "=" + strings.TrimSpace(value)
+		}
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
+
+// escapeDNValue escapes an attribute value for use in a DN (RFC 4514 section 2.4)
+func escapeDNValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == ',' || c == '+' || c == '"' || c == '\\' || c == '<' || c == '>' || c == ';' || c == '=',
+			(c == ' ' || c == '#') && i == 0,
+			c == ' ' && i == len(value)-1:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unescapeDNValue decodes the escapes of a DN attribute value
+func unescapeDNValue(value string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 >= len(value) {
+			return "", false
+		}
+		if i+2 < len(value) {
+			if high, ok := hexDigit(value[i+1]); ok {
+				if low, ok := hexDigit(value[i+2]); ok {
+					b.WriteByte(high<<4 | low)
+					i += 2
+					continue
+				}
+			}
+		}
+		b.WriteByte(value[i+1])
+		i++
+	}
+	return b.String(), true
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,310 @@
+package ldap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weedbox/userion"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	testServerBaseDN = "ou=people,dc=example,dc=com"
+	testTestuserDN   = "uid=testuser,ou=people,dc=example,dc=com"
+)
+
+// setupServer serves the users of a new user manager holding testuser and alice
+func setupServer(t *testing.T, opts ...ServerOption) (*Server, userion.UserManager, string) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to database")
+	t.Cleanup(func() {
+		sqlDB, err := db.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	userManager := userion.NewGormUserManager(db, "users_test_"+uuid.New().String()[:8])
+	require.NoError(t, userManager.AutoMigrate(), "Failed to migrate database")
+	require.NoError(t, userManager.CreateUser(&userion.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: "password123",
+		Name:     "Test User",
+		Phone:    "1234567890",
+		Enabled:  true,
+		Status:   userion.UserStatusActive,
+	}))
+	require.NoError(t, userManager.CreateUser(&userion.User{
+		Username: "alice",
+		Email:    "alice@example.org",
+		Password: "password123",
+		Name:     "Alice Liddell",
+		Enabled:  true,
+		Status:   userion.UserStatusActive,
+	}))
+
+	opts = append([]ServerOption{WithServiceAccount("cn=vpn,dc=example,dc=com", testServicePW)}, opts...)
+	server := NewServer(userManager, testServerBaseDN, opts...)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return server, userManager, "ldap://" + listener.Addr().String()
+}
+
+// dialServer connects to a test server
+func dialServer(t *testing.T, url string) *Conn {
+	conn, err := Dial(url, nil, time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// requireResultCode asserts that err is an LDAP result with the code
+func requireResultCode(t *testing.T, err error, code int) {
+	var ldapErr *Error
+	require.ErrorAs(t, err, &ldapErr)
+	assert.Equal(t, code, ldapErr.ResultCode)
+}
+
+// TestServerBind tests simple binds of users and service accounts
+func TestServerBind(t *testing.T) {
+	_, userManager, url := setupServer(t)
+	conn := dialServer(t, url)
+
+	require.NoError(t, conn.Bind(testTestuserDN, "password123"))
+	require.NoError(t, conn.Bind("UID=testuser, OU=People, DC=example, DC=com", "password123"), "DNs should be compared case-insensitively")
+	require.NoError(t, conn.Bind("cn=vpn,dc=example,dc=com", testServicePW))
+	require.NoError(t, conn.Bind("", ""), "Anonymous binds should be accepted")
+
+	requireResultCode(t, conn.Bind(testTestuserDN, "wrong"), ResultInvalidCredentials)
+	requireResultCode(t, conn.Bind("uid=nobody,ou=people,dc=example,dc=com", "password123"), ResultInvalidCredentials)
+	requireResultCode(t, conn.Bind("uid=testuser,ou=other,dc=example,dc=com", "password123"), ResultInvalidCredentials)
+	requireResultCode(t, conn.Bind("cn=vpn,dc=example,dc=com", "wrong"), ResultInvalidCredentials)
+
+	user, err := userManager.GetUserByUsername("testuser")
+	require.NoError(t, err)
+	require.NoError(t, userManager.DisableUserByID(user.ID.String()))
+	requireResultCode(t, conn.Bind(testTestuserDN, "password123"), ResultInvalidCredentials)
+}
+
+// TestServerSearch tests searches for users
+func TestServerSearch(t *testing.T) {
+	_, _, url := setupServer(t)
+	conn := dialServer(t, url)
+
+	search := func(filter string, attributes ...string) []*Entry {
+		entries, err := conn.Search(&SearchRequest{BaseDN: "dc=example,dc=com", Scope: ScopeWholeSubtree, Filter: filter, Attributes: attributes})
+		require.NoError(t, err)
+		return entries
+	}
+
+	_, err := conn.Search(&SearchRequest{BaseDN: testServerBaseDN, Scope: ScopeWholeSubtree, Filter: "(uid=testuser)"})
+	requireResultCode(t, err, ResultInsufficientAccess)
+
+	require.NoError(t, conn.Bind("cn=vpn,dc=example,dc=com", testServicePW))
+
+	entries := search("(uid=testuser)")
+	require.Len(t, entries, 1)
+	entry := entries[0]
+	assert.Equal(t, testTestuserDN, entry.DN)
+	assert.Equal(t, []string{"top", "person", "organizationalPerson", "inetOrgPerson"}, entry.Values("objectClass"))
+	assert.Equal(t, "test@example.com", entry.Value("mail"))
+	assert.Equal(t, "Test User", entry.Value("cn"))
+	assert.Equal(t, "User", entry.Value("sn"))
+	assert.Equal(t, "1234567890", entry.Value("telephoneNumber"))
+	assert.NotEmpty(t, entry.Value("entryUUID"))
+
+	assert.Len(t, search("(mail=alice@example.org)"), 1)
+	assert.Len(t, search("(cn=ALICE liddell)"), 1, "Values should match case-insensitively")
+	assert.Len(t, search("(telephoneNumber=1234567890)"), 1)
+	assert.Len(t, search("(uid=nobody)"), 0)
+	assert.Len(t, search("(objectClass=inetOrgPerson)"), 2)
+	assert.Len(t, search("(uid=a*)"), 1)
+	assert.Len(t, search("(&(objectClass=person)(mail=*@example.com))"), 1)
+	assert.Len(t, search("(|(uid=alice)(uid=testuser))"), 2)
+	assert.Len(t, search("(!(uid=alice))"), 1)
+	assert.Len(t, search("(&(uid=alice)(mail=test@example.com))"), 0)
+
+	entries = search("(uid=alice)", "mail")
+	require.Len(t, entries, 1)
+	assert.Len(t, entries[0].Attributes, 1, "Only requested attributes should be returned")
+	assert.Equal(t, "alice@example.org", entries[0].Value("mail"))
+
+	entries, err = conn.Search(&SearchRequest{BaseDN: testTestuserDN, Scope: ScopeBaseObject})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "testuser", entries[0].Value("uid"))
+
+	_, err = conn.Search(&SearchRequest{BaseDN: "uid=nobody,ou=people,dc=example,dc=com", Scope: ScopeBaseObject})
+	requireResultCode(t, err, ResultNoSuchObject)
+	_, err = conn.Search(&SearchRequest{BaseDN: "ou=groups,dc=example,dc=com", Scope: ScopeWholeSubtree})
+	requireResultCode(t, err, ResultNoSuchObject)
+
+	_, err = conn.Search(&SearchRequest{BaseDN: testServerBaseDN, Scope: ScopeWholeSubtree, SizeLimit: 1})
+	requireResultCode(t, err, ResultSizeLimitExceeded)
+
+	entries, err = conn.Search(&SearchRequest{BaseDN: testServerBaseDN, Scope: ScopeWholeSubtree, PageSize: 1})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "All pages should be returned")
+}
+
+// TestServerPagedResultsBounds tests that page sizes past the end of the
+// results cannot overflow the page bounds
+func TestServerPagedResultsBounds(t *testing.T) {
+	_, _, url := setupServer(t)
+	conn := dialServer(t, url)
+	require.NoError(t, conn.Bind("cn=vpn,dc=example,dc=com", testServicePW))
+
+	compiled, err := compileFilter("(objectClass=*)")
+	require.NoError(t, err)
+	op := newConstructed(classApplication, opSearchRequest,
+		newOctetString(testServerBaseDN),
+		newInteger(classUniversal, tagEnumerated, ScopeWholeSubtree),
+		newInteger(classUniversal, tagEnumerated, 0),
+		newInteger(classUniversal, tagInteger, 0),
+		newInteger(classUniversal, tagInteger, 0),
+		newBoolean(false),
+		compiled,
+		newSequence(),
+	)
+
+	id, err := conn.send(op, newPagedResultsControl(math.MaxInt, []byte("1")))
+	require.NoError(t, err)
+	entries := 0
+	for {
+		response, controls, err := conn.receive(id)
+		require.NoError(t, err)
+		if response.is(classApplication, opSearchResultEntry) {
+			entries++
+			continue
+		}
+		require.True(t, response.is(classApplication, opSearchResultDone))
+		require.NoError(t, parseResult(response))
+		value, ok := findControl(controls, oidPagedResults)
+		require.True(t, ok)
+		_, cookie, err := parsePagedResultsValue(value)
+		require.NoError(t, err)
+		assert.Empty(t, cookie, "The last page should end the search")
+		break
+	}
+	assert.Equal(t, 1, entries, "Only the entries after the cookie should be returned")
+
+	_, err = conn.Search(&SearchRequest{BaseDN: testServerBaseDN, Scope: ScopeWholeSubtree})
+	require.NoError(t, err, "The server should keep serving")
+}
+
+// TestServerRootDSE tests reading the root DSE before binding
+func TestServerRootDSE(t *testing.T) {
+	_, _, url := setupServer(t)
+	conn := dialServer(t, url)
+
+	entries, err := conn.Search(&SearchRequest{Scope: ScopeBaseObject, Attributes: []string{"namingContexts", "supportedLDAPVersion"}})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, testServerBaseDN, entries[0].Value("namingContexts"))
+	assert.Equal(t, "3", entries[0].Value("supportedLDAPVersion"))
+}
+
+// TestServerAnonymousSearch tests the option allowing searches without a bind
+func TestServerAnonymousSearch(t *testing.T) {
+	_, _, url := setupServer(t, WithAnonymousSearch(true))
+	conn := dialServer(t, url)
+
+	entries, err := conn.Search(&SearchRequest{BaseDN: testServerBaseDN, Scope: ScopeWholeSubtree, Filter: "(uid=alice)"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// TestServerReadOnly tests that updates are refused
+func TestServerReadOnly(t *testing.T) {
+	_, _, url := setupServer(t)
+	conn := dialServer(t, url)
+
+	// DelRequest [APPLICATION 10]
+	id, err := conn.send(newPrimitive(classApplication, 10, []byte(testTestuserDN)))
+	require.NoError(t, err)
+	response, _, err := conn.receive(id)
+	require.NoError(t, err)
+	assert.True(t, response.is(classApplication, 11))
+	requireResultCode(t, parseResult(response), ResultUnwillingToPerform)
+
+	requireResultCode(t, conn.StartTLS(nil), ResultUnavailable)
+}
+
+// TestServerStartTLS tests upgrading a connection with StartTLS
+func TestServerStartTLS(t *testing.T) {
+	certificate, pool := newTestCertificate(t)
+	_, _, url := setupServer(t, WithServerTLSConfig(&tls.Config{Certificates: []tls.Certificate{certificate}}))
+	conn := dialServer(t, url)
+
+	require.NoError(t, conn.StartTLS(&tls.Config{RootCAs: pool, ServerName: "localhost"}))
+	require.NoError(t, conn.Bind(testTestuserDN, "password123"))
+
+	plain := dialServer(t, url)
+	require.NoError(t, plain.Bind(testTestuserDN, "password123"))
+	assert.Error(t, plain.StartTLS(&tls.Config{RootCAs: pool, ServerName: "other"}), "Certificates for other names should be rejected")
+}
+
+// TestDirectoryAgainstServer tests the directory backend against the server
+func TestDirectoryAgainstServer(t *testing.T) {
+	_, _, url := setupServer(t)
+	directory, _, _ := setupDirectoryGorm(t)
+	directory.config.URL = url
+	directory.config.BindDN = "cn=vpn,dc=example,dc=com"
+	directory.config.BaseDN = testServerBaseDN
+	directory.config.UserFilter = "(objectClass=inetOrgPerson)"
+
+	user, err := directory.Authenticate("alice", "password123")
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.org", user.Email)
+	assert.Equal(t, "Alice Liddell", user.Name)
+
+	result, err := directory.Sync()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 1, result.Unchanged)
+}
+
+// newTestCertificate returns a self-signed certificate for localhost
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
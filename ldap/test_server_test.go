@@ -0,0 +1,183 @@
+package ldap
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testServer is an in-process directory server for tests. It supports simple
+// binds, subtree searches with paging and size limits, and unbind.
+type testServer struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	entries   []*Entry
+	passwords map[string]string
+	searches  int
+}
+
+// newTestServer starts a test server that is stopped when the test ends
+func newTestServer(t *testing.T) *testServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServer{listener: listener, passwords: map[string]string{}}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// url returns the ldap:// URL of the server
+func (s *testServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// add adds an entry with a password; an empty password disables binding
+func (s *testServer) add(entry *Entry, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+	if password != "" {
+		s.passwords[strings.ToLower(entry.DN)] = password
+	}
+}
+
+// remove deletes the entry with the DN
+func (s *testServer) remove(dn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, entry := range s.entries {
+		if strings.EqualFold(entry.DN, dn) {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// serve handles the requests of a connection
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+		id, op, controls, err := parseMessage(packet)
+		if err != nil {
+			return
+		}
+
+		var responses []*berPacket
+		switch op.tag {
+		case opBindRequest:
+			responses = append(responses, newMessage(id, s.bind(op)))
+		case opSearchRequest:
+			responses = s.search(id, op, controls)
+		case opUnbindRequest:
+			return
+		default:
+			responses = append(responses, newMessage(id, newResult(opExtendedResponse, ResultProtocolError, "", "unsupported operation")))
+		}
+
+		for _, response := range responses {
+			if _, err := conn.Write(response.encode()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind checks the password of a simple bind
+func (s *testServer) bind(op *berPacket) *berPacket {
+	dn, _ := op.children[1].str()
+	password, _ := op.children[2].str()
+
+	s.mu.Lock()
+	expected, ok := s.passwords[strings.ToLower(dn)]
+	s.mu.Unlock()
+
+	if dn == "" && password == "" {
+		return newResult(opBindResponse, ResultSuccess, "", "")
+	}
+	if !ok || expected != password {
+		return newResult(opBindResponse, ResultInvalidCredentials, "", "")
+	}
+	return newResult(opBindResponse, ResultSuccess, "", "")
+}
+
+// search returns the entries below the base DN matching the filter
+func (s *testServer) search(id int64, op *berPacket, controls []*berPacket) []*berPacket {
+	baseDN, _ := op.children[0].str()
+	sizeLimit, _ := op.children[3].integer()
+	filter := op.children[6]
+
+	var requested []string
+	for _, attribute := range op.children[7].children {
+		name, _ := attribute.str()
+		requested = append(requested, name)
+	}
+
+	s.mu.Lock()
+	s.searches++
+	var matches []*Entry
+	for _, entry := range s.entries {
+		if strings.HasSuffix(strings.ToLower(entry.DN), strings.ToLower(baseDN)) && matchFilter(filter, entry) {
+			matches = append(matches, entry)
+		}
+	}
+	s.mu.Unlock()
+
+	if sizeLimit > 0 && len(matches) > int(sizeLimit) {
+		return []*berPacket{newMessage(id, newResult(opSearchResultDone, ResultSizeLimitExceeded, "", ""))}
+	}
+
+	// Pages are addressed by the offset carried in the cookie
+	var doneControls []*berPacket
+	if value, ok := findControl(controls, oidPagedResults); ok {
+		size, cookie, _ := parsePagedResultsValue(value)
+		offset := 0
+		if len(cookie) > 0 {
+			offset = int(cookie[0])
+		}
+		end := offset + size
+		var next []byte
+		if end < len(matches) {
+			next = []byte{byte(end)}
+		} else {
+			end = len(matches)
+		}
+		matches = matches[offset:end]
+		doneControls = append(doneControls, newPagedResultsControl(0, next))
+	}
+
+	var responses []*berPacket
+	for _, entry := range matches {
+		attributes := newSequence()
+		for _, attribute := range entry.Attributes {
+			if len(requested) > 0 && !containsFold(requested, attribute.Name) {
+				continue
+			}
+			values := newConstructed(classUniversal, tagSet)
+			for _, value := range attribute.Values {
+				values.children = append(values.children, newOctetString(value))
+			}
+			attributes.children = append(attributes.children, newSequence(newOctetString(attribute.Name), values))
+		}
+		responses = append(responses, newMessage(id, newConstructed(classApplication, opSearchResultEntry, newOctetString(entry.DN), attributes)))
+	}
+	return append(responses, newMessage(id, newResult(opSearchResultDone, ResultSuccess, "", ""), doneControls...))
+}
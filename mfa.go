@@ -0,0 +1,43 @@
+package userion
+
+import (
+	"errors"
+)
+
+// Common errors returned by the TOTPManager
+var (
+	ErrMFANotEnrolled     = errors.New("multi-factor authentication not enrolled")
+	ErrMFAAlreadyEnrolled = errors.New("multi-factor authentication already enrolled")
+)
+
+// MFAChecker reports whether a user has to pass a second factor after the
+// password. Register one with WithMFAChecker.
+type MFAChecker interface {
+	MFAEnabled(userID string) (bool, error)
+}
+
+// PasswordChangeChecker is implemented by user managers that report
+// ErrMFARequired before telling whether a password has to be changed
+type PasswordChangeChecker interface {
+	// CheckPasswordChangeByID returns ErrPasswordChangeRequired or
+	// ErrPasswordExpired if the user has to change their password. Call it
+	// once the second factor has passed.
+	CheckPasswordChangeByID(id string) error
+}
+
+// TOTPEnrollment is returned when a user starts enrolling an authenticator app
+type TOTPEnrollment struct {
+	Secret string `json:"secret"` // Base32 secret for manual entry
+	URI    string `json:"uri"`    // otpauth:// URI to render as a QR code
+}
+
+// TOTPManager defines the interface for time-based one-time password (RFC 6238) second factors
+type TOTPManager interface {
+	MFAChecker
+
+	AutoMigrate() error
+	BeginTOTPEnrollment(userID, accountName string) (*TOTPEnrollment, error)
+	ConfirmTOTPEnrollment(userID, code string) error
+	VerifyTOTP(userID, code string) error
+	DisableTOTP(userID string) error
+}
@@ -0,0 +1,304 @@
+package userion
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Common errors returned by the OIDCClient
+var (
+	ErrInvalidState   = errors.New("invalid or expired state")
+	ErrInvalidIDToken = errors.New("invalid ID token")
+)
+
+// DefaultOIDCScopes are requested when OIDCProviderConfig.Scopes is empty
+var DefaultOIDCScopes = []string{"openid", "email", "profile"}
+
+// OIDCError is an error response of an OpenID Connect provider
+type OIDCError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OIDCError) Error() string {
+	if e.Description != "" {
+		return "oidc: " + e.Code + ": " + e.Description
+	}
+	return "oidc: " + e.Code
+}
+
+// OIDCProviderConfig describes an OpenID Connect provider and the client
+// registered with it. Endpoints left empty are discovered from the issuer.
+type OIDCProviderConfig struct {
+	Name         string // Provider name of linked ExternalIdentity records, e.g. "google"
+	Issuer       string
+	ClientID     string
+	ClientSecret string // Empty for public clients, which rely on PKCE alone
+	RedirectURL  string
+	Scopes       []string
+
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	UserInfoEndpoint      string
+	JWKSURI               string
+}
+
+// OIDCClient defines the interface for signing users in with an OpenID
+// Connect provider using the authorization code flow with PKCE.
+//
+// AuthorizationURL also returns a binding value that ties the sign-in to the
+// browser that started it. Keep it in a cookie and pass it to HandleCallback,
+// which rejects callbacks from any other browser, so that a callback URL
+// obtained by someone else cannot sign a victim in to their account.
+type OIDCClient interface {
+	AutoMigrate() error
+	AuthorizationURL(ctx context.Context) (authorizationURL, binding string, err error)
+	HandleCallback(ctx context.Context, binding, state, code string) (*User, error)
+}
+
+// oidcDiscovery is the subset of the provider metadata used by the client
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcTokenResponse is the response of the token endpoint
+type oidcTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// oidcProvider talks to an OpenID Connect provider and caches its metadata and keys
+type oidcProvider struct {
+	config     OIDCProviderConfig
+	httpClient *http.Client
+
+	mu         sync.Mutex
+	discovered bool
+	keys       *JWKSet
+}
+
+// endpoints returns the provider configuration with missing endpoints
+// filled in from the discovery document
+func (p *oidcProvider) endpoints(ctx context.Context) (OIDCProviderConfig, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	config := p.config
+	if p.discovered || (config.AuthorizationEndpoint != "" && config.TokenEndpoint != "" && config.JWKSURI != "") {
+		return config, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(ctx, strings.TrimSuffix(config.Issuer, "/")+"/.well-known/openid-configuration", "", &discovery); err != nil {
+		return config, err
+	}
+	// The metadata must be about the issuer it was fetched from
+	if discovery.Issuer != config.Issuer {
+		return config, fmt.Errorf("oidc: discovery issuer %q does not match %q", discovery.Issuer, config.Issuer)
+	}
+
+	if config.AuthorizationEndpoint == "" {
+		config.AuthorizationEndpoint = discovery.AuthorizationEndpoint
+	}
+	if config.TokenEndpoint == "" {
+		config.TokenEndpoint = discovery.TokenEndpoint
+	}
+	if config.UserInfoEndpoint == "" {
+		config.UserInfoEndpoint = discovery.UserInfoEndpoint
+	}
+	if config.JWKSURI == "" {
+		config.JWKSURI = discovery.JWKSURI
+	}
+
+	p.config = config
+	p.discovered = true
+	return config, nil
+}
+
+// jwks returns the provider keys, fetching them again if refresh is set
+func (p *oidcProvider) jwks(ctx context.Context, jwksURI string, refresh bool) (*JWKSet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && !refresh {
+		return p.keys, nil
+	}
+
+	var keys JWKSet
+	if err := p.getJSON(ctx, jwksURI, "", &keys); err != nil {
+		return nil, err
+	}
+	p.keys = &keys
+	return p.keys, nil
+}
+
+// getJSON fetches a JSON document, optionally with a bearer token
+func (p *oidcProvider) getJSON(ctx context.Context, endpoint, bearer string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s: %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// exchangeCode redeems an authorization code at the token endpoint
+func (p *oidcProvider) exchangeCode(ctx context.Context, config OIDCProviderConfig, code, codeVerifier string) (*oidcTokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if config.ClientSecret == "" {
+		form.Set("client_id", config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if config.ClientSecret != "" {
+		// client_secret_basic form-encodes the credentials before base64 (RFC 6749 section 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		oidcErr := &OIDCError{}
+		if json.Unmarshal(body, oidcErr) != nil || oidcErr.Code == "" {
+			return nil, fmt.Errorf("oidc: token endpoint: %s", resp.Status)
+		}
+		return nil, oidcErr
+	}
+
+	var token oidcTokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, ErrInvalidIDToken
+	}
+	return &token, nil
+}
+
+// verifyIDToken validates the signature and the standard claims of an ID
+// token (OpenID Connect Core section 3.1.3.7) and returns its claims
+func (p *oidcProvider) verifyIDToken(ctx context.Context, config OIDCProviderConfig, idToken, nonce string, now time.Time) (map[string]interface{}, error) {
+	keys, err := p.jwks(ctx, config.JWKSURI, false)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := VerifyJWT(idToken, keys, now)
+	if errors.Is(err, ErrInvalidToken) {
+		// The provider may have rotated its keys since they were cached
+		if keys, err = p.jwks(ctx, config.JWKSURI, true); err != nil {
+			return nil, err
+		}
+		claims, err = VerifyJWT(idToken, keys, now)
+	}
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	if issuer, _ := claims["iss"].(string); issuer != config.Issuer {
+		return nil, ErrInvalidIDToken
+	}
+	if !AudienceClaim(claims, config.ClientID) {
+		return nil, ErrInvalidIDToken
+	}
+	if audiences, ok := claims["aud"].([]interface{}); ok && len(audiences) > 1 {
+		if azp, _ := claims["azp"].(string); azp != config.ClientID {
+			return nil, ErrInvalidIDToken
+		}
+	}
+	if _, ok := NumericDateClaim(claims, "exp"); !ok {
+		return nil, ErrInvalidIDToken
+	}
+	if iat, ok := NumericDateClaim(claims, "iat"); !ok || iat.After(now.Add(time.Minute)) {
+		return nil, ErrInvalidIDToken
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, ErrInvalidIDToken
+	}
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return nil, ErrInvalidIDToken
+	}
+
+	return claims, nil
+}
+
+// pkceChallenge derives the S256 code challenge of a code verifier (RFC 7636)
+func pkceChallenge(verifier string) string {
+	digest := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// externalClaimsFromOIDC maps standard OpenID Connect claims to ExternalClaims
+func externalClaimsFromOIDC(provider string, claims map[string]interface{}) *ExternalClaims {
+	external := &ExternalClaims{
+		Provider: provider,
+		Raw:      claims,
+	}
+	external.Subject, _ = claims["sub"].(string)
+	external.Email, _ = claims["email"].(string)
+	external.EmailVerified = booleanClaim(claims["email_verified"])
+	external.Name, _ = claims["name"].(string)
+	external.PreferredUsername, _ = claims["preferred_username"].(string)
+	external.Phone, _ = claims["phone_number"].(string)
+	external.PhoneVerified = booleanClaim(claims["phone_number_verified"])
+	return external
+}
+
+// booleanClaim reads a boolean claim, which some providers send as a string
+func booleanClaim(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
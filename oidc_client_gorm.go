@@ -0,0 +1,320 @@
+package userion
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultOIDCStateTTL is how long an authorization request may take to complete
+const DefaultOIDCStateTTL = 10 * time.Minute
+
+// GormOIDCStateModel holds a pending authorization request. Only the hashes
+// of the state and the browser binding are stored; the nonce and PKCE
+// verifier never leave the server.
+type GormOIDCStateModel struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	Provider     string    `gorm:"type:varchar(64);not null"`
+	StateHash    string    `gorm:"type:varchar(64);unique;not null"`
+	BindingHash  string    `gorm:"type:varchar(64);not null;default:''"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+// GormOIDCClient is the GORM implementation of OIDCClient
+type GormOIDCClient struct {
+	db          *gorm.DB
+	tableName   string
+	identities  FederatedIdentityManager
+	userManager UserManager
+	provider    *oidcProvider
+
+	providerName string
+
+	stateTTL time.Duration
+
+	now func() time.Time
+}
+
+// OIDCClientOption configures optional behaviour of a GormOIDCClient
+type OIDCClientOption func(*GormOIDCClient)
+
+// WithOIDCStateTTL sets how long an authorization request may take to complete
+func WithOIDCStateTTL(ttl time.Duration) OIDCClientOption {
+	return func(c *GormOIDCClient) {
+		c.stateTTL = ttl
+	}
+}
+
+// WithOIDCHTTPClient sets the HTTP client used to reach the provider
+func WithOIDCHTTPClient(httpClient *http.Client) OIDCClientOption {
+	return func(c *GormOIDCClient) {
+		c.provider.httpClient = httpClient
+	}
+}
+
+// NewGormOIDCClient initializes a new OIDCClient for one provider. Users
+// signing in are resolved or provisioned through the identity manager and
+// kept up to date through the user manager.
+func NewGormOIDCClient(db *gorm.DB, tableName string, identities FederatedIdentityManager, userManager UserManager, config OIDCProviderConfig, opts ...OIDCClientOption) OIDCClient {
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultOIDCScopes
+	}
+
+	c := &GormOIDCClient{
+		db:          db,
+		tableName:   tableName,
+		identities:  identities,
+		userManager: userManager,
+		provider: &oidcProvider{
+			config:     config,
+			httpClient: http.DefaultClient,
+		},
+		providerName: config.Name,
+		stateTTL:     DefaultOIDCStateTTL,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// AutoMigrate creates or updates the database schema for pending authorization requests
+func (c *GormOIDCClient) AutoMigrate() error {
+	return c.db.Table(c.tableName).AutoMigrate(&GormOIDCStateModel{})
+}
+
+// AuthorizationURL starts a sign-in and returns the provider URL to redirect
+// the browser to, along with the binding value to store in a cookie of that
+// browser. Expired requests of earlier sign-ins are cleaned up.
+func (c *GormOIDCClient) AuthorizationURL(ctx context.Context) (string, string, error) {
+	config, err := c.provider.endpoints(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	binding, err := GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := c.now()
+	record := &GormOIDCStateModel{
+		ID:           uuid.New(),
+		Provider:     config.Name,
+		StateHash:    HashToken(state),
+		BindingHash:  HashToken(binding),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(c.stateTTL),
+		CreatedAt:    now,
+	}
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(c.tableName).Where("expires_at <= ?", now).Delete(&GormOIDCStateModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(c.tableName).Create(record).Error
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {config.ClientID},
+		"redirect_uri":          {config.RedirectURL},
+		"scope":                 {strings.Join(config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(config.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return config.AuthorizationEndpoint + separator + query.Encode(), binding, nil
+}
+
+// consumeState deletes a pending authorization request of this provider and
+// returns it. Unknown, replayed and expired states, and states started by
+// another browser, yield ErrInvalidState.
+func (c *GormOIDCClient) consumeState(binding, state string) (*GormOIDCStateModel, error) {
+	var record GormOIDCStateModel
+	if err := c.db.Table(c.tableName).Where("state_hash = ? AND provider = ?", HashToken(state), c.providerName).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidState
+		}
+		return nil, err
+	}
+
+	// A callback opened in another browser leaves the request to its owner
+	if subtle.ConstantTimeCompare([]byte(HashToken(binding)), []byte(record.BindingHash)) != 1 {
+		return nil, ErrInvalidState
+	}
+
+	// Deleting first makes the state single-use even under concurrent callbacks
+	result := c.db.Table(c.tableName).Where("id = ?", record.ID).Delete(&GormOIDCStateModel{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || !c.now().Before(record.ExpiresAt) {
+		return nil, ErrInvalidState
+	}
+
+	return &record, nil
+}
+
+// HandleCallback completes a sign-in with the state and code the provider
+// redirected back with and the binding value AuthorizationURL returned to the
+// same browser. The code is redeemed with the PKCE verifier, the ID token is
+// validated against the provider JWKS and its claims are mapped to the user,
+// who is provisioned on first sign-in.
+func (c *GormOIDCClient) HandleCallback(ctx context.Context, binding, state, code string) (*User, error) {
+	record, err := c.consumeState(binding, state)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := c.provider.endpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := c.provider.exchangeCode(ctx, config, code, record.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := c.provider.verifyIDToken(ctx, config, token.IDToken, record.Nonce, c.now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Providers may leave profile claims out of the ID token
+	if _, ok := claims["email"]; !ok && config.UserInfoEndpoint != "" && token.AccessToken != "" {
+		if err := c.mergeUserInfo(ctx, config.UserInfoEndpoint, token.AccessToken, claims); err != nil {
+			return nil, err
+		}
+	}
+
+	external := externalClaimsFromOIDC(config.Name, claims)
+	user, err := c.identities.SignInWithExternalIdentity(external)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.syncUser(user, external)
+}
+
+// mergeUserInfo adds the claims of the userinfo endpoint that the ID token lacks
+func (c *GormOIDCClient) mergeUserInfo(ctx context.Context, endpoint, accessToken string, claims map[string]interface{}) error {
+	userInfo := make(map[string]interface{})
+	if err := c.provider.getJSON(ctx, endpoint, accessToken, &userInfo); err != nil {
+		return err
+	}
+
+	// The response must describe the user the ID token was issued for
+	if subject, _ := userInfo["sub"].(string); subject != claims["sub"] {
+		return ErrInvalidIDToken
+	}
+
+	for name, value := range userInfo {
+		if _, ok := claims[name]; !ok {
+			claims[name] = value
+		}
+	}
+	return nil
+}
+
+// syncUser updates the name, and the email and phone number if verified by
+// the provider, of a user whose claims changed since the last sign-in. An
+// email or phone number held by another user is left unchanged, so the
+// identity can still sign in.
+func (c *GormOIDCClient) syncUser(user *User, claims *ExternalClaims) (*User, error) {
+	updates := make(map[string]interface{})
+	now := c.now()
+
+	if claims.Name != "" && claims.Name != user.Name {
+		updates["Name"] = claims.Name
+	}
+	if claims.Email != "" && claims.EmailVerified && (claims.Email != user.Email || user.EmailVerifiedAt == nil) {
+		available, err := c.emailAvailable(user, claims.Email)
+		if err != nil {
+			return nil, err
+		}
+		if available {
+			updates["Email"] = claims.Email
+			updates["EmailVerifiedAt"] = now
+		}
+	}
+	if claims.Phone != "" && claims.PhoneVerified && (claims.Phone != user.Phone || user.PhoneVerifiedAt == nil) {
+		available, err := c.phoneAvailable(user, claims.Phone)
+		if err != nil {
+			return nil, err
+		}
+		if available {
+			updates["Phone"] = claims.Phone
+			updates["PhoneVerifiedAt"] = now
+		}
+	}
+
+	if len(updates) == 0 {
+		return user, nil
+	}
+	if err := c.userManager.UpdateUserByID(user.ID.String(), updates); err != nil {
+		return nil, err
+	}
+	return c.userManager.GetUserByID(user.ID.String())
+}
+
+// emailAvailable reports whether no user other than user has the email
+func (c *GormOIDCClient) emailAvailable(user *User, email string) (bool, error) {
+	other, err := c.userManager.GetUserByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return other.ID == user.ID, nil
+}
+
+// phoneAvailable reports whether no user other than user has the phone number
+func (c *GormOIDCClient) phoneAvailable(user *User, phone string) (bool, error) {
+	others, err := c.userManager.ListUsers(2, 0, map[string]interface{}{"phone": phone}, "", false)
+	if err != nil {
+		return false, err
+	}
+	for _, other := range others {
+		if other.ID != user.ID {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,244 @@
+package userion
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupOIDCClientGorm creates an OIDCClient for a mock provider
+func setupOIDCClientGorm(t *testing.T) (*GormOIDCClient, *mockOIDCProvider, UserManager) {
+	identityManager, userManager := setupFederatedIdentityManagerGorm(t)
+	provider := newMockOIDCProvider(t)
+
+	db := identityManager.db
+	tableName := "oidc_states_test_" + uuid.New().String()[:8]
+	client := NewGormOIDCClient(db, tableName, identityManager, userManager, provider.config()).(*GormOIDCClient)
+	err := client.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	return client, provider, userManager
+}
+
+// janeOIDCClaims returns the provider claims of a test user
+func janeOIDCClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":                   "jane-123",
+		"email":                 "jane@example.com",
+		"email_verified":        true,
+		"name":                  "Jane Doe",
+		"phone_number":          "+15551234567",
+		"phone_number_verified": true,
+	}
+}
+
+// TestOIDCAuthorizationURL_Gorm tests the parameters of the authorization request
+func TestOIDCAuthorizationURL_Gorm(t *testing.T) {
+	client, provider, _ := setupOIDCClientGorm(t)
+
+	authorizationURL, binding, err := client.AuthorizationURL(context.Background())
+	require.NoError(t, err)
+
+	u, err := url.Parse(authorizationURL)
+	require.NoError(t, err)
+	assert.Equal(t, provider.issuer()+"/authorize", u.Scheme+"://"+u.Host+u.Path, "The endpoint should be discovered")
+
+	query := u.Query()
+	assert.Equal(t, "openid email profile", query.Get("scope"))
+	assert.Equal(t, "https://app.example.com/callback", query.Get("redirect_uri"))
+	assert.NotEmpty(t, query.Get("state"))
+	assert.NotEmpty(t, query.Get("nonce"))
+	assert.Len(t, query.Get("code_challenge"), 43)
+	assert.NotEmpty(t, binding, "A binding value should be returned for the browser")
+	assert.NotContains(t, authorizationURL, binding, "The binding value should not be sent to the provider")
+
+	other, _, err := client.AuthorizationURL(context.Background())
+	require.NoError(t, err)
+	assert.NotEqual(t, authorizationURL, other, "Every request should have its own state")
+	assert.Equal(t, 1, provider.discoveryRequests, "Discovery should be cached")
+}
+
+// TestOIDCHandleCallback_Gorm tests signing in, provisioning and claim mapping
+func TestOIDCHandleCallback_Gorm(t *testing.T) {
+	client, provider, userManager := setupOIDCClientGorm(t)
+	ctx := context.Background()
+
+	authorizationURL, binding, err := client.AuthorizationURL(ctx)
+	require.NoError(t, err)
+	state, code := provider.authorize(authorizationURL, janeOIDCClaims())
+
+	user, err := client.HandleCallback(ctx, binding, state, code)
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe", user.Name)
+	assert.Equal(t, "jane@example.com", user.Email)
+	assert.Equal(t, "+15551234567", user.Phone)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.NotNil(t, user.PhoneVerifiedAt)
+
+	// The state is single-use
+	_, err = client.HandleCallback(ctx, binding, state, code)
+	assert.Equal(t, ErrInvalidState, err)
+
+	// Changed claims update the user on the next sign-in
+	claims := janeOIDCClaims()
+	claims["name"] = "Jane Smith"
+	claims["email"] = "jane.smith@example.com"
+	claims["phone_number"] = "+15557654321"
+	claims["phone_number_verified"] = false
+	authorizationURL, binding, err = client.AuthorizationURL(ctx)
+	require.NoError(t, err)
+	state, code = provider.authorize(authorizationURL, claims)
+
+	updated, err := client.HandleCallback(ctx, binding, state, code)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, updated.ID)
+	assert.Equal(t, "Jane Smith", updated.Name)
+	assert.Equal(t, "jane.smith@example.com", updated.Email)
+	assert.Equal(t, "+15551234567", updated.Phone, "Unverified phone numbers should not be taken over")
+
+	stored, err := userManager.GetUserByID(user.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Smith", stored.Name)
+}
+
+// TestOIDCHandleCallback_TakenClaims_Gorm tests that an email or phone number
+// of another user is not taken over
+func TestOIDCHandleCallback_TakenClaims_Gorm(t *testing.T) {
+	client, provider, userManager := setupOIDCClientGorm(t)
+	ctx := context.Background()
+
+	authorizationURL, binding, err := client.AuthorizationURL(ctx)
+	require.NoError(t, err)
+	state, code := provider.authorize(authorizationURL, janeOIDCClaims())
+	user, err := client.HandleCallback(ctx, binding, state, code)
+	require.NoError(t, err)
+
+	other := createTestUser(t, userManager)
+	claims := janeOIDCClaims()
+	claims["name"] = "Jane Smith"
+	claims["email"] = other.Email
+	claims["phone_number"] = other.Phone
+	for i := 0; i < 2; i++ {
+		authorizationURL, binding, err = client.AuthorizationURL(ctx)
+		require.NoError(t, err)
+		state, code = provider.authorize(authorizationURL, claims)
+
+		updated, err := client.HandleCallback(ctx, binding, state, code)
+		require.NoError(t, err, "Signing in should keep working")
+		assert.Equal(t, user.ID, updated.ID)
+		assert.Equal(t, "Jane Smith", updated.Name)
+		assert.Equal(t, "jane@example.com", updated.Email, "Emails of other users should not be taken over")
+		assert.Equal(t, "+15551234567", updated.Phone, "Phone numbers of other users should not be taken over")
+	}
+}
+
+// TestOIDCHandleCallback_UserInfo_Gorm tests completing claims from the userinfo endpoint
+func TestOIDCHandleCallback_UserInfo_Gorm(t *testing.T) {
+	client, provider, _ := setupOIDCClientGorm(t)
+	ctx := context.Background()
+
+	provider.userInfo = janeOIDCClaims()
+	authorizationURL, binding, err := client.AuthorizationURL(ctx)
+	require.NoError(t, err)
+	state, code := provider.authorize(authorizationURL, map[string]interface{}{"sub": "jane-123"})
+
+	user, err := client.HandleCallback(ctx, binding, state, code)
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", user.Email)
+
+	// Userinfo about another subject is rejected
+	provider.userInfo = map[string]interface{}{"sub": "someone-else", "email": "x@example.com"}
+	authorizationURL, binding, err = client.AuthorizationURL(ctx)
+	require.NoError(t, err)
+	state, code = provider.authorize(authorizationURL, map[string]interface{}{"sub": "jane-456"})
+	_, err = client.HandleCallback(ctx, binding, state, code)
+	assert.Equal(t, ErrInvalidIDToken, err)
+}
+
+// TestOIDCHandleCallback_Validation_Gorm tests rejection of invalid states, codes and ID tokens
+func TestOIDCHandleCallback_Validation_Gorm(t *testing.T) {
+	client, provider, _ := setupOIDCClientGorm(t)
+	ctx := context.Background()
+
+	_, err := client.HandleCallback(ctx, "binding", "unknown-state", "code")
+	assert.Equal(t, ErrInvalidState, err)
+
+	// A wrong PKCE verifier is rejected by the provider
+	authorizationURL, binding, err := client.AuthorizationURL(ctx)
+	require.NoError(t, err)
+	state, _ := provider.authorize(authorizationURL, janeOIDCClaims())
+	_, err = client.HandleCallback(ctx, binding, state, "forged-code")
+	var oidcErr *OIDCError
+	require.ErrorAs(t, err, &oidcErr)
+	assert.Equal(t, "invalid_grant", oidcErr.Code)
+
+	tests := []struct {
+		name      string
+		overrides map[string]interface{}
+	}{
+		{"wrong issuer", map[string]interface{}{"iss": "https://evil.example.com"}},
+		{"wrong audience", map[string]interface{}{"aud": "other-client"}},
+		{"missing azp with several audiences", map[string]interface{}{"aud": []string{"test-client", "other-client"}}},
+		{"wrong nonce", map[string]interface{}{"nonce": "replayed"}},
+		{"expired", map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()}},
+		{"issued in the future", map[string]interface{}{"iat": time.Now().Add(time.Hour).Unix()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorizationURL, binding, err := client.AuthorizationURL(ctx)
+			require.NoError(t, err)
+			state, code := provider.authorize(authorizationURL, janeOIDCClaims())
+			provider.idTokenClaims = tt.overrides
+
+			_, err = client.HandleCallback(ctx, binding, state, code)
+			assert.Equal(t, ErrInvalidIDToken, err)
+		})
+	}
+
+	// A callback opened in another browser is rejected, which stops an
+	// attacker from signing a victim in with the attacker's callback URL
+	authorizationURL, binding, err = client.AuthorizationURL(ctx)
+	require.NoError(t, err)
+	state, code := provider.authorize(authorizationURL, janeOIDCClaims())
+	_, err = client.HandleCallback(ctx, "victim-binding", state, code)
+	assert.Equal(t, ErrInvalidState, err, "A callback with the wrong binding should be rejected")
+	_, err = client.HandleCallback(ctx, "", state, code)
+	assert.Equal(t, ErrInvalidState, err, "A callback without binding should be rejected")
+	_, err = client.HandleCallback(ctx, binding, state, code)
+	assert.NoError(t, err, "The browser that started the sign-in should still complete it")
+
+	// Expired states are rejected
+	authorizationURL, binding, err = client.AuthorizationURL(ctx)
+	require.NoError(t, err)
+	state, code = provider.authorize(authorizationURL, janeOIDCClaims())
+	client.now = func() time.Time { return time.Now().Add(DefaultOIDCStateTTL) }
+	_, err = client.HandleCallback(ctx, binding, state, code)
+	assert.Equal(t, ErrInvalidState, err)
+}
+
+// TestOIDCKeyRotation_Gorm tests that keys are fetched again after the provider rotates them
+func TestOIDCKeyRotation_Gorm(t *testing.T) {
+	client, provider, _ := setupOIDCClientGorm(t)
+	ctx := context.Background()
+
+	authorizationURL, binding, err := client.AuthorizationURL(ctx)
+	require.NoError(t, err)
+	state, code := provider.authorize(authorizationURL, janeOIDCClaims())
+	_, err = client.HandleCallback(ctx, binding, state, code)
+	require.NoError(t, err)
+
+	_, err = provider.keyRing.Rotate(AlgorithmRS256)
+	require.NoError(t, err)
+
+	authorizationURL, binding, err = client.AuthorizationURL(ctx)
+	require.NoError(t, err)
+	state, code = provider.authorize(authorizationURL, janeOIDCClaims())
+	_, err = client.HandleCallback(ctx, binding, state, code)
+	require.NoError(t, err, "The new key should be picked up from the JWKS")
+	assert.Equal(t, 2, provider.jwksRequests)
+}
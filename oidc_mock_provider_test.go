@@ -0,0 +1,198 @@
+package userion
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockOIDCProvider is a minimal OpenID Connect provider built on httptest. It
+// issues authorization codes for claims chosen by the test instead of
+// authenticating a browser.
+type mockOIDCProvider struct {
+	t            *testing.T
+	server       *httptest.Server
+	keyRing      *KeyRing
+	clientID     string
+	clientSecret string
+
+	mu    sync.Mutex
+	codes map[string]*mockAuthorization
+
+	// Overrides applied to the next ID token
+	idTokenClaims map[string]interface{}
+	// Claims served by the userinfo endpoint instead of the ID token claims
+	userInfo map[string]interface{}
+
+	discoveryRequests int
+	jwksRequests      int
+}
+
+// mockAuthorization is an issued authorization code
+type mockAuthorization struct {
+	claims        map[string]interface{}
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+}
+
+// newMockOIDCProvider starts a provider with an ES256 signing key
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := GenerateSigningKey(AlgorithmES256)
+	require.NoError(t, err)
+
+	p := &mockOIDCProvider{
+		t:            t,
+		keyRing:      NewKeyRing(key),
+		clientID:     "test-client",
+		clientSecret: "test-secret",
+		codes:        make(map[string]*mockAuthorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("/jwks", p.handleJWKS)
+	mux.HandleFunc("/token", p.handleToken)
+	mux.HandleFunc("/userinfo", p.handleUserInfo)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// issuer returns the issuer identifier of the provider
+func (p *mockOIDCProvider) issuer() string {
+	return p.server.URL
+}
+
+// config returns the client configuration for the provider
+func (p *mockOIDCProvider) config() OIDCProviderConfig {
+	return OIDCProviderConfig{
+		Name:         "mock",
+		Issuer:       p.issuer(),
+		ClientID:     p.clientID,
+		ClientSecret: p.clientSecret,
+		RedirectURL:  "https://app.example.com/callback",
+	}
+}
+
+// authorize plays the user consenting at the authorization URL and returns
+// the state and code the browser would be redirected back with
+func (p *mockOIDCProvider) authorize(authorizationURL string, claims map[string]interface{}) (string, string) {
+	u, err := url.Parse(authorizationURL)
+	require.NoError(p.t, err)
+	query := u.Query()
+
+	require.Equal(p.t, "code", query.Get("response_type"))
+	require.Equal(p.t, p.clientID, query.Get("client_id"))
+	require.Equal(p.t, "S256", query.Get("code_challenge_method"))
+
+	code, err := GenerateToken()
+	require.NoError(p.t, err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codes[code] = &mockAuthorization{
+		claims:        claims,
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   query.Get("redirect_uri"),
+	}
+
+	return query.Get("state"), code
+}
+
+func (p *mockOIDCProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.discoveryRequests++
+	p.mu.Unlock()
+
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                 p.issuer(),
+		"authorization_endpoint": p.issuer() + "/authorize",
+		"token_endpoint":         p.issuer() + "/token",
+		"userinfo_endpoint":      p.issuer() + "/userinfo",
+		"jwks_uri":               p.issuer() + "/jwks",
+	})
+}
+
+func (p *mockOIDCProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.jwksRequests++
+	p.mu.Unlock()
+
+	writeMockJSON(w, http.StatusOK, p.keyRing.JWKS())
+}
+
+func (p *mockOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != p.clientID || clientSecret != p.clientSecret {
+		writeMockJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	authorization := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	overrides := p.idTokenClaims
+	p.idTokenClaims = nil
+	p.mu.Unlock()
+
+	if r.PostFormValue("grant_type") != "authorization_code" || authorization == nil ||
+		r.PostFormValue("redirect_uri") != authorization.redirectURI ||
+		pkceChallenge(r.PostFormValue("code_verifier")) != authorization.codeChallenge {
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code or verifier rejected"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   p.issuer(),
+		"aud":   p.clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": authorization.nonce,
+	}
+	for name, value := range authorization.claims {
+		claims[name] = value
+	}
+	for name, value := range overrides {
+		claims[name] = value
+	}
+
+	idToken, err := p.keyRing.Sign(claims)
+	require.NoError(p.t, err)
+
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-" + authorization.nonce,
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+		"expires_in":   3600,
+	})
+}
+
+func (p *mockOIDCProvider) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	p.mu.Lock()
+	userInfo := p.userInfo
+	p.mu.Unlock()
+
+	writeMockJSON(w, http.StatusOK, userInfo)
+}
+
+// writeMockJSON writes a JSON response
+func writeMockJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
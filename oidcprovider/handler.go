@@ -0,0 +1,166 @@
+package oidcprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/weedbox/userion"
+)
+
+// Handler returns the HTTP handler serving the discovery document and the
+// authorization, token, userinfo and JWKS endpoints. Mount it at the path of
+// the issuer URL.
+func (p *GormProvider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("/authorize", p.handleAuthorize)
+	mux.HandleFunc("/token", p.handleToken)
+	mux.HandleFunc("/userinfo", p.handleUserInfo)
+	mux.HandleFunc("/jwks", p.handleJWKS)
+	return mux
+}
+
+// handleDiscovery serves the OpenID Provider Metadata
+func (p *GormProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.Discovery())
+}
+
+// handleJWKS serves the public signing keys
+func (p *GormProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.JWKS())
+}
+
+// handleAuthorize sends users who are not signed in to the login page and
+// users who have not consented to the consent page, then redirects back to
+// the client with a code
+func (p *GormProvider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, oauthError(ErrorInvalidRequest, "malformed request"))
+		return
+	}
+	request := ParseAuthorizationRequest(r.Form)
+
+	gormClient, err := p.validateRedirect(request)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if oauthErr := p.validateAuthorization(gormClient, request); oauthErr != nil {
+		http.Redirect(w, r, errorRedirect(request, oauthErr), http.StatusFound)
+		return
+	}
+
+	userID := ""
+	if p.config.Authenticate != nil {
+		if userID, err = p.config.Authenticate(r); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	if userID == "" {
+		if p.config.LoginURL == "" {
+			http.Redirect(w, r, errorRedirect(request, oauthError(ErrorLoginRequired, "")), http.StatusFound)
+			return
+		}
+		returnTo := p.config.Issuer + "/authorize?" + r.Form.Encode()
+		http.Redirect(w, r, appendQuery(p.config.LoginURL, url.Values{"return_to": {returnTo}}), http.StatusFound)
+		return
+	}
+
+	consented, err := p.HasConsent(userID, gormClient.ID, request.Scopes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !consented && p.config.ConsentURL != "" {
+		http.Redirect(w, r, appendQuery(p.config.ConsentURL, r.Form), http.StatusFound)
+		return
+	}
+
+	redirectURL, err := p.Authorize(request, userID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// handleToken serves the token endpoint. Clients authenticate with HTTP basic
+// authentication or with client_id and client_secret in the form.
+func (p *GormProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, oauthError(ErrorInvalidRequest, "POST required"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, oauthError(ErrorInvalidRequest, "malformed request"))
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		// Basic credentials are form-encoded (RFC 6749 section 2.3.1)
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	response, err := p.Token(r.PostForm, clientID, clientSecret)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleUserInfo serves the claims of the user an access token was issued for
+func (p *GormProvider) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken := ""
+	if authorization := r.Header.Get("Authorization"); len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		accessToken = authorization[7:]
+	}
+
+	claims, err := p.UserInfo(accessToken)
+	if err != nil {
+		var oauthErr *userion.OIDCError
+		if errors.As(err, &oauthErr) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="`+oauthErr.Code+`"`)
+			writeJSON(w, http.StatusUnauthorized, oauthErr)
+			return
+		}
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, claims)
+}
+
+// writeError writes an OAuth error response. Other errors are not exposed.
+func writeError(w http.ResponseWriter, err error) {
+	var oauthErr *userion.OIDCError
+	if !errors.As(err, &oauthErr) {
+		writeJSON(w, http.StatusInternalServerError, oauthError("server_error", ""))
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == ErrorInvalidClient {
+		status = http.StatusUnauthorized
+	}
+	writeJSON(w, status, oauthErr)
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,153 @@
+package oidcprovider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weedbox/userion"
+)
+
+// setupProviderServer serves a provider over HTTP. Users are signed in to the
+// host application with a "user" cookie.
+func setupProviderServer(t *testing.T) (*GormProvider, userion.UserManager, *httptest.Server) {
+	provider, userManager := setupProviderGorm(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider.Handler().ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	provider.config = Config{
+		Issuer: server.URL,
+		Authenticate: func(r *http.Request) (string, error) {
+			cookie, err := r.Cookie("user")
+			if err != nil {
+				return "", nil
+			}
+			return cookie.Value, nil
+		},
+		LoginURL:   "https://id.example.com/login",
+		ConsentURL: "https://id.example.com/consent",
+	}
+
+	return provider, userManager, server
+}
+
+// noRedirectClient returns an HTTP client that does not follow redirects
+func noRedirectClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// getLocation requests a URL as a signed in user and returns the redirect location
+func getLocation(t *testing.T, rawURL, userID string) *url.URL {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	require.NoError(t, err)
+	if userID != "" {
+		req.AddCookie(&http.Cookie{Name: "user", Value: userID})
+	}
+
+	resp, err := noRedirectClient().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return location
+}
+
+// TestHandlerSignIn tests a complete sign-in of userion's own OIDC client
+// against the provider
+func TestHandlerSignIn(t *testing.T) {
+	provider, userManager, server := setupProviderServer(t)
+	user := createTestUser(t, userManager)
+	token, err := userManager.IssueEmailVerification(user.ID.String())
+	require.NoError(t, err)
+	require.NoError(t, userManager.ConfirmEmail(token))
+
+	client := &Client{Name: "Wiki", RedirectURIs: []string{"https://wiki.example.com/callback"}}
+	secret, err := provider.RegisterClient(client)
+	require.NoError(t, err)
+
+	// The relying party keeps its own users
+	suffix := uuid.New().String()[:8]
+	rpUsers := userion.NewGormUserManager(provider.db, "rp_users_test_"+suffix)
+	require.NoError(t, rpUsers.AutoMigrate())
+	identities := userion.NewGormFederatedIdentityManager(provider.db, "rp_identities_test_"+suffix, rpUsers)
+	require.NoError(t, identities.AutoMigrate())
+	rp := userion.NewGormOIDCClient(provider.db, "rp_states_test_"+suffix, identities, rpUsers, userion.OIDCProviderConfig{
+		Name:         "userion",
+		Issuer:       server.URL,
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		RedirectURL:  client.RedirectURIs[0],
+	})
+	require.NoError(t, rp.AutoMigrate())
+
+	authorizationURL, binding, err := rp.AuthorizationURL(context.Background())
+	require.NoError(t, err)
+
+	location := getLocation(t, authorizationURL, "")
+	assert.Equal(t, "/login", location.Path, "Users who are not signed in should be sent to the login page")
+	assert.Equal(t, server.URL+"/authorize", strings.Split(location.Query().Get("return_to"), "?")[0])
+
+	location = getLocation(t, authorizationURL, user.ID.String())
+	assert.Equal(t, "/consent", location.Path, "Missing consent should be requested")
+	assert.Equal(t, client.ID, location.Query().Get("client_id"))
+
+	require.NoError(t, provider.GrantConsent(user.ID.String(), client.ID, strings.Fields(location.Query().Get("scope"))))
+
+	location = getLocation(t, authorizationURL, user.ID.String())
+	assert.Equal(t, "wiki.example.com", location.Host)
+	require.NotEmpty(t, location.Query().Get("code"))
+
+	signedIn, err := rp.HandleCallback(context.Background(), binding, location.Query().Get("state"), location.Query().Get("code"))
+	require.NoError(t, err)
+	assert.Equal(t, "test@example.com", signedIn.Email)
+	assert.Equal(t, "Test User", signedIn.Name)
+	assert.NotNil(t, signedIn.EmailVerifiedAt)
+}
+
+// TestHandlerErrors tests the error responses of the endpoints
+func TestHandlerErrors(t *testing.T) {
+	provider, _, server := setupProviderServer(t)
+	client, _ := registerTestClient(t, provider)
+
+	resp, err := http.Get(server.URL + "/authorize?client_id=" + client.ID + "&redirect_uri=https://evil.example.com/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Unregistered redirect URIs should not be redirected to")
+
+	location := getLocation(t, server.URL+"/authorize?client_id="+client.ID+"&redirect_uri="+url.QueryEscape(client.RedirectURIs[0])+"&response_type=code&state=abc", "")
+	assert.Equal(t, ErrorInvalidRequest, location.Query().Get("error"), "A missing code challenge should be redirected to the client")
+	assert.Equal(t, "abc", location.Query().Get("state"))
+
+	resp, err = http.PostForm(server.URL+"/token", url.Values{"grant_type": {GrantClientCredentials}, "client_id": {client.ID}, "client_secret": {"wrong"}})
+	require.NoError(t, err)
+	var oauthErr userion.OIDCError
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&oauthErr))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, ErrorInvalidClient, oauthErr.Code)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/userinfo", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer invalid")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("WWW-Authenticate"), ErrorInvalidToken)
+}
@@ -0,0 +1,146 @@
+// Package oidcprovider is an OAuth 2.0 authorization server and OpenID
+// Connect provider backed by a userion.UserManager. It supports the
+// authorization code flow with PKCE, refresh tokens and client credentials,
+// records user consent and signs tokens with a userion.KeyRing.
+package oidcprovider
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/weedbox/userion"
+)
+
+// Grant types a client may be registered for
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+// Scopes with a meaning to the provider. Clients may be registered for
+// additional scopes, which are passed through to access tokens.
+const (
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopeEmail         = "email"
+	ScopePhone         = "phone"
+	ScopeOfflineAccess = "offline_access"
+)
+
+// Default settings of GormProvider
+const (
+	DefaultCodeTTL         = time.Minute
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultIDTokenTTL      = time.Hour
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// OAuth 2.0 error codes (RFC 6749 section 4.1.2.1 and 5.2, OpenID Connect Core section 3.1.2.6)
+const (
+	ErrorInvalidRequest       = "invalid_request"
+	ErrorInvalidClient        = "invalid_client"
+	ErrorInvalidGrant         = "invalid_grant"
+	ErrorUnauthorizedClient   = "unauthorized_client"
+	ErrorUnsupportedGrantType = "unsupported_grant_type"
+	ErrorUnsupportedResponse  = "unsupported_response_type"
+	ErrorInvalidScope         = "invalid_scope"
+	ErrorAccessDenied         = "access_denied"
+	ErrorConsentRequired      = "consent_required"
+	ErrorLoginRequired        = "login_required"
+	ErrorInvalidToken         = "invalid_token"
+)
+
+// Common errors returned by the Provider
+var (
+	ErrClientNotFound = errors.New("client not found")
+	ErrClientExists   = errors.New("client already exists")
+)
+
+// oauthError creates an OAuth error response
+func oauthError(code, description string) *userion.OIDCError {
+	return &userion.OIDCError{Code: code, Description: description}
+}
+
+// Client is an application registered to sign users in or to call APIs
+type Client struct {
+	ID           string    `json:"client_id"`
+	Name         string    `json:"client_name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`           // Scopes the client may request
+	Public       bool      `json:"public,omitempty"` // Public clients have no secret and rely on PKCE
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Consent records the scopes a user granted to a client
+type Consent struct {
+	UserID    string    `json:"user_id"`
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AuthorizationRequest is the request of a client at the authorization endpoint
+type AuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scopes              []string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenResponse is the successful response of the token endpoint
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Config configures the provider
+type Config struct {
+	// Issuer is the URL the provider is reachable at, without trailing slash
+	Issuer string
+
+	// Authenticate returns the ID of the user signed in to the host
+	// application for a request to the authorization endpoint, or "" if none
+	Authenticate func(r *http.Request) (string, error)
+	// LoginURL is where users who are not signed in are sent, with the
+	// authorization URL to return to in the return_to parameter
+	LoginURL string
+	// ConsentURL is where users are sent to grant missing scopes, with the
+	// parameters of the authorization request. After GrantConsent the user
+	// is sent back to the authorization endpoint with the same parameters.
+	ConsentURL string
+}
+
+// Provider defines the interface of the OAuth 2.0 / OpenID Connect provider
+type Provider interface {
+	AutoMigrate() error
+
+	RegisterClient(client *Client) (string, error)
+	GetClient(id string) (*Client, error)
+	ListClients() ([]Client, error)
+	DeleteClient(id string) error
+
+	GrantConsent(userID, clientID string, scopes []string) error
+	HasConsent(userID, clientID string, scopes []string) (bool, error)
+	ListConsents(userID string) ([]Consent, error)
+	RevokeConsent(userID, clientID string) error
+
+	Authorize(request *AuthorizationRequest, userID string) (string, error)
+	Token(form map[string][]string, clientID, clientSecret string) (*TokenResponse, error)
+	UserInfo(accessToken string) (map[string]interface{}, error)
+	Discovery() map[string]interface{}
+	JWKS() *userion.JWKSet
+
+	Handler() http.Handler
+	HandleEvent(event userion.Event)
+}
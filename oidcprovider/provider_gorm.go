@@ -0,0 +1,967 @@
+package oidcprovider
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weedbox/userion"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// GormClientModel represents a registered client. Only the hash of the
+// client secret is stored.
+type GormClientModel struct {
+	ID           string         `gorm:"type:varchar(64);primaryKey;"`
+	SecretHash   string         `gorm:"type:varchar(64);not null;default:''"`
+	Name         string         `gorm:"not null"`
+	RedirectURIs datatypes.JSON `gorm:"type:json;default:'[]'"`
+	GrantTypes   datatypes.JSON `gorm:"type:json;default:'[]'"`
+	Scopes       datatypes.JSON `gorm:"type:json;default:'[]'"`
+	Public       bool           `gorm:"not null;default:false"`
+	CreatedAt    time.Time      `gorm:"autoCreateTime"`
+}
+
+// ToClient converts a GormClientModel to a Client business model
+func (g *GormClientModel) ToClient() *Client {
+	return &Client{
+		ID:           g.ID,
+		Name:         g.Name,
+		RedirectURIs: decodeStrings(g.RedirectURIs),
+		GrantTypes:   decodeStrings(g.GrantTypes),
+		Scopes:       decodeStrings(g.Scopes),
+		Public:       g.Public,
+		CreatedAt:    g.CreatedAt,
+	}
+}
+
+// GormAuthorizationCodeModel represents an issued authorization code. Its ID
+// is the family of the refresh tokens obtained with it.
+type GormAuthorizationCodeModel struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	CodeHash      string    `gorm:"type:varchar(64);unique;not null"`
+	ClientID      string    `gorm:"type:varchar(64);not null"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index"`
+	RedirectURI   string    `gorm:"not null"`
+	Scope         string    `gorm:"not null;default:''"`
+	Nonce         string    `gorm:"not null;default:''"`
+	CodeChallenge string    `gorm:"not null"`
+	AuthTime      time.Time `gorm:"not null"`
+	ExpiresAt     time.Time `gorm:"not null"`
+	UsedAt        *time.Time
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+}
+
+// GormRefreshTokenModel represents a refresh token issued to a client
+type GormRefreshTokenModel struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	FamilyID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	ClientID  string    `gorm:"type:varchar(64);not null;index"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Scope     string    `gorm:"not null;default:''"`
+	AuthTime  time.Time `gorm:"not null"`
+	TokenHash string    `gorm:"type:varchar(64);unique;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// GormConsentModel records the scopes a user granted to a client
+type GormConsentModel struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	ClientID  string    `gorm:"type:varchar(64);primaryKey;"`
+	Scope     string    `gorm:"not null;default:''"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// ToConsent converts a GormConsentModel to a Consent business model
+func (g *GormConsentModel) ToConsent() *Consent {
+	return &Consent{
+		UserID:    g.UserID.String(),
+		ClientID:  g.ClientID,
+		Scopes:    strings.Fields(g.Scope),
+		UpdatedAt: g.UpdatedAt,
+	}
+}
+
+// GormProvider is the GORM implementation of Provider
+type GormProvider struct {
+	db          *gorm.DB
+	tableName   string
+	userManager userion.UserManager
+	keyRing     *userion.KeyRing
+	config      Config
+
+	codeTTL         time.Duration
+	accessTokenTTL  time.Duration
+	idTokenTTL      time.Duration
+	refreshTokenTTL time.Duration
+
+	now func() time.Time
+}
+
+// Option configures optional behaviour of a GormProvider
+type Option func(*GormProvider)
+
+// WithCodeTTL sets how long authorization codes stay valid
+func WithCodeTTL(ttl time.Duration) Option {
+	return func(p *GormProvider) {
+		p.codeTTL = ttl
+	}
+}
+
+// WithAccessTokenTTL sets the lifetime of access tokens
+func WithAccessTokenTTL(ttl time.Duration) Option {
+	return func(p *GormProvider) {
+		p.accessTokenTTL = ttl
+	}
+}
+
+// WithIDTokenTTL sets the lifetime of ID tokens
+func WithIDTokenTTL(ttl time.Duration) Option {
+	return func(p *GormProvider) {
+		p.idTokenTTL = ttl
+	}
+}
+
+// WithRefreshTokenTTL sets the lifetime of refresh tokens
+func WithRefreshTokenTTL(ttl time.Duration) Option {
+	return func(p *GormProvider) {
+		p.refreshTokenTTL = ttl
+	}
+}
+
+// NewGormProvider initializes a new Provider. The table name is used for
+// clients and as the prefix of the code, refresh token and consent tables.
+func NewGormProvider(db *gorm.DB, tableName string, userManager userion.UserManager, keyRing *userion.KeyRing, config Config, opts ...Option) Provider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+
+	p := &GormProvider{
+		db:              db,
+		tableName:       tableName,
+		userManager:     userManager,
+		keyRing:         keyRing,
+		config:          config,
+		codeTTL:         DefaultCodeTTL,
+		accessTokenTTL:  DefaultAccessTokenTTL,
+		idTokenTTL:      DefaultIDTokenTTL,
+		refreshTokenTTL: DefaultRefreshTokenTTL,
+		now:             time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// codeTableName returns the name of the table holding authorization codes
+func (p *GormProvider) codeTableName() string {
+	return p.tableName + "_codes"
+}
+
+// refreshTokenTableName returns the name of the table holding refresh tokens
+func (p *GormProvider) refreshTokenTableName() string {
+	return p.tableName + "_refresh_tokens"
+}
+
+// consentTableName returns the name of the table holding consents
+func (p *GormProvider) consentTableName() string {
+	return p.tableName + "_consents"
+}
+
+// AutoMigrate creates or updates the database schema for clients, codes,
+// refresh tokens and consents
+func (p *GormProvider) AutoMigrate() error {
+	if err := p.db.Table(p.tableName).AutoMigrate(&GormClientModel{}); err != nil {
+		return err
+	}
+	if err := p.db.Table(p.codeTableName()).AutoMigrate(&GormAuthorizationCodeModel{}); err != nil {
+		return err
+	}
+	if err := p.db.Table(p.refreshTokenTableName()).AutoMigrate(&GormRefreshTokenModel{}); err != nil {
+		return err
+	}
+	return p.db.Table(p.consentTableName()).AutoMigrate(&GormConsentModel{})
+}
+
+// RegisterClient registers a client and returns its secret, which is only
+// shown once. Public clients get no secret. An empty ID is generated.
+func (p *GormProvider) RegisterClient(client *Client) (string, error) {
+	if client.ID == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return "", err
+		}
+		client.ID = hex.EncodeToString(id)
+	}
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{GrantAuthorizationCode, GrantRefreshToken}
+	}
+	if len(client.Scopes) == 0 {
+		client.Scopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopePhone, ScopeOfflineAccess}
+	}
+	if client.Public && containsString(client.GrantTypes, GrantClientCredentials) {
+		return "", oauthError(ErrorInvalidRequest, "public clients cannot use client credentials")
+	}
+
+	var count int64
+	if err := p.db.Table(p.tableName).Where("id = ?", client.ID).Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "", ErrClientExists
+	}
+
+	var secret string
+	var secretHash string
+	if !client.Public {
+		var err error
+		if secret, err = userion.GenerateToken(); err != nil {
+			return "", err
+		}
+		secretHash = userion.HashToken(secret)
+	}
+
+	client.CreatedAt = p.now()
+	gormClient := &GormClientModel{
+		ID:           client.ID,
+		SecretHash:   secretHash,
+		Name:         client.Name,
+		RedirectURIs: encodeStrings(client.RedirectURIs),
+		GrantTypes:   encodeStrings(client.GrantTypes),
+		Scopes:       encodeStrings(client.Scopes),
+		Public:       client.Public,
+		CreatedAt:    client.CreatedAt,
+	}
+	if err := p.db.Table(p.tableName).Create(gormClient).Error; err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// getClient retrieves a registered client
+func (p *GormProvider) getClient(id string) (*GormClientModel, error) {
+	var gormClient GormClientModel
+	if err := p.db.Table(p.tableName).Where("id = ?", id).First(&gormClient).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClientNotFound
+		}
+		return nil, err
+	}
+	return &gormClient, nil
+}
+
+// GetClient retrieves a registered client by ID
+func (p *GormProvider) GetClient(id string) (*Client, error) {
+	gormClient, err := p.getClient(id)
+	if err != nil {
+		return nil, err
+	}
+	return gormClient.ToClient(), nil
+}
+
+// ListClients returns the registered clients ordered by name
+func (p *GormProvider) ListClients() ([]Client, error) {
+	var gormClients []GormClientModel
+	if err := p.db.Table(p.tableName).Order("name").Find(&gormClients).Error; err != nil {
+		return nil, err
+	}
+
+	clients := make([]Client, len(gormClients))
+	for i := range gormClients {
+		clients[i] = *gormClients[i].ToClient()
+	}
+	return clients, nil
+}
+
+// DeleteClient removes a client together with its codes, refresh tokens and consents
+func (p *GormProvider) DeleteClient(id string) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Table(p.tableName).Where("id = ?", id).Delete(&GormClientModel{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrClientNotFound
+		}
+
+		if err := tx.Table(p.codeTableName()).Where("client_id = ?", id).Delete(&GormAuthorizationCodeModel{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Table(p.refreshTokenTableName()).Where("client_id = ?", id).Delete(&GormRefreshTokenModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(p.consentTableName()).Where("client_id = ?", id).Delete(&GormConsentModel{}).Error
+	})
+}
+
+// authenticateClient checks the credentials presented at the token endpoint.
+// Public clients only identify themselves.
+func (p *GormProvider) authenticateClient(clientID, clientSecret string) (*GormClientModel, error) {
+	gormClient, err := p.getClient(clientID)
+	if errors.Is(err, ErrClientNotFound) {
+		return nil, oauthError(ErrorInvalidClient, "unknown client")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if gormClient.Public {
+		if clientSecret != "" {
+			return nil, oauthError(ErrorInvalidClient, "public clients have no secret")
+		}
+		return gormClient, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(gormClient.SecretHash), []byte(userion.HashToken(clientSecret))) != 1 {
+		return nil, oauthError(ErrorInvalidClient, "client authentication failed")
+	}
+	return gormClient, nil
+}
+
+// GrantConsent records that a user granted scopes to a client, in addition
+// to scopes granted before
+func (p *GormProvider) GrantConsent(userID, clientID string, scopes []string) error {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return userion.ErrUserNotFound
+	}
+	if _, err := p.getClient(clientID); err != nil {
+		return err
+	}
+
+	var consent GormConsentModel
+	err = p.db.Table(p.consentTableName()).Where("user_id = ? AND client_id = ?", id, clientID).First(&consent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		consent = GormConsentModel{UserID: id, ClientID: clientID, CreatedAt: p.now(), UpdatedAt: p.now()}
+		consent.Scope = joinScopes(mergeScopes(nil, scopes))
+		return p.db.Table(p.consentTableName()).Create(&consent).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	merged := joinScopes(mergeScopes(strings.Fields(consent.Scope), scopes))
+	return p.db.Table(p.consentTableName()).
+		Where("user_id = ? AND client_id = ?", id, clientID).
+		Updates(map[string]interface{}{"scope": merged, "updated_at": p.now()}).Error
+}
+
+// HasConsent reports whether a user granted all of the scopes to a client
+func (p *GormProvider) HasConsent(userID, clientID string, scopes []string) (bool, error) {
+	var consent GormConsentModel
+	err := p.db.Table(p.consentTableName()).Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	granted := strings.Fields(consent.Scope)
+	for _, scope := range scopes {
+		if !containsString(granted, scope) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ListConsents returns the consents a user has given
+func (p *GormProvider) ListConsents(userID string) ([]Consent, error) {
+	var gormConsents []GormConsentModel
+	if err := p.db.Table(p.consentTableName()).Where("user_id = ?", userID).Order("client_id").Find(&gormConsents).Error; err != nil {
+		return nil, err
+	}
+
+	consents := make([]Consent, len(gormConsents))
+	for i := range gormConsents {
+		consents[i] = *gormConsents[i].ToConsent()
+	}
+	return consents, nil
+}
+
+// RevokeConsent withdraws the consent of a user for a client and revokes the
+// refresh tokens the client holds for the user
+func (p *GormProvider) RevokeConsent(userID, clientID string) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(p.consentTableName()).Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&GormConsentModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(p.refreshTokenTableName()).
+			Where("user_id = ? AND client_id = ? AND revoked_at IS NULL", userID, clientID).
+			Update("revoked_at", p.now()).Error
+	})
+}
+
+// ParseAuthorizationRequest reads an authorization request from its query parameters
+func ParseAuthorizationRequest(query url.Values) *AuthorizationRequest {
+	return &AuthorizationRequest{
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		ResponseType:        query.Get("response_type"),
+		Scopes:              strings.Fields(query.Get("scope")),
+		State:               query.Get("state"),
+		Nonce:               query.Get("nonce"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+}
+
+// validateRedirect checks the client and redirect URI of an authorization
+// request. Errors here must be shown to the user rather than redirected.
+func (p *GormProvider) validateRedirect(request *AuthorizationRequest) (*GormClientModel, error) {
+	gormClient, err := p.getClient(request.ClientID)
+	if errors.Is(err, ErrClientNotFound) {
+		return nil, oauthError(ErrorInvalidClient, "unknown client")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Redirect URIs are compared exactly (RFC 6749 section 3.1.2.3)
+	if !containsString(decodeStrings(gormClient.RedirectURIs), request.RedirectURI) {
+		return nil, oauthError(ErrorInvalidRequest, "redirect_uri is not registered")
+	}
+	return gormClient, nil
+}
+
+// validateAuthorization checks the parameters of an authorization request
+// from a client whose redirect URI is valid
+func (p *GormProvider) validateAuthorization(gormClient *GormClientModel, request *AuthorizationRequest) *userion.OIDCError {
+	if request.ResponseType != "code" {
+		return oauthError(ErrorUnsupportedResponse, "only the code response type is supported")
+	}
+	if !containsString(decodeStrings(gormClient.GrantTypes), GrantAuthorizationCode) {
+		return oauthError(ErrorUnauthorizedClient, "client may not use the authorization code grant")
+	}
+	if request.CodeChallenge == "" || request.CodeChallengeMethod != "S256" {
+		return oauthError(ErrorInvalidRequest, "PKCE with S256 is required")
+	}
+	if !containsString(request.Scopes, ScopeOpenID) {
+		return oauthError(ErrorInvalidScope, "the openid scope is required")
+	}
+	allowed := decodeStrings(gormClient.Scopes)
+	for _, scope := range request.Scopes {
+		if !containsString(allowed, scope) {
+			return oauthError(ErrorInvalidScope, "scope "+scope+" is not allowed for the client")
+		}
+	}
+	return nil
+}
+
+// Authorize issues an authorization code to a user who is signed in and has
+// consented to the requested scopes, and returns the URL to redirect the user
+// agent to. An invalid client or redirect URI is returned as an error; other
+// problems are reported to the client through the returned redirect URL.
+func (p *GormProvider) Authorize(request *AuthorizationRequest, userID string) (string, error) {
+	gormClient, err := p.validateRedirect(request)
+	if err != nil {
+		return "", err
+	}
+
+	if oauthErr := p.validateAuthorization(gormClient, request); oauthErr != nil {
+		return errorRedirect(request, oauthErr), nil
+	}
+
+	user, err := p.userManager.GetUserByID(userID)
+	if errors.Is(err, userion.ErrUserNotFound) {
+		return errorRedirect(request, oauthError(ErrorLoginRequired, "")), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !user.Enabled {
+		return errorRedirect(request, oauthError(ErrorAccessDenied, "user disabled")), nil
+	}
+
+	consented, err := p.HasConsent(userID, gormClient.ID, request.Scopes)
+	if err != nil {
+		return "", err
+	}
+	if !consented {
+		return errorRedirect(request, oauthError(ErrorConsentRequired, "")), nil
+	}
+
+	code, err := userion.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := p.now()
+	record := &GormAuthorizationCodeModel{
+		ID:            uuid.New(),
+		CodeHash:      userion.HashToken(code),
+		ClientID:      gormClient.ID,
+		UserID:        user.ID,
+		RedirectURI:   request.RedirectURI,
+		Scope:         joinScopes(request.Scopes),
+		Nonce:         request.Nonce,
+		CodeChallenge: request.CodeChallenge,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(p.codeTTL),
+		CreatedAt:     now,
+	}
+	if err := p.db.Table(p.codeTableName()).Create(record).Error; err != nil {
+		return "", err
+	}
+
+	params := url.Values{"code": {code}}
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	return appendQuery(request.RedirectURI, params), nil
+}
+
+// errorRedirect returns the redirect URI with an error response
+func errorRedirect(request *AuthorizationRequest, oauthErr *userion.OIDCError) string {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	return appendQuery(request.RedirectURI, params)
+}
+
+// Token handles a request to the token endpoint with the form parameters and
+// the client credentials, which the handler takes from HTTP basic
+// authentication or the form. OAuth errors are returned as *userion.OIDCError.
+func (p *GormProvider) Token(form map[string][]string, clientID, clientSecret string) (*TokenResponse, error) {
+	values := url.Values(form)
+
+	gormClient, err := p.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	grantType := values.Get("grant_type")
+	if grantType != GrantAuthorizationCode && grantType != GrantRefreshToken && grantType != GrantClientCredentials {
+		return nil, oauthError(ErrorUnsupportedGrantType, "")
+	}
+	if !containsString(decodeStrings(gormClient.GrantTypes), grantType) {
+		return nil, oauthError(ErrorUnauthorizedClient, "client may not use the "+grantType+" grant")
+	}
+
+	switch grantType {
+	case GrantAuthorizationCode:
+		return p.exchangeCode(gormClient, values)
+	case GrantRefreshToken:
+		return p.refresh(gormClient, values)
+	default:
+		return p.clientCredentials(gormClient, values)
+	}
+}
+
+// exchangeCode redeems an authorization code. A code presented twice
+// revokes the refresh tokens obtained with it (RFC 6749 section 4.1.2).
+func (p *GormProvider) exchangeCode(gormClient *GormClientModel, values url.Values) (*TokenResponse, error) {
+	var record GormAuthorizationCodeModel
+	err := p.db.Table(p.codeTableName()).Where("code_hash = ?", userion.HashToken(values.Get("code"))).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, oauthError(ErrorInvalidGrant, "unknown code")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if record.ClientID != gormClient.ID {
+		return nil, oauthError(ErrorInvalidGrant, "code was issued to another client")
+	}
+	now := p.now()
+	if record.UsedAt != nil {
+		if err := p.revokeFamily(record.ID); err != nil {
+			return nil, err
+		}
+		return nil, oauthError(ErrorInvalidGrant, "code already used")
+	}
+	if !now.Before(record.ExpiresAt) {
+		return nil, oauthError(ErrorInvalidGrant, "code expired")
+	}
+	if values.Get("redirect_uri") != record.RedirectURI {
+		return nil, oauthError(ErrorInvalidGrant, "redirect_uri does not match")
+	}
+	if subtle.ConstantTimeCompare([]byte(pkceChallenge(values.Get("code_verifier"))), []byte(record.CodeChallenge)) != 1 {
+		return nil, oauthError(ErrorInvalidGrant, "code_verifier does not match")
+	}
+
+	result := p.db.Table(p.codeTableName()).Where("id = ? AND used_at IS NULL", record.ID).Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, oauthError(ErrorInvalidGrant, "code already used")
+	}
+
+	user, err := p.enabledUser(record.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return p.issueTokens(gormClient, user, strings.Fields(record.Scope), record.Nonce, record.AuthTime, record.ID)
+}
+
+// refresh rotates a refresh token. Presenting a rotated token again revokes
+// every token of its family.
+func (p *GormProvider) refresh(gormClient *GormClientModel, values url.Values) (*TokenResponse, error) {
+	var record GormRefreshTokenModel
+	err := p.db.Table(p.refreshTokenTableName()).Where("token_hash = ?", userion.HashToken(values.Get("refresh_token"))).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, oauthError(ErrorInvalidGrant, "unknown refresh token")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if record.ClientID != gormClient.ID || record.RevokedAt != nil {
+		return nil, oauthError(ErrorInvalidGrant, "refresh token revoked")
+	}
+	if record.UsedAt != nil {
+		if err := p.revokeFamily(record.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, oauthError(ErrorInvalidGrant, "refresh token reused")
+	}
+	now := p.now()
+	if !now.Before(record.ExpiresAt) {
+		return nil, oauthError(ErrorInvalidGrant, "refresh token expired")
+	}
+
+	// A narrower scope may be requested (RFC 6749 section 6)
+	scopes := strings.Fields(record.Scope)
+	if requested := strings.Fields(values.Get("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !containsString(scopes, scope) {
+				return nil, oauthError(ErrorInvalidScope, "scope "+scope+" was not granted")
+			}
+		}
+		scopes = requested
+	}
+
+	result := p.db.Table(p.refreshTokenTableName()).Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", record.ID).Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := p.revokeFamily(record.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, oauthError(ErrorInvalidGrant, "refresh token reused")
+	}
+
+	user, err := p.enabledUser(record.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return p.issueTokens(gormClient, user, scopes, "", record.AuthTime, record.FamilyID)
+}
+
+// clientCredentials issues an access token to a confidential client acting on its own behalf
+func (p *GormProvider) clientCredentials(gormClient *GormClientModel, values url.Values) (*TokenResponse, error) {
+	allowed := decodeStrings(gormClient.Scopes)
+	scopes := strings.Fields(values.Get("scope"))
+	for _, scope := range scopes {
+		// Identity scopes need a user
+		if !containsString(allowed, scope) || scope == ScopeOpenID || scope == ScopeOfflineAccess {
+			return nil, oauthError(ErrorInvalidScope, "scope "+scope+" is not allowed for the client")
+		}
+	}
+
+	accessToken, err := p.signAccessToken(gormClient.ID, gormClient.ID, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(p.accessTokenTTL / time.Second),
+		Scope:       joinScopes(scopes),
+	}, nil
+}
+
+// enabledUser loads the user tokens are issued for
+func (p *GormProvider) enabledUser(userID string) (*userion.User, error) {
+	user, err := p.userManager.GetUserByID(userID)
+	if errors.Is(err, userion.ErrUserNotFound) {
+		return nil, oauthError(ErrorInvalidGrant, "user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.Enabled {
+		return nil, oauthError(ErrorInvalidGrant, "user disabled")
+	}
+	return user, nil
+}
+
+// issueTokens signs an access token and an ID token, and stores a refresh
+// token in the family if the client may refresh and offline_access was granted
+func (p *GormProvider) issueTokens(gormClient *GormClientModel, user *userion.User, scopes []string, nonce string, authTime time.Time, familyID uuid.UUID) (*TokenResponse, error) {
+	accessToken, err := p.signAccessToken(user.ID.String(), gormClient.ID, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(p.accessTokenTTL / time.Second),
+		Scope:       joinScopes(scopes),
+	}
+
+	if containsString(scopes, ScopeOpenID) {
+		now := p.now()
+		claims := userClaims(user, scopes)
+		claims["iss"] = p.config.Issuer
+		claims["aud"] = gormClient.ID
+		claims["azp"] = gormClient.ID
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(p.idTokenTTL).Unix()
+		claims["auth_time"] = authTime.Unix()
+		claims["at_hash"] = tokenHash(accessToken)
+		if nonce != "" {
+			claims["nonce"] = nonce
+		}
+		if response.IDToken, err = p.keyRing.Sign(claims); err != nil {
+			return nil, err
+		}
+	}
+
+	if containsString(scopes, ScopeOfflineAccess) && containsString(decodeStrings(gormClient.GrantTypes), GrantRefreshToken) {
+		refreshToken, err := userion.GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+
+		now := p.now()
+		record := &GormRefreshTokenModel{
+			ID:        uuid.New(),
+			FamilyID:  familyID,
+			ClientID:  gormClient.ID,
+			UserID:    user.ID,
+			Scope:     joinScopes(scopes),
+			AuthTime:  authTime,
+			TokenHash: userion.HashToken(refreshToken),
+			ExpiresAt: now.Add(p.refreshTokenTTL),
+			CreatedAt: now,
+		}
+		if err := p.db.Table(p.refreshTokenTableName()).Create(record).Error; err != nil {
+			return nil, err
+		}
+		response.RefreshToken = refreshToken
+	}
+
+	return response, nil
+}
+
+// signAccessToken signs a JWT access token (RFC 9068 claims) for a user or,
+// with the client credentials grant, for the client itself
+func (p *GormProvider) signAccessToken(subject, clientID string, scopes []string) (string, error) {
+	now := p.now()
+	return p.keyRing.Sign(map[string]interface{}{
+		"jti":       uuid.New().String(),
+		"iss":       p.config.Issuer,
+		"sub":       subject,
+		"aud":       p.config.Issuer,
+		"client_id": clientID,
+		"scope":     joinScopes(scopes),
+		"iat":       now.Unix(),
+		"exp":       now.Add(p.accessTokenTTL).Unix(),
+	})
+}
+
+// revokeFamily revokes the refresh tokens obtained with a code
+func (p *GormProvider) revokeFamily(familyID uuid.UUID) error {
+	return p.db.Table(p.refreshTokenTableName()).Where("family_id = ? AND revoked_at IS NULL", familyID).Update("revoked_at", p.now()).Error
+}
+
+// UserInfo validates an access token and returns the claims about its user
+// that the granted scopes allow
+func (p *GormProvider) UserInfo(accessToken string) (map[string]interface{}, error) {
+	claims, err := userion.VerifyJWT(accessToken, p.keyRing, p.now())
+	if err != nil {
+		return nil, oauthError(ErrorInvalidToken, "")
+	}
+
+	// ID tokens are signed by the same keys but are not access tokens
+	if issuer, _ := claims["iss"].(string); issuer != p.config.Issuer || !userion.AudienceClaim(claims, p.config.Issuer) {
+		return nil, oauthError(ErrorInvalidToken, "")
+	}
+	if _, ok := claims["client_id"].(string); !ok {
+		return nil, oauthError(ErrorInvalidToken, "")
+	}
+	scope, _ := claims["scope"].(string)
+	scopes := strings.Fields(scope)
+	if !containsString(scopes, ScopeOpenID) {
+		return nil, oauthError(ErrorInvalidToken, "the openid scope was not granted")
+	}
+
+	subject, _ := claims["sub"].(string)
+	user, err := p.userManager.GetUserByID(subject)
+	if errors.Is(err, userion.ErrUserNotFound) {
+		return nil, oauthError(ErrorInvalidToken, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.Enabled {
+		return nil, oauthError(ErrorInvalidToken, "user disabled")
+	}
+
+	return userClaims(user, scopes), nil
+}
+
+// userClaims returns the standard claims about a user that the scopes allow
+// (OpenID Connect Core section 5.4)
+func userClaims(user *userion.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": user.ID.String(),
+	}
+	if containsString(scopes, ScopeProfile) {
+		claims["name"] = user.Name
+		claims["preferred_username"] = user.Username
+	}
+	if containsString(scopes, ScopeEmail) && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerifiedAt != nil
+	}
+	if containsString(scopes, ScopePhone) && user.Phone != "" {
+		claims["phone_number"] = user.Phone
+		claims["phone_number_verified"] = user.PhoneVerifiedAt != nil
+	}
+	return claims
+}
+
+// Discovery returns the OpenID Provider Metadata served at
+// /.well-known/openid-configuration
+func (p *GormProvider) Discovery() map[string]interface{} {
+	algorithms := []string{}
+	for _, key := range p.keyRing.Keys() {
+		if !containsString(algorithms, key.Algorithm) {
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+
+	return map[string]interface{}{
+		"issuer":                                p.config.Issuer,
+		"authorization_endpoint":                p.config.Issuer + "/authorize",
+		"token_endpoint":                        p.config.Issuer + "/token",
+		"userinfo_endpoint":                     p.config.Issuer + "/userinfo",
+		"jwks_uri":                              p.config.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{GrantAuthorizationCode, GrantRefreshToken, GrantClientCredentials},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": algorithms,
+		"scopes_supported":                      []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopePhone, ScopeOfflineAccess},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"name", "preferred_username", "email", "email_verified", "phone_number", "phone_number_verified",
+		},
+	}
+}
+
+// JWKS returns the public keys clients need to verify ID and access tokens
+func (p *GormProvider) JWKS() *userion.JWKSet {
+	return p.keyRing.JWKS()
+}
+
+// HandleEvent revokes the refresh tokens of a user whose password changed or
+// who was disabled. Register it with userion.WithEventHandler.
+func (p *GormProvider) HandleEvent(event userion.Event) {
+	switch event.Type {
+	case userion.EventPasswordChanged, userion.EventPasswordReset, userion.EventUserDisabled:
+		// Errors cannot be reported back to the emitting manager
+		_ = p.db.Table(p.refreshTokenTableName()).
+			Where("user_id = ? AND revoked_at IS NULL", event.UserID).
+			Update("revoked_at", p.now()).Error
+	}
+}
+
+// pkceChallenge derives the S256 code challenge of a code verifier (RFC 7636)
+func pkceChallenge(verifier string) string {
+	digest := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// tokenHash computes the at_hash of an access token signed with a SHA-256
+// based algorithm (OpenID Connect Core section 3.1.3.6)
+func tokenHash(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(digest[:len(digest)/2])
+}
+
+// appendQuery adds parameters to a URL that may already have a query
+func appendQuery(rawURL string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+	return rawURL + separator + params.Encode()
+}
+
+// mergeScopes returns the scopes of a followed by those of b that are missing
+func mergeScopes(a, b []string) []string {
+	merged := append([]string{}, a...)
+	for _, scope := range b {
+		if !containsString(merged, scope) {
+			merged = append(merged, scope)
+		}
+	}
+	return merged
+}
+
+// joinScopes formats scopes as a space-separated scope parameter
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeStrings stores a string list as JSON
+func encodeStrings(list []string) datatypes.JSON {
+	if list == nil {
+		list = []string{}
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return datatypes.JSON("[]")
+	}
+	return datatypes.JSON(data)
+}
+
+// decodeStrings reads a string list stored as JSON
+func decodeStrings(data datatypes.JSON) []string {
+	list := []string{}
+	if len(data) > 0 {
+		if err := json.Unmarshal([]byte(data), &list); err != nil {
+			return []string{}
+		}
+	}
+	return list
+}
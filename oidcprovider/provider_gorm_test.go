@@ -0,0 +1,423 @@
+package oidcprovider
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weedbox/userion"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testIssuer = "https://id.example.com"
+
+// setupProviderGorm creates a provider backed by an in-memory database
+func setupProviderGorm(t *testing.T, opts ...userion.GormUserManagerOption) (*GormProvider, userion.UserManager) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to database")
+	t.Cleanup(func() {
+		sqlDB, err := db.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	suffix := uuid.New().String()[:8]
+	userManager := userion.NewGormUserManager(db, "users_test_"+suffix, opts...)
+	require.NoError(t, userManager.AutoMigrate(), "Failed to migrate database")
+
+	key, err := userion.GenerateSigningKey("ES256")
+	require.NoError(t, err)
+
+	provider := NewGormProvider(db, "oidc_clients_test_"+suffix, userManager, userion.NewKeyRing(key), Config{Issuer: testIssuer}).(*GormProvider)
+	require.NoError(t, provider.AutoMigrate(), "Failed to migrate database")
+
+	return provider, userManager
+}
+
+// createTestUser creates a user to sign in
+func createTestUser(t *testing.T, userManager userion.UserManager) *userion.User {
+	user := &userion.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: "password123",
+		Name:     "Test User",
+		Phone:    "1234567890",
+	}
+	require.NoError(t, userManager.CreateUser(user))
+	return user
+}
+
+// registerTestClient registers a confidential client
+func registerTestClient(t *testing.T, provider *GormProvider) (*Client, string) {
+	client := &Client{
+		Name:         "Wiki",
+		RedirectURIs: []string{"https://wiki.example.com/callback"},
+	}
+	secret, err := provider.RegisterClient(client)
+	require.NoError(t, err)
+	return client, secret
+}
+
+// testVerifier is the PKCE code verifier used by the tests
+const testVerifier = "dBjftJeZ4CVP-mJ92ZOKx0sPzYBw6bdDBk8W4kzh3Hc"
+
+// authorizationRequest returns a valid authorization request for a client
+func authorizationRequest(client *Client, scopes ...string) *AuthorizationRequest {
+	return &AuthorizationRequest{
+		ClientID:            client.ID,
+		RedirectURI:         client.RedirectURIs[0],
+		ResponseType:        "code",
+		Scopes:              scopes,
+		State:               "xyz",
+		Nonce:               "n-0S6",
+		CodeChallenge:       pkceChallenge(testVerifier),
+		CodeChallengeMethod: "S256",
+	}
+}
+
+// authorize grants consent and returns the code of an authorization request
+func authorize(t *testing.T, provider *GormProvider, client *Client, userID string, scopes ...string) string {
+	require.NoError(t, provider.GrantConsent(userID, client.ID, scopes))
+
+	redirectURL, err := provider.Authorize(authorizationRequest(client, scopes...), userID)
+	require.NoError(t, err)
+
+	u, err := url.Parse(redirectURL)
+	require.NoError(t, err)
+	require.Empty(t, u.Query().Get("error"))
+	assert.Equal(t, "xyz", u.Query().Get("state"))
+	return u.Query().Get("code")
+}
+
+// exchange redeems a code for tokens
+func exchange(provider *GormProvider, client *Client, secret, code string) (*TokenResponse, error) {
+	return provider.Token(url.Values{
+		"grant_type":    {GrantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {client.RedirectURIs[0]},
+		"code_verifier": {testVerifier},
+	}, client.ID, secret)
+}
+
+// requireOAuthError asserts that err is an OAuth error with the code
+func requireOAuthError(t *testing.T, err error, code string) {
+	oauthErr, ok := err.(*userion.OIDCError)
+	require.True(t, ok, "Expected an OAuth error, got %v", err)
+	assert.Equal(t, code, oauthErr.Code)
+}
+
+// TestRegisterClient_Gorm tests client registration and lookup
+func TestRegisterClient_Gorm(t *testing.T) {
+	provider, _ := setupProviderGorm(t)
+
+	client, secret := registerTestClient(t, provider)
+	assert.NotEmpty(t, client.ID)
+	assert.NotEmpty(t, secret)
+	assert.Equal(t, []string{GrantAuthorizationCode, GrantRefreshToken}, client.GrantTypes, "Grant types should default")
+
+	stored, err := provider.GetClient(client.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Wiki", stored.Name)
+	assert.Equal(t, client.RedirectURIs, stored.RedirectURIs)
+
+	var model GormClientModel
+	require.NoError(t, provider.db.Table(provider.tableName).Where("id = ?", client.ID).First(&model).Error)
+	assert.Equal(t, userion.HashToken(secret), model.SecretHash, "Only the hash of the secret should be stored")
+
+	_, err = provider.RegisterClient(&Client{ID: client.ID, Name: "Other"})
+	assert.ErrorIs(t, err, ErrClientExists)
+
+	public := &Client{Name: "CLI", Public: true, RedirectURIs: []string{"http://127.0.0.1/callback"}}
+	secret, err = provider.RegisterClient(public)
+	require.NoError(t, err)
+	assert.Empty(t, secret, "Public clients should get no secret")
+
+	_, err = provider.RegisterClient(&Client{Name: "Bad", Public: true, GrantTypes: []string{GrantClientCredentials}})
+	assert.Error(t, err, "Public clients cannot use client credentials")
+
+	clients, err := provider.ListClients()
+	require.NoError(t, err)
+	assert.Len(t, clients, 2)
+
+	require.NoError(t, provider.DeleteClient(client.ID))
+	_, err = provider.GetClient(client.ID)
+	assert.ErrorIs(t, err, ErrClientNotFound)
+	assert.ErrorIs(t, provider.DeleteClient(client.ID), ErrClientNotFound)
+}
+
+// TestConsent_Gorm tests recording and revoking consent
+func TestConsent_Gorm(t *testing.T) {
+	provider, userManager := setupProviderGorm(t)
+	user := createTestUser(t, userManager)
+	client, _ := registerTestClient(t, provider)
+	userID := user.ID.String()
+
+	ok, err := provider.HasConsent(userID, client.ID, []string{ScopeOpenID})
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, provider.GrantConsent(userID, client.ID, []string{ScopeOpenID, ScopeEmail}))
+	require.NoError(t, provider.GrantConsent(userID, client.ID, []string{ScopeProfile}))
+
+	ok, err = provider.HasConsent(userID, client.ID, []string{ScopeOpenID, ScopeEmail, ScopeProfile})
+	require.NoError(t, err)
+	assert.True(t, ok, "Granted scopes should accumulate")
+
+	ok, err = provider.HasConsent(userID, client.ID, []string{ScopePhone})
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	consents, err := provider.ListConsents(userID)
+	require.NoError(t, err)
+	require.Len(t, consents, 1)
+	assert.Equal(t, []string{ScopeOpenID, ScopeEmail, ScopeProfile}, consents[0].Scopes)
+
+	assert.ErrorIs(t, provider.GrantConsent(userID, "unknown", []string{ScopeOpenID}), ErrClientNotFound)
+
+	require.NoError(t, provider.RevokeConsent(userID, client.ID))
+	ok, err = provider.HasConsent(userID, client.ID, []string{ScopeOpenID})
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+// TestAuthorize_Gorm tests the validation of authorization requests
+func TestAuthorize_Gorm(t *testing.T) {
+	provider, userManager := setupProviderGorm(t)
+	user := createTestUser(t, userManager)
+	client, _ := registerTestClient(t, provider)
+	userID := user.ID.String()
+
+	request := authorizationRequest(client, ScopeOpenID)
+	request.RedirectURI = "https://evil.example.com/callback"
+	_, err := provider.Authorize(request, userID)
+	requireOAuthError(t, err, ErrorInvalidRequest)
+
+	request = authorizationRequest(client, ScopeOpenID)
+	request.ClientID = "unknown"
+	_, err = provider.Authorize(request, userID)
+	requireOAuthError(t, err, ErrorInvalidClient)
+
+	errorOf := func(request *AuthorizationRequest) string {
+		redirectURL, err := provider.Authorize(request, userID)
+		require.NoError(t, err)
+		u, err := url.Parse(redirectURL)
+		require.NoError(t, err)
+		assert.Equal(t, "xyz", u.Query().Get("state"))
+		return u.Query().Get("error")
+	}
+
+	assert.Equal(t, ErrorConsentRequired, errorOf(authorizationRequest(client, ScopeOpenID)))
+
+	require.NoError(t, provider.GrantConsent(userID, client.ID, []string{ScopeOpenID}))
+
+	request = authorizationRequest(client, ScopeOpenID)
+	request.CodeChallengeMethod = "plain"
+	assert.Equal(t, ErrorInvalidRequest, errorOf(request), "PKCE with S256 should be required")
+
+	request = authorizationRequest(client, ScopeOpenID)
+	request.ResponseType = "token"
+	assert.Equal(t, ErrorUnsupportedResponse, errorOf(request))
+
+	assert.Equal(t, ErrorInvalidScope, errorOf(authorizationRequest(client, ScopeProfile)), "openid should be required")
+	assert.Equal(t, ErrorInvalidScope, errorOf(authorizationRequest(client, ScopeOpenID, "admin")))
+
+	require.NoError(t, userManager.DisableUserByID(userID))
+	assert.Equal(t, ErrorAccessDenied, errorOf(authorizationRequest(client, ScopeOpenID)))
+}
+
+// TestAuthorizationCodeGrant_Gorm tests redeeming a code for tokens
+func TestAuthorizationCodeGrant_Gorm(t *testing.T) {
+	provider, userManager := setupProviderGorm(t)
+	user := createTestUser(t, userManager)
+	client, secret := registerTestClient(t, provider)
+
+	code := authorize(t, provider, client, user.ID.String(), ScopeOpenID, ScopeProfile, ScopeEmail, ScopeOfflineAccess)
+
+	_, err := exchange(provider, client, "wrong", code)
+	requireOAuthError(t, err, ErrorInvalidClient)
+
+	_, err = provider.Token(url.Values{
+		"grant_type":    {GrantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {client.RedirectURIs[0]},
+		"code_verifier": {"wrong-verifier"},
+	}, client.ID, secret)
+	requireOAuthError(t, err, ErrorInvalidGrant)
+
+	response, err := exchange(provider, client, secret, code)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", response.TokenType)
+	assert.NotEmpty(t, response.AccessToken)
+	assert.NotEmpty(t, response.RefreshToken, "offline_access should issue a refresh token")
+	assert.Equal(t, "openid profile email offline_access", response.Scope)
+
+	claims, err := userion.VerifyJWT(response.IDToken, provider.keyRing, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, testIssuer, claims["iss"])
+	assert.Equal(t, user.ID.String(), claims["sub"])
+	assert.Equal(t, client.ID, claims["aud"])
+	assert.Equal(t, "n-0S6", claims["nonce"])
+	assert.Equal(t, "testuser", claims["preferred_username"])
+	assert.Equal(t, "test@example.com", claims["email"])
+	assert.Equal(t, false, claims["email_verified"])
+	assert.NotContains(t, claims, "phone_number", "The phone scope was not granted")
+
+	userInfo, err := provider.UserInfo(response.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID.String(), userInfo["sub"])
+	assert.Equal(t, "Test User", userInfo["name"])
+
+	_, err = provider.UserInfo(response.IDToken)
+	requireOAuthError(t, err, ErrorInvalidToken)
+
+	// Replaying the code revokes the tokens obtained with it
+	_, err = exchange(provider, client, secret, code)
+	requireOAuthError(t, err, ErrorInvalidGrant)
+
+	_, err = provider.Token(url.Values{
+		"grant_type":    {GrantRefreshToken},
+		"refresh_token": {response.RefreshToken},
+	}, client.ID, secret)
+	requireOAuthError(t, err, ErrorInvalidGrant)
+}
+
+// TestAuthorizationCodeExpired_Gorm tests that expired codes are rejected
+func TestAuthorizationCodeExpired_Gorm(t *testing.T) {
+	provider, userManager := setupProviderGorm(t)
+	user := createTestUser(t, userManager)
+	client, secret := registerTestClient(t, provider)
+
+	code := authorize(t, provider, client, user.ID.String(), ScopeOpenID)
+
+	provider.now = func() time.Time { return time.Now().Add(DefaultCodeTTL + time.Second) }
+	_, err := exchange(provider, client, secret, code)
+	requireOAuthError(t, err, ErrorInvalidGrant)
+}
+
+// TestRefreshTokenGrant_Gorm tests refresh token rotation and reuse detection
+func TestRefreshTokenGrant_Gorm(t *testing.T) {
+	provider, userManager := setupProviderGorm(t)
+	user := createTestUser(t, userManager)
+	client, secret := registerTestClient(t, provider)
+
+	code := authorize(t, provider, client, user.ID.String(), ScopeOpenID, ScopeEmail, ScopeOfflineAccess)
+	first, err := exchange(provider, client, secret, code)
+	require.NoError(t, err)
+
+	refresh := func(refreshToken string, scope string) (*TokenResponse, error) {
+		form := url.Values{"grant_type": {GrantRefreshToken}, "refresh_token": {refreshToken}}
+		if scope != "" {
+			form.Set("scope", scope)
+		}
+		return provider.Token(form, client.ID, secret)
+	}
+
+	_, err = refresh(first.RefreshToken, "openid phone")
+	requireOAuthError(t, err, ErrorInvalidScope)
+
+	second, err := refresh(first.RefreshToken, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken, "Refresh tokens should rotate")
+	assert.NotEmpty(t, second.IDToken)
+
+	// Presenting the rotated token again revokes the family
+	_, err = refresh(first.RefreshToken, "")
+	requireOAuthError(t, err, ErrorInvalidGrant)
+	_, err = refresh(second.RefreshToken, "")
+	requireOAuthError(t, err, ErrorInvalidGrant)
+}
+
+// TestRefreshTokenRevokedOnEvent_Gorm tests that password changes revoke refresh tokens
+func TestRefreshTokenRevokedOnEvent_Gorm(t *testing.T) {
+	provider, userManager := setupProviderGorm(t)
+	user := createTestUser(t, userManager)
+	client, secret := registerTestClient(t, provider)
+
+	code := authorize(t, provider, client, user.ID.String(), ScopeOpenID, ScopeOfflineAccess)
+	response, err := exchange(provider, client, secret, code)
+	require.NoError(t, err)
+
+	provider.HandleEvent(userion.Event{Type: userion.EventPasswordChanged, UserID: user.ID, Time: time.Now()})
+
+	_, err = provider.Token(url.Values{
+		"grant_type":    {GrantRefreshToken},
+		"refresh_token": {response.RefreshToken},
+	}, client.ID, secret)
+	requireOAuthError(t, err, ErrorInvalidGrant)
+}
+
+// TestClientCredentialsGrant_Gorm tests tokens issued to clients themselves
+func TestClientCredentialsGrant_Gorm(t *testing.T) {
+	provider, _ := setupProviderGorm(t)
+
+	client := &Client{Name: "Reporting", GrantTypes: []string{GrantClientCredentials}, Scopes: []string{"reports:read"}}
+	secret, err := provider.RegisterClient(client)
+	require.NoError(t, err)
+
+	_, err = provider.Token(url.Values{"grant_type": {GrantClientCredentials}, "scope": {"reports:write"}}, client.ID, secret)
+	requireOAuthError(t, err, ErrorInvalidScope)
+
+	response, err := provider.Token(url.Values{"grant_type": {GrantClientCredentials}, "scope": {"reports:read"}}, client.ID, secret)
+	require.NoError(t, err)
+	assert.Empty(t, response.IDToken)
+	assert.Empty(t, response.RefreshToken)
+
+	claims, err := userion.VerifyJWT(response.AccessToken, provider.keyRing, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, client.ID, claims["sub"])
+	assert.Equal(t, "reports:read", claims["scope"])
+
+	_, err = provider.Token(url.Values{"grant_type": {GrantAuthorizationCode}}, client.ID, secret)
+	requireOAuthError(t, err, ErrorUnauthorizedClient)
+}
+
+// TestPublicClient_Gorm tests that public clients authenticate with PKCE only
+func TestPublicClient_Gorm(t *testing.T) {
+	provider, userManager := setupProviderGorm(t)
+	user := createTestUser(t, userManager)
+
+	client := &Client{Name: "CLI", Public: true, RedirectURIs: []string{"http://127.0.0.1:8400/callback"}}
+	_, err := provider.RegisterClient(client)
+	require.NoError(t, err)
+
+	code := authorize(t, provider, client, user.ID.String(), ScopeOpenID)
+
+	_, err = exchange(provider, client, "guess", code)
+	requireOAuthError(t, err, ErrorInvalidClient)
+
+	response, err := exchange(provider, client, "", code)
+	require.NoError(t, err)
+	assert.NotEmpty(t, response.IDToken)
+}
+
+// TestUserInfoScopes_Gorm tests the claims released for each scope
+func TestUserInfoScopes_Gorm(t *testing.T) {
+	user := &userion.User{ID: uuid.New(), Username: "jane", Name: "Jane", Email: "jane@example.com", Phone: "+15551234567"}
+	verified := time.Now()
+	user.PhoneVerifiedAt = &verified
+
+	claims := userClaims(user, []string{ScopeOpenID})
+	assert.Equal(t, map[string]interface{}{"sub": user.ID.String()}, claims)
+
+	claims = userClaims(user, []string{ScopeOpenID, ScopePhone, ScopeEmail})
+	assert.Equal(t, "+15551234567", claims["phone_number"])
+	assert.Equal(t, true, claims["phone_number_verified"])
+	assert.Equal(t, false, claims["email_verified"])
+	assert.NotContains(t, claims, "name")
+}
+
+// TestDiscovery_Gorm tests the provider metadata
+func TestDiscovery_Gorm(t *testing.T) {
+	provider, _ := setupProviderGorm(t)
+
+	metadata := provider.Discovery()
+	assert.Equal(t, testIssuer, metadata["issuer"])
+	assert.Equal(t, testIssuer+"/token", metadata["token_endpoint"])
+	assert.Equal(t, []string{"ES256"}, metadata["id_token_signing_alg_values_supported"])
+	assert.Len(t, provider.JWKS().Keys, 1)
+}
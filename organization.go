@@ -0,0 +1,110 @@
+package userion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Common errors returned by the OrganizationManager
+var (
+	ErrOrganizationNotFound      = errors.New("organization not found")
+	ErrOrganizationAlreadyExists = errors.New("organization already exists")
+	ErrNotOrganizationMember     = errors.New("user is not a member of the organization")
+	ErrAlreadyOrganizationMember = errors.New("user is already a member of the organization")
+	ErrInvalidOrganizationRole   = errors.New("invalid organization role")
+	ErrInvitationNotFound        = errors.New("invitation not found")
+	ErrOrganizationRoleTooLow    = errors.New("organization role does not permit this")
+
+	// Every organization has exactly one owner, who can only change through TransferOwnership
+	ErrOwnerRequired = errors.New("organization owner cannot be removed or demoted")
+)
+
+// OrganizationRole is the role of a member within an organization
+type OrganizationRole string
+
+const (
+	// OrganizationRoleOwner is held by exactly one member per organization
+	OrganizationRoleOwner OrganizationRole = "owner"
+	// OrganizationRoleAdmin manages members and settings of an organization
+	OrganizationRoleAdmin OrganizationRole = "admin"
+	// OrganizationRoleMember is a regular member of an organization
+	OrganizationRoleMember OrganizationRole = "member"
+)
+
+// organizationRoleRanks orders the organization roles from least to most privileged
+var organizationRoleRanks = map[OrganizationRole]int{
+	OrganizationRoleMember: 1,
+	OrganizationRoleAdmin:  2,
+	OrganizationRoleOwner:  3,
+}
+
+// Valid reports whether r is one of the defined organization roles
+func (r OrganizationRole) Valid() bool {
+	_, ok := organizationRoleRanks[r]
+	return ok
+}
+
+// AtLeast reports whether r grants at least the privileges of other, e.g.
+// OrganizationRoleOwner.AtLeast(OrganizationRoleAdmin) is true
+func (r OrganizationRole) AtLeast(other OrganizationRole) bool {
+	return r.Valid() && organizationRoleRanks[r] >= organizationRoleRanks[other]
+}
+
+// Organization is a customer account that users belong to with a role
+type Organization struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrganizationMember is the membership of a user in an organization
+type OrganizationMember struct {
+	OrganizationID uuid.UUID        `json:"organization_id"`
+	UserID         uuid.UUID        `json:"user_id"`
+	Role           OrganizationRole `json:"role"`
+	CreatedAt      time.Time        `json:"created_at"`
+}
+
+// OrganizationMembership is an organization as seen by one of its members
+type OrganizationMembership struct {
+	Organization Organization     `json:"organization"`
+	Role         OrganizationRole `json:"role"`
+}
+
+// OrganizationInvitation invites an email address to join an organization
+type OrganizationInvitation struct {
+	ID             uuid.UUID        `json:"id"`
+	OrganizationID uuid.UUID        `json:"organization_id"`
+	Email          string           `json:"email"`
+	Role           OrganizationRole `json:"role"`
+	InvitedBy      uuid.UUID        `json:"invited_by"`
+	ExpiresAt      time.Time        `json:"expires_at"`
+	CreatedAt      time.Time        `json:"created_at"`
+}
+
+// OrganizationManager defines the interface for managing organizations,
+// their members and invitations
+type OrganizationManager interface {
+	AutoMigrate() error
+
+	CreateOrganization(name, ownerID string) (*Organization, error)
+	GetOrganizationByID(id string) (*Organization, error)
+	GetOrganizationByName(name string) (*Organization, error)
+	UpdateOrganizationByID(id string, data map[string]interface{}) error
+	DeleteOrganizationByID(id string) error
+
+	AddMember(organizationID, userID string, role OrganizationRole, addedBy string) error
+	RemoveMember(organizationID, userID string, removedBy string) error
+	SetMemberRole(organizationID, userID string, role OrganizationRole, changedBy string) error
+	GetMember(organizationID, userID string) (*OrganizationMember, error)
+	ListMembers(organizationID string) ([]OrganizationMember, error)
+	ListUserOrganizations(userID string) ([]OrganizationMembership, error)
+	TransferOwnership(organizationID, newOwnerID string, transferredBy string) error
+
+	Invite(organizationID, email string, role OrganizationRole, invitedBy string) (*OrganizationInvitation, string, error)
+	ListInvitations(organizationID string) ([]OrganizationInvitation, error)
+	RevokeInvitation(id string) error
+	AcceptInvitation(token string, newUser *User) (*User, error)
+}
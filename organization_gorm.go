@@ -0,0 +1,654 @@
+package userion
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultInvitationTTL is how long organization invitations stay valid
+const DefaultInvitationTTL = 7 * 24 * time.Hour
+
+// GormOrganizationModel represents the GORM-specific database model for organizations
+type GormOrganizationModel struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	Name      string    `gorm:"unique;not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// ToOrganization converts a GormOrganizationModel to an Organization business model
+func (g *GormOrganizationModel) ToOrganization() *Organization {
+	return &Organization{
+		ID:        g.ID,
+		Name:      g.Name,
+		CreatedAt: g.CreatedAt,
+	}
+}
+
+// GormOrganizationMemberModel makes a user a member of an organization
+type GormOrganizationMemberModel struct {
+	OrganizationID uuid.UUID        `gorm:"type:uuid;primaryKey;"`
+	UserID         uuid.UUID        `gorm:"type:uuid;primaryKey;index"`
+	Role           OrganizationRole `gorm:"type:varchar(16);not null"`
+	CreatedAt      time.Time        `gorm:"autoCreateTime"`
+}
+
+// ToOrganizationMember converts a GormOrganizationMemberModel to an OrganizationMember business model
+func (g *GormOrganizationMemberModel) ToOrganizationMember() *OrganizationMember {
+	return &OrganizationMember{
+		OrganizationID: g.OrganizationID,
+		UserID:         g.UserID,
+		Role:           g.Role,
+		CreatedAt:      g.CreatedAt,
+	}
+}
+
+// GormOrganizationInvitationModel represents a pending, accepted or revoked
+// invitation. Only the hash of the invitation token is stored.
+type GormOrganizationInvitationModel struct {
+	ID             uuid.UUID        `gorm:"type:uuid;primaryKey;"`
+	OrganizationID uuid.UUID        `gorm:"type:uuid;not null;index"`
+	Email          string           `gorm:"not null;index"`
+	Role           OrganizationRole `gorm:"type:varchar(16);not null"`
+	InvitedBy      uuid.UUID        `gorm:"type:uuid;not null"`
+	TokenHash      string           `gorm:"type:varchar(64);unique;not null"`
+	ExpiresAt      time.Time        `gorm:"not null"`
+	AcceptedAt     *time.Time
+	AcceptedBy     *uuid.UUID `gorm:"type:uuid"`
+	RevokedAt      *time.Time
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+// ToOrganizationInvitation converts a GormOrganizationInvitationModel to an OrganizationInvitation business model
+func (g *GormOrganizationInvitationModel) ToOrganizationInvitation() *OrganizationInvitation {
+	return &OrganizationInvitation{
+		ID:             g.ID,
+		OrganizationID: g.OrganizationID,
+		Email:          g.Email,
+		Role:           g.Role,
+		InvitedBy:      g.InvitedBy,
+		ExpiresAt:      g.ExpiresAt,
+		CreatedAt:      g.CreatedAt,
+	}
+}
+
+// GormOrganizationManager is the GORM implementation of OrganizationManager
+type GormOrganizationManager struct {
+	db          *gorm.DB
+	tableName   string
+	userManager UserManager
+
+	invitationTTL time.Duration
+
+	now func() time.Time
+}
+
+// OrganizationOption configures optional behaviour of a GormOrganizationManager
+type OrganizationOption func(*GormOrganizationManager)
+
+// WithInvitationTTL sets how long invitations stay valid
+func WithInvitationTTL(ttl time.Duration) OrganizationOption {
+	return func(m *GormOrganizationManager) {
+		m.invitationTTL = ttl
+	}
+}
+
+// NewGormOrganizationManager initializes a new OrganizationManager. The table
+// name is used for organizations and as the prefix of the membership and
+// invitation tables.
+func NewGormOrganizationManager(db *gorm.DB, tableName string, userManager UserManager, opts ...OrganizationOption) OrganizationManager {
+	m := &GormOrganizationManager{
+		db:            db,
+		tableName:     tableName,
+		userManager:   userManager,
+		invitationTTL: DefaultInvitationTTL,
+		now:           time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// memberTableName returns the name of the table holding memberships
+func (m *GormOrganizationManager) memberTableName() string {
+	return m.tableName + "_members"
+}
+
+// invitationTableName returns the name of the table holding invitations
+func (m *GormOrganizationManager) invitationTableName() string {
+	return m.tableName + "_invitations"
+}
+
+// AutoMigrate creates or updates the database schema for organizations,
+// memberships and invitations
+func (m *GormOrganizationManager) AutoMigrate() error {
+	if err := m.db.Table(m.tableName).AutoMigrate(&GormOrganizationModel{}); err != nil {
+		return err
+	}
+	if err := m.db.Table(m.memberTableName()).AutoMigrate(&GormOrganizationMemberModel{}); err != nil {
+		return err
+	}
+	return m.db.Table(m.invitationTableName()).AutoMigrate(&GormOrganizationInvitationModel{})
+}
+
+// CreateOrganization creates an organization with a unique name, owned by the given user
+func (m *GormOrganizationManager) CreateOrganization(name, ownerID string) (*Organization, error) {
+	owner, err := m.userManager.GetUserByID(ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := m.db.Table(m.tableName).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrOrganizationAlreadyExists
+	}
+
+	now := m.now()
+	gormOrganization := &GormOrganizationModel{
+		ID:        uuid.New(),
+		Name:      name,
+		CreatedAt: now,
+	}
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(m.tableName).Create(gormOrganization).Error; err != nil {
+			return err
+		}
+		member := &GormOrganizationMemberModel{
+			OrganizationID: gormOrganization.ID,
+			UserID:         owner.ID,
+			Role:           OrganizationRoleOwner,
+			CreatedAt:      now,
+		}
+		return tx.Table(m.memberTableName()).Create(member).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return gormOrganization.ToOrganization(), nil
+}
+
+// getOrganization retrieves an organization by a column value
+func (m *GormOrganizationManager) getOrganization(column string, value interface{}) (*GormOrganizationModel, error) {
+	var gormOrganization GormOrganizationModel
+	if err := m.db.Table(m.tableName).Where(column+" = ?", value).First(&gormOrganization).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	return &gormOrganization, nil
+}
+
+// GetOrganizationByID retrieves an organization by ID
+func (m *GormOrganizationManager) GetOrganizationByID(id string) (*Organization, error) {
+	gormOrganization, err := m.getOrganization("id", id)
+	if err != nil {
+		return nil, err
+	}
+	return gormOrganization.ToOrganization(), nil
+}
+
+// GetOrganizationByName retrieves an organization by name
+func (m *GormOrganizationManager) GetOrganizationByName(name string) (*Organization, error) {
+	gormOrganization, err := m.getOrganization("name", name)
+	if err != nil {
+		return nil, err
+	}
+	return gormOrganization.ToOrganization(), nil
+}
+
+// UpdateOrganizationByID updates the name of an organization
+func (m *GormOrganizationManager) UpdateOrganizationByID(id string, data map[string]interface{}) error {
+	if name, ok := data["name"]; ok {
+		var count int64
+		if err := m.db.Table(m.tableName).Where("name = ? AND id <> ?", name, id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOrganizationAlreadyExists
+		}
+	}
+
+	result := m.db.Table(m.tableName).Where("id = ?", id).Updates(data)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrganizationNotFound
+	}
+	return nil
+}
+
+// DeleteOrganizationByID removes an organization together with its memberships and invitations
+func (m *GormOrganizationManager) DeleteOrganizationByID(id string) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Table(m.tableName).Where("id = ?", id).Delete(&GormOrganizationModel{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationNotFound
+		}
+
+		if err := tx.Table(m.memberTableName()).Where("organization_id = ?", id).Delete(&GormOrganizationMemberModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(m.invitationTableName()).Where("organization_id = ?", id).Delete(&GormOrganizationInvitationModel{}).Error
+	})
+}
+
+// getMember retrieves the membership of a user in an organization
+func (m *GormOrganizationManager) getMember(tx *gorm.DB, organizationID, userID interface{}) (*GormOrganizationMemberModel, error) {
+	var member GormOrganizationMemberModel
+	if err := tx.Table(m.memberTableName()).Where("organization_id = ? AND user_id = ?", organizationID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotOrganizationMember
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+// addMember creates a membership unless the user already is a member
+func (m *GormOrganizationManager) addMember(tx *gorm.DB, organizationID, userID uuid.UUID, role OrganizationRole) error {
+	var count int64
+	if err := tx.Table(m.memberTableName()).Where("organization_id = ? AND user_id = ?", organizationID, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAlreadyOrganizationMember
+	}
+
+	member := &GormOrganizationMemberModel{
+		OrganizationID: organizationID,
+		UserID:         userID,
+		Role:           role,
+		CreatedAt:      m.now(),
+	}
+	return tx.Table(m.memberTableName()).Create(member).Error
+}
+
+// AddMember adds a user to an organization as admin or member. Owners are
+// only made by CreateOrganization and TransferOwnership. Like Invite, only
+// admins and the owner may add members, to a role no higher than their own.
+func (m *GormOrganizationManager) AddMember(organizationID, userID string, role OrganizationRole, addedBy string) error {
+	if !role.Valid() || role == OrganizationRoleOwner {
+		return ErrInvalidOrganizationRole
+	}
+
+	gormOrganization, err := m.getOrganization("id", organizationID)
+	if err != nil {
+		return err
+	}
+	if _, err := m.authorize(gormOrganization.ID, addedBy, role); err != nil {
+		return err
+	}
+	user, err := m.userManager.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	return m.addMember(m.db, gormOrganization.ID, user.ID, role)
+}
+
+// RemoveMember removes a member other than the owner from an organization.
+// Members may remove themselves; removing others takes an admin or the owner
+// holding at least the role of the removed member.
+func (m *GormOrganizationManager) RemoveMember(organizationID, userID string, removedBy string) error {
+	member, err := m.getMember(m.db, organizationID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role == OrganizationRoleOwner {
+		return ErrOwnerRequired
+	}
+	actor, err := m.getMember(m.db, member.OrganizationID, removedBy)
+	if err != nil {
+		return err
+	}
+	if actor.UserID != member.UserID && !canManage(actor.Role, member.Role) {
+		return ErrOrganizationRoleTooLow
+	}
+
+	return m.db.Table(m.memberTableName()).Where("organization_id = ? AND user_id = ?", member.OrganizationID, member.UserID).Delete(&GormOrganizationMemberModel{}).Error
+}
+
+// SetMemberRole changes the role of a member other than the owner to admin or
+// member. Only admins and the owner may change roles, and only between roles
+// no higher than their own.
+func (m *GormOrganizationManager) SetMemberRole(organizationID, userID string, role OrganizationRole, changedBy string) error {
+	if !role.Valid() || role == OrganizationRoleOwner {
+		return ErrInvalidOrganizationRole
+	}
+
+	member, err := m.getMember(m.db, organizationID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role == OrganizationRoleOwner {
+		return ErrOwnerRequired
+	}
+	if _, err := m.authorize(member.OrganizationID, changedBy, member.Role, role); err != nil {
+		return err
+	}
+
+	return m.db.Table(m.memberTableName()).Where("organization_id = ? AND user_id = ?", member.OrganizationID, member.UserID).Update("role", role).Error
+}
+
+// authorize returns the membership of actorID, or ErrOrganizationRoleTooLow
+// unless the actor is an admin or the owner holding at least each of roles
+func (m *GormOrganizationManager) authorize(organizationID uuid.UUID, actorID string, roles ...OrganizationRole) (*GormOrganizationMemberModel, error) {
+	actor, err := m.getMember(m.db, organizationID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if !canManage(actor.Role, roles...) {
+		return nil, ErrOrganizationRoleTooLow
+	}
+	return actor, nil
+}
+
+// canManage reports whether a member with the actor's role may manage
+// members holding roles
+func canManage(actor OrganizationRole, roles ...OrganizationRole) bool {
+	if !actor.AtLeast(OrganizationRoleAdmin) {
+		return false
+	}
+	for _, role := range roles {
+		if !actor.AtLeast(role) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetMember returns the membership of a user in an organization
+func (m *GormOrganizationManager) GetMember(organizationID, userID string) (*OrganizationMember, error) {
+	member, err := m.getMember(m.db, organizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return member.ToOrganizationMember(), nil
+}
+
+// ListMembers returns the members of an organization in the order they joined
+func (m *GormOrganizationManager) ListMembers(organizationID string) ([]OrganizationMember, error) {
+	if _, err := m.getOrganization("id", organizationID); err != nil {
+		return nil, err
+	}
+
+	var gormMembers []GormOrganizationMemberModel
+	if err := m.db.Table(m.memberTableName()).Where("organization_id = ?", organizationID).Order("created_at").Find(&gormMembers).Error; err != nil {
+		return nil, err
+	}
+
+	members := make([]OrganizationMember, len(gormMembers))
+	for i := range gormMembers {
+		members[i] = *gormMembers[i].ToOrganizationMember()
+	}
+	return members, nil
+}
+
+// ListUserOrganizations returns the organizations of a user together with
+// the user's role in each, ordered by organization name
+func (m *GormOrganizationManager) ListUserOrganizations(userID string) ([]OrganizationMembership, error) {
+	var gormMembers []GormOrganizationMemberModel
+	if err := m.db.Table(m.memberTableName()).Where("user_id = ?", userID).Find(&gormMembers).Error; err != nil {
+		return nil, err
+	}
+
+	memberships := []OrganizationMembership{}
+	if len(gormMembers) == 0 {
+		return memberships, nil
+	}
+
+	roles := make(map[uuid.UUID]OrganizationRole, len(gormMembers))
+	ids := make([]uuid.UUID, len(gormMembers))
+	for i, member := range gormMembers {
+		roles[member.OrganizationID] = member.Role
+		ids[i] = member.OrganizationID
+	}
+
+	var gormOrganizations []GormOrganizationModel
+	if err := m.db.Table(m.tableName).Where("id IN ?", ids).Find(&gormOrganizations).Error; err != nil {
+		return nil, err
+	}
+	sort.Slice(gormOrganizations, func(i, j int) bool {
+		return gormOrganizations[i].Name < gormOrganizations[j].Name
+	})
+
+	for i := range gormOrganizations {
+		memberships = append(memberships, OrganizationMembership{
+			Organization: *gormOrganizations[i].ToOrganization(),
+			Role:         roles[gormOrganizations[i].ID],
+		})
+	}
+	return memberships, nil
+}
+
+// TransferOwnership makes an existing member the owner of an organization.
+// The previous owner stays on as an admin. Only the owner may transfer
+// ownership.
+func (m *GormOrganizationManager) TransferOwnership(organizationID, newOwnerID string, transferredBy string) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		newOwner, err := m.getMember(tx, organizationID, newOwnerID)
+		if err != nil {
+			return err
+		}
+		actor, err := m.getMember(tx, newOwner.OrganizationID, transferredBy)
+		if err != nil {
+			return err
+		}
+		if actor.Role != OrganizationRoleOwner {
+			return ErrOrganizationRoleTooLow
+		}
+		if newOwner.Role == OrganizationRoleOwner {
+			return nil
+		}
+
+		err = tx.Table(m.memberTableName()).
+			Where("organization_id = ? AND role = ?", newOwner.OrganizationID, OrganizationRoleOwner).
+			Update("role", OrganizationRoleAdmin).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Table(m.memberTableName()).
+			Where("organization_id = ? AND user_id = ?", newOwner.OrganizationID, newOwner.UserID).
+			Update("role", OrganizationRoleOwner).Error
+	})
+}
+
+// Invite creates an invitation for an email address to join an organization
+// as admin or member, and returns it together with the token to deliver to
+// the invitee. Pending invitations of the same address are revoked. Only
+// admins and the owner may invite, and only to a role no higher than their
+// own; others get ErrOrganizationRoleTooLow.
+func (m *GormOrganizationManager) Invite(organizationID, email string, role OrganizationRole, invitedBy string) (*OrganizationInvitation, string, error) {
+	if !role.Valid() || role == OrganizationRoleOwner {
+		return nil, "", ErrInvalidOrganizationRole
+	}
+
+	gormOrganization, err := m.getOrganization("id", organizationID)
+	if err != nil {
+		return nil, "", err
+	}
+	inviter, err := m.authorize(gormOrganization.ID, invitedBy, role)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Existing members need no invitation
+	if user, err := m.userManager.GetUserByEmail(email); err == nil {
+		if _, err := m.getMember(m.db, gormOrganization.ID, user.ID); err == nil {
+			return nil, "", ErrAlreadyOrganizationMember
+		} else if !errors.Is(err, ErrNotOrganizationMember) {
+			return nil, "", err
+		}
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return nil, "", err
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := m.now()
+	record := &GormOrganizationInvitationModel{
+		ID:             uuid.New(),
+		OrganizationID: gormOrganization.ID,
+		Email:          email,
+		Role:           role,
+		InvitedBy:      inviter.UserID,
+		TokenHash:      HashToken(token),
+		ExpiresAt:      now.Add(m.invitationTTL),
+		CreatedAt:      now,
+	}
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(m.invitationTableName()).
+			Where("organization_id = ? AND email = ? AND accepted_at IS NULL AND revoked_at IS NULL", gormOrganization.ID, email).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Table(m.invitationTableName()).Create(record).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return record.ToOrganizationInvitation(), token, nil
+}
+
+// ListInvitations returns the pending, unexpired invitations of an organization, newest first
+func (m *GormOrganizationManager) ListInvitations(organizationID string) ([]OrganizationInvitation, error) {
+	var records []GormOrganizationInvitationModel
+	err := m.db.Table(m.invitationTableName()).
+		Where("organization_id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", organizationID, m.now()).
+		Order("created_at DESC").
+		Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	invitations := make([]OrganizationInvitation, len(records))
+	for i := range records {
+		invitations[i] = *records[i].ToOrganizationInvitation()
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation revokes a pending invitation by its ID
+func (m *GormOrganizationManager) RevokeInvitation(id string) error {
+	result := m.db.Table(m.invitationTableName()).Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).Update("revoked_at", m.now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// AcceptInvitation consumes an invitation token and adds the user with the
+// invited email address to the organization. If no such user exists yet,
+// newUser is created with that address; pass nil to only link existing users.
+// Since the token was delivered to the address, the email counts as verified.
+func (m *GormOrganizationManager) AcceptInvitation(token string, newUser *User) (*User, error) {
+	var record GormOrganizationInvitationModel
+	if err := m.db.Table(m.invitationTableName()).Where("token_hash = ?", HashToken(token)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if record.AcceptedAt != nil || record.RevokedAt != nil {
+		return nil, ErrInvalidToken
+	}
+	now := m.now()
+	if !now.Before(record.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+	if _, err := m.getOrganization("id", record.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	// Claim the invitation before creating or changing any user; losing
+	// this race means it was accepted or revoked concurrently
+	result := m.db.Table(m.invitationTableName()).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", record.ID).
+		Update("accepted_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := m.invitedUser(record.Email, newUser, now)
+	if err == nil {
+		err = m.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Table(m.invitationTableName()).Where("id = ?", record.ID).Update("accepted_by", user.ID).Error; err != nil {
+				return err
+			}
+
+			// Someone who joined in the meantime keeps their current role
+			err := m.addMember(tx, record.OrganizationID, user.ID, record.Role)
+			if errors.Is(err, ErrAlreadyOrganizationMember) {
+				return nil
+			}
+			return err
+		})
+	}
+	if err != nil {
+		// Release the claim so the invitation can be accepted again
+		if releaseErr := m.db.Table(m.invitationTableName()).
+			Where("id = ? AND accepted_by IS NULL", record.ID).
+			Update("accepted_at", nil).Error; releaseErr != nil {
+			return nil, errors.Join(err, releaseErr)
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// invitedUser returns the user with the invited email address, creating it
+// from newUser if there is none, and marks the address as verified
+func (m *GormOrganizationManager) invitedUser(email string, newUser *User, now time.Time) (*User, error) {
+	user, err := m.userManager.GetUserByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		if newUser == nil {
+			return nil, ErrUserNotFound
+		}
+		newUser.Email = email
+		newUser.EmailVerifiedAt = &now
+		if err := m.userManager.CreateUser(newUser); err != nil {
+			return nil, err
+		}
+		return newUser, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := m.userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"EmailVerifiedAt": now}); err != nil {
+			return nil, err
+		}
+		user.EmailVerifiedAt = &now
+	}
+	return user, nil
+}
@@ -0,0 +1,356 @@
+package userion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupOrganizationManagerGorm creates an OrganizationManager backed by a UserManager
+func setupOrganizationManagerGorm(t *testing.T) (*GormOrganizationManager, UserManager) {
+	userManager, db := setupTestDBGorm(t)
+
+	tableName := "organizations_test_" + uuid.New().String()[:8]
+	organizationManager := NewGormOrganizationManager(db, tableName, userManager).(*GormOrganizationManager)
+	err := organizationManager.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	return organizationManager, userManager
+}
+
+// TestOrganizationRole tests the ordering of organization roles
+func TestOrganizationRole(t *testing.T) {
+	assert.True(t, OrganizationRoleOwner.AtLeast(OrganizationRoleAdmin))
+	assert.True(t, OrganizationRoleAdmin.AtLeast(OrganizationRoleAdmin))
+	assert.False(t, OrganizationRoleMember.AtLeast(OrganizationRoleAdmin))
+	assert.False(t, OrganizationRole("guest").AtLeast(OrganizationRoleMember))
+	assert.False(t, OrganizationRole("guest").Valid())
+}
+
+// TestOrganizationCRUD_Gorm tests creating, reading, updating and deleting organizations
+func TestOrganizationCRUD_Gorm(t *testing.T) {
+	organizationManager, userManager := setupOrganizationManagerGorm(t)
+	owner := createTestUser(t, userManager)
+
+	organization, err := organizationManager.CreateOrganization("Acme", owner.ID.String())
+	require.NoError(t, err)
+	_, err = organizationManager.CreateOrganization("Acme", owner.ID.String())
+	assert.Equal(t, ErrOrganizationAlreadyExists, err)
+	_, err = organizationManager.CreateOrganization("Globex", uuid.New().String())
+	assert.Equal(t, ErrUserNotFound, err)
+
+	member, err := organizationManager.GetMember(organization.ID.String(), owner.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleOwner, member.Role, "The creator should own the organization")
+
+	found, err := organizationManager.GetOrganizationByName("Acme")
+	require.NoError(t, err)
+	assert.Equal(t, organization.ID, found.ID)
+
+	require.NoError(t, organizationManager.UpdateOrganizationByID(organization.ID.String(), map[string]interface{}{"name": "Acme Corp"}))
+	found, err = organizationManager.GetOrganizationByID(organization.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "Acme Corp", found.Name)
+
+	require.NoError(t, organizationManager.DeleteOrganizationByID(organization.ID.String()))
+	_, err = organizationManager.GetOrganizationByID(organization.ID.String())
+	assert.Equal(t, ErrOrganizationNotFound, err)
+	assert.Equal(t, ErrOrganizationNotFound, organizationManager.DeleteOrganizationByID(organization.ID.String()))
+
+	memberships, err := organizationManager.ListUserOrganizations(owner.ID.String())
+	require.NoError(t, err)
+	assert.Empty(t, memberships, "Memberships should be deleted with the organization")
+}
+
+// TestOrganizationMembers_Gorm tests member roles and the protection of the owner
+func TestOrganizationMembers_Gorm(t *testing.T) {
+	organizationManager, userManager := setupOrganizationManagerGorm(t)
+	users := createGroupTestUsers(t, userManager, 3)
+	owner, admin, member := users[0], users[1], users[2]
+
+	organization, err := organizationManager.CreateOrganization("Acme", owner.ID.String())
+	require.NoError(t, err)
+	organizationID := organization.ID.String()
+
+	assert.Equal(t, ErrInvalidOrganizationRole, organizationManager.AddMember(organizationID, admin.ID.String(), OrganizationRoleOwner, owner.ID.String()))
+	require.NoError(t, organizationManager.AddMember(organizationID, admin.ID.String(), OrganizationRoleAdmin, owner.ID.String()))
+	require.NoError(t, organizationManager.AddMember(organizationID, member.ID.String(), OrganizationRoleMember, owner.ID.String()))
+	assert.Equal(t, ErrAlreadyOrganizationMember, organizationManager.AddMember(organizationID, member.ID.String(), OrganizationRoleAdmin, owner.ID.String()))
+
+	members, err := organizationManager.ListMembers(organizationID)
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+
+	require.NoError(t, organizationManager.SetMemberRole(organizationID, member.ID.String(), OrganizationRoleAdmin, owner.ID.String()))
+	found, err := organizationManager.GetMember(organizationID, member.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleAdmin, found.Role)
+
+	assert.Equal(t, ErrOwnerRequired, organizationManager.SetMemberRole(organizationID, owner.ID.String(), OrganizationRoleMember, owner.ID.String()))
+	assert.Equal(t, ErrOwnerRequired, organizationManager.RemoveMember(organizationID, owner.ID.String(), owner.ID.String()))
+	assert.Equal(t, ErrInvalidOrganizationRole, organizationManager.SetMemberRole(organizationID, member.ID.String(), OrganizationRoleOwner, owner.ID.String()))
+
+	require.NoError(t, organizationManager.RemoveMember(organizationID, member.ID.String(), owner.ID.String()))
+	_, err = organizationManager.GetMember(organizationID, member.ID.String())
+	assert.Equal(t, ErrNotOrganizationMember, err)
+	assert.Equal(t, ErrNotOrganizationMember, organizationManager.RemoveMember(organizationID, member.ID.String(), owner.ID.String()))
+}
+
+// TestOrganizationMemberRoles_Gorm tests that members can only be managed by
+// admins and the owner holding at least the roles involved
+func TestOrganizationMemberRoles_Gorm(t *testing.T) {
+	organizationManager, userManager := setupOrganizationManagerGorm(t)
+	users := createGroupTestUsers(t, userManager, 5)
+	owner, admin, other, member, outsider := users[0], users[1], users[2], users[3], users[4]
+
+	organization, err := organizationManager.CreateOrganization("Acme", owner.ID.String())
+	require.NoError(t, err)
+	organizationID := organization.ID.String()
+	require.NoError(t, organizationManager.AddMember(organizationID, admin.ID.String(), OrganizationRoleAdmin, owner.ID.String()))
+
+	assert.Equal(t, ErrNotOrganizationMember, organizationManager.AddMember(organizationID, member.ID.String(), OrganizationRoleMember, outsider.ID.String()))
+	require.NoError(t, organizationManager.AddMember(organizationID, member.ID.String(), OrganizationRoleMember, admin.ID.String()), "Admins should be able to add members")
+	assert.Equal(t, ErrOrganizationRoleTooLow, organizationManager.AddMember(organizationID, other.ID.String(), OrganizationRoleMember, member.ID.String()), "Members should not be able to add members")
+	require.NoError(t, organizationManager.AddMember(organizationID, other.ID.String(), OrganizationRoleAdmin, admin.ID.String()))
+
+	assert.Equal(t, ErrOrganizationRoleTooLow, organizationManager.SetMemberRole(organizationID, admin.ID.String(), OrganizationRoleMember, member.ID.String()), "Members should not be able to demote admins")
+	assert.Equal(t, ErrOrganizationRoleTooLow, organizationManager.SetMemberRole(organizationID, member.ID.String(), OrganizationRoleAdmin, member.ID.String()), "Members should not be able to promote themselves")
+	assert.Equal(t, ErrOrganizationRoleTooLow, organizationManager.RemoveMember(organizationID, admin.ID.String(), member.ID.String()), "Members should not be able to remove admins")
+	assert.Equal(t, ErrOrganizationRoleTooLow, organizationManager.TransferOwnership(organizationID, admin.ID.String(), admin.ID.String()), "Only the owner should transfer ownership")
+
+	require.NoError(t, organizationManager.SetMemberRole(organizationID, other.ID.String(), OrganizationRoleMember, admin.ID.String()))
+	require.NoError(t, organizationManager.RemoveMember(organizationID, other.ID.String(), admin.ID.String()))
+	require.NoError(t, organizationManager.RemoveMember(organizationID, member.ID.String(), member.ID.String()), "Members should be able to leave")
+
+	members, err := organizationManager.ListMembers(organizationID)
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+}
+
+// TestOrganizationTransferOwnership_Gorm tests handing an organization to another member
+func TestOrganizationTransferOwnership_Gorm(t *testing.T) {
+	organizationManager, userManager := setupOrganizationManagerGorm(t)
+	users := createGroupTestUsers(t, userManager, 3)
+	owner, member, outsider := users[0], users[1], users[2]
+
+	organization, err := organizationManager.CreateOrganization("Acme", owner.ID.String())
+	require.NoError(t, err)
+	organizationID := organization.ID.String()
+	require.NoError(t, organizationManager.AddMember(organizationID, member.ID.String(), OrganizationRoleMember, owner.ID.String()))
+
+	assert.Equal(t, ErrNotOrganizationMember, organizationManager.TransferOwnership(organizationID, outsider.ID.String(), owner.ID.String()))
+
+	require.NoError(t, organizationManager.TransferOwnership(organizationID, member.ID.String(), owner.ID.String()))
+	found, err := organizationManager.GetMember(organizationID, member.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleOwner, found.Role)
+	found, err = organizationManager.GetMember(organizationID, owner.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleAdmin, found.Role, "The previous owner should become an admin")
+
+	// The former owner can now be removed
+	assert.NoError(t, organizationManager.RemoveMember(organizationID, owner.ID.String(), member.ID.String()))
+}
+
+// TestListUserOrganizations_Gorm tests listing the organizations of a user with roles
+func TestListUserOrganizations_Gorm(t *testing.T) {
+	organizationManager, userManager := setupOrganizationManagerGorm(t)
+	users := createGroupTestUsers(t, userManager, 2)
+
+	globex, err := organizationManager.CreateOrganization("Globex", users[0].ID.String())
+	require.NoError(t, err)
+	acme, err := organizationManager.CreateOrganization("Acme", users[1].ID.String())
+	require.NoError(t, err)
+	require.NoError(t, organizationManager.AddMember(acme.ID.String(), users[0].ID.String(), OrganizationRoleMember, users[1].ID.String()))
+
+	memberships, err := organizationManager.ListUserOrganizations(users[0].ID.String())
+	require.NoError(t, err)
+	require.Len(t, memberships, 2)
+	assert.Equal(t, "Acme", memberships[0].Organization.Name)
+	assert.Equal(t, OrganizationRoleMember, memberships[0].Role)
+	assert.Equal(t, globex.ID, memberships[1].Organization.ID)
+	assert.Equal(t, OrganizationRoleOwner, memberships[1].Role)
+}
+
+// TestOrganizationInvitationNewUser_Gorm tests accepting an invitation as a new user
+func TestOrganizationInvitationNewUser_Gorm(t *testing.T) {
+	organizationManager, userManager := setupOrganizationManagerGorm(t)
+	owner := createTestUser(t, userManager)
+	organization, err := organizationManager.CreateOrganization("Acme", owner.ID.String())
+	require.NoError(t, err)
+
+	_, _, err = organizationManager.Invite(organization.ID.String(), "new@example.com", OrganizationRoleOwner, owner.ID.String())
+	assert.Equal(t, ErrInvalidOrganizationRole, err)
+	_, _, err = organizationManager.Invite(organization.ID.String(), "new@example.com", OrganizationRoleAdmin, uuid.New().String())
+	assert.Equal(t, ErrNotOrganizationMember, err, "Only members should be able to invite")
+	_, _, err = organizationManager.Invite(organization.ID.String(), owner.Email, OrganizationRoleAdmin, owner.ID.String())
+	assert.Equal(t, ErrAlreadyOrganizationMember, err)
+
+	invitation, token, err := organizationManager.Invite(organization.ID.String(), "new@example.com", OrganizationRoleAdmin, owner.ID.String())
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, owner.ID, invitation.InvitedBy)
+
+	invitations, err := organizationManager.ListInvitations(organization.ID.String())
+	require.NoError(t, err)
+	require.Len(t, invitations, 1)
+	assert.Equal(t, "new@example.com", invitations[0].Email)
+
+	// Without a user to create, only existing users can accept
+	_, err = organizationManager.AcceptInvitation(token, nil)
+	assert.Equal(t, ErrUserNotFound, err)
+
+	user, err := organizationManager.AcceptInvitation(token, &User{
+		Name:     "New User",
+		Username: "newuser",
+		Email:    "ignored@example.com",
+		Password: "password123",
+		Phone:    "5551234",
+		Enabled:  true,
+		Status:   UserStatusActive,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", user.Email, "The invited address should be used")
+	assert.NotNil(t, user.EmailVerifiedAt)
+
+	member, err := organizationManager.GetMember(organization.ID.String(), user.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleAdmin, member.Role)
+
+	_, err = organizationManager.AcceptInvitation(token, nil)
+	assert.Equal(t, ErrInvalidToken, err, "Invitations should be single-use")
+	invitations, err = organizationManager.ListInvitations(organization.ID.String())
+	require.NoError(t, err)
+	assert.Empty(t, invitations)
+}
+
+// TestOrganizationInvitationRoles_Gorm tests that invitations cannot grant more than the inviter holds
+func TestOrganizationInvitationRoles_Gorm(t *testing.T) {
+	organizationManager, userManager := setupOrganizationManagerGorm(t)
+	users := createGroupTestUsers(t, userManager, 3)
+	owner, admin, member := users[0], users[1], users[2]
+
+	organization, err := organizationManager.CreateOrganization("Acme", owner.ID.String())
+	require.NoError(t, err)
+	organizationID := organization.ID.String()
+	require.NoError(t, organizationManager.AddMember(organizationID, admin.ID.String(), OrganizationRoleAdmin, owner.ID.String()))
+	require.NoError(t, organizationManager.AddMember(organizationID, member.ID.String(), OrganizationRoleMember, owner.ID.String()))
+
+	_, _, err = organizationManager.Invite(organizationID, "new@example.com", OrganizationRoleAdmin, member.ID.String())
+	assert.Equal(t, ErrOrganizationRoleTooLow, err, "Members should not be able to invite admins")
+	_, _, err = organizationManager.Invite(organizationID, "new@example.com", OrganizationRoleMember, member.ID.String())
+	assert.Equal(t, ErrOrganizationRoleTooLow, err, "Members should not be able to invite")
+
+	_, _, err = organizationManager.Invite(organizationID, "new@example.com", OrganizationRoleAdmin, admin.ID.String())
+	assert.NoError(t, err, "Admins should be able to invite admins")
+	_, _, err = organizationManager.Invite(organizationID, "other@example.com", OrganizationRoleMember, owner.ID.String())
+	assert.NoError(t, err, "Owners should be able to invite members")
+
+	invitations, err := organizationManager.ListInvitations(organizationID)
+	require.NoError(t, err)
+	assert.Len(t, invitations, 2, "Rejected invitations should not be stored")
+}
+
+// revokingUserManager revokes an invitation while the invited user is looked up
+type revokingUserManager struct {
+	UserManager
+	revoke func() error
+	err    error
+}
+
+func (m *revokingUserManager) GetUserByEmail(email string) (*User, error) {
+	if m.revoke != nil {
+		m.err, m.revoke = m.revoke(), nil
+	}
+	return m.UserManager.GetUserByEmail(email)
+}
+
+// TestOrganizationInvitationRevokedConcurrently_Gorm tests that an invitation
+// is claimed before the invited user is created
+func TestOrganizationInvitationRevokedConcurrently_Gorm(t *testing.T) {
+	organizationManager, userManager := setupOrganizationManagerGorm(t)
+	owner := createTestUser(t, userManager)
+	organization, err := organizationManager.CreateOrganization("Acme", owner.ID.String())
+	require.NoError(t, err)
+
+	invitation, token, err := organizationManager.Invite(organization.ID.String(), "new@example.com", OrganizationRoleMember, owner.ID.String())
+	require.NoError(t, err)
+
+	revoking := &revokingUserManager{UserManager: userManager, revoke: func() error {
+		return organizationManager.RevokeInvitation(invitation.ID.String())
+	}}
+	organizationManager.userManager = revoking
+	user, err := organizationManager.AcceptInvitation(token, &User{Username: "newuser", Password: "password123"})
+	require.NoError(t, err, "The claimed invitation should be accepted")
+	assert.Equal(t, ErrInvitationNotFound, revoking.err, "Claimed invitations should not be revocable")
+
+	_, err = organizationManager.GetMember(organization.ID.String(), user.ID.String())
+	assert.NoError(t, err)
+}
+
+// TestOrganizationInvitationExistingUser_Gorm tests accepting an invitation as an existing user
+func TestOrganizationInvitationExistingUser_Gorm(t *testing.T) {
+	organizationManager, userManager := setupOrganizationManagerGorm(t)
+	users := createGroupTestUsers(t, userManager, 2)
+	owner, invitee := users[0], users[1]
+	organization, err := organizationManager.CreateOrganization("Acme", owner.ID.String())
+	require.NoError(t, err)
+
+	_, token, err := organizationManager.Invite(organization.ID.String(), invitee.Email, OrganizationRoleMember, owner.ID.String())
+	require.NoError(t, err)
+
+	user, err := organizationManager.AcceptInvitation(token, &User{Username: "unused"})
+	require.NoError(t, err)
+	assert.Equal(t, invitee.ID, user.ID, "The existing user should be linked")
+
+	found, err := userManager.GetUserByID(invitee.ID.String())
+	require.NoError(t, err)
+	assert.NotNil(t, found.EmailVerifiedAt)
+
+	memberships, err := organizationManager.ListUserOrganizations(invitee.ID.String())
+	require.NoError(t, err)
+	require.Len(t, memberships, 1)
+	assert.Equal(t, OrganizationRoleMember, memberships[0].Role)
+}
+
+// TestOrganizationInvitationLifecycle_Gorm tests expiry, revocation and re-invitation
+func TestOrganizationInvitationLifecycle_Gorm(t *testing.T) {
+	organizationManager, userManager := setupOrganizationManagerGorm(t)
+	owner := createTestUser(t, userManager)
+	organization, err := organizationManager.CreateOrganization("Acme", owner.ID.String())
+	require.NoError(t, err)
+	organizationID := organization.ID.String()
+
+	now := time.Now()
+	organizationManager.now = func() time.Time { return now }
+
+	_, token, err := organizationManager.Invite(organizationID, "new@example.com", OrganizationRoleMember, owner.ID.String())
+	require.NoError(t, err)
+
+	// Inviting the address again replaces the pending invitation
+	invitation, newToken, err := organizationManager.Invite(organizationID, "new@example.com", OrganizationRoleAdmin, owner.ID.String())
+	require.NoError(t, err)
+	_, err = organizationManager.AcceptInvitation(token, nil)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	invitations, err := organizationManager.ListInvitations(organizationID)
+	require.NoError(t, err)
+	require.Len(t, invitations, 1)
+	assert.Equal(t, invitation.ID, invitations[0].ID)
+
+	organizationManager.now = func() time.Time { return now.Add(DefaultInvitationTTL) }
+	_, err = organizationManager.AcceptInvitation(newToken, nil)
+	assert.Equal(t, ErrTokenExpired, err)
+	organizationManager.now = func() time.Time { return now }
+
+	require.NoError(t, organizationManager.RevokeInvitation(invitation.ID.String()))
+	assert.Equal(t, ErrInvitationNotFound, organizationManager.RevokeInvitation(invitation.ID.String()))
+	_, err = organizationManager.AcceptInvitation(newToken, nil)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	_, err = organizationManager.AcceptInvitation("unknown", nil)
+	assert.Equal(t, ErrInvalidToken, err)
+}
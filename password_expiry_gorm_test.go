@@ -0,0 +1,123 @@
+package userion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPasswordExpiry_Gorm tests that passwords older than MaxAge are reported as expired
+func TestPasswordExpiry_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	m := userManager.(*GormUserManager)
+	m.passwordPolicy = &PasswordPolicy{MaxAge: 90 * 24 * time.Hour}
+	user := createTestUser(t, userManager)
+
+	createdUser, err := userManager.GetUserByID(user.ID.String())
+	require.NoError(t, err)
+	require.NotNil(t, createdUser.PasswordChangedAt, "PasswordChangedAt should be set on creation")
+
+	err = userManager.VerifyPasswordByUsername(user.Username, "password123")
+	assert.NoError(t, err, "Fresh password should verify")
+
+	// Travel past the maximum age
+	m.now = func() time.Time { return time.Now().Add(91 * 24 * time.Hour) }
+	err = userManager.VerifyPasswordByUsername(user.Username, "password123")
+	assert.Equal(t, ErrPasswordExpired, err, "Old password should be expired")
+
+	err = userManager.VerifyPasswordByUsername(user.Username, "wrong_password")
+	assert.Equal(t, ErrInvalidPassword, err, "Wrong password should still be reported as invalid")
+
+	// Changing the password restarts the clock
+	err = userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Password": "rotated-password"})
+	require.NoError(t, err)
+	err = userManager.VerifyPasswordByID(user.ID.String(), "rotated-password")
+	assert.NoError(t, err, "Rotated password should verify")
+}
+
+// TestMustChangePassword_Gorm tests temporary passwords issued by an administrator
+func TestMustChangePassword_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	user := createTestUser(t, userManager)
+
+	// Issue a temporary password
+	err := userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{
+		"Password":           "temporary-password",
+		"MustChangePassword": true,
+	})
+	require.NoError(t, err)
+
+	err = userManager.VerifyPasswordByEmail(user.Email, "temporary-password")
+	assert.Equal(t, ErrPasswordChangeRequired, err, "Temporary password should require a change")
+
+	err = userManager.VerifyPasswordByEmail(user.Email, "wrong_password")
+	assert.Equal(t, ErrInvalidPassword, err, "Wrong password should still be reported as invalid")
+
+	// The user chooses a new password
+	err = userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Password": "chosen-password"})
+	require.NoError(t, err)
+
+	changedUser, err := userManager.GetUserByID(user.ID.String())
+	require.NoError(t, err)
+	assert.False(t, changedUser.MustChangePassword, "MustChangePassword should be cleared")
+
+	err = userManager.VerifyPasswordByEmail(user.Email, "chosen-password")
+	assert.NoError(t, err, "Chosen password should verify")
+}
+
+// TestMustChangePassword_Reset_Gorm tests that a password reset clears a forced change
+func TestMustChangePassword_Reset_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	user := createTestUser(t, userManager)
+
+	err := userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"MustChangePassword": true})
+	require.NoError(t, err)
+
+	token, err := userManager.RequestPasswordReset(user.Email)
+	require.NoError(t, err)
+	err = userManager.ResetPassword(token, "reset-password")
+	require.NoError(t, err)
+
+	err = userManager.VerifyPasswordByID(user.ID.String(), "reset-password")
+	assert.NoError(t, err, "Reset password should not require another change")
+}
+
+// TestPasswordExpiry_MFA_Gorm tests that expiry and forced changes are only
+// reported once the second factor has passed
+func TestPasswordExpiry_MFA_Gorm(t *testing.T) {
+	totpManager, userManager, _ := setupTOTPManagerGorm(t)
+	m := userManager.(*GormUserManager)
+	m.passwordPolicy = &PasswordPolicy{MaxAge: 90 * 24 * time.Hour}
+	user := createTestUser(t, userManager)
+
+	now := time.Now()
+	totpManager.now = func() time.Time { return now }
+	enrollment, err := totpManager.BeginTOTPEnrollment(user.ID.String(), user.Email)
+	require.NoError(t, err)
+	require.NoError(t, totpManager.ConfirmTOTPEnrollment(user.ID.String(), totpCode(t, enrollment.Secret, now)))
+
+	// An expired password only proves the first factor
+	m.now = func() time.Time { return time.Now().Add(91 * 24 * time.Hour) }
+	err = userManager.VerifyPasswordByUsername(user.Username, "password123")
+	assert.Equal(t, ErrMFARequired, err, "Expired passwords of enrolled users should require MFA first")
+
+	totpManager.now = func() time.Time { return now.Add(DefaultTOTPPeriod) }
+	require.NoError(t, totpManager.VerifyTOTP(user.ID.String(), totpCode(t, enrollment.Secret, now.Add(DefaultTOTPPeriod))))
+
+	var checker PasswordChangeChecker = m
+	assert.Equal(t, ErrPasswordExpired, checker.CheckPasswordChangeByID(user.ID.String()), "Expiry should be reported after MFA")
+
+	// The same holds for a forced change
+	m.now = time.Now
+	assert.NoError(t, checker.CheckPasswordChangeByID(user.ID.String()))
+	err = userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"MustChangePassword": true})
+	require.NoError(t, err)
+	err = userManager.VerifyPasswordByUsername(user.Username, "password123")
+	assert.Equal(t, ErrMFARequired, err, "Forced changes of enrolled users should require MFA first")
+	assert.Equal(t, ErrPasswordChangeRequired, checker.CheckPasswordChangeByID(user.ID.String()))
+
+	assert.Equal(t, ErrUserNotFound, checker.CheckPasswordChangeByID(uuid.New().String()))
+}
@@ -0,0 +1,109 @@
+package userion
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PasswordAlgorithmSHA256 identifies passwords hashed with HashPassword
+const PasswordAlgorithmSHA256 = "sha256"
+
+// GormPasswordHistoryModel represents a previous password of a user
+type GormPasswordHistoryModel struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Algorithm string    `gorm:"type:varchar(32);not null"`
+	Password  string    `gorm:"not null"`
+	Salt      string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// passwordHistoryTableName returns the name of the table holding previous passwords
+func (m *GormUserManager) passwordHistoryTableName() string {
+	return m.tableName + "_password_history"
+}
+
+// passwordHistorySize returns how many previous passwords are remembered
+func (m *GormUserManager) passwordHistorySize() int {
+	if m.passwordPolicy == nil {
+		return 0
+	}
+	return m.passwordPolicy.HistorySize
+}
+
+// matchesPasswordHash compares a plain password with a hash produced by the given algorithm
+func (m *GormUserManager) matchesPasswordHash(algorithm, hash, salt, password string) bool {
+	switch algorithm {
+	case PasswordAlgorithmSHA256:
+		expected := HashPassword(m.passwordPolicy.NormalizePassword(password), salt)
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+	default:
+		return false
+	}
+}
+
+// isPasswordReused reports whether the password matches the user's current
+// password or one of the remembered previous ones
+func (m *GormUserManager) isPasswordReused(tx *gorm.DB, user *User, password string) (bool, error) {
+	if m.matchesPasswordHash(PasswordAlgorithmSHA256, user.Password, user.Salt, password) {
+		return true, nil
+	}
+
+	var entries []GormPasswordHistoryModel
+	err := tx.Table(m.passwordHistoryTableName()).
+		Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Limit(m.passwordHistorySize()).
+		Find(&entries).Error
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		if m.matchesPasswordHash(entry.Algorithm, entry.Password, entry.Salt, password) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// recordPasswordHistory remembers a newly set password and forgets those
+// beyond the configured history size
+func (m *GormUserManager) recordPasswordHistory(tx *gorm.DB, userID uuid.UUID, hash, salt string) error {
+	size := m.passwordHistorySize()
+	if size <= 0 {
+		return nil
+	}
+
+	entry := &GormPasswordHistoryModel{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Algorithm: PasswordAlgorithmSHA256,
+		Password:  hash,
+		Salt:      salt,
+		CreatedAt: m.now(),
+	}
+	if err := tx.Table(m.passwordHistoryTableName()).Create(entry).Error; err != nil {
+		return err
+	}
+
+	var expired []uuid.UUID
+	err := tx.Table(m.passwordHistoryTableName()).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Offset(size).
+		Limit(-1).
+		Pluck("id", &expired).Error
+	if err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	return tx.Table(m.passwordHistoryTableName()).Where("id IN ?", expired).Delete(&GormPasswordHistoryModel{}).Error
+}
@@ -0,0 +1,82 @@
+package userion
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPasswordHistory_Gorm tests that recent passwords cannot be reused
+func TestPasswordHistory_Gorm(t *testing.T) {
+	userManager, db := setupTestDBGorm(t)
+	m := userManager.(*GormUserManager)
+	m.passwordPolicy = &PasswordPolicy{HistorySize: 2}
+	user := createTestUser(t, userManager)
+
+	// Test reusing the current password
+	err := userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Password": "password123"})
+	var policyErr *PasswordPolicyError
+	require.True(t, errors.As(err, &policyErr), "UpdateUserByID should return a PasswordPolicyError")
+	assert.True(t, policyErr.Has(PasswordReused), "Current password should be rejected")
+
+	// Change the password twice and try to go back
+	err = userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Password": "second-password"})
+	require.NoError(t, err)
+	err = userManager.UpdateUserByUsername(user.Username, map[string]interface{}{"Password": "third-password"})
+	require.NoError(t, err)
+
+	err = userManager.UpdateUserByEmail(user.Email, map[string]interface{}{"Password": "second-password"})
+	assert.ErrorIs(t, err, ErrWeakPassword, "Recent password should be rejected")
+
+	// Only the last two passwords are kept
+	var count int64
+	db.Table(m.passwordHistoryTableName()).Where("user_id = ?", user.ID).Count(&count)
+	assert.Equal(t, int64(2), count, "History should be pruned to its size")
+
+	err = userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Password": "password123"})
+	assert.NoError(t, err, "Password older than the history should be accepted")
+
+	err = userManager.VerifyPasswordByID(user.ID.String(), "password123")
+	assert.NoError(t, err)
+}
+
+// TestPasswordHistory_Reset_Gorm tests that password resets honour the history
+func TestPasswordHistory_Reset_Gorm(t *testing.T) {
+	userManager, db := setupTestDBGorm(t)
+	m := userManager.(*GormUserManager)
+	m.passwordPolicy = &PasswordPolicy{HistorySize: 3}
+	user := createTestUser(t, userManager)
+
+	token, err := userManager.RequestPasswordReset(user.Email)
+	require.NoError(t, err)
+
+	err = userManager.ResetPassword(token, "password123")
+	assert.ErrorIs(t, err, ErrWeakPassword, "ResetPassword should reject the current password")
+
+	err = userManager.ResetPassword(token, "brand-new-password")
+	require.NoError(t, err)
+
+	var entries []GormPasswordHistoryModel
+	db.Table(m.passwordHistoryTableName()).Where("user_id = ?", user.ID).Find(&entries)
+	require.Len(t, entries, 2, "Both passwords should be remembered")
+	for _, entry := range entries {
+		assert.Equal(t, PasswordAlgorithmSHA256, entry.Algorithm)
+		assert.NotEmpty(t, entry.Salt)
+	}
+}
+
+// TestPasswordHistory_Disabled_Gorm tests that no history is kept without the policy option
+func TestPasswordHistory_Disabled_Gorm(t *testing.T) {
+	userManager, db := setupTestDBGorm(t)
+	m := userManager.(*GormUserManager)
+	user := createTestUser(t, userManager)
+
+	err := userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Password": "password123"})
+	assert.NoError(t, err, "Reuse should be allowed without a history size")
+
+	var count int64
+	db.Table(m.passwordHistoryTableName()).Count(&count)
+	assert.Equal(t, int64(0), count, "No history should be recorded")
+}
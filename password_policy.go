@@ -0,0 +1,244 @@
+package userion
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// PasswordViolationCode identifies a password policy rule that was broken
+type PasswordViolationCode string
+
+const (
+	// PasswordTooShort means the password has fewer characters than MinLength
+	PasswordTooShort PasswordViolationCode = "too_short"
+	// PasswordTooLong means the password has more characters than MaxLength
+	PasswordTooLong PasswordViolationCode = "too_long"
+	// PasswordMissingUpper means an uppercase letter is required
+	PasswordMissingUpper PasswordViolationCode = "missing_upper"
+	// PasswordMissingLower means a lowercase letter is required
+	PasswordMissingLower PasswordViolationCode = "missing_lower"
+	// PasswordMissingDigit means a digit is required
+	PasswordMissingDigit PasswordViolationCode = "missing_digit"
+	// PasswordMissingSymbol means a symbol is required
+	PasswordMissingSymbol PasswordViolationCode = "missing_symbol"
+	// PasswordBannedSubstring means the password contains a banned substring
+	PasswordBannedSubstring PasswordViolationCode = "banned_substring"
+	// PasswordRepeatedChars means a character is repeated too many times in a row
+	PasswordRepeatedChars PasswordViolationCode = "repeated_chars"
+	// PasswordBreached means the password appears in a known data breach
+	PasswordBreached PasswordViolationCode = "breached"
+	// PasswordReused means the password matches the current or a recent password
+	PasswordReused PasswordViolationCode = "reused"
+)
+
+// PasswordViolation describes a single broken password policy rule
+type PasswordViolation struct {
+	Code    PasswordViolationCode `json:"code"`
+	Message string                `json:"message"`
+}
+
+// PasswordPolicyError is returned when a password breaks one or more policy
+// rules. It matches ErrWeakPassword with errors.Is.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation `json:"violations"`
+}
+
+// Error implements the error interface
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return ErrWeakPassword.Error() + ": " + strings.Join(messages, "; ")
+}
+
+// Unwrap allows errors.Is(err, ErrWeakPassword)
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// Has reports whether the error contains a violation with the given code
+func (e *PasswordPolicyError) Has(code PasswordViolationCode) bool {
+	for _, v := range e.Violations {
+		if v.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordPolicy defines the rules new passwords must satisfy.
+// Zero values disable the corresponding rule.
+type PasswordPolicy struct {
+	MinLength int // Minimum number of characters
+	MaxLength int // Maximum number of characters
+
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+
+	// BannedSubstrings are rejected anywhere in the password, case-insensitively
+	BannedSubstrings []string
+	// BanUserIdentifiers rejects passwords containing the username or the local part of the email
+	BanUserIdentifiers bool
+
+	// MaxRepeatedChars is the maximum number of identical consecutive characters
+	MaxRepeatedChars int
+
+	// Normalize applies Unicode NFKC normalization before validating and hashing
+	Normalize bool
+
+	// HistorySize is the number of previous passwords a user may not reuse.
+	// It is enforced by the user manager, which keeps that many hashes per user.
+	HistorySize int
+
+	// MaxAge is how long a password stays valid before it has to be changed.
+	// Password verification reports ErrPasswordExpired once it has passed.
+	MaxAge time.Duration
+}
+
+// DefaultPasswordPolicy returns a reasonable policy for most applications
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:          8,
+		MaxLength:          128,
+		RequireLower:       true,
+		RequireDigit:       true,
+		BanUserIdentifiers: true,
+		MaxRepeatedChars:   3,
+		Normalize:          true,
+	}
+}
+
+// minIdentifierLength is the shortest username or email local part that is
+// banned from passwords; shorter ones would reject too many passwords
+const minIdentifierLength = 3
+
+// NormalizePassword returns the password in the form that is validated and hashed
+func (p *PasswordPolicy) NormalizePassword(password string) string {
+	if p == nil || !p.Normalize {
+		return password
+	}
+	return norm.NFKC.String(password)
+}
+
+// Validate checks a password against the policy. The user, if given, provides
+// the identifiers banned by BanUserIdentifiers. It returns a
+// *PasswordPolicyError listing every broken rule, or nil.
+func (p *PasswordPolicy) Validate(password string, user *User) error {
+	if p == nil {
+		return nil
+	}
+
+	password = p.NormalizePassword(password)
+	var violations []PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("password must be at most %d characters", p.MaxLength),
+		})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case !unicode.IsLetter(r) && !unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingUpper, Message: "password must contain an uppercase letter"})
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingLower, Message: "password must contain a lowercase letter"})
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingDigit, Message: "password must contain a digit"})
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingSymbol, Message: "password must contain a symbol"})
+	}
+
+	lowered := strings.ToLower(password)
+	for _, banned := range p.bannedSubstrings(user) {
+		if strings.Contains(lowered, banned) {
+			violations = append(violations, PasswordViolation{
+				Code:    PasswordBannedSubstring,
+				Message: "password must not contain " + banned,
+			})
+		}
+	}
+
+	if p.MaxRepeatedChars > 0 && maxRun(password) > p.MaxRepeatedChars {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordRepeatedChars,
+			Message: fmt.Sprintf("password must not repeat a character more than %d times in a row", p.MaxRepeatedChars),
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// bannedSubstrings returns the lowercased substrings rejected for the user
+func (p *PasswordPolicy) bannedSubstrings(user *User) []string {
+	var banned []string
+	for _, s := range p.BannedSubstrings {
+		if s != "" {
+			banned = append(banned, strings.ToLower(p.NormalizePassword(s)))
+		}
+	}
+
+	if p.BanUserIdentifiers && user != nil {
+		localPart, _, _ := strings.Cut(user.Email, "@")
+		for _, s := range []string{user.Username, localPart} {
+			if utf8.RuneCountInString(s) >= minIdentifierLength {
+				banned = append(banned, strings.ToLower(p.NormalizePassword(s)))
+			}
+		}
+	}
+
+	return banned
+}
+
+// maxRun returns the length of the longest run of identical characters
+func maxRun(s string) int {
+	longest, current := 0, 0
+	var last rune = -1
+	for _, r := range s {
+		if r == last {
+			current++
+		} else {
+			current = 1
+			last = r
+		}
+		if current > longest {
+			longest = current
+		}
+	}
+	return longest
+}
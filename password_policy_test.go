@@ -0,0 +1,136 @@
+package userion
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPasswordPolicy_Validate tests the individual policy rules
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := &PasswordPolicy{
+		MinLength:          8,
+		MaxLength:          16,
+		RequireUpper:       true,
+		RequireLower:       true,
+		RequireDigit:       true,
+		RequireSymbol:      true,
+		BannedSubstrings:   []string{"acme"},
+		BanUserIdentifiers: true,
+		MaxRepeatedChars:   2,
+	}
+	user := &User{Username: "johndoe", Email: "jsmith@example.com"}
+
+	tests := []struct {
+		name     string
+		password string
+		code     PasswordViolationCode
+	}{
+		{"too short", "Ab1!", PasswordTooShort},
+		{"too long", "Abcdefgh1!xyzxyzxyz", PasswordTooLong},
+		{"missing upper", "abcdefg1!", PasswordMissingUpper},
+		{"missing lower", "ABCDEFG1!", PasswordMissingLower},
+		{"missing digit", "Abcdefgh!", PasswordMissingDigit},
+		{"missing symbol", "Abcdefgh1", PasswordMissingSymbol},
+		{"banned substring", "MyAcme2024!", PasswordBannedSubstring},
+		{"contains username", "xJohnDoe1!", PasswordBannedSubstring},
+		{"contains email local part", "Jsmith123!", PasswordBannedSubstring},
+		{"repeated characters", "Abccc123!", PasswordRepeatedChars},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, user)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrWeakPassword), "Policy errors should match ErrWeakPassword")
+
+			var policyErr *PasswordPolicyError
+			require.True(t, errors.As(err, &policyErr), "Error should be a PasswordPolicyError")
+			assert.True(t, policyErr.Has(tt.code), "Violation %s should be reported", tt.code)
+		})
+	}
+
+	assert.NoError(t, policy.Validate("Str0ng!Pass", user), "A compliant password should pass")
+
+	// Test that every violation is reported at once
+	err := policy.Validate("aaa", user)
+	var policyErr *PasswordPolicyError
+	require.True(t, errors.As(err, &policyErr))
+	assert.Len(t, policyErr.Violations, 5, "All violations should be reported")
+}
+
+// TestPasswordPolicy_Normalize tests Unicode NFKC normalization
+func TestPasswordPolicy_Normalize(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 4, RequireDigit: true, Normalize: true}
+
+	// Fullwidth digits normalize to ASCII digits
+	assert.Equal(t, "pass123", policy.NormalizePassword("pass１２３"))
+	assert.NoError(t, policy.Validate("pass１２３", nil))
+
+	// A nil policy accepts anything and leaves passwords untouched
+	var nilPolicy *PasswordPolicy
+	assert.NoError(t, nilPolicy.Validate("", nil))
+	assert.Equal(t, "pass１２３", nilPolicy.NormalizePassword("pass１２３"))
+}
+
+// TestPasswordPolicy_CreateUser_Gorm tests policy enforcement in CreateUser
+func TestPasswordPolicy_CreateUser_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	userManager.(*GormUserManager).passwordPolicy = DefaultPasswordPolicy()
+
+	user := &User{
+		Name:     "Policy User",
+		Username: "policyuser",
+		Email:    "policy@example.com",
+		Password: "short",
+		Phone:    "1112223333",
+	}
+
+	err := userManager.CreateUser(user)
+	var policyErr *PasswordPolicyError
+	require.True(t, errors.As(err, &policyErr), "CreateUser should return a PasswordPolicyError")
+	assert.True(t, policyErr.Has(PasswordTooShort))
+	assert.True(t, policyErr.Has(PasswordMissingDigit))
+
+	// Test that an empty password is no longer skipped silently
+	user.Password = ""
+	err = userManager.CreateUser(user)
+	assert.ErrorIs(t, err, ErrWeakPassword, "CreateUser should reject an empty password")
+
+	// Test with a compliant password entered in fullwidth digits
+	user.Password = "correct horse ７"
+	err = userManager.CreateUser(user)
+	require.NoError(t, err, "CreateUser should accept a compliant password")
+
+	err = userManager.VerifyPasswordByUsername("policyuser", "correct horse 7")
+	assert.NoError(t, err, "Normalized password should verify")
+}
+
+// TestPasswordPolicy_Update_Gorm tests policy enforcement on password updates
+func TestPasswordPolicy_Update_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	user := createTestUser(t, userManager)
+	userManager.(*GormUserManager).passwordPolicy = DefaultPasswordPolicy()
+
+	err := userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Password": "testuser99"})
+	var policyErr *PasswordPolicyError
+	require.True(t, errors.As(err, &policyErr), "UpdateUserByID should return a PasswordPolicyError")
+	assert.True(t, policyErr.Has(PasswordBannedSubstring), "Username should be banned")
+
+	err = userManager.UpdateUserByEmail(user.Email, map[string]interface{}{"Password": "brandnew99"})
+	assert.NoError(t, err, "UpdateUserByEmail should accept a compliant password")
+
+	// Verify the accepted password
+	err = userManager.VerifyPasswordByID(user.ID.String(), "brandnew99")
+	assert.NoError(t, err)
+
+	// Test policy enforcement on reset
+	token, err := userManager.RequestPasswordReset(user.Email)
+	require.NoError(t, err)
+	err = userManager.ResetPassword(token, "aaaa1111")
+	assert.ErrorIs(t, err, ErrWeakPassword, "ResetPassword should enforce the policy")
+	err = userManager.ResetPassword(token, "reset2024")
+	assert.NoError(t, err, "Token should remain usable after a rejected password")
+}
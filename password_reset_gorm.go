@@ -0,0 +1,99 @@
+package userion
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// RequestPasswordReset issues a single-use password reset token for the user
+// with the given email. To avoid revealing which addresses are registered,
+// an empty token and no error are returned when no enabled user matches.
+func (m *GormUserManager) RequestPasswordReset(email string) (string, error) {
+	var gormUser GormUserModel
+	if err := m.users(m.db).Select("id", "email", "enabled").Where("email = ?", email).First(&gormUser).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	if !gormUser.Enabled {
+		return "", nil
+	}
+
+	var token string
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = m.issueToken(tx, gormUser.ID, tokenPurposePasswordReset, gormUser.Email, m.passwordResetTTL)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	m.emit(EventPasswordResetRequested, gormUser.ID)
+
+	return token, nil
+}
+
+// ResetPassword consumes a password reset token and sets a new password with
+// a freshly generated salt. All other outstanding reset tokens of the user are
+// invalidated.
+func (m *GormUserManager) ResetPassword(token, newPassword string) error {
+	var gormUser GormUserModel
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		record, err := m.consumeToken(tx, token, tokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		if err := m.users(tx).Select("id", "username", "email", "password", "salt").Where("id = ?", record.UserID).First(&gormUser).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+
+		// The token was sent to a mailbox the user may no longer own
+		if gormUser.Email != record.Subject {
+			return ErrInvalidToken
+		}
+
+		// Validation failures roll back so the token can be used for another attempt
+		if newPassword == "" {
+			return ErrWeakPassword
+		}
+		if err := m.checkPassword(tx, newPassword, gormUser.ToUser(), true); err != nil {
+			return err
+		}
+
+		salt, err := GenerateSalt()
+		if err != nil {
+			return err
+		}
+
+		hash := HashPassword(m.passwordPolicy.NormalizePassword(newPassword), salt)
+		updates := map[string]interface{}{
+			"password":             hash,
+			"salt":                 salt,
+			"password_changed_at":  *record.UsedAt,
+			"must_change_password": false,
+		}
+		if err := m.users(tx).Where("id = ?", gormUser.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := m.recordPasswordHistory(tx, gormUser.ID, hash, salt); err != nil {
+			return err
+		}
+
+		return m.invalidateTokens(tx, gormUser.ID, tokenPurposePasswordReset, *record.UsedAt)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.emit(EventPasswordReset, gormUser.ID)
+
+	return nil
+}
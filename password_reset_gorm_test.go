@@ -0,0 +1,99 @@
+package userion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRequestPasswordReset_Gorm tests the RequestPasswordReset method
+func TestRequestPasswordReset_Gorm(t *testing.T) {
+	var events []Event
+	userManager, db := setupTestDBGorm(t)
+	m := userManager.(*GormUserManager)
+	m.eventHandlers = append(m.eventHandlers, func(event Event) { events = append(events, event) })
+	user := createTestUser(t, userManager)
+
+	token, err := userManager.RequestPasswordReset(user.Email)
+	assert.NoError(t, err, "RequestPasswordReset should not error with valid email")
+	assert.NotEmpty(t, token, "Token should be returned")
+	require.Len(t, events, 1, "An event should be emitted")
+	assert.Equal(t, EventPasswordResetRequested, events[0].Type)
+	assert.Equal(t, user.ID, events[0].UserID)
+
+	// Verify only the hash is stored
+	var count int64
+	db.Table(m.tokenTableName()).Where("token_hash = ?", HashToken(token)).Count(&count)
+	assert.Equal(t, int64(1), count, "Token hash should be stored")
+
+	// Test with an unknown email
+	token, err = userManager.RequestPasswordReset("unknown@example.com")
+	assert.NoError(t, err, "RequestPasswordReset should not reveal unknown emails")
+	assert.Empty(t, token, "No token should be issued for unknown emails")
+
+	// Test with a disabled user
+	err = userManager.DisableUserByID(user.ID.String())
+	require.NoError(t, err)
+	token, err = userManager.RequestPasswordReset(user.Email)
+	assert.NoError(t, err, "RequestPasswordReset should not reveal disabled users")
+	assert.Empty(t, token, "No token should be issued for disabled users")
+}
+
+// TestResetPassword_Gorm tests the ResetPassword method
+func TestResetPassword_Gorm(t *testing.T) {
+	var events []Event
+	userManager, _ := setupTestDBGorm(t)
+	m := userManager.(*GormUserManager)
+	m.eventHandlers = append(m.eventHandlers, func(event Event) { events = append(events, event) })
+	user := createTestUser(t, userManager)
+
+	otherToken, err := userManager.RequestPasswordReset(user.Email)
+	require.NoError(t, err)
+	token, err := userManager.RequestPasswordReset(user.Email)
+	require.NoError(t, err)
+
+	// Test an empty password
+	err = userManager.ResetPassword(token, "")
+	assert.ErrorIs(t, err, ErrWeakPassword, "ResetPassword should reject an empty password")
+
+	oldUser, err := userManager.GetUserByID(user.ID.String())
+	require.NoError(t, err)
+
+	err = userManager.ResetPassword(token, "resetpassword")
+	assert.NoError(t, err, "ResetPassword should not error with valid token")
+	assert.Equal(t, EventPasswordReset, events[len(events)-1].Type, "An event should be emitted")
+
+	// Verify the salt and hash are rotated
+	resetUser, err := userManager.GetUserByID(user.ID.String())
+	require.NoError(t, err)
+	assert.NotEqual(t, oldUser.Salt, resetUser.Salt, "Salt should be rotated")
+	assert.NotEqual(t, oldUser.Password, resetUser.Password, "Password should be updated")
+
+	err = userManager.VerifyPasswordByID(user.ID.String(), "resetpassword")
+	assert.NoError(t, err, "New password should verify correctly")
+
+	// Test that the token and other outstanding tokens are invalid
+	err = userManager.ResetPassword(token, "anotherpassword")
+	assert.Equal(t, ErrInvalidToken, err, "ResetPassword should reject a used token")
+	err = userManager.ResetPassword(otherToken, "anotherpassword")
+	assert.Equal(t, ErrInvalidToken, err, "ResetPassword should reject other outstanding tokens")
+}
+
+// TestResetPassword_Expired_Gorm tests that expired tokens are rejected
+func TestResetPassword_Expired_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	m := userManager.(*GormUserManager)
+	user := createTestUser(t, userManager)
+
+	token, err := userManager.RequestPasswordReset(user.Email)
+	require.NoError(t, err)
+
+	m.now = func() time.Time { return time.Now().Add(DefaultPasswordResetTTL + time.Minute) }
+	err = userManager.ResetPassword(token, "resetpassword")
+	assert.Equal(t, ErrTokenExpired, err, "ResetPassword should reject an expired token")
+
+	err = userManager.VerifyPasswordByID(user.ID.String(), "password123")
+	assert.NoError(t, err, "Old password should still verify")
+}
@@ -0,0 +1,85 @@
+package userion
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Common errors returned by the PhoneVerificationManager
+var (
+	ErrInvalidCode     = errors.New("invalid verification code")
+	ErrCodeExpired     = errors.New("verification code expired")
+	ErrTooManyAttempts = errors.New("too many verification attempts")
+	ErrRateLimited     = errors.New("too many verification codes requested")
+	ErrNoPhone         = errors.New("user has no phone number")
+)
+
+// PhoneVerificationManager defines the interface for verifying phone numbers
+// with one-time codes
+type PhoneVerificationManager interface {
+	AutoMigrate() error
+	SendPhoneVerification(userID string) error
+	VerifyPhone(userID string, code string) error
+}
+
+// SMSSender delivers text messages to phone numbers
+type SMSSender interface {
+	SendSMS(phone, message string) error
+}
+
+// SMSMessage is a text message recorded by MemorySMSSender
+type SMSMessage struct {
+	Phone   string
+	Message string
+	SentAt  time.Time
+}
+
+// MemorySMSSender is an SMSSender that keeps messages in memory, useful for tests
+type MemorySMSSender struct {
+	mu       sync.Mutex
+	messages []SMSMessage
+}
+
+// NewMemorySMSSender creates an empty MemorySMSSender
+func NewMemorySMSSender() *MemorySMSSender {
+	return &MemorySMSSender{}
+}
+
+// SendSMS records the message
+func (s *MemorySMSSender) SendSMS(phone, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, SMSMessage{
+		Phone:   phone,
+		Message: message,
+		SentAt:  time.Now(),
+	})
+
+	return nil
+}
+
+// Messages returns a copy of all recorded messages
+func (s *MemorySMSSender) Messages() []SMSMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]SMSMessage, len(s.messages))
+	copy(messages, s.messages)
+	return messages
+}
+
+// LastMessage returns the most recent message sent to a phone number
+func (s *MemorySMSSender) LastMessage(phone string) (SMSMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].Phone == phone {
+			return s.messages[i], true
+		}
+	}
+
+	return SMSMessage{}, false
+}
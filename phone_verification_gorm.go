@@ -0,0 +1,273 @@
+package userion
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Default settings of GormPhoneVerificationManager
+const (
+	DefaultPhoneCodeLength         = 6
+	DefaultPhoneCodeTTL            = 10 * time.Minute
+	DefaultPhoneCodeResendInterval = time.Minute
+	DefaultPhoneCodeSendLimit      = 5
+	DefaultPhoneCodeSendWindow     = time.Hour
+	DefaultPhoneCodeMaxAttempts    = 5
+	DefaultPhoneCodeMessage        = "Your verification code is %s"
+)
+
+// GormPhoneCodeModel represents a one-time code sent to a user's phone.
+// Only the salted hash of the code is stored. Sequence numbers the codes of
+// a user; it is unique per user so concurrent sends cannot both pass the
+// rate limits.
+type GormPhoneCodeModel struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	Sequence   *int64
+	Phone      string    `gorm:"not null"`
+	CodeHash   string    `gorm:"not null"`
+	Salt       string    `gorm:"not null"`
+	Attempts   int       `gorm:"not null;default:0"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	ConsumedAt *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+// GormPhoneVerificationManager is the GORM implementation of PhoneVerificationManager
+type GormPhoneVerificationManager struct {
+	db          *gorm.DB
+	tableName   string
+	userManager UserManager
+	sender      SMSSender
+
+	codeLength     int
+	codeTTL        time.Duration
+	resendInterval time.Duration
+	sendLimit      int
+	sendWindow     time.Duration
+	maxAttempts    int
+	message        string
+
+	now func() time.Time
+}
+
+// PhoneVerificationOption configures optional behaviour of a GormPhoneVerificationManager
+type PhoneVerificationOption func(*GormPhoneVerificationManager)
+
+// WithPhoneCodeLength sets the number of digits of generated codes
+func WithPhoneCodeLength(digits int) PhoneVerificationOption {
+	return func(m *GormPhoneVerificationManager) {
+		m.codeLength = digits
+	}
+}
+
+// WithPhoneCodeTTL sets how long a code stays valid
+func WithPhoneCodeTTL(ttl time.Duration) PhoneVerificationOption {
+	return func(m *GormPhoneVerificationManager) {
+		m.codeTTL = ttl
+	}
+}
+
+// WithPhoneCodeResendInterval sets the minimum time between two codes for the same user
+func WithPhoneCodeResendInterval(interval time.Duration) PhoneVerificationOption {
+	return func(m *GormPhoneVerificationManager) {
+		m.resendInterval = interval
+	}
+}
+
+// WithPhoneCodeSendLimit sets how many codes a user may request within a window
+func WithPhoneCodeSendLimit(limit int, window time.Duration) PhoneVerificationOption {
+	return func(m *GormPhoneVerificationManager) {
+		m.sendLimit = limit
+		m.sendWindow = window
+	}
+}
+
+// WithPhoneCodeMaxAttempts sets how many wrong guesses invalidate a code
+func WithPhoneCodeMaxAttempts(attempts int) PhoneVerificationOption {
+	return func(m *GormPhoneVerificationManager) {
+		m.maxAttempts = attempts
+	}
+}
+
+// WithPhoneCodeMessage sets the message format; %s is replaced by the code
+func WithPhoneCodeMessage(format string) PhoneVerificationOption {
+	return func(m *GormPhoneVerificationManager) {
+		m.message = format
+	}
+}
+
+// NewGormPhoneVerificationManager initializes a new PhoneVerificationManager
+func NewGormPhoneVerificationManager(db *gorm.DB, tableName string, userManager UserManager, sender SMSSender, opts ...PhoneVerificationOption) PhoneVerificationManager {
+	m := &GormPhoneVerificationManager{
+		db:             db,
+		tableName:      tableName,
+		userManager:    userManager,
+		sender:         sender,
+		codeLength:     DefaultPhoneCodeLength,
+		codeTTL:        DefaultPhoneCodeTTL,
+		resendInterval: DefaultPhoneCodeResendInterval,
+		sendLimit:      DefaultPhoneCodeSendLimit,
+		sendWindow:     DefaultPhoneCodeSendWindow,
+		maxAttempts:    DefaultPhoneCodeMaxAttempts,
+		message:        DefaultPhoneCodeMessage,
+		now:            time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// AutoMigrate creates or updates the database schema for phone codes
+func (m *GormPhoneVerificationManager) AutoMigrate() error {
+	if err := m.db.Table(m.tableName).AutoMigrate(&GormPhoneCodeModel{}); err != nil {
+		return err
+	}
+	// Codes stored before sequences were introduced keep a NULL sequence
+	return migrateUniqueIndex(m.db, &GormPhoneCodeModel{}, m.tableName, "idx_"+m.tableName+"_user_sequence", "", "user_id", "sequence")
+}
+
+// SendPhoneVerification generates a new code for the user's phone and sends
+// it through the SMSSender. Any previously sent code is superseded. Users
+// without a phone number get ErrNoPhone.
+func (m *GormPhoneVerificationManager) SendPhoneVerification(userID string) error {
+	user, err := m.userManager.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Phone == "" {
+		return ErrNoPhone
+	}
+
+	code, err := GenerateNumericCode(m.codeLength)
+	if err != nil {
+		return err
+	}
+
+	salt, err := GenerateSalt()
+	if err != nil {
+		return err
+	}
+
+	now := m.now()
+	record := &GormPhoneCodeModel{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Phone:     user.Phone,
+		CodeHash:  HashPassword(code, salt),
+		Salt:      salt,
+		ExpiresAt: now.Add(m.codeTTL),
+		CreatedAt: now,
+	}
+
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		// Only the most recent codes matter for rate limiting
+		var recent []GormPhoneCodeModel
+		if err := tx.Table(m.tableName).Where("user_id = ?", user.ID).Order("created_at DESC").Limit(m.sendLimit).Find(&recent).Error; err != nil {
+			return err
+		}
+
+		if len(recent) > 0 && now.Sub(recent[0].CreatedAt) < m.resendInterval {
+			return ErrRateLimited
+		}
+
+		sentInWindow := 0
+		for _, code := range recent {
+			if now.Sub(code.CreatedAt) < m.sendWindow {
+				sentInWindow++
+			}
+		}
+		if sentInWindow >= m.sendLimit {
+			return ErrRateLimited
+		}
+
+		// A concurrent send that passed the same checks claims the same
+		// sequence number, and only one of the inserts succeeds
+		var last *int64
+		if err := tx.Table(m.tableName).Where("user_id = ?", user.ID).Select("MAX(sequence)").Scan(&last).Error; err != nil {
+			return err
+		}
+		sequence := int64(1)
+		if last != nil {
+			sequence = *last + 1
+		}
+		record.Sequence = &sequence
+
+		return tx.Table(m.tableName).Create(record).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrRateLimited) || record.Sequence == nil {
+			return err
+		}
+		var taken int64
+		if countErr := m.db.Table(m.tableName).Where("user_id = ? AND sequence = ?", user.ID, *record.Sequence).Count(&taken).Error; countErr == nil && taken > 0 {
+			return ErrRateLimited
+		}
+		return err
+	}
+
+	return m.sender.SendSMS(user.Phone, fmt.Sprintf(m.message, code))
+}
+
+// VerifyPhone checks a code against the latest one sent to the user and marks
+// the phone number as verified on success
+func (m *GormPhoneVerificationManager) VerifyPhone(userID string, code string) error {
+	user, err := m.userManager.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	var record GormPhoneCodeModel
+	if err := m.db.Table(m.tableName).Where("user_id = ?", user.ID).Order("created_at DESC").First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidCode
+		}
+		return err
+	}
+
+	// The code only proves ownership of the number it was sent to
+	if record.ConsumedAt != nil || record.Phone != user.Phone {
+		return ErrInvalidCode
+	}
+
+	now := m.now()
+	if !now.Before(record.ExpiresAt) {
+		return ErrCodeExpired
+	}
+
+	// Count the attempt before comparing so concurrent guesses cannot exceed the limit
+	result := m.db.Table(m.tableName).
+		Where("id = ? AND attempts < ? AND consumed_at IS NULL", record.ID, m.maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTooManyAttempts
+	}
+
+	if subtle.ConstantTimeCompare([]byte(HashPassword(code, record.Salt)), []byte(record.CodeHash)) != 1 {
+		return ErrInvalidCode
+	}
+
+	result = m.db.Table(m.tableName).Where("id = ? AND consumed_at IS NULL", record.ID).Update("consumed_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+
+	return m.userManager.UpdateUserByID(userID, map[string]interface{}{
+		"phone_verified_at": now,
+	})
+}
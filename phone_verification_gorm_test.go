@@ -0,0 +1,195 @@
+package userion
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupPhoneVerificationGorm creates a PhoneVerificationManager backed by the test database
+func setupPhoneVerificationGorm(t *testing.T, opts ...PhoneVerificationOption) (*GormPhoneVerificationManager, UserManager, *MemorySMSSender) {
+	userManager, db := setupTestDBGorm(t)
+	sender := NewMemorySMSSender()
+
+	tableName := "phone_codes_test_" + uuid.New().String()[:8]
+	manager := NewGormPhoneVerificationManager(db, tableName, userManager, sender, opts...)
+
+	err := manager.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	return manager.(*GormPhoneVerificationManager), userManager, sender
+}
+
+// lastCode extracts the code from the last message sent to a phone number
+func lastCode(t *testing.T, sender *MemorySMSSender, phone string) string {
+	message, ok := sender.LastMessage(phone)
+	require.True(t, ok, "A message should have been sent")
+	return strings.TrimPrefix(message.Message, "Your verification code is ")
+}
+
+// TestSendPhoneVerification_Gorm tests the SendPhoneVerification method
+func TestSendPhoneVerification_Gorm(t *testing.T) {
+	manager, userManager, sender := setupPhoneVerificationGorm(t)
+	user := createTestUser(t, userManager)
+
+	err := manager.SendPhoneVerification(user.ID.String())
+	assert.NoError(t, err, "SendPhoneVerification should not error with valid ID")
+
+	code := lastCode(t, sender, user.Phone)
+	assert.Len(t, code, DefaultPhoneCodeLength, "Code should have the default length")
+
+	// Test the resend interval
+	err = manager.SendPhoneVerification(user.ID.String())
+	assert.Equal(t, ErrRateLimited, err, "SendPhoneVerification should enforce the resend interval")
+
+	// Test with a non-existent user
+	err = manager.SendPhoneVerification(uuid.New().String())
+	assert.Equal(t, ErrUserNotFound, err, "SendPhoneVerification should return ErrUserNotFound with invalid ID")
+
+	// Test a user without a phone number
+	err = userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Phone": ""})
+	require.NoError(t, err)
+	manager.now = func() time.Time { return time.Now().Add(time.Hour) }
+	err = manager.SendPhoneVerification(user.ID.String())
+	assert.Equal(t, ErrNoPhone, err, "SendPhoneVerification should reject users without a phone number")
+	assert.Len(t, sender.Messages(), 1, "No message should have been sent without a phone number")
+}
+
+// TestSendPhoneVerification_Concurrent_Gorm tests that concurrent requests cannot exceed the limits
+func TestSendPhoneVerification_Concurrent_Gorm(t *testing.T) {
+	// An in-memory database is private to one connection, so use a file
+	// shared by concurrent connections
+	dsn := "file:" + filepath.Join(t.TempDir(), "phone.db") + "?_busy_timeout=5000&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to database")
+	t.Cleanup(func() {
+		sqlDB, err := db.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	userManager := NewGormUserManager(db, "users_test_"+uuid.New().String()[:8])
+	require.NoError(t, userManager.AutoMigrate(), "Failed to migrate database")
+	sender := NewMemorySMSSender()
+	manager := NewGormPhoneVerificationManager(db, "phone_codes_test_"+uuid.New().String()[:8], userManager, sender)
+	require.NoError(t, manager.AutoMigrate(), "Failed to migrate database")
+	user := createTestUser(t, userManager)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- manager.SendPhoneVerification(user.ID.String())
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	sent := 0
+	for err := range errs {
+		if err == nil {
+			sent++
+			continue
+		}
+		assert.Equal(t, ErrRateLimited, err, "Concurrent requests should be rate limited")
+	}
+	assert.Equal(t, 1, sent, "Only one concurrent request should send a code")
+	assert.Len(t, sender.Messages(), 1, "Only one message should have been sent")
+}
+
+// TestSendPhoneVerification_Limit_Gorm tests the send limit within a window
+func TestSendPhoneVerification_Limit_Gorm(t *testing.T) {
+	manager, userManager, sender := setupPhoneVerificationGorm(t, WithPhoneCodeSendLimit(2, time.Hour))
+	user := createTestUser(t, userManager)
+
+	base := time.Now()
+	for i := 0; i < 2; i++ {
+		manager.now = func() time.Time { return base.Add(time.Duration(i) * 2 * time.Minute) }
+		err := manager.SendPhoneVerification(user.ID.String())
+		require.NoError(t, err)
+	}
+
+	manager.now = func() time.Time { return base.Add(10 * time.Minute) }
+	err := manager.SendPhoneVerification(user.ID.String())
+	assert.Equal(t, ErrRateLimited, err, "SendPhoneVerification should enforce the send limit")
+
+	// The window slides
+	manager.now = func() time.Time { return base.Add(2 * time.Hour) }
+	err = manager.SendPhoneVerification(user.ID.String())
+	assert.NoError(t, err, "SendPhoneVerification should allow sending after the window")
+	assert.Len(t, sender.Messages(), 3, "Three messages should have been sent")
+}
+
+// TestVerifyPhone_Gorm tests the VerifyPhone method
+func TestVerifyPhone_Gorm(t *testing.T) {
+	manager, userManager, sender := setupPhoneVerificationGorm(t)
+	user := createTestUser(t, userManager)
+
+	// Test verifying without a code
+	err := manager.VerifyPhone(user.ID.String(), "000000")
+	assert.Equal(t, ErrInvalidCode, err, "VerifyPhone should error without a sent code")
+
+	err = manager.SendPhoneVerification(user.ID.String())
+	require.NoError(t, err)
+	code := lastCode(t, sender, user.Phone)
+
+	err = manager.VerifyPhone(user.ID.String(), code)
+	assert.NoError(t, err, "VerifyPhone should not error with the correct code")
+
+	verifiedUser, err := userManager.GetUserByID(user.ID.String())
+	require.NoError(t, err)
+	assert.NotNil(t, verifiedUser.PhoneVerifiedAt, "PhoneVerifiedAt should be set")
+
+	// Test the code is single-use
+	err = manager.VerifyPhone(user.ID.String(), code)
+	assert.Equal(t, ErrInvalidCode, err, "VerifyPhone should reject a used code")
+}
+
+// TestVerifyPhone_Rules_Gorm tests attempt limits, expiry and phone changes
+func TestVerifyPhone_Rules_Gorm(t *testing.T) {
+	manager, userManager, sender := setupPhoneVerificationGorm(t, WithPhoneCodeMaxAttempts(2), WithPhoneCodeResendInterval(0))
+	user := createTestUser(t, userManager)
+
+	// Test the attempt limit
+	err := manager.SendPhoneVerification(user.ID.String())
+	require.NoError(t, err)
+	code := lastCode(t, sender, user.Phone)
+	wrong := "x" + code[1:]
+
+	assert.Equal(t, ErrInvalidCode, manager.VerifyPhone(user.ID.String(), wrong))
+	assert.Equal(t, ErrInvalidCode, manager.VerifyPhone(user.ID.String(), wrong))
+	err = manager.VerifyPhone(user.ID.String(), code)
+	assert.Equal(t, ErrTooManyAttempts, err, "VerifyPhone should lock the code after too many attempts")
+
+	// Test an expired code
+	err = manager.SendPhoneVerification(user.ID.String())
+	require.NoError(t, err)
+	code = lastCode(t, sender, user.Phone)
+	manager.now = func() time.Time { return time.Now().Add(DefaultPhoneCodeTTL + time.Minute) }
+	err = manager.VerifyPhone(user.ID.String(), code)
+	assert.Equal(t, ErrCodeExpired, err, "VerifyPhone should reject an expired code")
+	manager.now = time.Now
+
+	// Test that a code does not verify a changed phone number
+	err = manager.SendPhoneVerification(user.ID.String())
+	require.NoError(t, err)
+	code = lastCode(t, sender, user.Phone)
+	err = userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Phone": "5555555555"})
+	require.NoError(t, err)
+	err = manager.VerifyPhone(user.ID.String(), code)
+	assert.Equal(t, ErrInvalidCode, err, "VerifyPhone should reject a code sent to another number")
+}
@@ -0,0 +1,71 @@
+package userion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Common errors returned by the RBACManager
+var (
+	ErrRoleNotFound            = errors.New("role not found")
+	ErrRoleAlreadyExists       = errors.New("role already exists")
+	ErrPermissionNotFound      = errors.New("permission not found")
+	ErrPermissionAlreadyExists = errors.New("permission already exists")
+	ErrRoleCycle               = errors.New("role inheritance would create a cycle")
+)
+
+// Role is a named set of permissions. A role also grants the permissions of
+// the roles it inherits from.
+type Role struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Permission is an action that can be granted to roles, e.g. "invoices:write"
+type Permission struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RoleAssignment grants a role to a user. An empty Scope applies everywhere;
+// otherwise the role only applies to the named resource or tenant.
+type RoleAssignment struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Role      string    `json:"role"`
+	Scope     string    `json:"scope,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RBACManager defines the interface for role-based access control
+type RBACManager interface {
+	AutoMigrate() error
+
+	CreateRole(name, description string) (*Role, error)
+	GetRole(name string) (*Role, error)
+	ListRoles() ([]Role, error)
+	DeleteRole(name string) error
+
+	CreatePermission(name, description string) (*Permission, error)
+	ListPermissions() ([]Permission, error)
+	DeletePermission(name string) error
+
+	GrantPermission(role, permission string) error
+	RevokePermission(role, permission string) error
+	RolePermissions(role string) ([]string, error)
+
+	AddRoleParent(role, parent string) error
+	RemoveRoleParent(role, parent string) error
+
+	AssignRole(userID, role, scope string) error
+	UnassignRole(userID, role, scope string) error
+	ListUserRoles(userID string) ([]RoleAssignment, error)
+
+	HasPermission(userID, permission string) (bool, error)
+	HasScopedPermission(userID, permission, scope string) (bool, error)
+}
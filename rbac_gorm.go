@@ -0,0 +1,628 @@
+package userion
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Default settings of GormRBACManager
+const (
+	DefaultRBACCacheTTL = time.Minute
+)
+
+// GormRoleModel represents the GORM-specific database model for roles
+type GormRoleModel struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	Name        string    `gorm:"unique;not null"`
+	Description string
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+// ToRole converts a GormRoleModel to a Role business model
+func (g *GormRoleModel) ToRole() *Role {
+	return &Role{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+		CreatedAt:   g.CreatedAt,
+	}
+}
+
+// GormPermissionModel represents the GORM-specific database model for permissions
+type GormPermissionModel struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	Name        string    `gorm:"unique;not null"`
+	Description string
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+// ToPermission converts a GormPermissionModel to a Permission business model
+func (g *GormPermissionModel) ToPermission() *Permission {
+	return &Permission{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+		CreatedAt:   g.CreatedAt,
+	}
+}
+
+// GormRolePermissionModel grants a permission to a role
+type GormRolePermissionModel struct {
+	RoleID       uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	PermissionID uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+// GormRoleParentModel makes a role inherit the permissions of a parent role
+type GormRoleParentModel struct {
+	RoleID    uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	ParentID  uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// GormUserRoleModel assigns a role to a user, optionally within a scope
+type GormUserRoleModel struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	RoleID    uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	Scope     string    `gorm:"type:varchar(255);primaryKey;default:''"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// rbacCacheEntry holds the effective permissions of a user in a scope
+type rbacCacheEntry struct {
+	permissions map[string]struct{}
+	expiresAt   time.Time
+}
+
+// GormRBACManager is the GORM implementation of RBACManager. Effective
+// permissions are cached in memory; changes made through the manager clear
+// the cache, changes made by other instances are seen after the cache TTL.
+type GormRBACManager struct {
+	db        *gorm.DB
+	tableName string
+
+	cacheTTL time.Duration
+	cacheMu  sync.RWMutex
+	cache    map[string]rbacCacheEntry
+
+	now func() time.Time
+}
+
+// RBACOption configures optional behaviour of a GormRBACManager
+type RBACOption func(*GormRBACManager)
+
+// WithRBACCacheTTL sets how long effective permissions are cached; zero disables caching
+func WithRBACCacheTTL(ttl time.Duration) RBACOption {
+	return func(m *GormRBACManager) {
+		m.cacheTTL = ttl
+	}
+}
+
+// NewGormRBACManager initializes a new RBACManager. The table name is used for
+// roles and as the prefix of the permission and assignment tables.
+func NewGormRBACManager(db *gorm.DB, tableName string, opts ...RBACOption) RBACManager {
+	m := &GormRBACManager{
+		db:        db,
+		tableName: tableName,
+		cacheTTL:  DefaultRBACCacheTTL,
+		cache:     make(map[string]rbacCacheEntry),
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// permissionTableName returns the name of the table holding permissions
+func (m *GormRBACManager) permissionTableName() string {
+	return m.tableName + "_permissions"
+}
+
+// rolePermissionTableName returns the name of the table holding permission grants
+func (m *GormRBACManager) rolePermissionTableName() string {
+	return m.tableName + "_role_permissions"
+}
+
+// roleParentTableName returns the name of the table holding role inheritance
+func (m *GormRBACManager) roleParentTableName() string {
+	return m.tableName + "_role_parents"
+}
+
+// userRoleTableName returns the name of the table holding role assignments
+func (m *GormRBACManager) userRoleTableName() string {
+	return m.tableName + "_user_roles"
+}
+
+// AutoMigrate creates or updates the database schema for roles, permissions and assignments
+func (m *GormRBACManager) AutoMigrate() error {
+	migrations := []struct {
+		table string
+		model interface{}
+	}{
+		{m.tableName, &GormRoleModel{}},
+		{m.permissionTableName(), &GormPermissionModel{}},
+		{m.rolePermissionTableName(), &GormRolePermissionModel{}},
+		{m.roleParentTableName(), &GormRoleParentModel{}},
+		{m.userRoleTableName(), &GormUserRoleModel{}},
+	}
+
+	for _, migration := range migrations {
+		if err := m.db.Table(migration.table).AutoMigrate(migration.model); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateRole creates a role with a unique name
+func (m *GormRBACManager) CreateRole(name, description string) (*Role, error) {
+	var count int64
+	if err := m.db.Table(m.tableName).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrRoleAlreadyExists
+	}
+
+	gormRole := &GormRoleModel{
+		ID:          uuid.New(),
+		Name:        name,
+		Description: description,
+		CreatedAt:   m.now(),
+	}
+	if err := m.db.Table(m.tableName).Create(gormRole).Error; err != nil {
+		return nil, err
+	}
+
+	return gormRole.ToRole(), nil
+}
+
+// GetRole retrieves a role by name
+func (m *GormRBACManager) GetRole(name string) (*Role, error) {
+	gormRole, err := m.getRole(m.db, name)
+	if err != nil {
+		return nil, err
+	}
+	return gormRole.ToRole(), nil
+}
+
+// getRole loads a role by name
+func (m *GormRBACManager) getRole(tx *gorm.DB, name string) (*GormRoleModel, error) {
+	var gormRole GormRoleModel
+	if err := tx.Table(m.tableName).Where("name = ?", name).First(&gormRole).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &gormRole, nil
+}
+
+// ListRoles returns all roles ordered by name
+func (m *GormRBACManager) ListRoles() ([]Role, error) {
+	var gormRoles []GormRoleModel
+	if err := m.db.Table(m.tableName).Order("name").Find(&gormRoles).Error; err != nil {
+		return nil, err
+	}
+
+	roles := make([]Role, len(gormRoles))
+	for i := range gormRoles {
+		roles[i] = *gormRoles[i].ToRole()
+	}
+	return roles, nil
+}
+
+// DeleteRole removes a role together with its grants, inheritance links and assignments
+func (m *GormRBACManager) DeleteRole(name string) error {
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		gormRole, err := m.getRole(tx, name)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Table(m.rolePermissionTableName()).Where("role_id = ?", gormRole.ID).Delete(&GormRolePermissionModel{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Table(m.roleParentTableName()).Where("role_id = ? OR parent_id = ?", gormRole.ID, gormRole.ID).Delete(&GormRoleParentModel{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Table(m.userRoleTableName()).Where("role_id = ?", gormRole.ID).Delete(&GormUserRoleModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(m.tableName).Where("id = ?", gormRole.ID).Delete(&GormRoleModel{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	m.clearCache()
+	return nil
+}
+
+// CreatePermission creates a permission with a unique name
+func (m *GormRBACManager) CreatePermission(name, description string) (*Permission, error) {
+	var count int64
+	if err := m.db.Table(m.permissionTableName()).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrPermissionAlreadyExists
+	}
+
+	gormPermission := &GormPermissionModel{
+		ID:          uuid.New(),
+		Name:        name,
+		Description: description,
+		CreatedAt:   m.now(),
+	}
+	if err := m.db.Table(m.permissionTableName()).Create(gormPermission).Error; err != nil {
+		return nil, err
+	}
+
+	return gormPermission.ToPermission(), nil
+}
+
+// ListPermissions returns all permissions ordered by name
+func (m *GormRBACManager) ListPermissions() ([]Permission, error) {
+	var gormPermissions []GormPermissionModel
+	if err := m.db.Table(m.permissionTableName()).Order("name").Find(&gormPermissions).Error; err != nil {
+		return nil, err
+	}
+
+	permissions := make([]Permission, len(gormPermissions))
+	for i := range gormPermissions {
+		permissions[i] = *gormPermissions[i].ToPermission()
+	}
+	return permissions, nil
+}
+
+// DeletePermission removes a permission and revokes it from all roles
+func (m *GormRBACManager) DeletePermission(name string) error {
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		gormPermission, err := m.getPermission(tx, name)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Table(m.rolePermissionTableName()).Where("permission_id = ?", gormPermission.ID).Delete(&GormRolePermissionModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(m.permissionTableName()).Where("id = ?", gormPermission.ID).Delete(&GormPermissionModel{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	m.clearCache()
+	return nil
+}
+
+// getPermission loads a permission by name
+func (m *GormRBACManager) getPermission(tx *gorm.DB, name string) (*GormPermissionModel, error) {
+	var gormPermission GormPermissionModel
+	if err := tx.Table(m.permissionTableName()).Where("name = ?", name).First(&gormPermission).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPermissionNotFound
+		}
+		return nil, err
+	}
+	return &gormPermission, nil
+}
+
+// GrantPermission grants a permission to a role. Granting twice is not an error.
+func (m *GormRBACManager) GrantPermission(role, permission string) error {
+	gormRole, err := m.getRole(m.db, role)
+	if err != nil {
+		return err
+	}
+	gormPermission, err := m.getPermission(m.db, permission)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := m.db.Table(m.rolePermissionTableName()).Where("role_id = ? AND permission_id = ?", gormRole.ID, gormPermission.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		grant := &GormRolePermissionModel{RoleID: gormRole.ID, PermissionID: gormPermission.ID, CreatedAt: m.now()}
+		if err := m.db.Table(m.rolePermissionTableName()).Create(grant).Error; err != nil {
+			return err
+		}
+	}
+
+	m.clearCache()
+	return nil
+}
+
+// RevokePermission revokes a permission from a role
+func (m *GormRBACManager) RevokePermission(role, permission string) error {
+	gormRole, err := m.getRole(m.db, role)
+	if err != nil {
+		return err
+	}
+	gormPermission, err := m.getPermission(m.db, permission)
+	if err != nil {
+		return err
+	}
+
+	if err := m.db.Table(m.rolePermissionTableName()).Where("role_id = ? AND permission_id = ?", gormRole.ID, gormPermission.ID).Delete(&GormRolePermissionModel{}).Error; err != nil {
+		return err
+	}
+
+	m.clearCache()
+	return nil
+}
+
+// RolePermissions returns the effective permissions of a role, including
+// inherited ones, ordered by name
+func (m *GormRBACManager) RolePermissions(role string) ([]string, error) {
+	gormRole, err := m.getRole(m.db, role)
+	if err != nil {
+		return nil, err
+	}
+
+	roleIDs, err := m.withAncestors([]uuid.UUID{gormRole.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	return m.permissionNames(roleIDs)
+}
+
+// AddRoleParent makes role inherit the permissions of parent
+func (m *GormRBACManager) AddRoleParent(role, parent string) error {
+	gormRole, err := m.getRole(m.db, role)
+	if err != nil {
+		return err
+	}
+	gormParent, err := m.getRole(m.db, parent)
+	if err != nil {
+		return err
+	}
+
+	// The new link closes a cycle if the role is already an ancestor of the parent
+	ancestors, err := m.withAncestors([]uuid.UUID{gormParent.ID})
+	if err != nil {
+		return err
+	}
+	for _, id := range ancestors {
+		if id == gormRole.ID {
+			return ErrRoleCycle
+		}
+	}
+
+	var count int64
+	if err := m.db.Table(m.roleParentTableName()).Where("role_id = ? AND parent_id = ?", gormRole.ID, gormParent.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		link := &GormRoleParentModel{RoleID: gormRole.ID, ParentID: gormParent.ID, CreatedAt: m.now()}
+		if err := m.db.Table(m.roleParentTableName()).Create(link).Error; err != nil {
+			return err
+		}
+	}
+
+	m.clearCache()
+	return nil
+}
+
+// RemoveRoleParent stops role from inheriting the permissions of parent
+func (m *GormRBACManager) RemoveRoleParent(role, parent string) error {
+	gormRole, err := m.getRole(m.db, role)
+	if err != nil {
+		return err
+	}
+	gormParent, err := m.getRole(m.db, parent)
+	if err != nil {
+		return err
+	}
+
+	if err := m.db.Table(m.roleParentTableName()).Where("role_id = ? AND parent_id = ?", gormRole.ID, gormParent.ID).Delete(&GormRoleParentModel{}).Error; err != nil {
+		return err
+	}
+
+	m.clearCache()
+	return nil
+}
+
+// AssignRole grants a role to a user, globally with an empty scope or within
+// a resource or tenant. Assigning twice is not an error.
+func (m *GormRBACManager) AssignRole(userID, role, scope string) error {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	gormRole, err := m.getRole(m.db, role)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := m.db.Table(m.userRoleTableName()).Where("user_id = ? AND role_id = ? AND scope = ?", id, gormRole.ID, scope).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		assignment := &GormUserRoleModel{UserID: id, RoleID: gormRole.ID, Scope: scope, CreatedAt: m.now()}
+		if err := m.db.Table(m.userRoleTableName()).Create(assignment).Error; err != nil {
+			return err
+		}
+	}
+
+	m.clearCache()
+	return nil
+}
+
+// UnassignRole removes a role assignment of a user
+func (m *GormRBACManager) UnassignRole(userID, role, scope string) error {
+	gormRole, err := m.getRole(m.db, role)
+	if err != nil {
+		return err
+	}
+
+	if err := m.db.Table(m.userRoleTableName()).Where("user_id = ? AND role_id = ? AND scope = ?", userID, gormRole.ID, scope).Delete(&GormUserRoleModel{}).Error; err != nil {
+		return err
+	}
+
+	m.clearCache()
+	return nil
+}
+
+// ListUserRoles returns the role assignments of a user
+func (m *GormRBACManager) ListUserRoles(userID string) ([]RoleAssignment, error) {
+	var rows []struct {
+		UserID    uuid.UUID
+		Name      string
+		Scope     string
+		CreatedAt time.Time
+	}
+	err := m.db.Table(m.userRoleTableName()+" AS ur").
+		Select("ur.user_id, r.name, ur.scope, ur.created_at").
+		Joins("JOIN "+m.tableName+" AS r ON r.id = ur.role_id").
+		Where("ur.user_id = ?", userID).
+		Order("ur.scope, r.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	assignments := make([]RoleAssignment, len(rows))
+	for i, row := range rows {
+		assignments[i] = RoleAssignment{UserID: row.UserID, Role: row.Name, Scope: row.Scope, CreatedAt: row.CreatedAt}
+	}
+	return assignments, nil
+}
+
+// HasPermission reports whether the user's global roles grant a permission
+func (m *GormRBACManager) HasPermission(userID, permission string) (bool, error) {
+	return m.HasScopedPermission(userID, permission, "")
+}
+
+// HasScopedPermission reports whether the user's global roles or roles within
+// the scope grant a permission
+func (m *GormRBACManager) HasScopedPermission(userID, permission, scope string) (bool, error) {
+	permissions, err := m.effectivePermissions(userID, scope)
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := permissions[permission]
+	return ok, nil
+}
+
+// effectivePermissions resolves the permissions of a user in a scope, using the cache
+func (m *GormRBACManager) effectivePermissions(userID, scope string) (map[string]struct{}, error) {
+	key := userID + "\x00" + scope
+	now := m.now()
+
+	if m.cacheTTL > 0 {
+		m.cacheMu.RLock()
+		entry, ok := m.cache[key]
+		m.cacheMu.RUnlock()
+		if ok && now.Before(entry.expiresAt) {
+			return entry.permissions, nil
+		}
+	}
+
+	var roleIDs []uuid.UUID
+	query := m.db.Table(m.userRoleTableName()).Where("user_id = ?", userID)
+	if scope == "" {
+		query = query.Where("scope = ''")
+	} else {
+		query = query.Where("scope = '' OR scope = ?", scope)
+	}
+	if err := query.Pluck("role_id", &roleIDs).Error; err != nil {
+		return nil, err
+	}
+
+	roleIDs, err := m.withAncestors(roleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := m.permissionNames(roleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		permissions[name] = struct{}{}
+	}
+
+	if m.cacheTTL > 0 {
+		m.cacheMu.Lock()
+		m.cache[key] = rbacCacheEntry{permissions: permissions, expiresAt: now.Add(m.cacheTTL)}
+		m.cacheMu.Unlock()
+	}
+
+	return permissions, nil
+}
+
+// withAncestors returns the roles together with all roles they inherit from
+func (m *GormRBACManager) withAncestors(roleIDs []uuid.UUID) ([]uuid.UUID, error) {
+	seen := make(map[uuid.UUID]struct{}, len(roleIDs))
+	result := make([]uuid.UUID, 0, len(roleIDs))
+	frontier := make([]uuid.UUID, 0, len(roleIDs))
+	for _, id := range roleIDs {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			result = append(result, id)
+			frontier = append(frontier, id)
+		}
+	}
+
+	// Walk up one level of the hierarchy per query
+	for len(frontier) > 0 {
+		var parents []uuid.UUID
+		if err := m.db.Table(m.roleParentTableName()).Where("role_id IN ?", frontier).Pluck("parent_id", &parents).Error; err != nil {
+			return nil, err
+		}
+
+		frontier = frontier[:0]
+		for _, id := range parents {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				result = append(result, id)
+				frontier = append(frontier, id)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// permissionNames returns the names of the permissions granted to the roles
+func (m *GormRBACManager) permissionNames(roleIDs []uuid.UUID) ([]string, error) {
+	names := []string{}
+	if len(roleIDs) == 0 {
+		return names, nil
+	}
+
+	err := m.db.Table(m.permissionTableName()+" AS p").
+		Distinct("p.name").
+		Joins("JOIN "+m.rolePermissionTableName()+" AS rp ON rp.permission_id = p.id").
+		Where("rp.role_id IN ?", roleIDs).
+		Order("p.name").
+		Pluck("p.name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// clearCache drops all cached permissions after a change
+func (m *GormRBACManager) clearCache() {
+	m.cacheMu.Lock()
+	m.cache = make(map[string]rbacCacheEntry)
+	m.cacheMu.Unlock()
+}
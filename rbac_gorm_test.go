@@ -0,0 +1,167 @@
+package userion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupRBACManagerGorm creates an RBACManager with an editor role inheriting from viewer
+func setupRBACManagerGorm(t *testing.T) (*GormRBACManager, UserManager, *gorm.DB) {
+	userManager, db := setupTestDBGorm(t)
+
+	tableName := "roles_test_" + uuid.New().String()[:8]
+	rbacManager := NewGormRBACManager(db, tableName).(*GormRBACManager)
+	err := rbacManager.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	for _, permission := range []string{"documents:read", "documents:write", "billing:manage"} {
+		_, err := rbacManager.CreatePermission(permission, "")
+		require.NoError(t, err)
+	}
+	for _, role := range []string{"viewer", "editor", "admin"} {
+		_, err := rbacManager.CreateRole(role, "")
+		require.NoError(t, err)
+	}
+	require.NoError(t, rbacManager.GrantPermission("viewer", "documents:read"))
+	require.NoError(t, rbacManager.GrantPermission("editor", "documents:write"))
+	require.NoError(t, rbacManager.GrantPermission("admin", "billing:manage"))
+	require.NoError(t, rbacManager.AddRoleParent("editor", "viewer"))
+	require.NoError(t, rbacManager.AddRoleParent("admin", "editor"))
+
+	return rbacManager, userManager, db
+}
+
+// TestRolesAndPermissions_Gorm tests role and permission management
+func TestRolesAndPermissions_Gorm(t *testing.T) {
+	rbacManager, _, _ := setupRBACManagerGorm(t)
+
+	_, err := rbacManager.CreateRole("viewer", "")
+	assert.Equal(t, ErrRoleAlreadyExists, err)
+	_, err = rbacManager.CreatePermission("documents:read", "")
+	assert.Equal(t, ErrPermissionAlreadyExists, err)
+
+	role, err := rbacManager.GetRole("editor")
+	assert.NoError(t, err)
+	assert.Equal(t, "editor", role.Name)
+	_, err = rbacManager.GetRole("unknown")
+	assert.Equal(t, ErrRoleNotFound, err)
+
+	roles, err := rbacManager.ListRoles()
+	assert.NoError(t, err)
+	assert.Len(t, roles, 3)
+
+	permissions, err := rbacManager.ListPermissions()
+	assert.NoError(t, err)
+	assert.Len(t, permissions, 3)
+
+	assert.Equal(t, ErrPermissionNotFound, rbacManager.GrantPermission("viewer", "unknown"))
+	assert.Equal(t, ErrRoleNotFound, rbacManager.GrantPermission("unknown", "documents:read"))
+	assert.NoError(t, rbacManager.GrantPermission("viewer", "documents:read"), "Granting twice should not error")
+
+	// Inherited permissions are included
+	effective, err := rbacManager.RolePermissions("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"billing:manage", "documents:read", "documents:write"}, effective)
+
+	assert.NoError(t, rbacManager.RevokePermission("viewer", "documents:read"))
+	effective, err = rbacManager.RolePermissions("editor")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"documents:write"}, effective)
+
+	assert.NoError(t, rbacManager.DeletePermission("documents:write"))
+	effective, err = rbacManager.RolePermissions("editor")
+	assert.NoError(t, err)
+	assert.Empty(t, effective)
+}
+
+// TestRoleInheritanceCycles_Gorm tests cycle detection
+func TestRoleInheritanceCycles_Gorm(t *testing.T) {
+	rbacManager, _, _ := setupRBACManagerGorm(t)
+
+	assert.Equal(t, ErrRoleCycle, rbacManager.AddRoleParent("viewer", "admin"), "Indirect cycles should be rejected")
+	assert.Equal(t, ErrRoleCycle, rbacManager.AddRoleParent("viewer", "viewer"), "Self inheritance should be rejected")
+
+	assert.NoError(t, rbacManager.RemoveRoleParent("admin", "editor"))
+	assert.NoError(t, rbacManager.AddRoleParent("viewer", "admin"), "Removing a link should allow the reverse link")
+}
+
+// TestHasPermission_Gorm tests permission checks with inheritance, scopes and caching
+func TestHasPermission_Gorm(t *testing.T) {
+	rbacManager, userManager, _ := setupRBACManagerGorm(t)
+	user := createTestUser(t, userManager)
+	userID := user.ID.String()
+
+	allowed, err := rbacManager.HasPermission(userID, "documents:read")
+	assert.NoError(t, err)
+	assert.False(t, allowed, "Users without roles have no permissions")
+
+	require.NoError(t, rbacManager.AssignRole(userID, "editor", ""))
+	allowed, err = rbacManager.HasPermission(userID, "documents:read")
+	assert.NoError(t, err)
+	assert.True(t, allowed, "Inherited permissions should be granted")
+	allowed, err = rbacManager.HasPermission(userID, "billing:manage")
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	// Scoped assignments only apply within their scope
+	require.NoError(t, rbacManager.AssignRole(userID, "admin", "tenant-a"))
+	allowed, err = rbacManager.HasScopedPermission(userID, "billing:manage", "tenant-a")
+	assert.NoError(t, err)
+	assert.True(t, allowed, "Scoped roles should apply within the scope")
+	allowed, err = rbacManager.HasScopedPermission(userID, "billing:manage", "tenant-b")
+	assert.NoError(t, err)
+	assert.False(t, allowed, "Scoped roles should not apply to other scopes")
+	allowed, err = rbacManager.HasScopedPermission(userID, "documents:write", "tenant-b")
+	assert.NoError(t, err)
+	assert.True(t, allowed, "Global roles should apply within every scope")
+	allowed, err = rbacManager.HasPermission(userID, "billing:manage")
+	assert.NoError(t, err)
+	assert.False(t, allowed, "Scoped roles should not apply globally")
+
+	assignments, err := rbacManager.ListUserRoles(userID)
+	assert.NoError(t, err)
+	require.Len(t, assignments, 2)
+	assert.Equal(t, "editor", assignments[0].Role)
+	assert.Equal(t, "admin", assignments[1].Role)
+	assert.Equal(t, "tenant-a", assignments[1].Scope)
+
+	// Changes through the manager take effect immediately
+	require.NoError(t, rbacManager.UnassignRole(userID, "editor", ""))
+	allowed, err = rbacManager.HasPermission(userID, "documents:read")
+	assert.NoError(t, err)
+	assert.False(t, allowed, "Unassigned roles should no longer apply")
+
+	require.NoError(t, rbacManager.DeleteRole("admin"))
+	allowed, err = rbacManager.HasScopedPermission(userID, "billing:manage", "tenant-a")
+	assert.NoError(t, err)
+	assert.False(t, allowed, "Deleted roles should no longer apply")
+}
+
+// TestRBACCache_Gorm tests that results are cached until the TTL expires
+func TestRBACCache_Gorm(t *testing.T) {
+	rbacManager, userManager, db := setupRBACManagerGorm(t)
+	user := createTestUser(t, userManager)
+	now := time.Now()
+	rbacManager.now = func() time.Time { return now }
+
+	require.NoError(t, rbacManager.AssignRole(user.ID.String(), "viewer", ""))
+	allowed, err := rbacManager.HasPermission(user.ID.String(), "documents:read")
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	// A change made behind the manager's back is not seen until the cache expires
+	require.NoError(t, db.Table(rbacManager.userRoleTableName()).Where("user_id = ?", user.ID).Delete(&GormUserRoleModel{}).Error)
+	allowed, err = rbacManager.HasPermission(user.ID.String(), "documents:read")
+	assert.NoError(t, err)
+	assert.True(t, allowed, "Cached permissions should be used")
+
+	now = now.Add(DefaultRBACCacheTTL)
+	allowed, err = rbacManager.HasPermission(user.ID.String(), "documents:read")
+	assert.NoError(t, err)
+	assert.False(t, allowed, "Expired cache entries should be reloaded")
+}
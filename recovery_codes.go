@@ -0,0 +1,11 @@
+package userion
+
+// RecoveryCodeManager defines the interface for single-use recovery codes
+// that replace the second factor when the authenticator is lost
+type RecoveryCodeManager interface {
+	AutoMigrate() error
+	GenerateRecoveryCodes(userID string) ([]string, error)
+	ConsumeRecoveryCode(userID, code string) error
+	RemainingRecoveryCodes(userID string) (int, error)
+	DeleteRecoveryCodes(userID string) error
+}
@@ -0,0 +1,158 @@
+package userion
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Default settings of GormRecoveryCodeManager
+const (
+	DefaultRecoveryCodeCount  = 10
+	DefaultRecoveryCodeLength = 10
+)
+
+// GormRecoveryCodeModel represents a recovery code. Only the salted hash of
+// the code is stored.
+type GormRecoveryCodeModel struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	CodeHash  string    `gorm:"not null"`
+	Salt      string    `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// GormRecoveryCodeManager is the GORM implementation of RecoveryCodeManager
+type GormRecoveryCodeManager struct {
+	db        *gorm.DB
+	tableName string
+
+	count  int
+	length int
+
+	now func() time.Time
+}
+
+// RecoveryCodeOption configures optional behaviour of a GormRecoveryCodeManager
+type RecoveryCodeOption func(*GormRecoveryCodeManager)
+
+// WithRecoveryCodeCount sets how many codes are generated per set
+func WithRecoveryCodeCount(count int) RecoveryCodeOption {
+	return func(m *GormRecoveryCodeManager) {
+		m.count = count
+	}
+}
+
+// WithRecoveryCodeLength sets the number of characters of each code
+func WithRecoveryCodeLength(length int) RecoveryCodeOption {
+	return func(m *GormRecoveryCodeManager) {
+		m.length = length
+	}
+}
+
+// NewGormRecoveryCodeManager initializes a new RecoveryCodeManager
+func NewGormRecoveryCodeManager(db *gorm.DB, tableName string, opts ...RecoveryCodeOption) RecoveryCodeManager {
+	m := &GormRecoveryCodeManager{
+		db:        db,
+		tableName: tableName,
+		count:     DefaultRecoveryCodeCount,
+		length:    DefaultRecoveryCodeLength,
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// AutoMigrate creates or updates the database schema for recovery codes
+func (m *GormRecoveryCodeManager) AutoMigrate() error {
+	return m.db.Table(m.tableName).AutoMigrate(&GormRecoveryCodeModel{})
+}
+
+// GenerateRecoveryCodes creates a new set of codes for the user, replacing
+// any previous set. The plain codes are only returned here and must be shown
+// to the user right away.
+func (m *GormRecoveryCodeManager) GenerateRecoveryCodes(userID string) ([]string, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	codes := make([]string, m.count)
+	records := make([]GormRecoveryCodeModel, m.count)
+	for i := range codes {
+		code, err := GenerateRecoveryCode(m.length)
+		if err != nil {
+			return nil, err
+		}
+
+		salt, err := GenerateSalt()
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = code
+		records[i] = GormRecoveryCodeModel{
+			ID:       uuid.New(),
+			UserID:   id,
+			CodeHash: HashPassword(NormalizeRecoveryCode(code), salt),
+			Salt:     salt,
+		}
+	}
+
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(m.tableName).Where("user_id = ?", id).Delete(&GormRecoveryCodeModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(m.tableName).Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// ConsumeRecoveryCode accepts an unused code of the user and marks it as used
+func (m *GormRecoveryCodeManager) ConsumeRecoveryCode(userID, code string) error {
+	var records []GormRecoveryCodeModel
+	if err := m.db.Table(m.tableName).Where("user_id = ? AND used_at IS NULL", userID).Find(&records).Error; err != nil {
+		return err
+	}
+
+	normalized := NormalizeRecoveryCode(code)
+	for _, record := range records {
+		if subtle.ConstantTimeCompare([]byte(HashPassword(normalized, record.Salt)), []byte(record.CodeHash)) != 1 {
+			continue
+		}
+
+		result := m.db.Table(m.tableName).Where("id = ? AND used_at IS NULL", record.ID).Update("used_at", m.now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	return ErrInvalidCode
+}
+
+// RemainingRecoveryCodes returns how many unused codes the user has left
+func (m *GormRecoveryCodeManager) RemainingRecoveryCodes(userID string) (int, error) {
+	var count int64
+	err := m.db.Table(m.tableName).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return int(count), err
+}
+
+// DeleteRecoveryCodes removes all codes of the user, e.g. when MFA is disabled
+func (m *GormRecoveryCodeManager) DeleteRecoveryCodes(userID string) error {
+	return m.db.Table(m.tableName).Where("user_id = ?", userID).Delete(&GormRecoveryCodeModel{}).Error
+}
@@ -0,0 +1,80 @@
+package userion
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupRecoveryCodeManagerGorm creates a RecoveryCodeManager for tests
+func setupRecoveryCodeManagerGorm(t *testing.T) (*GormRecoveryCodeManager, UserManager, *gorm.DB) {
+	userManager, db := setupTestDBGorm(t)
+
+	tableName := "recovery_codes_test_" + uuid.New().String()[:8]
+	recoveryManager := NewGormRecoveryCodeManager(db, tableName).(*GormRecoveryCodeManager)
+	err := recoveryManager.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	return recoveryManager, userManager, db
+}
+
+// TestGenerateRecoveryCodes_Gorm tests generating and regenerating recovery codes
+func TestGenerateRecoveryCodes_Gorm(t *testing.T) {
+	recoveryManager, userManager, db := setupRecoveryCodeManagerGorm(t)
+	user := createTestUser(t, userManager)
+
+	codes, err := recoveryManager.GenerateRecoveryCodes(user.ID.String())
+	assert.NoError(t, err, "GenerateRecoveryCodes should not error with valid user ID")
+	assert.Len(t, codes, DefaultRecoveryCodeCount)
+	assert.Len(t, codes[0], DefaultRecoveryCodeLength+1, "Codes should contain a separator")
+
+	// Verify only hashes are stored
+	var count int64
+	db.Table(recoveryManager.tableName).Where("code_hash = ? OR code_hash = ?", codes[0], NormalizeRecoveryCode(codes[0])).Count(&count)
+	assert.Equal(t, int64(0), count, "Plain codes should not be stored")
+
+	remaining, err := recoveryManager.RemainingRecoveryCodes(user.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultRecoveryCodeCount, remaining)
+
+	// Regenerating invalidates the old set
+	newCodes, err := recoveryManager.GenerateRecoveryCodes(user.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, ErrInvalidCode, recoveryManager.ConsumeRecoveryCode(user.ID.String(), codes[0]), "Old codes should be invalid")
+	assert.NoError(t, recoveryManager.ConsumeRecoveryCode(user.ID.String(), newCodes[0]), "New codes should be valid")
+
+	remaining, err = recoveryManager.RemainingRecoveryCodes(user.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultRecoveryCodeCount-1, remaining, "Old codes should not be counted")
+
+	assert.NoError(t, recoveryManager.DeleteRecoveryCodes(user.ID.String()))
+	remaining, err = recoveryManager.RemainingRecoveryCodes(user.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, remaining, "DeleteRecoveryCodes should remove all codes")
+}
+
+// TestConsumeRecoveryCode_Gorm tests single use and lenient input
+func TestConsumeRecoveryCode_Gorm(t *testing.T) {
+	recoveryManager, userManager, _ := setupRecoveryCodeManagerGorm(t)
+	user := createTestUser(t, userManager)
+
+	codes, err := recoveryManager.GenerateRecoveryCodes(user.ID.String())
+	require.NoError(t, err)
+
+	// Codes of one user do not work for another
+	assert.Equal(t, ErrInvalidCode, recoveryManager.ConsumeRecoveryCode(uuid.New().String(), codes[0]))
+
+	// Typed codes may differ in case and separators
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	assert.NoError(t, recoveryManager.ConsumeRecoveryCode(user.ID.String(), typed), "ConsumeRecoveryCode should accept a valid code")
+	assert.Equal(t, ErrInvalidCode, recoveryManager.ConsumeRecoveryCode(user.ID.String(), codes[0]), "Codes should be single-use")
+	assert.Equal(t, ErrInvalidCode, recoveryManager.ConsumeRecoveryCode(user.ID.String(), "wrong-code"))
+
+	remaining, err := recoveryManager.RemainingRecoveryCodes(user.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultRecoveryCodeCount-1, remaining)
+}
@@ -0,0 +1,530 @@
+package restapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/weedbox/userion"
+)
+
+// openAPIDocument is the OpenAPI 3 description of the API
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// OpenAPI returns the OpenAPI 3 document describing the API
+func OpenAPI() []byte {
+	return append([]byte(nil), openAPIDocument...)
+}
+
+// maxBodySize limits the size of request bodies
+const maxBodySize = 1 << 20
+
+// orderColumns are the columns users may be ordered by
+var orderColumns = map[string]bool{"created_at": true, "username": true, "email": true, "name": true}
+
+// filterColumns are the columns users may be filtered by
+var filterColumns = []string{"username", "email", "phone", "name", "status"}
+
+// Server serves the REST API of a UserManager
+type Server struct {
+	userManager userion.UserManager
+	config      Config
+	mux         *http.ServeMux
+}
+
+// NewServer returns the REST API of a UserManager. Mount it with
+// http.StripPrefix when it is not served at the root, e.g.
+// http.StripPrefix("/api", server).
+func NewServer(userManager userion.UserManager, config Config) *Server {
+	if config.DefaultPageSize <= 0 {
+		config.DefaultPageSize = 50
+	}
+	if config.MaxPageSize <= 0 {
+		config.MaxPageSize = 500
+	}
+
+	s := &Server{userManager: userManager, config: config, mux: http.NewServeMux()}
+
+	s.mux.HandleFunc("GET /openapi.json", s.handleOpenAPI)
+	s.mux.HandleFunc("POST /users", s.handleCreateUser)
+	s.mux.HandleFunc("GET /users", s.handleListUsers)
+	s.mux.HandleFunc("GET /users/{id}", s.handleGetUser)
+	s.mux.HandleFunc("GET /users/by-username/{username}", s.handleGetUserByUsername)
+	s.mux.HandleFunc("GET /users/by-email/{email}", s.handleGetUserByEmail)
+	s.mux.HandleFunc("PATCH /users/{id}", s.handleUpdateUser)
+	s.mux.HandleFunc("DELETE /users/{id}", s.handleDeleteUser)
+	s.mux.HandleFunc("POST /users/{id}/enable", s.handleEnableUser)
+	s.mux.HandleFunc("POST /users/{id}/disable", s.handleDisableUser)
+	s.mux.HandleFunc("PUT /users/{id}/status", s.handleSetUserStatus)
+	s.mux.HandleFunc("POST /verify-password", s.handleVerifyPassword)
+
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, &Error{Status: http.StatusNotFound, Code: "not_found", Message: "unknown endpoint"})
+	})
+	return s
+}
+
+// ServeHTTP serves a request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorize asks Config.Authorize whether the request may perform the operation
+func (s *Server) authorize(r *http.Request, operation Operation, userID string) error {
+	if s.config.Authorize == nil {
+		return authorizationError(ErrForbidden)
+	}
+	if err := s.config.Authorize(r, operation, userID); err != nil {
+		return authorizationError(err)
+	}
+	return nil
+}
+
+// handleOpenAPI serves the OpenAPI document. It needs no authorization.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+// handleCreateUser serves POST /users
+func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorize(r, OperationCreateUser, ""); err != nil {
+		writeError(w, err)
+		return
+	}
+	var request CreateUserRequest
+	if err := readJSON(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	if request.Username == "" {
+		writeError(w, invalidRequest("username is required"))
+		return
+	}
+	if request.Status == "" {
+		request.Status = userion.DefaultUserStatus
+	}
+	if !validStatus(request.Status) {
+		writeError(w, invalidRequest("unknown status "+string(request.Status)))
+		return
+	}
+	if err := checkPassword(request.Password); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	user := &userion.User{
+		Username:           request.Username,
+		Email:              request.Email,
+		Name:               request.Name,
+		Phone:              request.Phone,
+		Password:           request.Password,
+		Enabled:            true,
+		Status:             request.Status,
+		Data:               request.Data,
+		MustChangePassword: request.MustChangePassword,
+	}
+	if user.Password == "" {
+		user.Password = userion.UnusablePassword
+	}
+	if err := s.userManager.CreateUser(user); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Users are enabled by default, so disabled ones are disabled afterwards
+	if request.Enabled != nil && !*request.Enabled {
+		if err := s.userManager.DisableUserByID(user.ID.String()); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	s.writeUser(w, http.StatusCreated, user.ID.String())
+}
+
+// handleListUsers serves GET /users
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorize(r, OperationListUsers, ""); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := intParameter(query.Get("limit"), s.config.DefaultPageSize)
+	if err != nil || limit < 1 {
+		writeError(w, invalidRequest("limit must be a positive integer"))
+		return
+	}
+	limit = min(limit, s.config.MaxPageSize)
+	offset, err := intParameter(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, invalidRequest("offset must be a non-negative integer"))
+		return
+	}
+
+	orderBy := query.Get("order_by")
+	if orderBy == "" {
+		orderBy = "created_at"
+	}
+	if !orderColumns[orderBy] {
+		writeError(w, invalidRequest("cannot order by "+orderBy))
+		return
+	}
+	desc := query.Get("desc") == "true"
+
+	filters := map[string]interface{}{}
+	for _, column := range filterColumns {
+		if query.Has(column) {
+			filters[column] = query.Get(column)
+		}
+	}
+	if query.Has("enabled") {
+		enabled, err := strconv.ParseBool(query.Get("enabled"))
+		if err != nil {
+			writeError(w, invalidRequest("enabled must be true or false"))
+			return
+		}
+		filters["enabled"] = enabled
+	}
+	if query.Has("group") {
+		filters[userion.FilterGroup] = query.Get("group")
+	}
+
+	users, err := s.userManager.ListUsers(limit, offset, filters, orderBy, desc)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	response := &ListUsersResponse{Users: []*User{}, Limit: limit, Offset: offset}
+	for i := range users {
+		response.Users = append(response.Users, NewUser(&users[i]))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleGetUser serves GET /users/{id}
+func (s *Server) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := s.authorizeUser(r, OperationGetUser)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeUser(w, http.StatusOK, id)
+}
+
+// handleGetUserByUsername serves GET /users/by-username/{username}
+func (s *Server) handleGetUserByUsername(w http.ResponseWriter, r *http.Request) {
+	user, err := s.userManager.GetUserByUsername(r.PathValue("username"))
+	s.writeLookup(w, r, user, err)
+}
+
+// handleGetUserByEmail serves GET /users/by-email/{email}
+func (s *Server) handleGetUserByEmail(w http.ResponseWriter, r *http.Request) {
+	user, err := s.userManager.GetUserByEmail(r.PathValue("email"))
+	s.writeLookup(w, r, user, err)
+}
+
+// writeLookup writes a user looked up by username or email. The request is
+// authorized for the user found, or for no user when there is none, so
+// unauthorized callers cannot tell which users exist.
+func (s *Server) writeLookup(w http.ResponseWriter, r *http.Request, user *userion.User, err error) {
+	userID := ""
+	if err == nil {
+		userID = user.ID.String()
+	}
+	if authErr := s.authorize(r, OperationGetUser, userID); authErr != nil {
+		writeError(w, authErr)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, NewUser(user))
+}
+
+// handleUpdateUser serves PATCH /users/{id}
+func (s *Server) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := s.authorizeUser(r, OperationUpdateUser)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var request UpdateUserRequest
+	if err := readJSON(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	user, err := s.userManager.GetUserByID(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	changes := map[string]interface{}{}
+	if request.Username != nil && *request.Username != user.Username {
+		if *request.Username == "" {
+			writeError(w, invalidRequest("username cannot be empty"))
+			return
+		}
+		if err := checkAvailable(s.userManager.GetUserByUsername(*request.Username)); err != nil {
+			writeError(w, err)
+			return
+		}
+		changes["Username"] = *request.Username
+	}
+	if request.Email != nil && *request.Email != user.Email {
+		if err := checkAvailable(s.userManager.GetUserByEmail(*request.Email)); err != nil {
+			writeError(w, err)
+			return
+		}
+		changes["Email"] = *request.Email
+		// Ownership of the new address has not been confirmed
+		changes["EmailVerifiedAt"] = nil
+	}
+	if request.Phone != nil && *request.Phone != user.Phone {
+		changes["Phone"] = *request.Phone
+		changes["PhoneVerifiedAt"] = nil
+	}
+	if request.Name != nil {
+		changes["Name"] = *request.Name
+	}
+	if request.Password != nil {
+		if *request.Password == "" {
+			writeError(w, invalidRequest("password cannot be empty"))
+			return
+		}
+		if err := checkPassword(*request.Password); err != nil {
+			writeError(w, err)
+			return
+		}
+		changes["Password"] = *request.Password
+	}
+	if request.Data != nil {
+		// Keys are merged into the existing data; null removes a key
+		data := map[string]interface{}{}
+		for key, value := range user.Data {
+			data[key] = value
+		}
+		for key, value := range request.Data {
+			if value == nil {
+				delete(data, key)
+			} else {
+				data[key] = value
+			}
+		}
+		changes["Data"] = data
+	}
+	if request.MustChangePassword != nil {
+		changes["MustChangePassword"] = *request.MustChangePassword
+	}
+
+	if len(changes) > 0 {
+		if err := s.userManager.UpdateUserByID(id, changes); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	s.writeUser(w, http.StatusOK, id)
+}
+
+// checkPassword rejects passwords of 64 or more characters, which the
+// manager stores as given, taking them for hashes
+func checkPassword(password string) error {
+	if len(password) >= 64 {
+		return invalidRequest("password must be shorter than 64 characters")
+	}
+	return nil
+}
+
+// checkAvailable turns the result of looking up a new username or email
+// into ErrUserAlreadyExists when another user already has it
+func checkAvailable(_ *userion.User, err error) error {
+	if err == nil {
+		return userion.ErrUserAlreadyExists
+	}
+	if errors.Is(err, userion.ErrUserNotFound) {
+		return nil
+	}
+	return err
+}
+
+// handleDeleteUser serves DELETE /users/{id}
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := s.authorizeUser(r, OperationDeleteUser)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := s.userManager.DeleteUserByID(id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEnableUser serves POST /users/{id}/enable
+func (s *Server) handleEnableUser(w http.ResponseWriter, r *http.Request) {
+	id, err := s.authorizeUser(r, OperationEnableUser)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := s.userManager.EnableUserByID(id); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeUser(w, http.StatusOK, id)
+}
+
+// handleDisableUser serves POST /users/{id}/disable
+func (s *Server) handleDisableUser(w http.ResponseWriter, r *http.Request) {
+	id, err := s.authorizeUser(r, OperationDisableUser)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := s.userManager.DisableUserByID(id); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeUser(w, http.StatusOK, id)
+}
+
+// handleSetUserStatus serves PUT /users/{id}/status
+func (s *Server) handleSetUserStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := s.authorizeUser(r, OperationSetUserStatus)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var request SetStatusRequest
+	if err := readJSON(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	if !validStatus(request.Status) {
+		writeError(w, invalidRequest("unknown status "+string(request.Status)))
+		return
+	}
+	if err := s.userManager.SetUserStatusByID(id, request.Status); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeUser(w, http.StatusOK, id)
+}
+
+// handleVerifyPassword serves POST /verify-password. Unknown users fail like
+// wrong passwords so callers cannot tell which users exist; disabled and
+// inactive users fail once their password is verified.
+func (s *Server) handleVerifyPassword(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorize(r, OperationVerifyPassword, ""); err != nil {
+		writeError(w, err)
+		return
+	}
+	var request VerifyPasswordRequest
+	if err := readJSON(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var user *userion.User
+	var err error
+	switch {
+	case request.ID != "" && request.Username == "" && request.Email == "":
+		if _, parseErr := uuid.Parse(request.ID); parseErr != nil {
+			err = userion.ErrUserNotFound
+		} else if err = s.userManager.VerifyPasswordByID(request.ID, request.Password); err == nil {
+			user, err = s.userManager.GetUserByID(request.ID)
+		}
+	case request.Username != "" && request.ID == "" && request.Email == "":
+		if err = s.userManager.VerifyPasswordByUsername(request.Username, request.Password); err == nil {
+			user, err = s.userManager.GetUserByUsername(request.Username)
+		}
+	case request.Email != "" && request.ID == "" && request.Username == "":
+		if err = s.userManager.VerifyPasswordByEmail(request.Email, request.Password); err == nil {
+			user, err = s.userManager.GetUserByEmail(request.Email)
+		}
+	default:
+		writeError(w, invalidRequest("exactly one of id, username and email is required"))
+		return
+	}
+	if errors.Is(err, userion.ErrUserNotFound) {
+		err = userion.ErrInvalidPassword
+	}
+	if err == nil && !user.Enabled {
+		err = userion.ErrUserDisabled
+	}
+	if err == nil && user.Status != userion.UserStatusActive {
+		err = userion.ErrUserNotActive
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, NewUser(user))
+}
+
+// authorizeUser authorizes an operation on the user named by the request
+// path and returns the user's ID
+func (s *Server) authorizeUser(r *http.Request, operation Operation) (string, error) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		// Malformed IDs are authorized like unknown ones
+		if authErr := s.authorize(r, operation, ""); authErr != nil {
+			return "", authErr
+		}
+		return "", userion.ErrUserNotFound
+	}
+	if err := s.authorize(r, operation, id.String()); err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// writeUser writes the current state of a user
+func (s *Server) writeUser(w http.ResponseWriter, status int, id string) {
+	user, err := s.userManager.GetUserByID(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, status, NewUser(user))
+}
+
+// intParameter parses an integer query parameter
+func intParameter(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// readJSON decodes a request body, rejecting unknown fields
+func readJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return invalidRequest("malformed JSON body: " + err.Error())
+	}
+	return nil
+}
+
+// writeError writes an error as JSON
+func writeError(w http.ResponseWriter, err error) {
+	apiErr := toError(err)
+	writeJSON(w, apiErr.Status, apiErr)
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
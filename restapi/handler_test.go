@@ -0,0 +1,338 @@
+package restapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weedbox/userion"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupServer serves the REST API of a new user manager. Requests carrying
+// an "X-Role: admin" header may do anything; requests with "X-User: <id>"
+// may only read that user.
+func setupServer(t *testing.T) (*Server, userion.UserManager) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to database")
+	t.Cleanup(func() {
+		sqlDB, err := db.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	userManager := userion.NewGormUserManager(db, "users_test_"+uuid.New().String()[:8])
+	require.NoError(t, userManager.AutoMigrate(), "Failed to migrate database")
+
+	server := NewServer(userManager, Config{
+		Authorize: func(r *http.Request, operation Operation, userID string) error {
+			if r.Header.Get("X-Role") == "admin" {
+				return nil
+			}
+			if self := r.Header.Get("X-User"); self != "" {
+				if operation == OperationGetUser && userID == self {
+					return nil
+				}
+				return ErrForbidden
+			}
+			return ErrUnauthenticated
+		},
+		MaxPageSize: 3,
+	})
+	return server, userManager
+}
+
+// request sends a request to the server as an administrator unless headers
+// are given, and decodes the response body into v
+func request(t *testing.T, server *Server, method, path string, body interface{}, v interface{}, headers ...string) int {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if len(headers) == 0 {
+		headers = []string{"X-Role", "admin"}
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	if v != nil {
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), v), recorder.Body.String())
+	}
+	return recorder.Code
+}
+
+// createUser creates a user through the API
+func createUser(t *testing.T, server *Server, username string) *User {
+	var user User
+	status := request(t, server, http.MethodPost, "/users", &CreateUserRequest{
+		Username: username,
+		Email:    username + "@example.com",
+		Name:     strings.ToUpper(username[:1]) + username[1:],
+		Password: "password123",
+		Status:   userion.UserStatusActive,
+	}, &user)
+	require.Equal(t, http.StatusCreated, status)
+	return &user
+}
+
+// TestServerCreateUser tests creating users
+func TestServerCreateUser(t *testing.T) {
+	server, userManager := setupServer(t)
+
+	user := createUser(t, server, "alice")
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, userion.UserStatusActive, user.Status)
+	assert.True(t, user.Enabled)
+	assert.True(t, user.HasPassword)
+	require.NoError(t, userManager.VerifyPasswordByUsername("alice", "password123"))
+
+	var body map[string]interface{}
+	request(t, server, http.MethodGet, "/users/"+user.ID.String(), nil, &body)
+	assert.NotContains(t, body, "password", "Password hashes should never be returned")
+	assert.NotContains(t, body, "salt")
+
+	var apiErr Error
+	assert.Equal(t, http.StatusConflict, request(t, server, http.MethodPost, "/users", &CreateUserRequest{Username: "alice", Email: "other@example.com"}, &apiErr))
+	assert.Equal(t, "user_already_exists", apiErr.Code)
+
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodPost, "/users", map[string]interface{}{"username": "bob", "role": "admin"}, &apiErr))
+	assert.Equal(t, "invalid_request", apiErr.Code, "Unknown fields should be rejected")
+
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodPost, "/users", &CreateUserRequest{Username: "bob", Status: "deleted"}, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodPost, "/users", &CreateUserRequest{Username: "bob", Password: strings.Repeat("a", 64)}, &apiErr),
+		"Passwords the manager would take for hashes should be rejected")
+
+	disabled := false
+	var bob User
+	require.Equal(t, http.StatusCreated, request(t, server, http.MethodPost, "/users", &CreateUserRequest{Username: "bob", Email: "bob@example.com", Enabled: &disabled}, &bob))
+	assert.False(t, bob.Enabled)
+	assert.False(t, bob.HasPassword, "Users created without a password cannot sign in with one")
+	assert.Equal(t, userion.DefaultUserStatus, bob.Status)
+}
+
+// TestServerGetUser tests looking users up by ID, username and email
+func TestServerGetUser(t *testing.T) {
+	server, _ := setupServer(t)
+	alice := createUser(t, server, "alice")
+
+	for _, path := range []string{"/users/" + alice.ID.String(), "/users/by-username/alice", "/users/by-email/alice@example.com"} {
+		var user User
+		require.Equal(t, http.StatusOK, request(t, server, http.MethodGet, path, nil, &user), path)
+		assert.Equal(t, alice.ID, user.ID, path)
+	}
+
+	var apiErr Error
+	for _, path := range []string{"/users/" + uuid.New().String(), "/users/not-a-uuid", "/users/by-username/nobody", "/users/by-email/nobody@example.com"} {
+		assert.Equal(t, http.StatusNotFound, request(t, server, http.MethodGet, path, nil, &apiErr), path)
+		assert.Equal(t, "user_not_found", apiErr.Code, path)
+	}
+}
+
+// TestServerAuthorization tests that the authorization hook is consulted
+func TestServerAuthorization(t *testing.T) {
+	server, _ := setupServer(t)
+	alice := createUser(t, server, "alice")
+	bob := createUser(t, server, "bob")
+	asAlice := []string{"X-User", alice.ID.String()}
+
+	var apiErr Error
+	assert.Equal(t, http.StatusUnauthorized, request(t, server, http.MethodGet, "/users", nil, &apiErr, "X-None", ""))
+	assert.Equal(t, "unauthenticated", apiErr.Code)
+
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/users/"+alice.ID.String(), nil, nil, asAlice...))
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/users/by-username/alice", nil, nil, asAlice...))
+	assert.Equal(t, http.StatusForbidden, request(t, server, http.MethodGet, "/users/"+bob.ID.String(), nil, &apiErr, asAlice...))
+	assert.Equal(t, "forbidden", apiErr.Code)
+	assert.Equal(t, http.StatusForbidden, request(t, server, http.MethodGet, "/users/by-username/bob", nil, nil, asAlice...))
+	assert.Equal(t, http.StatusForbidden, request(t, server, http.MethodGet, "/users/by-username/nobody", nil, nil, asAlice...), "Unknown users should not be disclosed")
+	assert.Equal(t, http.StatusForbidden, request(t, server, http.MethodDelete, "/users/"+alice.ID.String(), nil, nil, asAlice...))
+
+	unconfigured := NewServer(server.userManager, Config{})
+	assert.Equal(t, http.StatusForbidden, request(t, unconfigured, http.MethodGet, "/users", nil, nil), "Requests should be rejected without an authorization hook")
+	assert.Equal(t, http.StatusOK, request(t, unconfigured, http.MethodGet, "/openapi.json", nil, nil), "The OpenAPI document needs no authorization")
+}
+
+// TestServerUpdateUser tests patching users
+func TestServerUpdateUser(t *testing.T) {
+	server, userManager := setupServer(t)
+	alice := createUser(t, server, "alice")
+	createUser(t, server, "bob")
+	path := "/users/" + alice.ID.String()
+
+	require.NoError(t, userManager.UpdateUserByID(alice.ID.String(), map[string]interface{}{
+		"Data": map[string]interface{}{"theme": "dark", "locale": "en"},
+	}))
+
+	var user User
+	require.Equal(t, http.StatusOK, request(t, server, http.MethodPatch, path, map[string]interface{}{
+		"name":     "Alice Liddell",
+		"email":    "liddell@example.com",
+		"password": "new password 1",
+		"data":     map[string]interface{}{"theme": "light", "locale": nil},
+	}, &user))
+	assert.Equal(t, "Alice Liddell", user.Name)
+	assert.Equal(t, "alice", user.Username, "Missing fields should be left unchanged")
+	assert.Equal(t, "liddell@example.com", user.Email)
+	assert.Nil(t, user.EmailVerifiedAt)
+	assert.Equal(t, map[string]interface{}{"theme": "light"}, user.Data)
+	require.NoError(t, userManager.VerifyPasswordByUsername("alice", "new password 1"))
+
+	var apiErr Error
+	assert.Equal(t, http.StatusConflict, request(t, server, http.MethodPatch, path, map[string]interface{}{"username": "bob"}, &apiErr))
+	assert.Equal(t, "user_already_exists", apiErr.Code)
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodPatch, path, map[string]interface{}{"status": "active"}, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodPatch, path, map[string]interface{}{"password": ""}, &apiErr))
+	assert.Equal(t, "invalid_request", apiErr.Code)
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodPatch, path, map[string]interface{}{"password": strings.Repeat("a", 64)}, &apiErr))
+	assert.Equal(t, "invalid_request", apiErr.Code)
+	require.NoError(t, userManager.VerifyPasswordByUsername("alice", "new password 1"), "Rejected passwords should not be stored")
+	assert.Equal(t, http.StatusNotFound, request(t, server, http.MethodPatch, "/users/"+uuid.New().String(), map[string]interface{}{"name": "x"}, &apiErr))
+}
+
+// TestServerUserStatus tests enabling, disabling and setting the status of users
+func TestServerUserStatus(t *testing.T) {
+	server, _ := setupServer(t)
+	alice := createUser(t, server, "alice")
+	path := "/users/" + alice.ID.String()
+
+	var user User
+	require.Equal(t, http.StatusOK, request(t, server, http.MethodPost, path+"/disable", nil, &user))
+	assert.False(t, user.Enabled)
+	require.Equal(t, http.StatusOK, request(t, server, http.MethodPost, path+"/enable", nil, &user))
+	assert.True(t, user.Enabled)
+
+	require.Equal(t, http.StatusOK, request(t, server, http.MethodPut, path+"/status", &SetStatusRequest{Status: userion.UserStatusSuspended}, &user))
+	assert.Equal(t, userion.UserStatusSuspended, user.Status)
+
+	var apiErr Error
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodPut, path+"/status", &SetStatusRequest{Status: "deleted"}, &apiErr))
+	assert.Equal(t, http.StatusNotFound, request(t, server, http.MethodPost, "/users/"+uuid.New().String()+"/enable", nil, &apiErr))
+}
+
+// TestServerListUsers tests listing users with filters and pagination
+func TestServerListUsers(t *testing.T) {
+	server, _ := setupServer(t)
+	for _, username := range []string{"alice", "bob", "carol", "dave"} {
+		createUser(t, server, username)
+	}
+	request(t, server, http.MethodPost, "/users/"+createUser(t, server, "erin").ID.String()+"/disable", nil, nil)
+
+	list := func(query string) []string {
+		var response ListUsersResponse
+		require.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/users"+query, nil, &response), query)
+		var usernames []string
+		for _, user := range response.Users {
+			usernames = append(usernames, user.Username)
+		}
+		return usernames
+	}
+
+	assert.Equal(t, []string{"alice", "bob", "carol"}, list(""), "Pages should be capped at the maximum page size")
+	assert.Equal(t, []string{"dave", "erin"}, list("?offset=3"))
+	assert.Equal(t, []string{"erin", "dave"}, list("?order_by=username&desc=true&limit=2"))
+	assert.Equal(t, []string{"carol"}, list("?email=carol@example.com"))
+	assert.Equal(t, []string{"erin"}, list("?enabled=false"))
+	assert.Empty(t, list("?status=locked"))
+
+	var apiErr Error
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodGet, "/users?order_by=password", nil, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodGet, "/users?limit=0", nil, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodGet, "/users?enabled=maybe", nil, &apiErr))
+}
+
+// TestServerDeleteUser tests deleting users
+func TestServerDeleteUser(t *testing.T) {
+	server, userManager := setupServer(t)
+	alice := createUser(t, server, "alice")
+
+	assert.Equal(t, http.StatusNoContent, request(t, server, http.MethodDelete, "/users/"+alice.ID.String(), nil, nil))
+	_, err := userManager.GetUserByID(alice.ID.String())
+	assert.ErrorIs(t, err, userion.ErrUserNotFound)
+	assert.Equal(t, http.StatusNotFound, request(t, server, http.MethodDelete, "/users/"+alice.ID.String(), nil, nil))
+}
+
+// TestServerVerifyPassword tests verifying passwords
+func TestServerVerifyPassword(t *testing.T) {
+	server, userManager := setupServer(t)
+	alice := createUser(t, server, "alice")
+
+	for _, req := range []VerifyPasswordRequest{
+		{Username: "alice", Password: "password123"},
+		{Email: "alice@example.com", Password: "password123"},
+		{ID: alice.ID.String(), Password: "password123"},
+	} {
+		var user User
+		require.Equal(t, http.StatusOK, request(t, server, http.MethodPost, "/verify-password", &req, &user), req)
+		assert.Equal(t, alice.ID, user.ID)
+	}
+
+	var apiErr Error
+	assert.Equal(t, http.StatusUnauthorized, request(t, server, http.MethodPost, "/verify-password", &VerifyPasswordRequest{Username: "alice", Password: "wrong"}, &apiErr))
+	assert.Equal(t, "invalid_credentials", apiErr.Code)
+	assert.Equal(t, http.StatusUnauthorized, request(t, server, http.MethodPost, "/verify-password", &VerifyPasswordRequest{Username: "nobody", Password: "password123"}, &apiErr))
+	assert.Equal(t, "invalid_credentials", apiErr.Code, "Unknown users should fail like wrong passwords")
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodPost, "/verify-password", &VerifyPasswordRequest{Username: "alice", Email: "alice@example.com", Password: "password123"}, &apiErr))
+
+	require.NoError(t, userManager.UpdateUserByID(alice.ID.String(), map[string]interface{}{"MustChangePassword": true}))
+	assert.Equal(t, http.StatusForbidden, request(t, server, http.MethodPost, "/verify-password", &VerifyPasswordRequest{Username: "alice", Password: "password123"}, &apiErr))
+	assert.Equal(t, "password_change_required", apiErr.Code)
+	require.NoError(t, userManager.UpdateUserByID(alice.ID.String(), map[string]interface{}{"MustChangePassword": false}))
+
+	require.NoError(t, userManager.DisableUserByID(alice.ID.String()))
+	assert.Equal(t, http.StatusForbidden, request(t, server, http.MethodPost, "/verify-password", &VerifyPasswordRequest{Username: "alice", Password: "password123"}, &apiErr))
+	assert.Equal(t, "user_disabled", apiErr.Code)
+	assert.Equal(t, http.StatusUnauthorized, request(t, server, http.MethodPost, "/verify-password", &VerifyPasswordRequest{Username: "alice", Password: "wrong"}, &apiErr))
+	assert.Equal(t, "invalid_credentials", apiErr.Code, "Disabled users should only be reported once the password is verified")
+
+	require.NoError(t, userManager.EnableUserByID(alice.ID.String()))
+	require.NoError(t, userManager.SetUserStatusByID(alice.ID.String(), userion.UserStatusSuspended))
+	assert.Equal(t, http.StatusForbidden, request(t, server, http.MethodPost, "/verify-password", &VerifyPasswordRequest{Username: "alice", Password: "password123"}, &apiErr))
+	assert.Equal(t, "user_not_active", apiErr.Code)
+}
+
+// TestOpenAPI tests that the OpenAPI document describes every route
+func TestOpenAPI(t *testing.T) {
+	server, _ := setupServer(t)
+
+	var document struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/openapi.json", nil, &document))
+	assert.True(t, strings.HasPrefix(document.OpenAPI, "3."))
+
+	routes := map[string][]string{
+		"/users":                        {"get", "post"},
+		"/users/{id}":                   {"get", "patch", "delete"},
+		"/users/by-username/{username}": {"get"},
+		"/users/by-email/{email}":       {"get"},
+		"/users/{id}/enable":            {"post"},
+		"/users/{id}/disable":           {"post"},
+		"/users/{id}/status":            {"put"},
+		"/verify-password":              {"post"},
+	}
+	assert.Len(t, document.Paths, len(routes))
+	for path, methods := range routes {
+		require.Contains(t, document.Paths, path)
+		for _, method := range methods {
+			assert.Contains(t, document.Paths[path], method, path)
+		}
+	}
+	assert.JSONEq(t, string(OpenAPI()), string(openAPIDocument))
+}
@@ -0,0 +1,201 @@
+// Package restapi exposes a UserManager as a JSON REST API over net/http.
+// The API is described by the OpenAPI 3 document served at /openapi.json.
+package restapi
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weedbox/userion"
+)
+
+// Operation identifies what a request does, for authorization decisions
+type Operation string
+
+const (
+	OperationCreateUser     Operation = "create_user"
+	OperationGetUser        Operation = "get_user"
+	OperationListUsers      Operation = "list_users"
+	OperationUpdateUser     Operation = "update_user"
+	OperationDeleteUser     Operation = "delete_user"
+	OperationEnableUser     Operation = "enable_user"
+	OperationDisableUser    Operation = "disable_user"
+	OperationSetUserStatus  Operation = "set_user_status"
+	OperationVerifyPassword Operation = "verify_password"
+)
+
+// Errors returned by Config.Authorize to reject a request. Any other error
+// is treated like ErrForbidden.
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("operation not allowed")
+)
+
+// Config configures the REST API
+type Config struct {
+	// Authorize decides whether a request may perform an operation. userID
+	// is the user the operation applies to, or empty for operations on no
+	// particular user such as creating or listing users. Requests are
+	// rejected when it is nil or returns an error.
+	Authorize func(r *http.Request, operation Operation, userID string) error
+
+	// DefaultPageSize and MaxPageSize bound the users returned by a list
+	// request. They default to 50 and 500.
+	DefaultPageSize int
+	MaxPageSize     int
+}
+
+// Error is the JSON body of an error response
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"error"` // e.g. user_not_found, invalid_request
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// invalidRequest returns the error for a malformed request
+func invalidRequest(message string) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: "invalid_request", Message: message}
+}
+
+// toError maps errors of the UserManager to API errors
+func toError(err error) *Error {
+	var apiErr *Error
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, userion.ErrUserNotFound):
+		return &Error{Status: http.StatusNotFound, Code: "user_not_found", Message: err.Error()}
+	case errors.Is(err, userion.ErrUserAlreadyExists):
+		return &Error{Status: http.StatusConflict, Code: "user_already_exists", Message: err.Error()}
+	case errors.Is(err, userion.ErrWeakPassword):
+		return &Error{Status: http.StatusUnprocessableEntity, Code: "weak_password", Message: err.Error()}
+	case errors.Is(err, userion.ErrInvalidPassword):
+		return &Error{Status: http.StatusUnauthorized, Code: "invalid_credentials", Message: err.Error()}
+	case errors.Is(err, userion.ErrPasswordExpired):
+		return &Error{Status: http.StatusForbidden, Code: "password_expired", Message: err.Error()}
+	case errors.Is(err, userion.ErrPasswordChangeRequired):
+		return &Error{Status: http.StatusForbidden, Code: "password_change_required", Message: err.Error()}
+	case errors.Is(err, userion.ErrMFARequired):
+		return &Error{Status: http.StatusForbidden, Code: "mfa_required", Message: err.Error()}
+	case errors.Is(err, userion.ErrUserDisabled):
+		return &Error{Status: http.StatusForbidden, Code: "user_disabled", Message: err.Error()}
+	case errors.Is(err, userion.ErrUserNotActive):
+		return &Error{Status: http.StatusForbidden, Code: "user_not_active", Message: err.Error()}
+	case errors.Is(err, userion.ErrCrossTenantAccess):
+		return &Error{Status: http.StatusForbidden, Code: "cross_tenant_access", Message: err.Error()}
+	}
+	return &Error{Status: http.StatusInternalServerError, Code: "internal_error", Message: "internal error"}
+}
+
+// authorizationError maps an error of Config.Authorize to an API error.
+// Errors other than ErrUnauthenticated are not disclosed.
+func authorizationError(err error) *Error {
+	if errors.Is(err, ErrUnauthenticated) {
+		return &Error{Status: http.StatusUnauthorized, Code: "unauthenticated", Message: ErrUnauthenticated.Error()}
+	}
+	return &Error{Status: http.StatusForbidden, Code: "forbidden", Message: ErrForbidden.Error()}
+}
+
+// User is the JSON representation of a user. Passwords and salts are never
+// returned.
+type User struct {
+	ID                 uuid.UUID              `json:"id"`
+	TenantID           string                 `json:"tenant_id,omitempty"`
+	Username           string                 `json:"username"`
+	Email              string                 `json:"email"`
+	Name               string                 `json:"name"`
+	Phone              string                 `json:"phone"`
+	Enabled            bool                   `json:"enabled"`
+	Status             userion.UserStatus     `json:"status"`
+	Data               map[string]interface{} `json:"data,omitempty"`
+	CreatedAt          time.Time              `json:"created_at"`
+	EmailVerifiedAt    *time.Time             `json:"email_verified_at,omitempty"`
+	PhoneVerifiedAt    *time.Time             `json:"phone_verified_at,omitempty"`
+	PasswordChangedAt  *time.Time             `json:"password_changed_at,omitempty"`
+	MustChangePassword bool                   `json:"must_change_password"`
+	HasPassword        bool                   `json:"has_password"`
+}
+
+// NewUser returns the JSON representation of a user
+func NewUser(user *userion.User) *User {
+	return &User{
+		ID:                 user.ID,
+		TenantID:           user.TenantID,
+		Username:           user.Username,
+		Email:              user.Email,
+		Name:               user.Name,
+		Phone:              user.Phone,
+		Enabled:            user.Enabled,
+		Status:             user.Status,
+		Data:               user.Data,
+		CreatedAt:          user.CreatedAt,
+		EmailVerifiedAt:    user.EmailVerifiedAt,
+		PhoneVerifiedAt:    user.PhoneVerifiedAt,
+		PasswordChangedAt:  user.PasswordChangedAt,
+		MustChangePassword: user.MustChangePassword,
+		HasPassword:        userion.HasUsablePassword(user),
+	}
+}
+
+// CreateUserRequest is the body of a request creating a user. Users created
+// without a password cannot sign in with one.
+type CreateUserRequest struct {
+	Username           string                 `json:"username"`
+	Email              string                 `json:"email"`
+	Name               string                 `json:"name"`
+	Phone              string                 `json:"phone"`
+	Password           string                 `json:"password"`
+	Enabled            *bool                  `json:"enabled"` // Defaults to true
+	Status             userion.UserStatus     `json:"status"`  // Defaults to userion.DefaultUserStatus
+	Data               map[string]interface{} `json:"data"`
+	MustChangePassword bool                   `json:"must_change_password"`
+}
+
+// UpdateUserRequest is the body of a request updating a user. Fields that
+// are missing are left unchanged. Data is merged into the existing data,
+// and keys set to null are removed.
+type UpdateUserRequest struct {
+	Username           *string                `json:"username"`
+	Email              *string                `json:"email"`
+	Name               *string                `json:"name"`
+	Phone              *string                `json:"phone"`
+	Password           *string                `json:"password"`
+	Data               map[string]interface{} `json:"data"`
+	MustChangePassword *bool                  `json:"must_change_password"`
+}
+
+// SetStatusRequest is the body of a request setting the status of a user
+type SetStatusRequest struct {
+	Status userion.UserStatus `json:"status"`
+}
+
+// VerifyPasswordRequest is the body of a request verifying a password. The
+// user is identified by exactly one of ID, Username and Email.
+type VerifyPasswordRequest struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// ListUsersResponse is the body of a list response
+type ListUsersResponse struct {
+	Users  []*User `json:"users"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+}
+
+// validStatus reports whether status is one of the known user statuses
+func validStatus(status userion.UserStatus) bool {
+	switch status {
+	case userion.UserStatusActive, userion.UserStatusInactive, userion.UserStatusSuspended, userion.UserStatusLocked:
+		return true
+	}
+	return false
+}
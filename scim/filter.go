@@ -0,0 +1,449 @@
+package scim
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// filter is a parsed filter expression (RFC 7644 section 3.4.2.2) evaluated
+// against a resource or an element of a multi-valued attribute
+type filter interface {
+	match(resource map[string]interface{}) bool
+}
+
+// attrPath names an attribute and optionally one of its sub-attributes
+type attrPath struct {
+	attribute    string
+	subAttribute string
+}
+
+// logicalFilter combines two filters with and or or
+type logicalFilter struct {
+	and         bool
+	left, right filter
+}
+
+func (f *logicalFilter) match(resource map[string]interface{}) bool {
+	if f.and {
+		return f.left.match(resource) && f.right.match(resource)
+	}
+	return f.left.match(resource) || f.right.match(resource)
+}
+
+// notFilter negates a filter
+type notFilter struct {
+	inner filter
+}
+
+func (f *notFilter) match(resource map[string]interface{}) bool {
+	return !f.inner.match(resource)
+}
+
+// compareFilter compares an attribute with a value, or tests its presence
+type compareFilter struct {
+	path     attrPath
+	operator string // eq, ne, co, sw, ew, gt, lt, ge, le or pr
+	value    interface{}
+}
+
+func (f *compareFilter) match(resource map[string]interface{}) bool {
+	values := resolveValues(resource, f.path)
+	if f.operator == "pr" {
+		for _, value := range values {
+			if value != nil && value != "" {
+				return true
+			}
+		}
+		return false
+	}
+	if f.operator == "ne" {
+		for _, value := range values {
+			if compareValues(value, "eq", f.value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, value := range values {
+		if compareValues(value, f.operator, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// valuePathFilter matches resources having an element of a multi-valued
+// attribute that matches the inner filter, as in emails[type eq "work"]
+type valuePathFilter struct {
+	attribute string
+	inner     filter
+}
+
+func (f *valuePathFilter) match(resource map[string]interface{}) bool {
+	for _, element := range elements(lookup(resource, f.attribute)) {
+		if f.inner.match(element) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the attribute of a resource; names are case-insensitive
+func lookup(resource map[string]interface{}, name string) interface{} {
+	if value, ok := resource[name]; ok {
+		return value
+	}
+	for key, value := range resource {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return nil
+}
+
+// elements returns the complex values of a multi-valued attribute
+func elements(value interface{}) []map[string]interface{} {
+	var result []map[string]interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if element, ok := item.(map[string]interface{}); ok {
+				result = append(result, element)
+			}
+		}
+	case []map[string]interface{}:
+		result = v
+	case map[string]interface{}:
+		result = append(result, v)
+	}
+	return result
+}
+
+// resolveValues returns the values an attribute path refers to. A path into
+// a multi-valued attribute yields the sub-attribute of every element, and a
+// multi-valued attribute without sub-attribute compares its "value"s.
+func resolveValues(resource map[string]interface{}, path attrPath) []interface{} {
+	value := lookup(resource, path.attribute)
+	if value == nil {
+		return nil
+	}
+
+	subAttribute := path.subAttribute
+	if list, ok := value.([]interface{}); ok && subAttribute == "" {
+		if len(elements(list)) == 0 {
+			return list
+		}
+		subAttribute = "value"
+	}
+	if subAttribute == "" {
+		return []interface{}{value}
+	}
+
+	var values []interface{}
+	for _, element := range elements(value) {
+		if v := lookup(element, subAttribute); v != nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// compareValues applies a comparison operator. Strings compare
+// case-insensitively; timestamps compare correctly as ISO 8601 strings.
+func compareValues(actual interface{}, operator string, expected interface{}) bool {
+	switch e := expected.(type) {
+	case string:
+		a, ok := actual.(string)
+		if !ok {
+			return false
+		}
+		a, e = strings.ToLower(a), strings.ToLower(e)
+		switch operator {
+		case "eq":
+			return a == e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "lt":
+			return a < e
+		case "ge":
+			return a >= e
+		case "le":
+			return a <= e
+		}
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		switch operator {
+		case "eq":
+			return a == e
+		case "gt":
+			return a > e
+		case "lt":
+			return a < e
+		case "ge":
+			return a >= e
+		case "le":
+			return a <= e
+		}
+	case bool:
+		a, ok := actual.(bool)
+		return ok && operator == "eq" && a == e
+	case nil:
+		return operator == "eq" && actual == nil
+	}
+	return false
+}
+
+// parseFilter parses a filter expression
+func parseFilter(expression string) (filter, error) {
+	tokens, err := tokenizeFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.offset != len(p.tokens) {
+		return nil, invalidFilter("unexpected " + p.tokens[p.offset].text)
+	}
+	return f, nil
+}
+
+// filterToken is a token of a filter expression
+type filterToken struct {
+	text   string
+	quoted bool // JSON string literal
+}
+
+// tokenizeFilter splits a filter expression into words, string literals and
+// the characters ( ) [ ]
+func tokenizeFilter(expression string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, filterToken{text: string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(expression) && expression[end] != '"'; end++ {
+				if expression[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expression) {
+				return nil, invalidFilter("unterminated string")
+			}
+			var s string
+			if err := json.Unmarshal([]byte(expression[i:end+1]), &s); err != nil {
+				return nil, invalidFilter("invalid string")
+			}
+			tokens = append(tokens, filterToken{text: s, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(expression) && !strings.ContainsRune(" \t()[]\"", rune(expression[end])) {
+				end++
+			}
+			tokens = append(tokens, filterToken{text: expression[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser parses tokens into a filter. and binds tighter than or.
+type filterParser struct {
+	tokens []filterToken
+	offset int
+}
+
+// maxFilterDepth bounds nesting so hostile filters cannot exhaust the stack
+const maxFilterDepth = 32
+
+// peekKeyword reports whether the next token is the unquoted keyword
+func (p *filterParser) peekKeyword(keyword string) bool {
+	return p.offset < len(p.tokens) && !p.tokens[p.offset].quoted && strings.EqualFold(p.tokens[p.offset].text, keyword)
+}
+
+// next returns the next token
+func (p *filterParser) next() (filterToken, bool) {
+	if p.offset >= len(p.tokens) {
+		return filterToken{}, false
+	}
+	p.offset++
+	return p.tokens[p.offset-1], true
+}
+
+// expect consumes the unquoted token
+func (p *filterParser) expect(text string) error {
+	token, ok := p.next()
+	if !ok || token.quoted || token.text != text {
+		return invalidFilter("expected " + text)
+	}
+	return nil
+}
+
+func (p *filterParser) or(depth int) (filter, error) {
+	left, err := p.and(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.offset++
+		right, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalFilter{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) and(depth int) (filter, error) {
+	left, err := p.unary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.offset++
+		right, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalFilter{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) unary(depth int) (filter, error) {
+	if depth > maxFilterDepth {
+		return nil, invalidFilter("filter nested too deeply")
+	}
+
+	if p.peekKeyword("not") {
+		p.offset++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &notFilter{inner: inner}, nil
+	}
+
+	if p.peekKeyword("(") {
+		p.offset++
+		inner, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	token, ok := p.next()
+	if !ok || token.quoted {
+		return nil, invalidFilter("expected an attribute")
+	}
+
+	if p.peekKeyword("[") {
+		p.offset++
+		path, err := parseAttrPath(token.text)
+		if err != nil || path.subAttribute != "" {
+			return nil, invalidFilter("invalid attribute " + token.text)
+		}
+		inner, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return &valuePathFilter{attribute: path.attribute, inner: inner}, nil
+	}
+
+	path, err := parseAttrPath(token.text)
+	if err != nil {
+		return nil, err
+	}
+
+	operatorToken, ok := p.next()
+	if !ok || operatorToken.quoted {
+		return nil, invalidFilter("expected an operator")
+	}
+	operator := strings.ToLower(operatorToken.text)
+	switch operator {
+	case "pr":
+		return &compareFilter{path: path, operator: operator}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "lt", "ge", "le":
+	default:
+		return nil, invalidFilter("unknown operator " + operatorToken.text)
+	}
+
+	valueToken, ok := p.next()
+	if !ok {
+		return nil, invalidFilter("expected a value")
+	}
+	var value interface{}
+	if valueToken.quoted {
+		value = valueToken.text
+	} else if err := json.Unmarshal([]byte(strings.ToLower(valueToken.text)), &value); err != nil {
+		return nil, invalidFilter("invalid value " + valueToken.text)
+	}
+	if _, ok := value.(string); !ok && (operator == "co" || operator == "sw" || operator == "ew") {
+		return nil, invalidFilter(operator + " requires a string")
+	}
+	return &compareFilter{path: path, operator: operator, value: value}, nil
+}
+
+// parseAttrPath parses [URN ":"] attribute ["." subAttribute]. The schema
+// URN of the core resources is accepted and dropped.
+func parseAttrPath(text string) (attrPath, error) {
+	if index := strings.LastIndex(text, ":"); index >= 0 {
+		if !strings.HasPrefix(strings.ToLower(text), "urn:ietf:params:scim:schemas:core:2.0:") {
+			return attrPath{}, invalidFilter("unsupported schema in " + text)
+		}
+		text = text[index+1:]
+	}
+
+	attribute, subAttribute, _ := strings.Cut(text, ".")
+	if !validAttributeName(attribute) || subAttribute != "" && !validAttributeName(subAttribute) {
+		return attrPath{}, invalidFilter("invalid attribute " + text)
+	}
+	return attrPath{attribute: attribute, subAttribute: subAttribute}, nil
+}
+
+// validAttributeName reports whether s is an ATTRNAME (RFC 7643 section 2.1)
+func validAttributeName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		alpha := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if !alpha && (i == 0 && c != '$' || !(c >= '0' && c <= '9' || c == '_' || c == '-' || c == '$')) {
+			return false
+		}
+	}
+	return true
+}
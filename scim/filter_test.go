@@ -0,0 +1,83 @@
+package scim
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testResource is a User resource as the handler presents it
+func testResource() map[string]interface{} {
+	return map[string]interface{}{
+		"userName":    "bjensen",
+		"displayName": "Barbara Jensen",
+		"active":      true,
+		"name":        map[string]interface{}{"givenName": "Barbara", "familyName": "Jensen"},
+		"emails": []interface{}{
+			map[string]interface{}{"value": "bjensen@example.com", "type": "work", "primary": true},
+			map[string]interface{}{"value": "babs@jensen.org", "type": "home"},
+		},
+		"meta": map[string]interface{}{"created": "2024-03-01T10:00:00Z"},
+	}
+}
+
+// TestParseFilter tests evaluating filter expressions against a resource
+func TestParseFilter(t *testing.T) {
+	resource := testResource()
+
+	tests := []struct {
+		expression string
+		match      bool
+	}{
+		{`userName eq "bjensen"`, true},
+		{`UserName EQ "BJensen"`, true},
+		{`userName eq "jsmith"`, false},
+		{`userName ne "jsmith"`, true},
+		{`userName co "jens"`, true},
+		{`userName sw "bj"`, true},
+		{`userName ew "sen"`, true},
+		{`name.familyName eq "Jensen"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "bjensen"`, true},
+		{`emails eq "babs@jensen.org"`, true},
+		{`emails.type eq "home"`, true},
+		{`emails[type eq "work" and value co "@example.com"]`, true},
+		{`emails[type eq "home" and value co "@example.com"]`, false},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`meta.created gt "2024-01-01T00:00:00Z"`, true},
+		{`meta.created lt "2024-01-01T00:00:00Z"`, false},
+		{`externalId pr`, false},
+		{`title pr or userName pr`, true},
+		{`not (userName eq "bjensen")`, false},
+		{`userName eq "x" or (active eq true and name.givenName sw "B")`, true},
+		{`userName eq "bjensen" and not (emails.type eq "home")`, false},
+	}
+	for _, test := range tests {
+		f, err := parseFilter(test.expression)
+		require.NoError(t, err, test.expression)
+		assert.Equal(t, test.match, f.match(resource), test.expression)
+	}
+}
+
+// TestParseFilterErrors tests that malformed filters are rejected
+func TestParseFilterErrors(t *testing.T) {
+	for _, expression := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName like "b"`,
+		`userName eq "unterminated`,
+		`(userName eq "b"`,
+		`userName eq "b")`,
+		`userName eq "b" and`,
+		`active co true`,
+		`emails[type eq "work"`,
+		`urn:example:custom:userName eq "b"`,
+	} {
+		_, err := parseFilter(expression)
+		var scimErr *Error
+		require.ErrorAs(t, err, &scimErr, expression)
+		assert.Equal(t, "invalidFilter", scimErr.ScimType, expression)
+	}
+}
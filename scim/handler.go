@@ -0,0 +1,679 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weedbox/userion"
+)
+
+// ContentType is the media type of SCIM requests and responses
+const ContentType = "application/scim+json"
+
+// maxBodySize limits the size of request bodies
+const maxBodySize = 1 << 20
+
+// scanBatchSize is the number of users or groups read at a time when a
+// filter cannot be answered with an indexed lookup
+const scanBatchSize = 500
+
+// Server is a SCIM 2.0 service provider serving the /Users and /Groups
+// endpoints along with the discovery endpoints /ServiceProviderConfig,
+// /Schemas and /ResourceTypes
+type Server struct {
+	userManager  userion.UserManager
+	groupManager userion.GroupManager
+	config       Config
+	mux          *http.ServeMux
+	now          func() time.Time
+}
+
+// NewServer returns a SCIM service provider. Without a group manager the
+// /Groups endpoints are not served. Mount the server at Config.BaseURL,
+// e.g. with http.StripPrefix("/scim/v2", server).
+func NewServer(userManager userion.UserManager, groupManager userion.GroupManager, config Config) *Server {
+	s := &Server{
+		userManager:  userManager,
+		groupManager: groupManager,
+		config:       config,
+		mux:          http.NewServeMux(),
+		now:          time.Now,
+	}
+	s.config.BaseURL = strings.TrimSuffix(s.config.BaseURL, "/")
+
+	s.mux.HandleFunc("GET /ServiceProviderConfig", s.handleServiceProviderConfig)
+	s.mux.HandleFunc("GET /Schemas", s.handleSchemas)
+	s.mux.HandleFunc("GET /Schemas/{id}", s.handleSchema)
+	s.mux.HandleFunc("GET /ResourceTypes", s.handleResourceTypes)
+	s.mux.HandleFunc("GET /ResourceTypes/{name}", s.handleResourceType)
+
+	s.mux.HandleFunc("GET /Users", s.handleListUsers)
+	s.mux.HandleFunc("POST /Users", s.handleCreateUser)
+	s.mux.HandleFunc("GET /Users/{id}", s.handleGetUser)
+	s.mux.HandleFunc("PUT /Users/{id}", s.handleReplaceUser)
+	s.mux.HandleFunc("PATCH /Users/{id}", s.handlePatchUser)
+	s.mux.HandleFunc("DELETE /Users/{id}", s.handleDeleteUser)
+
+	if groupManager != nil {
+		s.mux.HandleFunc("GET /Groups", s.handleListGroups)
+		s.mux.HandleFunc("POST /Groups", s.handleCreateGroup)
+		s.mux.HandleFunc("GET /Groups/{id}", s.handleGetGroup)
+		s.mux.HandleFunc("PUT /Groups/{id}", s.handleReplaceGroup)
+		s.mux.HandleFunc("PATCH /Groups/{id}", s.handlePatchGroup)
+		s.mux.HandleFunc("DELETE /Groups/{id}", s.handleDeleteGroup)
+	}
+
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, notFound("unknown endpoint"))
+	})
+	return s
+}
+
+// ServeHTTP authenticates the identity provider and serves the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.config.Authenticate == nil || s.config.Authenticate(r) != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+		writeError(w, &Error{Status: http.StatusUnauthorized, Detail: "authentication required"})
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// location returns the URL of a resource
+func (s *Server) location(endpoint, id string) string {
+	return s.config.BaseURL + "/" + endpoint + "/" + id
+}
+
+// handleListUsers serves GET /Users
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if counter, ok := s.userManager.(userion.UserCounter); ok && query.filter == nil {
+		s.listUserPage(w, query, counter)
+		return
+	}
+
+	users, err := s.candidateUsers(query.filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var resources []map[string]interface{}
+	for i := range users {
+		resource, err := s.userResource(&users[i])
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if query.filter == nil || query.filter.match(resource) {
+			resources = append(resources, resource)
+		}
+	}
+	writeList(w, query, resources)
+}
+
+// listUserPage serves an unfiltered GET /Users by reading only the requested
+// page of users
+func (s *Server) listUserPage(w http.ResponseWriter, query *listQuery, counter userion.UserCounter) {
+	total, err := counter.CountUsers(nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var users []userion.User
+	if query.count > 0 && int64(query.startIndex) <= total {
+		users, err = s.userManager.ListUsers(query.count, query.startIndex-1, nil, "created_at", false)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	resources := make([]map[string]interface{}, 0, len(users))
+	for i := range users {
+		resource, err := s.userResource(&users[i])
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		resources = append(resources, resource)
+	}
+	writePage(w, query, resources, int(total))
+}
+
+// candidateUsers returns the users a filter could match. Equality on userName
+// or an email is first answered with an indexed, case-sensitive lookup;
+// filters match case-insensitively, so other filters and lookups finding
+// nothing scan all users.
+func (s *Server) candidateUsers(f filter) ([]userion.User, error) {
+	if compare, ok := f.(*compareFilter); ok && compare.operator == "eq" {
+		value, _ := compare.value.(string)
+		path := compare.path
+		var user *userion.User
+		var err error
+		switch {
+		case strings.EqualFold(path.attribute, "userName") && path.subAttribute == "":
+			user, err = s.userManager.GetUserByUsername(value)
+		case strings.EqualFold(path.attribute, "emails") && (path.subAttribute == "" || strings.EqualFold(path.subAttribute, "value")):
+			user, err = s.userManager.GetUserByEmail(value)
+		default:
+			return s.scanUsers()
+		}
+		if value == "" {
+			return nil, nil
+		}
+		if errors.Is(err, userion.ErrUserNotFound) {
+			return s.scanUsers()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []userion.User{*user}, nil
+	}
+	return s.scanUsers()
+}
+
+// scanUsers returns all users in creation order
+func (s *Server) scanUsers() ([]userion.User, error) {
+	var users []userion.User
+	for offset := 0; ; offset += scanBatchSize {
+		batch, err := s.userManager.ListUsers(scanBatchSize, offset, nil, "created_at", false)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, batch...)
+		if len(batch) < scanBatchSize {
+			return users, nil
+		}
+	}
+}
+
+// handleCreateUser serves POST /Users
+func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	resource, err := readResource(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	user, err := s.createUser(resource)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeUser(w, r, http.StatusCreated, user)
+}
+
+// handleGetUser serves GET /Users/{id}
+func (s *Server) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getUser(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeUser(w, r, http.StatusOK, user)
+}
+
+// handleReplaceUser serves PUT /Users/{id}. Attributes missing from the
+// request are cleared.
+func (s *Server) handleReplaceUser(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getUser(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resource, err := readResource(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	previous, err := s.userResource(user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if user, err = s.updateUser(user, previous, resource); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeUser(w, r, http.StatusOK, user)
+}
+
+// handlePatchUser serves PATCH /Users/{id}
+func (s *Server) handlePatchUser(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getUser(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	operations, err := readPatch(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	previous, err := s.userResource(user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resource, err := copyResource(previous)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := applyPatch(resource, operations); err != nil {
+		writeError(w, err)
+		return
+	}
+	if user, err = s.updateUser(user, previous, resource); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeUser(w, r, http.StatusOK, user)
+}
+
+// handleDeleteUser serves DELETE /Users/{id}
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getUser(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := s.userManager.DeleteUserByID(user.ID.String()); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getUser returns the user named by the request path
+func (s *Server) getUser(r *http.Request) (*userion.User, error) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return nil, notFound("user not found")
+	}
+	return s.userManager.GetUserByID(id.String())
+}
+
+// writeUser writes a user as a User resource
+func (s *Server) writeUser(w http.ResponseWriter, r *http.Request, status int, user *userion.User) {
+	resource, err := s.userResource(user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResource(w, r, status, resource)
+}
+
+// handleListGroups serves GET /Groups
+func (s *Server) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	groups, err := s.candidateGroups(query.filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var resources []map[string]interface{}
+	for i := range groups {
+		resource, err := s.groupResource(&groups[i])
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if query.filter == nil || query.filter.match(resource) {
+			resources = append(resources, resource)
+		}
+	}
+	writeList(w, query, resources)
+}
+
+// candidateGroups returns the groups a filter could match. Equality on
+// displayName is first answered with an indexed, case-sensitive lookup;
+// other filters and lookups finding nothing scan all groups.
+func (s *Server) candidateGroups(f filter) ([]userion.Group, error) {
+	if compare, ok := f.(*compareFilter); ok && compare.operator == "eq" &&
+		strings.EqualFold(compare.path.attribute, "displayName") && compare.path.subAttribute == "" {
+		value, _ := compare.value.(string)
+		group, err := s.groupManager.GetGroupByName(value)
+		if err == nil {
+			return []userion.Group{*group}, nil
+		}
+		if !errors.Is(err, userion.ErrGroupNotFound) {
+			return nil, err
+		}
+	}
+
+	var groups []userion.Group
+	for offset := 0; ; offset += scanBatchSize {
+		batch, err := s.groupManager.ListGroups(scanBatchSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, batch...)
+		if len(batch) < scanBatchSize {
+			return groups, nil
+		}
+	}
+}
+
+// handleCreateGroup serves POST /Groups
+func (s *Server) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	resource, err := readResource(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	group, err := s.createGroup(resource)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeGroup(w, r, http.StatusCreated, group)
+}
+
+// handleGetGroup serves GET /Groups/{id}
+func (s *Server) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := s.getGroup(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeGroup(w, r, http.StatusOK, group)
+}
+
+// handleReplaceGroup serves PUT /Groups/{id}
+func (s *Server) handleReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := s.getGroup(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resource, err := readResource(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if group, err = s.updateGroup(group, resource); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeGroup(w, r, http.StatusOK, group)
+}
+
+// handlePatchGroup serves PATCH /Groups/{id}
+func (s *Server) handlePatchGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := s.getGroup(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	operations, err := readPatch(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	previous, err := s.groupResource(group)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resource, err := copyResource(previous)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := applyPatch(resource, operations); err != nil {
+		writeError(w, err)
+		return
+	}
+	if group, err = s.updateGroup(group, resource); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeGroup(w, r, http.StatusOK, group)
+}
+
+// handleDeleteGroup serves DELETE /Groups/{id}
+func (s *Server) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := s.getGroup(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := s.groupManager.DeleteGroupByID(group.ID.String()); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getGroup returns the group named by the request path
+func (s *Server) getGroup(r *http.Request) (*userion.Group, error) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return nil, notFound("group not found")
+	}
+	return s.groupManager.GetGroupByID(id.String())
+}
+
+// writeGroup writes a group as a Group resource
+func (s *Server) writeGroup(w http.ResponseWriter, r *http.Request, status int, group *userion.Group) {
+	resource, err := s.groupResource(group)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResource(w, r, status, resource)
+}
+
+// listQuery holds the query parameters of a list request
+type listQuery struct {
+	filter     filter
+	startIndex int
+	count      int
+	attributes []attrPath
+	excluded   []attrPath
+}
+
+// parseListQuery reads the filter, pagination (RFC 7644 section 3.4.2.4)
+// and attribute parameters of a list request
+func parseListQuery(r *http.Request) (*listQuery, error) {
+	values := r.URL.Query()
+	query := &listQuery{startIndex: 1, count: DefaultPageSize}
+
+	if expression := values.Get("filter"); expression != "" {
+		f, err := parseFilter(expression)
+		if err != nil {
+			return nil, err
+		}
+		query.filter = f
+	}
+
+	// Out of range values are clamped rather than rejected
+	if value := values.Get("startIndex"); value != "" {
+		startIndex, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, invalidValue("startIndex must be an integer")
+		}
+		query.startIndex = max(startIndex, 1)
+	}
+	if value := values.Get("count"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, invalidValue("count must be an integer")
+		}
+		query.count = min(max(count, 0), MaxPageSize)
+	}
+
+	var err error
+	if query.attributes, err = parseAttributeList(values.Get("attributes")); err != nil {
+		return nil, err
+	}
+	if query.excluded, err = parseAttributeList(values.Get("excludedAttributes")); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// parseAttributeList parses a comma separated list of attribute paths
+func parseAttributeList(list string) ([]attrPath, error) {
+	var paths []attrPath
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		path, err := parseAttrPath(name)
+		if err != nil {
+			return nil, invalidValue("invalid attribute " + name)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// project returns the resource limited to the requested attributes, or
+// without the excluded ones. id and schemas are always returned.
+func project(resource map[string]interface{}, attributes, excluded []attrPath) map[string]interface{} {
+	if len(attributes) > 0 {
+		result := map[string]interface{}{"schemas": resource["schemas"], "id": resource["id"]}
+		for _, path := range attributes {
+			value := lookup(resource, path.attribute)
+			if value == nil {
+				continue
+			}
+			if path.subAttribute == "" {
+				result[path.attribute] = value
+				continue
+			}
+			complex, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if sub := lookup(complex, path.subAttribute); sub != nil {
+				projected, _ := result[path.attribute].(map[string]interface{})
+				if projected == nil {
+					projected = map[string]interface{}{}
+					result[path.attribute] = projected
+				}
+				projected[path.subAttribute] = sub
+			}
+		}
+		resource = result
+	}
+
+	for _, path := range excluded {
+		if strings.EqualFold(path.attribute, "id") || strings.EqualFold(path.attribute, "schemas") {
+			continue
+		}
+		if path.subAttribute == "" {
+			deleteAttribute(resource, path.attribute)
+		} else if complex, ok := lookup(resource, path.attribute).(map[string]interface{}); ok {
+			deleteAttribute(complex, path.subAttribute)
+		}
+	}
+	return resource
+}
+
+// readResource decodes a resource from a request body
+func readResource(r *http.Request) (map[string]interface{}, error) {
+	var resource map[string]interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize)).Decode(&resource); err != nil || resource == nil {
+		return nil, &Error{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: "malformed JSON"}
+	}
+	return resource, nil
+}
+
+// readPatch decodes the operations of a PATCH request body
+func readPatch(r *http.Request) ([]patchOperation, error) {
+	var request patchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize)).Decode(&request); err != nil {
+		return nil, &Error{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: "malformed JSON"}
+	}
+	return request.Operations, nil
+}
+
+// copyResource returns a deep copy of a resource with the types JSON
+// decoding produces, so patches see the same values as request bodies
+func copyResource(resource map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	var copied map[string]interface{}
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// writeList writes the requested page of all matching resources as a list
+// response
+func writeList(w http.ResponseWriter, query *listQuery, resources []map[string]interface{}) {
+	var page []map[string]interface{}
+	if start := query.startIndex - 1; start < len(resources) {
+		page = resources[start:min(start+query.count, len(resources))]
+	}
+	writePage(w, query, page, len(resources))
+}
+
+// writePage writes a page of resources out of total matching ones as a list
+// response
+func writePage(w http.ResponseWriter, query *listQuery, resources []map[string]interface{}, total int) {
+	page := []interface{}{}
+	for _, resource := range resources {
+		page = append(page, project(resource, query.attributes, query.excluded))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"schemas":      []string{SchemaListResponse},
+		"totalResults": total,
+		"startIndex":   query.startIndex,
+		"itemsPerPage": len(page),
+		"Resources":    page,
+	})
+}
+
+// writeResource writes a resource, honouring the attributes and
+// excludedAttributes parameters, with its location
+func writeResource(w http.ResponseWriter, r *http.Request, status int, resource map[string]interface{}) {
+	attributes, err := parseAttributeList(r.URL.Query().Get("attributes"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	excluded, err := parseAttributeList(r.URL.Query().Get("excludedAttributes"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if meta, ok := resource["meta"].(map[string]interface{}); ok {
+		if location, ok := meta["location"].(string); ok {
+			w.Header().Set("Location", location)
+		}
+	}
+	writeJSON(w, status, project(resource, attributes, excluded))
+}
+
+// writeError writes an error in the SCIM error schema
+func writeError(w http.ResponseWriter, err error) {
+	scimErr := toError(err)
+	writeJSON(w, scimErr.Status, scimErr.body())
+}
+
+// writeJSON writes a SCIM JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,464 @@
+package scim
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weedbox/userion"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testToken = "scim-test-token"
+
+// setupServer serves a SCIM service provider over HTTP at /scim/v2
+func setupServer(t *testing.T) (*Server, userion.UserManager, userion.GroupManager, *httptest.Server) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to database")
+	t.Cleanup(func() {
+		sqlDB, err := db.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	suffix := uuid.New().String()[:8]
+	userManager := userion.NewGormUserManager(db, "users_test_"+suffix)
+	require.NoError(t, userManager.AutoMigrate(), "Failed to migrate database")
+	groupManager := userion.NewGormGroupManager(db, "groups_test_"+suffix)
+	require.NoError(t, groupManager.AutoMigrate(), "Failed to migrate database")
+
+	mux := http.NewServeMux()
+	httpServer := httptest.NewServer(mux)
+	t.Cleanup(httpServer.Close)
+
+	server := NewServer(userManager, groupManager, Config{
+		BaseURL: httpServer.URL + "/scim/v2",
+		Authenticate: func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "Bearer "+testToken {
+				return errors.New("invalid token")
+			}
+			return nil
+		},
+	})
+	mux.Handle("/scim/v2/", http.StripPrefix("/scim/v2", server))
+
+	return server, userManager, groupManager, httpServer
+}
+
+// do sends an authenticated SCIM request and decodes the response body
+func do(t *testing.T, httpServer *httptest.Server, method, path string, body interface{}) (int, map[string]interface{}) {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, httpServer.URL+"/scim/v2"+path, reader)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", ContentType)
+
+	resp, err := httpServer.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	if resp.StatusCode != http.StatusNoContent {
+		assert.Equal(t, ContentType, resp.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	}
+	return resp.StatusCode, result
+}
+
+// createTestUser provisions bjensen and returns her resource
+func createTestUser(t *testing.T, httpServer *httptest.Server) map[string]interface{} {
+	status, resource := do(t, httpServer, http.MethodPost, "/Users", map[string]interface{}{
+		"schemas":    []string{SchemaUser},
+		"userName":   "bjensen",
+		"externalId": "00u1",
+		"name":       map[string]interface{}{"givenName": "Barbara", "familyName": "Jensen"},
+		"emails":     []interface{}{map[string]interface{}{"value": "bjensen@example.com", "type": "work", "primary": true}},
+		"active":     true,
+	})
+	require.Equal(t, http.StatusCreated, status, resource)
+	return resource
+}
+
+// TestServerAuthentication tests that requests without valid credentials are rejected
+func TestServerAuthentication(t *testing.T) {
+	_, _, _, httpServer := setupServer(t)
+
+	resp, err := http.Get(httpServer.URL + "/scim/v2/Users")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	server := NewServer(nil, nil, Config{})
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/Users", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code, "Requests should be rejected without an authenticator")
+}
+
+// TestServerCreateUser tests provisioning a user
+func TestServerCreateUser(t *testing.T) {
+	_, userManager, _, httpServer := setupServer(t)
+	resource := createTestUser(t, httpServer)
+
+	assert.Equal(t, "bjensen", resource["userName"])
+	assert.Equal(t, "00u1", resource["externalId"])
+	assert.Equal(t, "Barbara Jensen", resource["displayName"])
+	assert.Equal(t, true, resource["active"])
+	assert.Equal(t, httpServer.URL+"/scim/v2/Users/"+resource["id"].(string), resource["meta"].(map[string]interface{})["location"])
+	assert.Empty(t, resource["groups"])
+
+	user, err := userManager.GetUserByUsername("bjensen")
+	require.NoError(t, err)
+	assert.Equal(t, "bjensen@example.com", user.Email)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.True(t, user.Enabled)
+	assert.Equal(t, userion.UserStatusActive, user.Status)
+	assert.False(t, userion.HasUsablePassword(user), "Users without a password should only sign in through single sign-on")
+
+	status, body := do(t, httpServer, http.MethodPost, "/Users", map[string]interface{}{
+		"userName": "bjensen",
+		"emails":   []interface{}{map[string]interface{}{"value": "other@example.com"}},
+	})
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, "uniqueness", body["scimType"])
+
+	status, body = do(t, httpServer, http.MethodPost, "/Users", map[string]interface{}{"userName": "jsmith"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalidValue", body["scimType"])
+
+	status, resource = do(t, httpServer, http.MethodPost, "/Users", map[string]interface{}{
+		"userName": "jsmith",
+		"password": "correct horse battery",
+		"emails":   []interface{}{map[string]interface{}{"value": "jsmith@example.com"}},
+		"active":   "False",
+	})
+	require.Equal(t, http.StatusCreated, status, resource)
+	assert.Equal(t, false, resource["active"])
+	assert.NotContains(t, resource, "password")
+	require.NoError(t, userManager.VerifyPasswordByUsername("jsmith", "correct horse battery"))
+
+	status, body = do(t, httpServer, http.MethodPost, "/Users", map[string]interface{}{
+		"userName": "hashed",
+		"password": strings.Repeat("a", 64),
+		"emails":   []interface{}{map[string]interface{}{"value": "hashed@example.com"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, status, "Passwords the manager would take for hashes should be rejected")
+	assert.Equal(t, "invalidValue", body["scimType"])
+}
+
+// TestServerUpdateUser tests replacing and patching users
+func TestServerUpdateUser(t *testing.T) {
+	_, userManager, _, httpServer := setupServer(t)
+	id := createTestUser(t, httpServer)["id"].(string)
+
+	status, resource := do(t, httpServer, http.MethodPatch, "/Users/"+id, map[string]interface{}{
+		"schemas": []string{SchemaPatchOp},
+		"Operations": []interface{}{
+			map[string]interface{}{"op": "replace", "path": "displayName", "value": "Babs Jensen"},
+			map[string]interface{}{"op": "replace", "path": `emails[type eq "work"].value`, "value": "babs@example.com"},
+			map[string]interface{}{"op": "add", "path": "phoneNumbers", "value": []interface{}{map[string]interface{}{"value": "555-0100"}}},
+			map[string]interface{}{"op": "Replace", "value": map[string]interface{}{"active": "False"}},
+		},
+	})
+	require.Equal(t, http.StatusOK, status, resource)
+
+	user, err := userManager.GetUserByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, "Babs Jensen", user.Name)
+	assert.Equal(t, "babs@example.com", user.Email)
+	assert.Equal(t, "555-0100", user.Phone)
+	assert.False(t, user.Enabled, "active should map to Enabled")
+	assert.Equal(t, "00u1", resource["externalId"], "Attributes not patched should be kept")
+
+	status, resource = do(t, httpServer, http.MethodPut, "/Users/"+id, map[string]interface{}{
+		"schemas":  []string{SchemaUser},
+		"userName": "barbara",
+		"name":     map[string]interface{}{"formatted": "Barbara J."},
+		"emails":   []interface{}{map[string]interface{}{"value": "babs@example.com"}},
+		"active":   true,
+	})
+	require.Equal(t, http.StatusOK, status, resource)
+	assert.Equal(t, "barbara", resource["userName"])
+	assert.Equal(t, "Barbara J.", resource["displayName"])
+	assert.NotContains(t, resource, "externalId", "Attributes missing from a replacement should be cleared")
+	assert.NotContains(t, resource, "phoneNumbers")
+
+	user, err = userManager.GetUserByID(id)
+	require.NoError(t, err)
+	assert.True(t, user.Enabled)
+	assert.Empty(t, user.Phone)
+
+	require.NoError(t, userManager.CreateUser(&userion.User{Username: "jsmith", Email: "jsmith@example.com", Password: "password123"}))
+	status, body := do(t, httpServer, http.MethodPatch, "/Users/"+id, map[string]interface{}{
+		"Operations": []interface{}{map[string]interface{}{"op": "replace", "path": "userName", "value": "jsmith"}},
+	})
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, "uniqueness", body["scimType"])
+
+	status, body = do(t, httpServer, http.MethodPatch, "/Users/"+id, map[string]interface{}{
+		"Operations": []interface{}{map[string]interface{}{"op": "replace", "path": "password", "value": strings.Repeat("a", 64)}},
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalidValue", body["scimType"])
+
+	status, _ = do(t, httpServer, http.MethodPatch, "/Users/"+uuid.New().String(), map[string]interface{}{
+		"Operations": []interface{}{map[string]interface{}{"op": "replace", "path": "userName", "value": "x"}},
+	})
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+// TestServerListUsers tests filtering and paginating users
+func TestServerListUsers(t *testing.T) {
+	_, userManager, _, httpServer := setupServer(t)
+	for i := 0; i < 5; i++ {
+		user := &userion.User{
+			Username: fmt.Sprintf("user%d", i),
+			Email:    fmt.Sprintf("user%d@example.com", i),
+			Password: "password123",
+		}
+		require.NoError(t, userManager.CreateUser(user))
+		if i%2 == 1 {
+			require.NoError(t, userManager.DisableUserByID(user.ID.String()))
+		}
+	}
+
+	list := func(query url.Values) map[string]interface{} {
+		status, body := do(t, httpServer, http.MethodGet, "/Users?"+query.Encode(), nil)
+		require.Equal(t, http.StatusOK, status, body)
+		return body
+	}
+	userNames := func(body map[string]interface{}) []string {
+		var names []string
+		for _, resource := range body["Resources"].([]interface{}) {
+			names = append(names, resource.(map[string]interface{})["userName"].(string))
+		}
+		return names
+	}
+
+	body := list(url.Values{"filter": {`userName eq "user3"`}})
+	assert.Equal(t, float64(1), body["totalResults"])
+	assert.Equal(t, []string{"user3"}, userNames(body))
+
+	body = list(url.Values{"filter": {`emails.value eq "user4@example.com"`}})
+	assert.Equal(t, []string{"user4"}, userNames(body))
+
+	body = list(url.Values{"filter": {`userName eq "USER3"`}})
+	assert.Equal(t, []string{"user3"}, userNames(body), "userName should match case-insensitively")
+
+	body = list(url.Values{"filter": {`emails.value eq "User4@Example.com"`}})
+	assert.Equal(t, []string{"user4"}, userNames(body), "Emails should match case-insensitively")
+
+	body = list(url.Values{"filter": {`userName eq "nobody"`}})
+	assert.Equal(t, float64(0), body["totalResults"])
+	assert.Empty(t, body["Resources"])
+
+	body = list(url.Values{"filter": {`active eq true and userName sw "user"`}})
+	assert.Equal(t, []string{"user0", "user2", "user4"}, userNames(body))
+
+	body = list(url.Values{"startIndex": {"2"}, "count": {"2"}})
+	assert.Equal(t, float64(5), body["totalResults"])
+	assert.Equal(t, float64(2), body["startIndex"])
+	assert.Equal(t, float64(2), body["itemsPerPage"])
+	assert.Equal(t, []string{"user1", "user2"}, userNames(body))
+
+	body = list(url.Values{"startIndex": {"5"}, "count": {"10"}})
+	assert.Equal(t, float64(5), body["totalResults"])
+	assert.Equal(t, []string{"user4"}, userNames(body))
+
+	body = list(url.Values{"startIndex": {"9"}})
+	assert.Equal(t, float64(5), body["totalResults"])
+	assert.Empty(t, body["Resources"])
+
+	body = list(url.Values{"filter": {`userName eq "user1"`}, "attributes": {"userName"}})
+	resource := body["Resources"].([]interface{})[0].(map[string]interface{})
+	assert.ElementsMatch(t, []string{"schemas", "id", "userName"}, keys(resource))
+
+	body = list(url.Values{"filter": {`userName eq "user1"`}, "excludedAttributes": {"emails,meta,id"}})
+	resource = body["Resources"].([]interface{})[0].(map[string]interface{})
+	assert.NotContains(t, resource, "emails")
+	assert.NotContains(t, resource, "meta")
+	assert.Contains(t, resource, "id", "id should always be returned")
+
+	status, body := do(t, httpServer, http.MethodGet, "/Users?filter="+url.QueryEscape(`userName eq`), nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalidFilter", body["scimType"])
+}
+
+// pageRecorder records the pages read from a user manager
+type pageRecorder struct {
+	*userion.GormUserManager
+	pages [][2]int
+}
+
+func (r *pageRecorder) ListUsers(limit, offset int, filters map[string]interface{}, orderBy string, desc bool) ([]userion.User, error) {
+	r.pages = append(r.pages, [2]int{limit, offset})
+	return r.GormUserManager.ListUsers(limit, offset, filters, orderBy, desc)
+}
+
+// TestServerListUsersPage tests that unfiltered lists only read the requested page
+func TestServerListUsersPage(t *testing.T) {
+	_, userManager, _, _ := setupServer(t)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, userManager.CreateUser(&userion.User{
+			Username: fmt.Sprintf("user%d", i),
+			Email:    fmt.Sprintf("user%d@example.com", i),
+			Password: "password123",
+		}))
+	}
+
+	recorder := &pageRecorder{GormUserManager: userManager.(*userion.GormUserManager)}
+	server := NewServer(recorder, nil, Config{Authenticate: func(*http.Request) error { return nil }})
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/Users?startIndex=3&count=2", nil))
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+	assert.Equal(t, float64(5), body["totalResults"])
+	assert.Equal(t, float64(2), body["itemsPerPage"])
+	assert.Equal(t, [][2]int{{2, 2}}, recorder.pages)
+}
+
+// keys returns the names of a resource's attributes
+func keys(resource map[string]interface{}) []string {
+	var names []string
+	for name := range resource {
+		names = append(names, name)
+	}
+	return names
+}
+
+// TestServerDeleteUser tests deprovisioning a user
+func TestServerDeleteUser(t *testing.T) {
+	_, userManager, _, httpServer := setupServer(t)
+	id := createTestUser(t, httpServer)["id"].(string)
+
+	status, _ := do(t, httpServer, http.MethodDelete, "/Users/"+id, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	_, err := userManager.GetUserByID(id)
+	assert.ErrorIs(t, err, userion.ErrUserNotFound)
+
+	status, _ = do(t, httpServer, http.MethodGet, "/Users/"+id, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = do(t, httpServer, http.MethodGet, "/Users/not-a-uuid", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+// TestServerGroups tests provisioning groups and their members
+func TestServerGroups(t *testing.T) {
+	_, _, groupManager, httpServer := setupServer(t)
+	userID := createTestUser(t, httpServer)["id"].(string)
+
+	status, admins := do(t, httpServer, http.MethodPost, "/Groups", map[string]interface{}{
+		"schemas":     []string{SchemaGroup},
+		"displayName": "Admins",
+	})
+	require.Equal(t, http.StatusCreated, status, admins)
+	adminsID := admins["id"].(string)
+
+	status, group := do(t, httpServer, http.MethodPost, "/Groups", map[string]interface{}{
+		"schemas":     []string{SchemaGroup},
+		"displayName": "Engineering",
+		"members":     []interface{}{map[string]interface{}{"value": userID}},
+	})
+	require.Equal(t, http.StatusCreated, status, group)
+	groupID := group["id"].(string)
+	require.Len(t, group["members"], 1)
+	assert.Equal(t, "User", group["members"].([]interface{})[0].(map[string]interface{})["type"])
+
+	status, user := do(t, httpServer, http.MethodGet, "/Users/"+userID, nil)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, user["groups"], 1)
+	assert.Equal(t, "Engineering", user["groups"].([]interface{})[0].(map[string]interface{})["display"])
+
+	status, group = do(t, httpServer, http.MethodPatch, "/Groups/"+groupID, map[string]interface{}{
+		"schemas": []string{SchemaPatchOp},
+		"Operations": []interface{}{
+			map[string]interface{}{"op": "replace", "path": "displayName", "value": "Platform"},
+			map[string]interface{}{"op": "add", "path": "members", "value": []interface{}{map[string]interface{}{"value": adminsID}}},
+			map[string]interface{}{"op": "remove", "path": fmt.Sprintf("members[value eq %q]", userID)},
+		},
+	})
+	require.Equal(t, http.StatusOK, status, group)
+	assert.Equal(t, "Platform", group["displayName"])
+
+	memberIDs, err := groupManager.ListMemberIDs(groupID)
+	require.NoError(t, err)
+	assert.Empty(t, memberIDs)
+	subgroups, err := groupManager.ListSubgroups(groupID)
+	require.NoError(t, err)
+	require.Len(t, subgroups, 1)
+	assert.Equal(t, "Admins", subgroups[0].Name, "Groups should be added as subgroups")
+
+	status, body := do(t, httpServer, http.MethodPatch, "/Groups/"+adminsID, map[string]interface{}{
+		"Operations": []interface{}{map[string]interface{}{"op": "add", "path": "members", "value": []interface{}{map[string]interface{}{"value": groupID}}}},
+	})
+	assert.Equal(t, http.StatusBadRequest, status, "Cycles should be rejected")
+	assert.Equal(t, "invalidValue", body["scimType"])
+
+	status, body = do(t, httpServer, http.MethodPut, "/Groups/"+groupID, map[string]interface{}{
+		"displayName": "Platform",
+		"members":     []interface{}{map[string]interface{}{"value": uuid.New().String()}},
+	})
+	assert.Equal(t, http.StatusBadRequest, status, "Unknown members should be rejected")
+	assert.Equal(t, "invalidValue", body["scimType"])
+
+	status, body = do(t, httpServer, http.MethodGet, "/Groups?filter="+url.QueryEscape(`displayName eq "Platform"`)+"&excludedAttributes=members", nil)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, body["Resources"], 1)
+	assert.NotContains(t, body["Resources"].([]interface{})[0], "members")
+
+	status, body = do(t, httpServer, http.MethodGet, "/Groups?filter="+url.QueryEscape(`displayName eq "PLATFORM"`), nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Len(t, body["Resources"], 1, "displayName should match case-insensitively")
+
+	status, _ = do(t, httpServer, http.MethodDelete, "/Groups/"+groupID, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	_, err = groupManager.GetGroupByID(groupID)
+	assert.ErrorIs(t, err, userion.ErrGroupNotFound)
+}
+
+// TestServerDiscovery tests the ServiceProviderConfig, Schemas and ResourceTypes endpoints
+func TestServerDiscovery(t *testing.T) {
+	_, _, _, httpServer := setupServer(t)
+
+	status, config := do(t, httpServer, http.MethodGet, "/ServiceProviderConfig", nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, true, config["patch"].(map[string]interface{})["supported"])
+	assert.Equal(t, true, config["filter"].(map[string]interface{})["supported"])
+	assert.Equal(t, false, config["bulk"].(map[string]interface{})["supported"])
+
+	status, schemas := do(t, httpServer, http.MethodGet, "/Schemas", nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(2), schemas["totalResults"])
+
+	status, schema := do(t, httpServer, http.MethodGet, "/Schemas/"+SchemaUser, nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "User", schema["name"])
+
+	status, resourceType := do(t, httpServer, http.MethodGet, "/ResourceTypes/Group", nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "/Groups", resourceType["endpoint"])
+
+	status, body := do(t, httpServer, http.MethodGet, "/Unknown", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, []interface{}{SchemaError}, body["schemas"])
+}
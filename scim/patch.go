@@ -0,0 +1,294 @@
+package scim
+
+import (
+	"strings"
+)
+
+// patchRequest is a PATCH request body (RFC 7644 section 3.5.2)
+type patchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []patchOperation `json:"Operations"`
+}
+
+// patchOperation is one operation of a PATCH request
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// patchPath is a parsed PATCH path: attribute, an optional filter selecting
+// elements of a multi-valued attribute and an optional sub-attribute, as in
+// emails[type eq "work"].value
+type patchPath struct {
+	attribute    string
+	filter       filter
+	subAttribute string
+}
+
+// parsePatchPath parses a PATCH path (RFC 7644 section 3.5.2)
+func parsePatchPath(text string) (patchPath, error) {
+	head, rest := text, ""
+	if index := strings.IndexByte(text, '['); index >= 0 {
+		head, rest = text[:index], text[index:]
+	}
+
+	attr, err := parseAttrPath(head)
+	if err != nil {
+		return patchPath{}, invalidPath("invalid path " + text)
+	}
+	path := patchPath{attribute: attr.attribute, subAttribute: attr.subAttribute}
+	if rest == "" {
+		return path, nil
+	}
+
+	end := strings.LastIndexByte(rest, ']')
+	if path.subAttribute != "" || end < 0 {
+		return patchPath{}, invalidPath("invalid path " + text)
+	}
+	if path.filter, err = parseFilter(rest[1:end]); err != nil {
+		return patchPath{}, invalidPath("invalid filter in path " + text)
+	}
+	if after := rest[end+1:]; after != "" {
+		if !strings.HasPrefix(after, ".") || !validAttributeName(after[1:]) {
+			return patchPath{}, invalidPath("invalid path " + text)
+		}
+		path.subAttribute = after[1:]
+	}
+	return path, nil
+}
+
+// applyPatch applies the operations of a PATCH request to a resource
+func applyPatch(resource map[string]interface{}, operations []patchOperation) error {
+	if len(operations) == 0 {
+		return invalidValue("no operations")
+	}
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return invalidValue("unknown operation " + operation.Op)
+		}
+		if err := applyOperation(resource, op, operation.Path, operation.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyOperation applies one add, replace or remove operation
+func applyOperation(resource map[string]interface{}, op, pathText string, value interface{}) error {
+	if pathText == "" {
+		if op == "remove" {
+			return noTarget("remove requires a path")
+		}
+		// Without a path the value holds the attributes to add or replace,
+		// whose names may themselves be paths such as name.givenName
+		values, ok := value.(map[string]interface{})
+		if !ok {
+			return invalidValue("value must be an object when there is no path")
+		}
+		for name, v := range values {
+			if err := applyOperation(resource, op, name, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path, err := parsePatchPath(pathText)
+	if err != nil {
+		return err
+	}
+	if path.filter != nil {
+		return applyFiltered(resource, op, path, value)
+	}
+
+	current := lookup(resource, path.attribute)
+	if path.subAttribute != "" {
+		complex, ok := current.(map[string]interface{})
+		if !ok {
+			if current != nil {
+				return invalidPath(path.attribute + " has no sub-attributes")
+			}
+			if op == "remove" {
+				return nil
+			}
+			complex = map[string]interface{}{}
+			setAttribute(resource, path.attribute, complex)
+		}
+		if op == "remove" {
+			deleteAttribute(complex, path.subAttribute)
+		} else {
+			setAttribute(complex, path.subAttribute, value)
+		}
+		return nil
+	}
+
+	switch op {
+	case "remove":
+		// A value lists the elements to remove, as Azure AD does for members
+		if list, ok := current.([]interface{}); ok && value != nil {
+			setAttribute(resource, path.attribute, removeElements(list, value))
+			return nil
+		}
+		deleteAttribute(resource, path.attribute)
+	case "add":
+		if list, ok := current.([]interface{}); ok {
+			setAttribute(resource, path.attribute, appendElements(list, value))
+			return nil
+		}
+		if _, ok := value.([]interface{}); ok {
+			setAttribute(resource, path.attribute, appendElements(nil, value))
+			return nil
+		}
+		fallthrough
+	case "replace":
+		// Sub-attributes of a complex attribute that are not given are kept
+		if complex, ok := current.(map[string]interface{}); ok {
+			if values, ok := value.(map[string]interface{}); ok {
+				for name, v := range values {
+					setAttribute(complex, name, v)
+				}
+				return nil
+			}
+		}
+		setAttribute(resource, path.attribute, value)
+	}
+	return nil
+}
+
+// applyFiltered applies an operation to the elements of a multi-valued
+// attribute that match the filter of the path
+func applyFiltered(resource map[string]interface{}, op string, path patchPath, value interface{}) error {
+	list, _ := lookup(resource, path.attribute).([]interface{})
+
+	matched := false
+	result := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		element, ok := item.(map[string]interface{})
+		if !ok || !path.filter.match(element) {
+			result = append(result, item)
+			continue
+		}
+		matched = true
+
+		switch {
+		case op == "remove" && path.subAttribute == "":
+			continue
+		case op == "remove":
+			deleteAttribute(element, path.subAttribute)
+		case path.subAttribute != "":
+			setAttribute(element, path.subAttribute, value)
+		default:
+			replacement, ok := value.(map[string]interface{})
+			if !ok {
+				return invalidValue("value must be an object")
+			}
+			element = replacement
+		}
+		result = append(result, element)
+	}
+
+	if !matched {
+		if op == "remove" {
+			return nil
+		}
+		// Identity providers set emails[type eq "work"].value on users that
+		// have no work email yet, so an equality filter creates the element
+		element := filterElement(path.filter)
+		if element == nil {
+			return noTarget("no element matches the path")
+		}
+		if path.subAttribute != "" {
+			setAttribute(element, path.subAttribute, value)
+		} else if values, ok := value.(map[string]interface{}); ok {
+			for name, v := range values {
+				setAttribute(element, name, v)
+			}
+		}
+		result = append(result, element)
+	}
+
+	setAttribute(resource, path.attribute, result)
+	return nil
+}
+
+// filterElement returns a new element matching an equality filter such as
+// type eq "work", or nil for any other filter
+func filterElement(f filter) map[string]interface{} {
+	compare, ok := f.(*compareFilter)
+	if !ok || compare.operator != "eq" || compare.path.subAttribute != "" {
+		return nil
+	}
+	return map[string]interface{}{compare.path.attribute: compare.value}
+}
+
+// appendElements adds values to a multi-valued attribute, skipping those
+// already present
+func appendElements(list []interface{}, value interface{}) []interface{} {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	for _, v := range values {
+		if indexOfElement(list, v) < 0 {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// removeElements removes values from a multi-valued attribute
+func removeElements(list []interface{}, value interface{}) []interface{} {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	result := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		if indexOfElement(values, item) < 0 {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// indexOfElement returns the index of the element with the same value as v,
+// comparing the "value" sub-attribute of complex elements
+func indexOfElement(list []interface{}, v interface{}) int {
+	key := elementValue(v)
+	for i, item := range list {
+		if key != nil && compareValues(elementValue(item), "eq", key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// elementValue returns the "value" of a complex element, or a simple element itself
+func elementValue(v interface{}) interface{} {
+	if element, ok := v.(map[string]interface{}); ok {
+		return lookup(element, "value")
+	}
+	return v
+}
+
+// setAttribute sets an attribute, keeping the case of an existing name
+func setAttribute(resource map[string]interface{}, name string, value interface{}) {
+	for key := range resource {
+		if strings.EqualFold(key, name) {
+			resource[key] = value
+			return
+		}
+	}
+	resource[name] = value
+}
+
+// deleteAttribute removes an attribute; names are case-insensitive
+func deleteAttribute(resource map[string]interface{}, name string) {
+	for key := range resource {
+		if strings.EqualFold(key, name) {
+			delete(resource, key)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package scim
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestApplyPatch tests add, replace and remove operations on a resource
+func TestApplyPatch(t *testing.T) {
+	resource := testResource()
+	require.NoError(t, applyPatch(resource, []patchOperation{
+		{Op: "replace", Path: "displayName", Value: "Babs Jensen"},
+		{Op: "Replace", Path: "name.givenName", Value: "Babs"},
+		{Op: "add", Path: "externalId", Value: "ext-1"},
+		{Op: "replace", Path: `emails[type eq "work"].value`, Value: "babs@example.com"},
+		{Op: "remove", Path: `emails[type eq "home"]`},
+		{Op: "add", Path: "phoneNumbers", Value: []interface{}{map[string]interface{}{"value": "555-0100", "type": "work"}}},
+	}))
+
+	assert.Equal(t, "Babs Jensen", resource["displayName"])
+	assert.Equal(t, "Babs", resource["name"].(map[string]interface{})["givenName"])
+	assert.Equal(t, "Jensen", resource["name"].(map[string]interface{})["familyName"], "Other sub-attributes should be kept")
+	assert.Equal(t, "ext-1", resource["externalId"])
+	assert.Equal(t, "babs@example.com", primaryValue(resource["emails"]))
+	assert.Len(t, resource["emails"], 1)
+	assert.Equal(t, "555-0100", primaryValue(resource["phoneNumbers"]))
+
+	require.NoError(t, applyPatch(resource, []patchOperation{
+		{Op: "remove", Path: "externalId"},
+		{Op: "remove", Path: "name.familyName"},
+		{Op: "replace", Value: map[string]interface{}{"active": false, "name.familyName": "Doe"}},
+	}))
+	assert.NotContains(t, resource, "externalId")
+	assert.Equal(t, false, resource["active"])
+	assert.Equal(t, "Doe", resource["name"].(map[string]interface{})["familyName"])
+}
+
+// TestApplyPatchCreatesElements tests that an equality filter matching no
+// element creates it, as identity providers expect
+func TestApplyPatchCreatesElements(t *testing.T) {
+	resource := map[string]interface{}{"userName": "bjensen"}
+	require.NoError(t, applyPatch(resource, []patchOperation{
+		{Op: "replace", Path: `emails[type eq "work"].value`, Value: "bjensen@example.com"},
+		{Op: "add", Path: `phoneNumbers[type eq "mobile"].value`, Value: "555-0100"},
+	}))
+	assert.Equal(t, []interface{}{map[string]interface{}{"type": "work", "value": "bjensen@example.com"}}, resource["emails"])
+	assert.Equal(t, "555-0100", primaryValue(resource["phoneNumbers"]))
+
+	err := applyPatch(resource, []patchOperation{{Op: "replace", Path: `emails[value co "@example.org"].type`, Value: "home"}})
+	var scimErr *Error
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, "noTarget", scimErr.ScimType)
+}
+
+// TestApplyPatchMembers tests the member updates Okta and Azure AD send
+func TestApplyPatchMembers(t *testing.T) {
+	member := func(id string) interface{} { return map[string]interface{}{"value": id} }
+	resource := map[string]interface{}{"displayName": "Engineering", "members": []interface{}{member("a")}}
+
+	require.NoError(t, applyPatch(resource, []patchOperation{
+		{Op: "add", Path: "members", Value: []interface{}{member("a"), member("b"), member("c")}},
+	}))
+	assert.Equal(t, []interface{}{member("a"), member("b"), member("c")}, resource["members"], "Existing members should not be duplicated")
+
+	require.NoError(t, applyPatch(resource, []patchOperation{
+		{Op: "remove", Path: `members[value eq "a"]`},
+		{Op: "Remove", Path: "members", Value: []interface{}{member("c")}},
+	}))
+	assert.Equal(t, []interface{}{member("b")}, resource["members"])
+
+	require.NoError(t, applyPatch(resource, []patchOperation{{Op: "remove", Path: "members"}}))
+	assert.NotContains(t, resource, "members")
+}
+
+// TestApplyPatchErrors tests that invalid operations are rejected
+func TestApplyPatchErrors(t *testing.T) {
+	tests := []struct {
+		operation patchOperation
+		scimType  string
+	}{
+		{patchOperation{Op: "move", Path: "userName"}, "invalidValue"},
+		{patchOperation{Op: "remove"}, "noTarget"},
+		{patchOperation{Op: "replace", Value: "x"}, "invalidValue"},
+		{patchOperation{Op: "replace", Path: "user name", Value: "x"}, "invalidPath"},
+		{patchOperation{Op: "replace", Path: `emails[type eq]`, Value: "x"}, "invalidPath"},
+		{patchOperation{Op: "replace", Path: "userName.first", Value: "x"}, "invalidPath"},
+		{patchOperation{Op: "replace", Path: "urn:example:custom:User:level", Value: "x"}, "invalidPath"},
+	}
+	for _, test := range tests {
+		err := applyPatch(testResource(), []patchOperation{test.operation})
+		var scimErr *Error
+		require.ErrorAs(t, err, &scimErr, test.operation)
+		assert.Equal(t, test.scimType, scimErr.ScimType, test.operation)
+	}
+
+	var scimErr *Error
+	require.ErrorAs(t, applyPatch(testResource(), nil), &scimErr)
+}
@@ -0,0 +1,500 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weedbox/userion"
+)
+
+// userResource presents a user as a SCIM User resource. Groups are listed
+// when the server manages groups.
+func (s *Server) userResource(user *userion.User) (map[string]interface{}, error) {
+	extra := scimData(user)
+
+	name := map[string]interface{}{"formatted": user.Name}
+	for _, key := range []string{"givenName", "familyName"} {
+		if value, ok := extra[key]; ok {
+			name[key] = value
+		}
+	}
+
+	resource := map[string]interface{}{
+		"schemas":     []interface{}{SchemaUser},
+		"id":          user.ID.String(),
+		"userName":    user.Username,
+		"name":        name,
+		"displayName": user.Name,
+		"active":      user.Enabled,
+		"meta": map[string]interface{}{
+			"resourceType": "User",
+			"created":      user.CreatedAt.UTC().Format(time.RFC3339),
+			"location":     s.location("Users", user.ID.String()),
+		},
+	}
+	if externalID, ok := extra["externalId"]; ok {
+		resource["externalId"] = externalID
+	}
+	if user.Email != "" {
+		resource["emails"] = []interface{}{
+			map[string]interface{}{"value": user.Email, "type": "work", "primary": true},
+		}
+	}
+	if user.Phone != "" {
+		resource["phoneNumbers"] = []interface{}{
+			map[string]interface{}{"value": user.Phone, "type": "work"},
+		}
+	}
+
+	if s.groupManager != nil {
+		groups, err := s.groupManager.ListUserGroups(user.ID.String())
+		if err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for _, group := range groups {
+			list = append(list, map[string]interface{}{
+				"value":   group.ID.String(),
+				"display": group.Name,
+				"$ref":    s.location("Groups", group.ID.String()),
+				"type":    "direct",
+			})
+		}
+		resource["groups"] = list
+	}
+
+	return resource, nil
+}
+
+// scimData returns the SCIM attributes kept in User.Data
+func scimData(user *userion.User) map[string]interface{} {
+	if data, ok := user.Data[DataKey].(map[string]interface{}); ok {
+		return data
+	}
+	return map[string]interface{}{}
+}
+
+// userAttributes are the attributes of a User resource userion stores
+type userAttributes struct {
+	userName    string
+	displayName string
+	formatted   string
+	givenName   string
+	familyName  string
+	email       string
+	phone       string
+	externalID  string
+	password    string
+	active      *bool
+}
+
+// parseUserResource reads the stored attributes of a User resource
+func parseUserResource(resource map[string]interface{}) (*userAttributes, error) {
+	attrs := &userAttributes{
+		userName:    stringAttribute(resource, "userName"),
+		displayName: stringAttribute(resource, "displayName"),
+		externalID:  stringAttribute(resource, "externalId"),
+		password:    stringAttribute(resource, "password"),
+		email:       primaryValue(lookup(resource, "emails")),
+		phone:       primaryValue(lookup(resource, "phoneNumbers")),
+	}
+	if name, ok := lookup(resource, "name").(map[string]interface{}); ok {
+		attrs.formatted = stringAttribute(name, "formatted")
+		attrs.givenName = stringAttribute(name, "givenName")
+		attrs.familyName = stringAttribute(name, "familyName")
+	}
+
+	switch active := lookup(resource, "active").(type) {
+	case bool:
+		attrs.active = &active
+	case string:
+		// Some identity providers send booleans as strings
+		value := strings.EqualFold(active, "true")
+		if !value && !strings.EqualFold(active, "false") {
+			return nil, invalidValue("active must be a boolean")
+		}
+		attrs.active = &value
+	case nil:
+	default:
+		return nil, invalidValue("active must be a boolean")
+	}
+
+	return attrs, nil
+}
+
+// validate checks the attributes userion requires
+func (a *userAttributes) validate() error {
+	if a.userName == "" {
+		return invalidValue("userName is required")
+	}
+	if a.email == "" {
+		return invalidValue("an email is required")
+	}
+	// The manager stores passwords of 64 or more characters as given,
+	// taking them for hashes
+	if len(a.password) >= 64 {
+		return invalidValue("password must be shorter than 64 characters")
+	}
+	return nil
+}
+
+// names returns the candidates for User.Name in order of preference
+func (a *userAttributes) names() []string {
+	return []string{a.formatted, strings.TrimSpace(a.givenName + " " + a.familyName), a.displayName}
+}
+
+// name returns the name of a new user
+func (a *userAttributes) name() string {
+	for _, name := range a.names() {
+		if name != "" {
+			return name
+		}
+	}
+	return a.userName
+}
+
+// changedName returns the name of an updated user. Name, name.formatted and
+// displayName all present User.Name, so the first one the update changed wins.
+func (a *userAttributes) changedName(previous *userAttributes, current string) string {
+	names, previousNames := a.names(), previous.names()
+	for i, name := range names {
+		if name != "" && name != previousNames[i] {
+			return name
+		}
+	}
+	return current
+}
+
+// data returns the SCIM attributes to keep in User.Data
+func (a *userAttributes) data() map[string]interface{} {
+	data := map[string]interface{}{}
+	if a.externalID != "" {
+		data["externalId"] = a.externalID
+	}
+	if a.givenName != "" {
+		data["givenName"] = a.givenName
+	}
+	if a.familyName != "" {
+		data["familyName"] = a.familyName
+	}
+	return data
+}
+
+// stringAttribute returns a string attribute, or "" if it is missing
+func stringAttribute(resource map[string]interface{}, name string) string {
+	value, _ := lookup(resource, name).(string)
+	return value
+}
+
+// primaryValue returns the value of the primary element of a multi-valued
+// attribute, or of its first element
+func primaryValue(attribute interface{}) string {
+	list := elements(attribute)
+	for _, element := range list {
+		if primary, _ := lookup(element, "primary").(bool); primary {
+			value, _ := lookup(element, "value").(string)
+			return value
+		}
+	}
+	for _, element := range list {
+		if value, _ := lookup(element, "value").(string); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// createUser provisions a user from a User resource. Users without a
+// password can only sign in through single sign-on.
+func (s *Server) createUser(resource map[string]interface{}) (*userion.User, error) {
+	attrs, err := parseUserResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	if err := attrs.validate(); err != nil {
+		return nil, err
+	}
+
+	// The identity provider has already onboarded the user and is the
+	// authority for the addresses it provisions
+	verifiedAt := s.now()
+	user := &userion.User{
+		Username:        attrs.userName,
+		Email:           attrs.email,
+		Name:            attrs.name(),
+		Phone:           attrs.phone,
+		Password:        attrs.password,
+		Enabled:         true,
+		Status:          userion.UserStatusActive,
+		EmailVerifiedAt: &verifiedAt,
+		Data:            map[string]interface{}{DataKey: attrs.data()},
+	}
+	if user.Password == "" {
+		user.Password = userion.UnusablePassword
+	}
+	if err := s.userManager.CreateUser(user); err != nil {
+		return nil, err
+	}
+
+	// Users are enabled by default, so inactive ones are disabled afterwards
+	if attrs.active != nil && !*attrs.active {
+		if err := s.userManager.DisableUserByID(user.ID.String()); err != nil {
+			return nil, err
+		}
+	}
+	return s.userManager.GetUserByID(user.ID.String())
+}
+
+// updateUser stores the attributes of a replaced or patched User resource.
+// previous is the resource the user was presented as before the change.
+func (s *Server) updateUser(user *userion.User, previous, resource map[string]interface{}) (*userion.User, error) {
+	attrs, err := parseUserResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	if err := attrs.validate(); err != nil {
+		return nil, err
+	}
+	previousAttrs, err := parseUserResource(previous)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	if attrs.userName != user.Username {
+		if err := s.checkAvailable(s.userManager.GetUserByUsername(attrs.userName)); err != nil {
+			return nil, err
+		}
+		changes["Username"] = attrs.userName
+	}
+	if attrs.email != user.Email {
+		if err := s.checkAvailable(s.userManager.GetUserByEmail(attrs.email)); err != nil {
+			return nil, err
+		}
+		changes["Email"] = attrs.email
+		changes["EmailVerifiedAt"] = s.now()
+	}
+	if name := attrs.changedName(previousAttrs, user.Name); name != user.Name {
+		changes["Name"] = name
+	}
+	if attrs.phone != user.Phone {
+		changes["Phone"] = attrs.phone
+		// Ownership of the new number has not been confirmed
+		changes["PhoneVerifiedAt"] = nil
+	}
+	if attrs.password != "" {
+		changes["Password"] = attrs.password
+	}
+	if data := attrs.data(); !reflect.DeepEqual(data, scimData(user)) {
+		merged := map[string]interface{}{}
+		for key, value := range user.Data {
+			merged[key] = value
+		}
+		merged[DataKey] = data
+		changes["Data"] = merged
+	}
+
+	id := user.ID.String()
+	if len(changes) > 0 {
+		if err := s.userManager.UpdateUserByID(id, changes); err != nil {
+			return nil, err
+		}
+	}
+
+	// Enabling and disabling go through the manager so handlers see the events
+	if attrs.active != nil && *attrs.active != user.Enabled {
+		if *attrs.active {
+			err = s.userManager.EnableUserByID(id)
+		} else {
+			err = s.userManager.DisableUserByID(id)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.userManager.GetUserByID(id)
+}
+
+// checkAvailable turns the result of looking up a new username or email
+// into a uniqueness error when another user already has it
+func (s *Server) checkAvailable(_ *userion.User, err error) error {
+	if err == nil {
+		return userion.ErrUserAlreadyExists
+	}
+	if errors.Is(err, userion.ErrUserNotFound) {
+		return nil
+	}
+	return err
+}
+
+// groupResource presents a group as a SCIM Group resource. Subgroups are
+// listed as members of type Group.
+func (s *Server) groupResource(group *userion.Group) (map[string]interface{}, error) {
+	memberIDs, err := s.groupManager.ListMemberIDs(group.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	subgroups, err := s.groupManager.ListSubgroups(group.ID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	members := []interface{}{}
+	for _, id := range memberIDs {
+		members = append(members, map[string]interface{}{
+			"value": id.String(),
+			"type":  "User",
+			"$ref":  s.location("Users", id.String()),
+		})
+	}
+	for _, subgroup := range subgroups {
+		members = append(members, map[string]interface{}{
+			"value":   subgroup.ID.String(),
+			"display": subgroup.Name,
+			"type":    "Group",
+			"$ref":    s.location("Groups", subgroup.ID.String()),
+		})
+	}
+
+	return map[string]interface{}{
+		"schemas":     []interface{}{SchemaGroup},
+		"id":          group.ID.String(),
+		"displayName": group.Name,
+		"members":     members,
+		"meta": map[string]interface{}{
+			"resourceType": "Group",
+			"created":      group.CreatedAt.UTC().Format(time.RFC3339),
+			"location":     s.location("Groups", group.ID.String()),
+		},
+	}, nil
+}
+
+// groupMembers are the members of a Group resource split by type
+type groupMembers struct {
+	users     map[uuid.UUID]bool
+	subgroups map[uuid.UUID]bool
+}
+
+// parseGroupMembers resolves the members of a Group resource to users and
+// groups. Members without a type may be either.
+func (s *Server) parseGroupMembers(resource map[string]interface{}) (*groupMembers, error) {
+	members := &groupMembers{users: map[uuid.UUID]bool{}, subgroups: map[uuid.UUID]bool{}}
+	for _, member := range elements(lookup(resource, "members")) {
+		value, _ := lookup(member, "value").(string)
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, invalidValue("unknown member " + value)
+		}
+		memberType, _ := lookup(member, "type").(string)
+
+		if !strings.EqualFold(memberType, "Group") {
+			_, err := s.userManager.GetUserByID(value)
+			if err == nil {
+				members.users[id] = true
+				continue
+			}
+			if !errors.Is(err, userion.ErrUserNotFound) {
+				return nil, err
+			}
+		}
+		if !strings.EqualFold(memberType, "User") {
+			_, err := s.groupManager.GetGroupByID(value)
+			if err == nil {
+				members.subgroups[id] = true
+				continue
+			}
+			if !errors.Is(err, userion.ErrGroupNotFound) {
+				return nil, err
+			}
+		}
+		return nil, invalidValue("unknown member " + value)
+	}
+	return members, nil
+}
+
+// createGroup creates a group from a Group resource
+func (s *Server) createGroup(resource map[string]interface{}) (*userion.Group, error) {
+	name := stringAttribute(resource, "displayName")
+	if name == "" {
+		return nil, invalidValue("displayName is required")
+	}
+	members, err := s.parseGroupMembers(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := s.groupManager.CreateGroup(name, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.syncMembers(group, members); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// updateGroup stores the name and members of a replaced or patched Group resource
+func (s *Server) updateGroup(group *userion.Group, resource map[string]interface{}) (*userion.Group, error) {
+	name := stringAttribute(resource, "displayName")
+	if name == "" {
+		return nil, invalidValue("displayName is required")
+	}
+	members, err := s.parseGroupMembers(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != group.Name {
+		if err := s.groupManager.UpdateGroupByID(group.ID.String(), map[string]interface{}{"name": name}); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.syncMembers(group, members); err != nil {
+		return nil, err
+	}
+	return s.groupManager.GetGroupByID(group.ID.String())
+}
+
+// syncMembers adds and removes members so the group has exactly the given ones
+func (s *Server) syncMembers(group *userion.Group, members *groupMembers) error {
+	groupID := group.ID.String()
+
+	currentUsers, err := s.groupManager.ListMemberIDs(groupID)
+	if err != nil {
+		return err
+	}
+	for _, id := range currentUsers {
+		if members.users[id] {
+			delete(members.users, id)
+		} else if err := s.groupManager.RemoveMember(groupID, id.String()); err != nil {
+			return err
+		}
+	}
+	for id := range members.users {
+		if err := s.groupManager.AddMember(groupID, id.String()); err != nil {
+			return err
+		}
+	}
+
+	currentSubgroups, err := s.groupManager.ListSubgroups(groupID)
+	if err != nil {
+		return err
+	}
+	for _, subgroup := range currentSubgroups {
+		if members.subgroups[subgroup.ID] {
+			delete(members.subgroups, subgroup.ID)
+		} else if err := s.groupManager.RemoveSubgroup(groupID, subgroup.ID.String()); err != nil {
+			return err
+		}
+	}
+	for id := range members.subgroups {
+		if err := s.groupManager.AddSubgroup(groupID, id.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package scim
+
+import (
+	"net/http"
+	"strings"
+)
+
+// schemaAttribute describes an attribute in a schema definition (RFC 7643
+// section 7)
+func schemaAttribute(name, attrType string, multiValued, required bool, mutability, returned, uniqueness string, subAttributes ...map[string]interface{}) map[string]interface{} {
+	attribute := map[string]interface{}{
+		"name":        name,
+		"type":        attrType,
+		"multiValued": multiValued,
+		"required":    required,
+		"caseExact":   false,
+		"mutability":  mutability,
+		"returned":    returned,
+		"uniqueness":  uniqueness,
+	}
+	if len(subAttributes) > 0 {
+		attribute["subAttributes"] = subAttributes
+	}
+	return attribute
+}
+
+// multiValuedSubAttributes are the sub-attributes of emails and phoneNumbers
+func multiValuedSubAttributes() []map[string]interface{} {
+	return []map[string]interface{}{
+		schemaAttribute("value", "string", false, false, "readWrite", "default", "none"),
+		schemaAttribute("type", "string", false, false, "readWrite", "default", "none"),
+		schemaAttribute("primary", "boolean", false, false, "readWrite", "default", "none"),
+	}
+}
+
+// referenceSubAttributes are the sub-attributes of groups and members
+func referenceSubAttributes(mutability string) []map[string]interface{} {
+	return []map[string]interface{}{
+		schemaAttribute("value", "string", false, false, mutability, "default", "none"),
+		schemaAttribute("$ref", "reference", false, false, mutability, "default", "none"),
+		schemaAttribute("display", "string", false, false, "readOnly", "default", "none"),
+		schemaAttribute("type", "string", false, false, mutability, "default", "none"),
+	}
+}
+
+// userSchema describes the attributes of the User resources served
+func (s *Server) userSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":     []string{SchemaSchema},
+		"id":          SchemaUser,
+		"name":        "User",
+		"description": "User Account",
+		"attributes": []map[string]interface{}{
+			schemaAttribute("userName", "string", false, true, "readWrite", "default", "server"),
+			schemaAttribute("externalId", "string", false, false, "readWrite", "default", "none"),
+			schemaAttribute("name", "complex", false, false, "readWrite", "default", "none",
+				schemaAttribute("formatted", "string", false, false, "readWrite", "default", "none"),
+				schemaAttribute("givenName", "string", false, false, "readWrite", "default", "none"),
+				schemaAttribute("familyName", "string", false, false, "readWrite", "default", "none"),
+			),
+			schemaAttribute("displayName", "string", false, false, "readWrite", "default", "none"),
+			schemaAttribute("active", "boolean", false, false, "readWrite", "default", "none"),
+			schemaAttribute("password", "string", false, false, "writeOnly", "never", "none"),
+			schemaAttribute("emails", "complex", true, true, "readWrite", "default", "server", multiValuedSubAttributes()...),
+			schemaAttribute("phoneNumbers", "complex", true, false, "readWrite", "default", "none", multiValuedSubAttributes()...),
+			schemaAttribute("groups", "complex", true, false, "readOnly", "default", "none", referenceSubAttributes("readOnly")...),
+		},
+		"meta": s.meta("Schema", "Schemas/"+SchemaUser),
+	}
+}
+
+// groupSchema describes the attributes of the Group resources served
+func (s *Server) groupSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":     []string{SchemaSchema},
+		"id":          SchemaGroup,
+		"name":        "Group",
+		"description": "Group",
+		"attributes": []map[string]interface{}{
+			schemaAttribute("displayName", "string", false, true, "readWrite", "default", "server"),
+			schemaAttribute("members", "complex", true, false, "readWrite", "default", "none", referenceSubAttributes("immutable")...),
+		},
+		"meta": s.meta("Schema", "Schemas/"+SchemaGroup),
+	}
+}
+
+// schemas returns the schema definitions of the resources served
+func (s *Server) schemas() []map[string]interface{} {
+	schemas := []map[string]interface{}{s.userSchema()}
+	if s.groupManager != nil {
+		schemas = append(schemas, s.groupSchema())
+	}
+	return schemas
+}
+
+// resourceTypes returns the resource types served (RFC 7643 section 6)
+func (s *Server) resourceTypes() []map[string]interface{} {
+	types := []map[string]interface{}{{
+		"schemas":     []string{SchemaResourceType},
+		"id":          "User",
+		"name":        "User",
+		"endpoint":    "/Users",
+		"description": "User Account",
+		"schema":      SchemaUser,
+		"meta":        s.meta("ResourceType", "ResourceTypes/User"),
+	}}
+	if s.groupManager != nil {
+		types = append(types, map[string]interface{}{
+			"schemas":     []string{SchemaResourceType},
+			"id":          "Group",
+			"name":        "Group",
+			"endpoint":    "/Groups",
+			"description": "Group",
+			"schema":      SchemaGroup,
+			"meta":        s.meta("ResourceType", "ResourceTypes/Group"),
+		})
+	}
+	return types
+}
+
+// meta returns the meta attribute of a discovery resource
+func (s *Server) meta(resourceType, path string) map[string]interface{} {
+	return map[string]interface{}{"resourceType": resourceType, "location": s.config.BaseURL + "/" + path}
+}
+
+// handleServiceProviderConfig serves the features the service provider
+// supports (RFC 7643 section 5)
+func (s *Server) handleServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{SchemaServiceProviderConfig},
+		"patch":          map[string]interface{}{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": MaxPageSize},
+		"changePassword": map[string]interface{}{"supported": true},
+		"sort":           map[string]interface{}{"supported": false},
+		"etag":           map[string]interface{}{"supported": false},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with a bearer token",
+		}},
+		"meta": s.meta("ServiceProviderConfig", "ServiceProviderConfig"),
+	})
+}
+
+// handleSchemas serves the schema definitions
+func (s *Server) handleSchemas(w http.ResponseWriter, r *http.Request) {
+	writeDiscoveryList(w, s.schemas())
+}
+
+// handleSchema serves one schema definition
+func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
+	for _, schema := range s.schemas() {
+		if schema["id"] == r.PathValue("id") {
+			writeJSON(w, http.StatusOK, schema)
+			return
+		}
+	}
+	writeError(w, notFound("unknown schema"))
+}
+
+// handleResourceTypes serves the resource types
+func (s *Server) handleResourceTypes(w http.ResponseWriter, r *http.Request) {
+	writeDiscoveryList(w, s.resourceTypes())
+}
+
+// handleResourceType serves one resource type
+func (s *Server) handleResourceType(w http.ResponseWriter, r *http.Request) {
+	for _, resourceType := range s.resourceTypes() {
+		if strings.EqualFold(resourceType["name"].(string), r.PathValue("name")) {
+			writeJSON(w, http.StatusOK, resourceType)
+			return
+		}
+	}
+	writeError(w, notFound("unknown resource type"))
+}
+
+// writeDiscoveryList writes discovery resources as a list response
+func writeDiscoveryList(w http.ResponseWriter, resources []map[string]interface{}) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"schemas":      []string{SchemaListResponse},
+		"totalResults": len(resources),
+		"startIndex":   1,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	})
+}
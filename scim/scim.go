@@ -0,0 +1,123 @@
+// Package scim implements a SCIM 2.0 service provider (RFC 7643, RFC 7644)
+// so identity providers such as Okta or Azure AD can provision userion users
+// and groups.
+package scim
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/weedbox/userion"
+)
+
+// Schema URNs (RFC 7643 section 8.7)
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// DataKey is the key of User.Data holding the SCIM attributes userion has
+// no field for: externalId, name.givenName and name.familyName
+const DataKey = "scim"
+
+// Default and maximum page sizes of list responses
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// Error is a SCIM error response (RFC 7644 section 3.12)
+type Error struct {
+	Status   int
+	ScimType string // e.g. invalidFilter, uniqueness, invalidValue, noTarget
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	if e.ScimType != "" {
+		return "scim: " + e.ScimType + ": " + e.Detail
+	}
+	return "scim: " + e.Detail
+}
+
+// body returns the error in the SCIM error schema
+func (e *Error) body() map[string]interface{} {
+	body := map[string]interface{}{
+		"schemas": []string{SchemaError},
+		"status":  strconv.Itoa(e.Status),
+	}
+	if e.ScimType != "" {
+		body["scimType"] = e.ScimType
+	}
+	if e.Detail != "" {
+		body["detail"] = e.Detail
+	}
+	return body
+}
+
+// invalidFilter returns the error for an unparsable filter
+func invalidFilter(detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, ScimType: "invalidFilter", Detail: detail}
+}
+
+// invalidValue returns the error for a request with a bad attribute value
+func invalidValue(detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: detail}
+}
+
+// invalidPath returns the error for a PATCH path that cannot be used
+func invalidPath(detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, ScimType: "invalidPath", Detail: detail}
+}
+
+// noTarget returns the error for a PATCH operation without a target
+func noTarget(detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, ScimType: "noTarget", Detail: detail}
+}
+
+// notFound returns the error for an unknown resource
+func notFound(detail string) *Error {
+	return &Error{Status: http.StatusNotFound, Detail: detail}
+}
+
+// toError maps errors of the userion managers to SCIM errors
+func toError(err error) *Error {
+	var scimErr *Error
+	switch {
+	case errors.As(err, &scimErr):
+		return scimErr
+	case errors.Is(err, userion.ErrUserNotFound):
+		return notFound("user not found")
+	case errors.Is(err, userion.ErrGroupNotFound):
+		return notFound("group not found")
+	case errors.Is(err, userion.ErrUserAlreadyExists):
+		return &Error{Status: http.StatusConflict, ScimType: "uniqueness", Detail: "userName or email is already taken"}
+	case errors.Is(err, userion.ErrGroupAlreadyExists):
+		return &Error{Status: http.StatusConflict, ScimType: "uniqueness", Detail: "displayName is already taken"}
+	case errors.Is(err, userion.ErrWeakPassword):
+		return invalidValue(err.Error())
+	case errors.Is(err, userion.ErrGroupCycle):
+		return invalidValue(err.Error())
+	case errors.Is(err, userion.ErrCrossTenantAccess):
+		return &Error{Status: http.StatusForbidden, Detail: "cross-tenant access"}
+	}
+	return &Error{Status: http.StatusInternalServerError, Detail: "internal error"}
+}
+
+// Config configures the SCIM service provider
+type Config struct {
+	// BaseURL is the URL the handler is mounted at, used for resource
+	// locations, e.g. https://app.example.com/scim/v2
+	BaseURL string
+
+	// Authenticate checks the credentials of the identity provider, usually
+	// a bearer token. Requests are rejected when it is nil or returns an error.
+	Authenticate func(r *http.Request) error
+}
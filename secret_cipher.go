@@ -0,0 +1,61 @@
+package userion
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// ErrDecryptionFailed is returned when a stored secret cannot be decrypted
+var ErrDecryptionFailed = errors.New("failed to decrypt secret")
+
+// SecretCipher encrypts secrets before they are stored. The associated data
+// binds a ciphertext to its owner so it cannot be copied to another record.
+type SecretCipher interface {
+	Encrypt(plaintext, associatedData []byte) ([]byte, error)
+	Decrypt(ciphertext, associatedData []byte) ([]byte, error)
+}
+
+// AESGCMCipher is a SecretCipher using AES-GCM with a random nonce per secret
+type AESGCMCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMCipher creates an AESGCMCipher from a 16, 24 or 32 byte key
+func NewAESGCMCipher(key []byte) (*AESGCMCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AESGCMCipher{aead: aead}, nil
+}
+
+// Encrypt seals plaintext and prepends the nonce
+func (c *AESGCMCipher) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+// Decrypt opens a ciphertext produced by Encrypt
+func (c *AESGCMCipher) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, ErrDecryptionFailed
+	}
+
+	plaintext, err := c.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], associatedData)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
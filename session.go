@@ -0,0 +1,47 @@
+package userion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Common errors returned by the SessionManager
+var (
+	ErrInvalidSession = errors.New("invalid session")
+	ErrSessionExpired = errors.New("session expired")
+)
+
+// Session represents a server-side login session of a user
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	IPAddress  string     `json:"ip_address,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	Device     string     `json:"device,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// SessionMetadata describes the client a session is created for
+type SessionMetadata struct {
+	IPAddress string
+	UserAgent string
+	Device    string
+}
+
+// SessionManager defines the interface for managing user sessions.
+// Sessions are identified by an opaque token handed to the client once;
+// the ID of a Session is only used to list and revoke sessions.
+type SessionManager interface {
+	AutoMigrate() error
+	CreateSession(userID string, metadata SessionMetadata) (*Session, string, error)
+	ValidateSession(token string) (*Session, error)
+	ListSessions(userID string) ([]Session, error)
+	RevokeSession(id string) error
+	RevokeAllSessions(userID string) error
+	HandleEvent(event Event)
+}
@@ -0,0 +1,243 @@
+package userion
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Default settings of GormSessionManager
+const (
+	DefaultSessionTTL         = 24 * time.Hour
+	DefaultSessionIdleTimeout = time.Hour
+	// sessionTouchInterval limits how often LastSeenAt is written
+	sessionTouchInterval = time.Minute
+)
+
+// GormSessionModel represents the GORM-specific database model for sessions
+type GormSessionModel struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	TokenHash  string    `gorm:"type:varchar(64);unique;not null"`
+	IPAddress  string
+	UserAgent  string
+	Device     string
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	LastSeenAt time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+}
+
+// ToSession converts a GormSessionModel to a Session business model
+func (g *GormSessionModel) ToSession() *Session {
+	return &Session{
+		ID:         g.ID,
+		UserID:     g.UserID,
+		IPAddress:  g.IPAddress,
+		UserAgent:  g.UserAgent,
+		Device:     g.Device,
+		CreatedAt:  g.CreatedAt,
+		LastSeenAt: g.LastSeenAt,
+		ExpiresAt:  g.ExpiresAt,
+		RevokedAt:  g.RevokedAt,
+	}
+}
+
+// GormSessionManager is the GORM implementation of SessionManager
+type GormSessionManager struct {
+	db        *gorm.DB
+	tableName string
+
+	ttl         time.Duration
+	idleTimeout time.Duration
+
+	errorHandler func(event Event, err error)
+
+	now func() time.Time
+}
+
+// SessionOption configures optional behaviour of a GormSessionManager
+type SessionOption func(*GormSessionManager)
+
+// WithSessionTTL sets the absolute lifetime of sessions
+func WithSessionTTL(ttl time.Duration) SessionOption {
+	return func(m *GormSessionManager) {
+		m.ttl = ttl
+	}
+}
+
+// WithSessionIdleTimeout sets how long a session may go unused; zero disables it
+func WithSessionIdleTimeout(timeout time.Duration) SessionOption {
+	return func(m *GormSessionManager) {
+		m.idleTimeout = timeout
+	}
+}
+
+// WithSessionErrorHandler sets the handler of errors revoking sessions in
+// HandleEvent, which cannot return them to the emitting manager. By default
+// they are logged; nil ignores them.
+func WithSessionErrorHandler(handler func(event Event, err error)) SessionOption {
+	return func(m *GormSessionManager) {
+		m.errorHandler = handler
+	}
+}
+
+// logSessionError is the default handler of errors revoking sessions
+func logSessionError(event Event, err error) {
+	log.Printf("userion: revoking sessions of user %s after %s: %v", event.UserID, event.Type, err)
+}
+
+// NewGormSessionManager initializes a new SessionManager. To revoke sessions
+// automatically, register its HandleEvent with the user manager:
+//
+//	sessions := userion.NewGormSessionManager(db, "user_sessions")
+//	users := userion.NewGormUserManager(db, "users", userion.WithEventHandler(sessions.HandleEvent))
+func NewGormSessionManager(db *gorm.DB, tableName string, opts ...SessionOption) SessionManager {
+	m := &GormSessionManager{
+		db:           db,
+		tableName:    tableName,
+		ttl:          DefaultSessionTTL,
+		idleTimeout:  DefaultSessionIdleTimeout,
+		errorHandler: logSessionError,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// AutoMigrate creates or updates the database schema for sessions
+func (m *GormSessionManager) AutoMigrate() error {
+	return m.db.Table(m.tableName).AutoMigrate(&GormSessionModel{})
+}
+
+// CreateSession starts a session for the user and returns it together with
+// the opaque token to hand to the client. Only the token's hash is stored.
+func (m *GormSessionManager) CreateSession(userID string, metadata SessionMetadata) (*Session, string, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, "", ErrUserNotFound
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := m.now()
+	gormSession := &GormSessionModel{
+		ID:         uuid.New(),
+		UserID:     id,
+		TokenHash:  HashToken(token),
+		IPAddress:  metadata.IPAddress,
+		UserAgent:  metadata.UserAgent,
+		Device:     metadata.Device,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(m.ttl),
+	}
+
+	if err := m.db.Table(m.tableName).Create(gormSession).Error; err != nil {
+		return nil, "", err
+	}
+
+	return gormSession.ToSession(), token, nil
+}
+
+// ValidateSession looks up an active session by token and records the activity
+func (m *GormSessionManager) ValidateSession(token string) (*Session, error) {
+	var gormSession GormSessionModel
+	if err := m.db.Table(m.tableName).Where("token_hash = ?", HashToken(token)).First(&gormSession).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidSession
+		}
+		return nil, err
+	}
+
+	if gormSession.RevokedAt != nil {
+		return nil, ErrInvalidSession
+	}
+
+	now := m.now()
+	if !m.isActive(&gormSession, now) {
+		return nil, ErrSessionExpired
+	}
+
+	// Avoid a write on every request
+	if now.Sub(gormSession.LastSeenAt) >= sessionTouchInterval {
+		if err := m.db.Table(m.tableName).Where("id = ?", gormSession.ID).Update("last_seen_at", now).Error; err != nil {
+			return nil, err
+		}
+		gormSession.LastSeenAt = now
+	}
+
+	return gormSession.ToSession(), nil
+}
+
+// isActive reports whether a session has neither expired nor gone idle
+func (m *GormSessionManager) isActive(gormSession *GormSessionModel, now time.Time) bool {
+	if !now.Before(gormSession.ExpiresAt) {
+		return false
+	}
+	if m.idleTimeout > 0 && !now.Before(gormSession.LastSeenAt.Add(m.idleTimeout)) {
+		return false
+	}
+	return true
+}
+
+// ListSessions returns the active sessions of a user, most recent first
+func (m *GormSessionManager) ListSessions(userID string) ([]Session, error) {
+	var gormSessions []GormSessionModel
+	err := m.db.Table(m.tableName).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("last_seen_at DESC").
+		Find(&gormSessions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	sessions := make([]Session, 0, len(gormSessions))
+	for i := range gormSessions {
+		if m.isActive(&gormSessions[i], now) {
+			sessions = append(sessions, *gormSessions[i].ToSession())
+		}
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends a single session by its ID
+func (m *GormSessionManager) RevokeSession(id string) error {
+	result := m.db.Table(m.tableName).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", m.now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidSession
+	}
+	return nil
+}
+
+// RevokeAllSessions ends every session of a user
+func (m *GormSessionManager) RevokeAllSessions(userID string) error {
+	return m.db.Table(m.tableName).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", m.now()).Error
+}
+
+// HandleEvent revokes all sessions of a user whose password changed or who
+// was disabled. Register it with WithEventHandler. Errors cannot be reported
+// back to the emitting manager, so they go to the error handler.
+func (m *GormSessionManager) HandleEvent(event Event) {
+	switch event.Type {
+	case EventPasswordChanged, EventPasswordReset, EventUserDisabled:
+		if err := m.RevokeAllSessions(event.UserID.String()); err != nil && m.errorHandler != nil {
+			m.errorHandler(event, err)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package userion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupSessionManagerGorm creates a SessionManager wired to a UserManager through events
+func setupSessionManagerGorm(t *testing.T) (*GormSessionManager, UserManager, *gorm.DB) {
+	userManager, db := setupTestDBGorm(t)
+
+	tableName := "sessions_test_" + uuid.New().String()[:8]
+	sessionManager := NewGormSessionManager(db, tableName).(*GormSessionManager)
+	err := sessionManager.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	m := userManager.(*GormUserManager)
+	m.eventHandlers = append(m.eventHandlers, sessionManager.HandleEvent)
+
+	return sessionManager, userManager, db
+}
+
+// TestCreateSession_Gorm tests the CreateSession and ValidateSession methods
+func TestCreateSession_Gorm(t *testing.T) {
+	sessionManager, userManager, db := setupSessionManagerGorm(t)
+	user := createTestUser(t, userManager)
+
+	session, token, err := sessionManager.CreateSession(user.ID.String(), SessionMetadata{
+		IPAddress: "192.0.2.1",
+		UserAgent: "Mozilla/5.0",
+		Device:    "laptop",
+	})
+	assert.NoError(t, err, "CreateSession should not error with valid user ID")
+	assert.NotEmpty(t, token, "Token should be returned")
+	assert.Equal(t, user.ID, session.UserID)
+
+	// Verify only the hash is stored
+	var count int64
+	db.Table(sessionManager.tableName).Where("token_hash = ?", HashToken(token)).Count(&count)
+	assert.Equal(t, int64(1), count, "Token hash should be stored")
+
+	validated, err := sessionManager.ValidateSession(token)
+	assert.NoError(t, err, "ValidateSession should not error with valid token")
+	assert.Equal(t, session.ID, validated.ID)
+	assert.Equal(t, "192.0.2.1", validated.IPAddress)
+	assert.Equal(t, "Mozilla/5.0", validated.UserAgent)
+	assert.Equal(t, "laptop", validated.Device)
+
+	_, err = sessionManager.ValidateSession("unknown-token")
+	assert.Equal(t, ErrInvalidSession, err, "ValidateSession should reject an unknown token")
+}
+
+// TestSessionExpiry_Gorm tests absolute expiry and idle timeout
+func TestSessionExpiry_Gorm(t *testing.T) {
+	sessionManager, userManager, _ := setupSessionManagerGorm(t)
+	user := createTestUser(t, userManager)
+	base := time.Now()
+
+	_, token, err := sessionManager.CreateSession(user.ID.String(), SessionMetadata{})
+	require.NoError(t, err)
+
+	// Activity keeps the session alive past the idle timeout
+	for i := 1; i <= 3; i++ {
+		sessionManager.now = func() time.Time { return base.Add(time.Duration(i) * 45 * time.Minute) }
+		_, err = sessionManager.ValidateSession(token)
+		require.NoError(t, err, "Active session should stay valid")
+	}
+
+	// Going idle expires the session
+	sessionManager.now = func() time.Time { return base.Add(135*time.Minute + DefaultSessionIdleTimeout) }
+	_, err = sessionManager.ValidateSession(token)
+	assert.Equal(t, ErrSessionExpired, err, "Idle session should expire")
+
+	// The absolute lifetime cannot be extended
+	sessionManager.now = func() time.Time { return base }
+	_, token, err = sessionManager.CreateSession(user.ID.String(), SessionMetadata{})
+	require.NoError(t, err)
+	sessionManager.idleTimeout = 0
+	sessionManager.now = func() time.Time { return base.Add(DefaultSessionTTL) }
+	_, err = sessionManager.ValidateSession(token)
+	assert.Equal(t, ErrSessionExpired, err, "Session should expire after its TTL")
+}
+
+// TestListAndRevokeSessions_Gorm tests listing and revoking sessions
+func TestListAndRevokeSessions_Gorm(t *testing.T) {
+	sessionManager, userManager, _ := setupSessionManagerGorm(t)
+	user := createTestUser(t, userManager)
+
+	first, firstToken, err := sessionManager.CreateSession(user.ID.String(), SessionMetadata{Device: "phone"})
+	require.NoError(t, err)
+	_, secondToken, err := sessionManager.CreateSession(user.ID.String(), SessionMetadata{Device: "laptop"})
+	require.NoError(t, err)
+
+	sessions, err := sessionManager.ListSessions(user.ID.String())
+	assert.NoError(t, err, "ListSessions should not error")
+	assert.Len(t, sessions, 2, "Both sessions should be listed")
+
+	// Revoke one session
+	err = sessionManager.RevokeSession(first.ID.String())
+	assert.NoError(t, err, "RevokeSession should not error with valid ID")
+	_, err = sessionManager.ValidateSession(firstToken)
+	assert.Equal(t, ErrInvalidSession, err, "Revoked session should be invalid")
+
+	err = sessionManager.RevokeSession(first.ID.String())
+	assert.Equal(t, ErrInvalidSession, err, "Revoking twice should error")
+
+	sessions, err = sessionManager.ListSessions(user.ID.String())
+	require.NoError(t, err)
+	require.Len(t, sessions, 1, "Revoked session should not be listed")
+	assert.Equal(t, "laptop", sessions[0].Device)
+
+	// Revoke all sessions
+	err = sessionManager.RevokeAllSessions(user.ID.String())
+	assert.NoError(t, err, "RevokeAllSessions should not error")
+	_, err = sessionManager.ValidateSession(secondToken)
+	assert.Equal(t, ErrInvalidSession, err, "All sessions should be revoked")
+}
+
+// TestSessionRevocationOnUserEvents_Gorm tests automatic revocation on password changes and disabling
+func TestSessionRevocationOnUserEvents_Gorm(t *testing.T) {
+	sessionManager, userManager, _ := setupSessionManagerGorm(t)
+	user := createTestUser(t, userManager)
+
+	// Password change through an update
+	_, token, err := sessionManager.CreateSession(user.ID.String(), SessionMetadata{})
+	require.NoError(t, err)
+	err = userManager.UpdateUserByUsername(user.Username, map[string]interface{}{"Password": "changed-password"})
+	require.NoError(t, err)
+	_, err = sessionManager.ValidateSession(token)
+	assert.Equal(t, ErrInvalidSession, err, "Sessions should be revoked after a password change")
+
+	// Password reset
+	_, token, err = sessionManager.CreateSession(user.ID.String(), SessionMetadata{})
+	require.NoError(t, err)
+	resetToken, err := userManager.RequestPasswordReset(user.Email)
+	require.NoError(t, err)
+	err = userManager.ResetPassword(resetToken, "reset-password")
+	require.NoError(t, err)
+	_, err = sessionManager.ValidateSession(token)
+	assert.Equal(t, ErrInvalidSession, err, "Sessions should be revoked after a password reset")
+
+	// Other updates keep sessions
+	_, token, err = sessionManager.CreateSession(user.ID.String(), SessionMetadata{})
+	require.NoError(t, err)
+	err = userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Name": "Renamed"})
+	require.NoError(t, err)
+	_, err = sessionManager.ValidateSession(token)
+	assert.NoError(t, err, "Sessions should survive unrelated updates")
+
+	// Disabling the user
+	err = userManager.DisableUserByID(user.ID.String())
+	require.NoError(t, err)
+	_, err = sessionManager.ValidateSession(token)
+	assert.Equal(t, ErrInvalidSession, err, "Sessions should be revoked when the user is disabled")
+}
+
+// TestSessionRevocationErrors_Gorm tests that errors revoking sessions on
+// user events are reported
+func TestSessionRevocationErrors_Gorm(t *testing.T) {
+	sessionManager, userManager, db := setupSessionManagerGorm(t)
+	user := createTestUser(t, userManager)
+	assert.NotNil(t, sessionManager.errorHandler, "Errors should be logged by default")
+
+	var reported []error
+	sessionManager.errorHandler = func(event Event, err error) {
+		assert.Equal(t, user.ID, event.UserID)
+		reported = append(reported, err)
+	}
+	require.NoError(t, db.Migrator().DropTable(sessionManager.tableName))
+
+	require.NoError(t, userManager.DisableUserByID(user.ID.String()))
+	assert.Len(t, reported, 1, "Failed revocations should be reported")
+}
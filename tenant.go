@@ -0,0 +1,20 @@
+package userion
+
+import "errors"
+
+// ErrCrossTenantAccess is returned when a tenant-scoped manager is asked to
+// create a user in, or move a user to, another tenant
+var ErrCrossTenantAccess = errors.New("cross-tenant access denied")
+
+// DefaultTenantID is the tenant of users created without one. Single-tenant
+// deployments keep all users in it.
+const DefaultTenantID = ""
+
+// TenantScoper is implemented by user managers that can be restricted to the
+// users of a single tenant
+type TenantScoper interface {
+	// ForTenant returns a manager sharing the configuration of the receiver
+	// whose lookups, updates, deletes and lists only see users of tenantID.
+	// Users of other tenants are reported as ErrUserNotFound.
+	ForTenant(tenantID string) UserManager
+}
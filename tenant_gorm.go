@@ -0,0 +1,80 @@
+package userion
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tenantUniqueColumns are the user columns that are unique within a tenant
+var tenantUniqueColumns = []string{"username", "email", "phone"}
+
+// ForTenant returns a copy of the manager scoped to the users of tenantID
+func (m *GormUserManager) ForTenant(tenantID string) UserManager {
+	scoped := *m
+	scoped.tenantID = tenantID
+	scoped.tenantScoped = true
+	return &scoped
+}
+
+// users starts a query on the user table, restricted to the manager's tenant
+// if it is scoped
+func (m *GormUserManager) users(tx *gorm.DB) *gorm.DB {
+	query := tx.Table(m.tableName)
+	if m.tenantScoped {
+		query = query.Where("tenant_id = ?", m.tenantID)
+	}
+	return query
+}
+
+// tenantIndexName returns the name of the per-tenant unique index on column.
+// Index names are shared by all tables of a database, so they include the table name.
+func (m *GormUserManager) tenantIndexName(column string) string {
+	return "idx_" + m.tableName + "_tenant_" + column
+}
+
+// migrateTenantIndexes creates the composite unique indexes on tenant_id and
+// each of tenantUniqueColumns. Phone numbers are optional, so users without
+// one are left out of its index.
+func (m *GormUserManager) migrateTenantIndexes() error {
+	for _, column := range tenantUniqueColumns {
+		where := ""
+		if column == "phone" {
+			if m.db.Dialector.Name() == "mysql" {
+				if err := m.migrateMySQLPhoneIndex(); err != nil {
+					return err
+				}
+				continue
+			}
+			where = "phone <> ''"
+		}
+
+		err := migrateUniqueIndex(m.db, &GormUserModel{}, m.tableName, m.tenantIndexName(column), where, "tenant_id", column)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateMySQLPhoneIndex creates the phone index on MySQL, which has no
+// partial indexes. Empty phone numbers are indexed as NULL instead, which a
+// unique index accepts any number of times. Functional key parts require
+// MySQL 8.0.13 or later.
+func (m *GormUserManager) migrateMySQLPhoneIndex() error {
+	migrator := m.db.Table(m.tableName).Migrator()
+
+	// Earlier versions indexed empty phone numbers as well
+	legacy := m.tenantIndexName("phone")
+	if migrator.HasIndex(&GormUserModel{}, legacy) {
+		if err := migrator.DropIndex(&GormUserModel{}, legacy); err != nil {
+			return err
+		}
+	}
+
+	name := legacy + "_set"
+	if migrator.HasIndex(&GormUserModel{}, name) {
+		return nil
+	}
+	return m.db.Exec("CREATE UNIQUE INDEX ? ON ? (?, (NULLIF(?, '')))",
+		clause.Column{Name: name}, clause.Table{Name: m.tableName}, clause.Column{Name: "tenant_id"}, clause.Column{Name: "phone"}).Error
+}
@@ -0,0 +1,161 @@
+package userion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTenantTestUser creates the same "admin" user in the tenant of a scoped manager
+func createTenantTestUser(t *testing.T, userManager UserManager) *User {
+	user := &User{
+		Name:     "Admin",
+		Username: "admin",
+		Email:    "admin@example.com",
+		Password: "password123",
+		Phone:    "5550000",
+		Enabled:  true,
+		Status:   UserStatusActive,
+	}
+	require.NoError(t, userManager.CreateUser(user))
+	return user
+}
+
+// TestTenantUniqueness_Gorm tests that identifiers are unique per tenant only
+func TestTenantUniqueness_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	acme := userManager.(TenantScoper).ForTenant("acme")
+	globex := userManager.(TenantScoper).ForTenant("globex")
+
+	acmeAdmin := createTenantTestUser(t, acme)
+	globexAdmin := createTenantTestUser(t, globex)
+	assert.Equal(t, "acme", acmeAdmin.TenantID)
+	assert.Equal(t, "globex", globexAdmin.TenantID)
+	assert.NotEqual(t, acmeAdmin.ID, globexAdmin.ID)
+
+	err := acme.CreateUser(&User{Name: "Admin", Username: "admin", Email: "other@example.com", Phone: "5550001"})
+	assert.Equal(t, ErrUserAlreadyExists, err)
+
+	err = acme.CreateUser(&User{Name: "Other", Username: "other", Email: "other@example.com", Phone: "5550000"})
+	assert.Equal(t, ErrUserAlreadyExists, err, "Duplicate phone within a tenant should be rejected")
+
+	// Users without a phone number do not clash
+	for _, username := range []string{"first", "second"} {
+		err = acme.CreateUser(&User{Name: "No Phone", Username: username, Email: username + "@example.com"})
+		assert.NoError(t, err, "Users without a phone number should not clash")
+	}
+
+	// The unscoped manager creates users in the tenant they name
+	err = userManager.CreateUser(&User{TenantID: "initech", Name: "Admin", Username: "admin", Email: "admin@example.com", Phone: "5550000"})
+	assert.NoError(t, err)
+}
+
+// TestTenantScopedLookups_Gorm tests that a scoped manager only sees its own tenant
+func TestTenantScopedLookups_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	acme := userManager.(TenantScoper).ForTenant("acme")
+	globex := userManager.(TenantScoper).ForTenant("globex")
+
+	acmeAdmin := createTenantTestUser(t, acme)
+	globexAdmin := createTenantTestUser(t, globex)
+
+	found, err := acme.GetUserByUsername("admin")
+	require.NoError(t, err)
+	assert.Equal(t, acmeAdmin.ID, found.ID)
+	found, err = globex.GetUserByEmail("admin@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, globexAdmin.ID, found.ID)
+
+	_, err = acme.GetUserByID(globexAdmin.ID.String())
+	assert.Equal(t, ErrUserNotFound, err, "Users of other tenants should not be visible")
+	assert.Equal(t, ErrUserNotFound, acme.VerifyPasswordByID(globexAdmin.ID.String(), "password123"))
+	assert.NoError(t, acme.VerifyPasswordByUsername("admin", "password123"))
+
+	users, err := acme.ListUsers(10, 0, nil, "", false)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, acmeAdmin.ID, users[0].ID)
+
+	// The unscoped manager sees every tenant
+	users, err = userManager.ListUsers(10, 0, nil, "", false)
+	require.NoError(t, err)
+	assert.Len(t, users, 2)
+	users, err = userManager.ListUsers(10, 0, map[string]interface{}{"tenant_id": "globex"}, "", false)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, globexAdmin.ID, users[0].ID)
+}
+
+// TestTenantScopedMutations_Gorm tests that a scoped manager cannot modify other tenants
+func TestTenantScopedMutations_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	acme := userManager.(TenantScoper).ForTenant("acme")
+	globex := userManager.(TenantScoper).ForTenant("globex")
+
+	createTenantTestUser(t, acme)
+	globexAdmin := createTenantTestUser(t, globex)
+	globexID := globexAdmin.ID.String()
+
+	assert.Equal(t, ErrUserNotFound, acme.UpdateUserByID(globexID, map[string]interface{}{"Name": "Hijacked"}))
+	assert.Equal(t, ErrUserNotFound, acme.UpdateUserByID(globexID, map[string]interface{}{"Password": "newpassword123"}))
+	assert.Equal(t, ErrUserNotFound, acme.DisableUserByID(globexID))
+	assert.Equal(t, ErrUserNotFound, acme.SetUserStatusByID(globexID, UserStatusLocked))
+	assert.Equal(t, ErrUserNotFound, acme.DeleteUserByID(globexID))
+
+	found, err := globex.GetUserByID(globexID)
+	require.NoError(t, err)
+	assert.Equal(t, "Admin", found.Name)
+	assert.True(t, found.Enabled)
+	assert.Equal(t, UserStatusActive, found.Status)
+	assert.NoError(t, globex.VerifyPasswordByID(globexID, "password123"))
+
+	// Usernames are resolved within the tenant, so only acme's admin is deleted
+	assert.NoError(t, acme.DeleteUserByUsername("admin"))
+	_, err = globex.GetUserByUsername("admin")
+	assert.NoError(t, err)
+}
+
+// TestTenantGuards_Gorm tests that scoped managers refuse to cross tenants
+func TestTenantGuards_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	acme := userManager.(TenantScoper).ForTenant("acme")
+
+	err := acme.CreateUser(&User{TenantID: "globex", Name: "Admin", Username: "admin", Email: "admin@example.com", Phone: "5550000"})
+	assert.Equal(t, ErrCrossTenantAccess, err)
+
+	admin := createTenantTestUser(t, acme)
+	err = acme.UpdateUserByID(admin.ID.String(), map[string]interface{}{"TenantID": "globex"})
+	assert.Equal(t, ErrCrossTenantAccess, err)
+	err = acme.UpdateUserByID(admin.ID.String(), map[string]interface{}{"tenant_id": "globex"})
+	assert.Equal(t, ErrCrossTenantAccess, err)
+
+	// Moving a user is left to the unscoped manager
+	require.NoError(t, userManager.UpdateUserByID(admin.ID.String(), map[string]interface{}{"TenantID": "globex"}))
+	_, err = acme.GetUserByID(admin.ID.String())
+	assert.Equal(t, ErrUserNotFound, err)
+	moved, err := userManager.(TenantScoper).ForTenant("globex").GetUserByID(admin.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "globex", moved.TenantID)
+}
+
+// TestTenantPasswordReset_Gorm tests that reset requests are resolved within the tenant
+func TestTenantPasswordReset_Gorm(t *testing.T) {
+	userManager, _ := setupTestDBGorm(t)
+	acme := userManager.(TenantScoper).ForTenant("acme")
+	globex := userManager.(TenantScoper).ForTenant("globex")
+
+	createTenantTestUser(t, acme)
+	globexAdmin := createTenantTestUser(t, globex)
+
+	token, err := globex.RequestPasswordReset("admin@example.com")
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	// A token of another tenant is rejected and stays usable
+	assert.Equal(t, ErrUserNotFound, acme.ResetPassword(token, "newpassword123"))
+	require.NoError(t, globex.ResetPassword(token, "newpassword123"))
+
+	assert.NoError(t, globex.VerifyPasswordByID(globexAdmin.ID.String(), "newpassword123"))
+	assert.NoError(t, acme.VerifyPasswordByUsername("admin", "password123"))
+}
@@ -0,0 +1,52 @@
+package userion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrRefreshTokenReused is returned when a rotated refresh token is presented
+// again. The whole token family is revoked in response.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// AccessTokenUse is the token_use claim of access tokens issued by a
+// TokenService. It tells them apart from other JWTs signed with the same
+// keys, such as ID tokens and access tokens of the OpenID Connect provider.
+const AccessTokenUse = "access"
+
+// TokenPair is the result of a login or refresh
+type TokenPair struct {
+	AccessToken           string    `json:"access_token"`
+	RefreshToken          string    `json:"refresh_token"`
+	TokenType             string    `json:"token_type"`
+	ExpiresIn             int64     `json:"expires_in"` // Lifetime of the access token in seconds
+	AccessTokenExpiresAt  time.Time `json:"-"`
+	RefreshTokenExpiresAt time.Time `json:"-"`
+}
+
+// AccessTokenClaims are the verified claims of an access token
+type AccessTokenClaims struct {
+	ID        string     `json:"jti"`
+	UserID    uuid.UUID  `json:"sub"`
+	Username  string     `json:"username"`
+	Status    UserStatus `json:"status"`
+	Issuer    string     `json:"iss"`
+	Audience  string     `json:"aud,omitempty"`
+	IssuedAt  time.Time  `json:"iat"`
+	ExpiresAt time.Time  `json:"exp"`
+}
+
+// TokenService defines the interface for issuing stateless access tokens and
+// rotating refresh tokens
+type TokenService interface {
+	AutoMigrate() error
+	IssueTokens(userID string) (*TokenPair, error)
+	Refresh(refreshToken string) (*TokenPair, error)
+	VerifyAccessToken(accessToken string) (*AccessTokenClaims, error)
+	RevokeRefreshToken(refreshToken string) error
+	RevokeAllRefreshTokens(userID string) error
+	JWKS() *JWKSet
+	HandleEvent(event Event)
+}
@@ -0,0 +1,320 @@
+package userion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Default settings of GormTokenService
+const (
+	DefaultTokenIssuer     = "userion"
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// GormRefreshTokenModel represents a refresh token. Tokens descending from
+// the same login share a FamilyID so that replay can revoke all of them.
+type GormRefreshTokenModel struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	FamilyID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	TokenHash string    `gorm:"type:varchar(64);unique;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// GormTokenService is the GORM implementation of TokenService
+type GormTokenService struct {
+	db          *gorm.DB
+	tableName   string
+	userManager UserManager
+	keyRing     *KeyRing
+
+	issuer          string
+	audience        string
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+
+	now func() time.Time
+}
+
+// TokenServiceOption configures optional behaviour of a GormTokenService
+type TokenServiceOption func(*GormTokenService)
+
+// WithTokenIssuer sets the iss claim of access tokens
+func WithTokenIssuer(issuer string) TokenServiceOption {
+	return func(s *GormTokenService) {
+		s.issuer = issuer
+	}
+}
+
+// WithTokenAudience sets the aud claim of access tokens and requires it on verification
+func WithTokenAudience(audience string) TokenServiceOption {
+	return func(s *GormTokenService) {
+		s.audience = audience
+	}
+}
+
+// WithAccessTokenTTL sets the lifetime of access tokens
+func WithAccessTokenTTL(ttl time.Duration) TokenServiceOption {
+	return func(s *GormTokenService) {
+		s.accessTokenTTL = ttl
+	}
+}
+
+// WithRefreshTokenTTL sets the lifetime of refresh tokens
+func WithRefreshTokenTTL(ttl time.Duration) TokenServiceOption {
+	return func(s *GormTokenService) {
+		s.refreshTokenTTL = ttl
+	}
+}
+
+// NewGormTokenService initializes a new TokenService signing with the key ring
+func NewGormTokenService(db *gorm.DB, tableName string, userManager UserManager, keyRing *KeyRing, opts ...TokenServiceOption) TokenService {
+	s := &GormTokenService{
+		db:              db,
+		tableName:       tableName,
+		userManager:     userManager,
+		keyRing:         keyRing,
+		issuer:          DefaultTokenIssuer,
+		accessTokenTTL:  DefaultAccessTokenTTL,
+		refreshTokenTTL: DefaultRefreshTokenTTL,
+		now:             time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// AutoMigrate creates or updates the database schema for refresh tokens
+func (s *GormTokenService) AutoMigrate() error {
+	return s.db.Table(s.tableName).AutoMigrate(&GormRefreshTokenModel{})
+}
+
+// IssueTokens issues an access token and a new refresh token family for an
+// enabled user, typically right after the password has been verified
+func (s *GormTokenService) IssueTokens(userID string) (*TokenPair, error) {
+	user, err := s.userManager.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Enabled {
+		return nil, ErrUserDisabled
+	}
+
+	return s.issuePair(s.db, user, uuid.New())
+}
+
+// issuePair signs an access token and stores a refresh token in the family
+func (s *GormTokenService) issuePair(tx *gorm.DB, user *User, familyID uuid.UUID) (*TokenPair, error) {
+	now := s.now()
+	accessExpiresAt := now.Add(s.accessTokenTTL)
+
+	claims := map[string]interface{}{
+		"jti":       uuid.New().String(),
+		"sub":       user.ID.String(),
+		"username":  user.Username,
+		"status":    string(user.Status),
+		"iss":       s.issuer,
+		"iat":       now.Unix(),
+		"exp":       accessExpiresAt.Unix(),
+		"token_use": AccessTokenUse,
+	}
+	if s.audience != "" {
+		claims["aud"] = s.audience
+	}
+
+	accessToken, err := s.keyRing.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	record := &GormRefreshTokenModel{
+		ID:        uuid.New(),
+		FamilyID:  familyID,
+		UserID:    user.ID,
+		TokenHash: HashToken(refreshToken),
+		ExpiresAt: now.Add(s.refreshTokenTTL),
+		CreatedAt: now,
+	}
+	if err := tx.Table(s.tableName).Create(record).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:           accessToken,
+		RefreshToken:          refreshToken,
+		TokenType:             "Bearer",
+		ExpiresIn:             int64(s.accessTokenTTL / time.Second),
+		AccessTokenExpiresAt:  accessExpiresAt,
+		RefreshTokenExpiresAt: record.ExpiresAt,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented token
+// is rotated out; presenting it again revokes every token of its family.
+func (s *GormTokenService) Refresh(refreshToken string) (*TokenPair, error) {
+	var record GormRefreshTokenModel
+	if err := s.db.Table(s.tableName).Where("token_hash = ?", HashToken(refreshToken)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if record.RevokedAt != nil {
+		return nil, ErrInvalidToken
+	}
+	if record.UsedAt != nil {
+		return nil, s.revokeFamily(record.FamilyID, ErrRefreshTokenReused)
+	}
+
+	now := s.now()
+	if !now.Before(record.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+
+	user, err := s.userManager.GetUserByID(record.UserID.String())
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, s.revokeFamily(record.FamilyID, ErrInvalidToken)
+		}
+		return nil, err
+	}
+	if !user.Enabled {
+		return nil, s.revokeFamily(record.FamilyID, ErrUserDisabled)
+	}
+
+	var pair *TokenPair
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Rotate the token; losing this race means it was replayed concurrently
+		result := tx.Table(s.tableName).Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", record.ID).Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		pair, err = s.issuePair(tx, user, record.FamilyID)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		return nil, s.revokeFamily(record.FamilyID, ErrRefreshTokenReused)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// revokeFamily revokes all tokens of a family and returns reason, or the
+// database error if revocation failed
+func (s *GormTokenService) revokeFamily(familyID uuid.UUID, reason error) error {
+	err := s.db.Table(s.tableName).Where("family_id = ? AND revoked_at IS NULL", familyID).Update("revoked_at", s.now()).Error
+	if err != nil {
+		return err
+	}
+	return reason
+}
+
+// VerifyAccessToken checks the signature, expiry, issuer and audience of an
+// access token and returns its claims. Other JWTs signed with the same key
+// ring are rejected: the token_use claim must be AccessTokenUse, and tokens
+// issued to OAuth clients, which carry client_id or azp, are never accepted.
+func (s *GormTokenService) VerifyAccessToken(accessToken string) (*AccessTokenClaims, error) {
+	claims, err := VerifyJWT(accessToken, s.keyRing, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	if use, _ := claims["token_use"].(string); use != AccessTokenUse {
+		return nil, ErrInvalidToken
+	}
+	if _, ok := claims["client_id"]; ok {
+		return nil, ErrInvalidToken
+	}
+	if _, ok := claims["azp"]; ok {
+		return nil, ErrInvalidToken
+	}
+	if issuer, _ := claims["iss"].(string); issuer != s.issuer {
+		return nil, ErrInvalidToken
+	}
+	if s.audience != "" {
+		if !AudienceClaim(claims, s.audience) {
+			return nil, ErrInvalidToken
+		}
+	} else if _, ok := claims["aud"]; ok {
+		// Tokens meant for a particular audience are not meant for this service
+		return nil, ErrInvalidToken
+	}
+
+	subject, _ := claims["sub"].(string)
+	userID, err := uuid.Parse(subject)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	result := &AccessTokenClaims{
+		UserID: userID,
+		Issuer: s.issuer,
+	}
+	result.ID, _ = claims["jti"].(string)
+	result.Username, _ = claims["username"].(string)
+	result.Audience, _ = claims["aud"].(string)
+	if status, ok := claims["status"].(string); ok {
+		result.Status = UserStatus(status)
+	}
+	result.IssuedAt, _ = NumericDateClaim(claims, "iat")
+	result.ExpiresAt, _ = NumericDateClaim(claims, "exp")
+
+	return result, nil
+}
+
+// RevokeRefreshToken revokes the family of a refresh token, e.g. on logout
+func (s *GormTokenService) RevokeRefreshToken(refreshToken string) error {
+	var record GormRefreshTokenModel
+	if err := s.db.Table(s.tableName).Select("family_id").Where("token_hash = ?", HashToken(refreshToken)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+
+	return s.revokeFamily(record.FamilyID, nil)
+}
+
+// RevokeAllRefreshTokens revokes every refresh token of a user
+func (s *GormTokenService) RevokeAllRefreshTokens(userID string) error {
+	return s.db.Table(s.tableName).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", s.now()).Error
+}
+
+// JWKS returns the public keys verifiers need to check access tokens
+func (s *GormTokenService) JWKS() *JWKSet {
+	return s.keyRing.JWKS()
+}
+
+// HandleEvent revokes the refresh tokens of a user whose password changed or
+// who was disabled. Register it with WithEventHandler.
+func (s *GormTokenService) HandleEvent(event Event) {
+	switch event.Type {
+	case EventPasswordChanged, EventPasswordReset, EventUserDisabled:
+		// Errors cannot be reported back to the emitting manager
+		_ = s.RevokeAllRefreshTokens(event.UserID.String())
+	}
+}
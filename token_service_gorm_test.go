@@ -0,0 +1,176 @@
+package userion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupTokenServiceGorm creates a TokenService wired to a UserManager through events
+func setupTokenServiceGorm(t *testing.T, opts ...TokenServiceOption) (*GormTokenService, UserManager, *gorm.DB) {
+	userManager, db := setupTestDBGorm(t)
+
+	key, err := GenerateSigningKey(AlgorithmEdDSA)
+	require.NoError(t, err, "Failed to generate signing key")
+
+	tableName := "refresh_tokens_test_" + uuid.New().String()[:8]
+	tokenService := NewGormTokenService(db, tableName, userManager, NewKeyRing(key), opts...).(*GormTokenService)
+	err = tokenService.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	m := userManager.(*GormUserManager)
+	m.eventHandlers = append(m.eventHandlers, tokenService.HandleEvent)
+
+	return tokenService, userManager, db
+}
+
+// TestIssueTokens_Gorm tests issuing and verifying access tokens
+func TestIssueTokens_Gorm(t *testing.T) {
+	tokenService, userManager, db := setupTokenServiceGorm(t, WithTokenIssuer("https://auth.example.com"), WithTokenAudience("api"))
+	user := createTestUser(t, userManager)
+
+	pair, err := tokenService.IssueTokens(user.ID.String())
+	assert.NoError(t, err, "IssueTokens should not error with valid user ID")
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.Equal(t, int64(DefaultAccessTokenTTL/time.Second), pair.ExpiresIn)
+
+	// Verify only the refresh token hash is stored
+	var count int64
+	db.Table(tokenService.tableName).Where("token_hash = ?", HashToken(pair.RefreshToken)).Count(&count)
+	assert.Equal(t, int64(1), count, "Refresh token hash should be stored")
+
+	claims, err := tokenService.VerifyAccessToken(pair.AccessToken)
+	assert.NoError(t, err, "VerifyAccessToken should not error with valid token")
+	assert.Equal(t, user.ID, claims.UserID)
+	assert.Equal(t, user.Username, claims.Username)
+	assert.Equal(t, user.Status, claims.Status)
+	assert.Equal(t, "https://auth.example.com", claims.Issuer)
+	assert.Equal(t, "api", claims.Audience)
+
+	// Tokens of another issuer are rejected even with the same keys
+	other := NewGormTokenService(db, tokenService.tableName, userManager, tokenService.keyRing)
+	_, err = other.VerifyAccessToken(pair.AccessToken)
+	assert.Equal(t, ErrInvalidToken, err, "VerifyAccessToken should reject a foreign issuer")
+
+	tokenService.now = func() time.Time { return time.Now().Add(DefaultAccessTokenTTL) }
+	_, err = tokenService.VerifyAccessToken(pair.AccessToken)
+	assert.Equal(t, ErrTokenExpired, err, "VerifyAccessToken should reject an expired token")
+
+	// Disabled users cannot obtain tokens
+	require.NoError(t, userManager.DisableUserByID(user.ID.String()))
+	_, err = tokenService.IssueTokens(user.ID.String())
+	assert.Equal(t, ErrUserDisabled, err, "IssueTokens should reject a disabled user")
+}
+
+// TestVerifyAccessToken_ForeignTokens_Gorm tests that other JWTs signed with
+// the same key ring are not accepted as access tokens
+func TestVerifyAccessToken_ForeignTokens_Gorm(t *testing.T) {
+	tokenService, userManager, _ := setupTokenServiceGorm(t)
+	user := createTestUser(t, userManager)
+
+	now := time.Now()
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": user.ID.String(),
+			"iss": DefaultTokenIssuer,
+			"iat": now.Unix(),
+			"exp": now.Add(time.Minute).Unix(),
+		}
+		for key, value := range extra {
+			c[key] = value
+		}
+		return c
+	}
+
+	for name, c := range map[string]map[string]interface{}{
+		"ID token":                 claims(map[string]interface{}{"aud": "client-1", "azp": "client-1"}),
+		"client access token":      claims(map[string]interface{}{"aud": DefaultTokenIssuer, "client_id": "client-1", "scope": "openid"}),
+		"typed client token":       claims(map[string]interface{}{"token_use": AccessTokenUse, "client_id": "client-1"}),
+		"token with audience":      claims(map[string]interface{}{"token_use": AccessTokenUse, "aud": "other-api"}),
+		"token without expiry":     {"sub": user.ID.String(), "iss": DefaultTokenIssuer, "token_use": AccessTokenUse},
+		"token with another usage": claims(map[string]interface{}{"token_use": "id"}),
+	} {
+		token, err := tokenService.keyRing.Sign(c)
+		require.NoError(t, err)
+		_, err = tokenService.VerifyAccessToken(token)
+		assert.Equal(t, ErrInvalidToken, err, "VerifyAccessToken should reject a %s", name)
+	}
+
+	// Genuine access tokens still verify
+	pair, err := tokenService.IssueTokens(user.ID.String())
+	require.NoError(t, err)
+	_, err = tokenService.VerifyAccessToken(pair.AccessToken)
+	assert.NoError(t, err)
+}
+
+// TestRefreshTokenRotation_Gorm tests rotation and reuse detection
+func TestRefreshTokenRotation_Gorm(t *testing.T) {
+	tokenService, userManager, _ := setupTokenServiceGorm(t)
+	user := createTestUser(t, userManager)
+
+	first, err := tokenService.IssueTokens(user.ID.String())
+	require.NoError(t, err)
+
+	second, err := tokenService.Refresh(first.RefreshToken)
+	assert.NoError(t, err, "Refresh should not error with valid token")
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken, "Refresh should rotate the refresh token")
+
+	third, err := tokenService.Refresh(second.RefreshToken)
+	require.NoError(t, err)
+
+	// Replaying a rotated token revokes the whole family
+	_, err = tokenService.Refresh(first.RefreshToken)
+	assert.Equal(t, ErrRefreshTokenReused, err, "Refresh should detect reuse")
+	_, err = tokenService.Refresh(third.RefreshToken)
+	assert.Equal(t, ErrInvalidToken, err, "The latest token of the family should be revoked")
+
+	// Other families are unaffected
+	other, err := tokenService.IssueTokens(user.ID.String())
+	require.NoError(t, err)
+	_, err = tokenService.Refresh(other.RefreshToken)
+	assert.NoError(t, err, "Other families should survive reuse detection")
+
+	_, err = tokenService.Refresh("unknown-token")
+	assert.Equal(t, ErrInvalidToken, err, "Refresh should reject an unknown token")
+
+	// Expired refresh tokens
+	pair, err := tokenService.IssueTokens(user.ID.String())
+	require.NoError(t, err)
+	tokenService.now = func() time.Time { return time.Now().Add(DefaultRefreshTokenTTL) }
+	_, err = tokenService.Refresh(pair.RefreshToken)
+	assert.Equal(t, ErrTokenExpired, err, "Refresh should reject an expired token")
+}
+
+// TestRevokeRefreshTokens_Gorm tests logout and automatic revocation on user events
+func TestRevokeRefreshTokens_Gorm(t *testing.T) {
+	tokenService, userManager, _ := setupTokenServiceGorm(t)
+	user := createTestUser(t, userManager)
+
+	pair, err := tokenService.IssueTokens(user.ID.String())
+	require.NoError(t, err)
+	err = tokenService.RevokeRefreshToken(pair.RefreshToken)
+	assert.NoError(t, err, "RevokeRefreshToken should not error with valid token")
+	_, err = tokenService.Refresh(pair.RefreshToken)
+	assert.Equal(t, ErrInvalidToken, err, "Revoked token should be rejected")
+	assert.Equal(t, ErrInvalidToken, tokenService.RevokeRefreshToken("unknown-token"))
+
+	// Password change
+	pair, err = tokenService.IssueTokens(user.ID.String())
+	require.NoError(t, err)
+	err = userManager.UpdateUserByID(user.ID.String(), map[string]interface{}{"Password": "changed-password"})
+	require.NoError(t, err)
+	_, err = tokenService.Refresh(pair.RefreshToken)
+	assert.Equal(t, ErrInvalidToken, err, "Refresh tokens should be revoked after a password change")
+
+	// Disabling the user
+	pair, err = tokenService.IssueTokens(user.ID.String())
+	require.NoError(t, err)
+	err = userManager.DisableUserByID(user.ID.String())
+	require.NoError(t, err)
+	_, err = tokenService.Refresh(pair.RefreshToken)
+	assert.Equal(t, ErrInvalidToken, err, "Refresh tokens should be revoked when the user is disabled")
+}
@@ -0,0 +1,111 @@
+package userion
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default TOTP parameters, understood by all common authenticator apps
+const (
+	DefaultTOTPDigits     = 6
+	DefaultTOTPPeriod     = 30 * time.Second
+	DefaultTOTPSkew       = 1
+	DefaultTOTPSecretSize = 20
+)
+
+// totpEncoding is the unpadded base32 alphabet used for TOTP secrets
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret creates a random base32 encoded TOTP secret
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, DefaultTOTPSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// decodeTOTPSecret accepts secrets with or without padding, spaces and lower case letters
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return totpEncoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// TOTPStep returns the RFC 6238 time step of t
+func TOTPStep(t time.Time, period time.Duration) int64 {
+	return t.Unix() / int64(period/time.Second)
+}
+
+// TOTPCodeAt computes the HOTP value (RFC 4226) of a base32 secret for a time step
+func TOTPCodeAt(secret string, step int64, digits int) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", ErrInvalidCode
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%modulo), nil
+}
+
+// MatchTOTP looks for code within skew steps around t and returns the
+// matching step. The caller must reject steps that were already used.
+func MatchTOTP(secret, code string, t time.Time, period time.Duration, digits, skew int) (int64, bool) {
+	if len(code) != digits {
+		return 0, false
+	}
+
+	current := TOTPStep(t, period)
+	for delta := -skew; delta <= skew; delta++ {
+		expected, err := TOTPCodeAt(secret, current+int64(delta), digits)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return current + int64(delta), true
+		}
+	}
+
+	return 0, false
+}
+
+// TOTPURI builds the otpauth:// URI encoded into enrollment QR codes
+func TOTPURI(issuer, accountName, secret string, period time.Duration, digits int) string {
+	label := accountName
+	if issuer != "" {
+		label = issuer + ":" + accountName
+	}
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	if issuer != "" {
+		query.Set("issuer", issuer)
+	}
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(digits))
+	query.Set("period", strconv.Itoa(int(period/time.Second)))
+
+	return "otpauth://totp/" + url.PathEscape(label) + "?" + query.Encode()
+}
@@ -0,0 +1,282 @@
+package userion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Default settings of GormTOTPManager
+const (
+	DefaultTOTPMaxAttempts = 5
+	DefaultTOTPLockout     = 15 * time.Minute
+)
+
+// GormTOTPModel represents the authenticator of a user. The secret is stored
+// encrypted; enrollment is pending until ConfirmedAt is set.
+type GormTOTPModel struct {
+	UserID         uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	Secret         []byte    `gorm:"not null"`
+	ConfirmedAt    *time.Time
+	LastUsedStep   int64 `gorm:"not null;default:0"`
+	FailedAttempts int   `gorm:"not null;default:0"`
+	LockedUntil    *time.Time
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+}
+
+// GormTOTPManager is the GORM implementation of TOTPManager
+type GormTOTPManager struct {
+	db        *gorm.DB
+	tableName string
+	cipher    SecretCipher
+
+	issuer      string
+	digits      int
+	period      time.Duration
+	skew        int
+	maxAttempts int
+	lockout     time.Duration
+
+	now func() time.Time
+}
+
+// TOTPOption configures optional behaviour of a GormTOTPManager
+type TOTPOption func(*GormTOTPManager)
+
+// WithTOTPIssuer sets the issuer shown in authenticator apps
+func WithTOTPIssuer(issuer string) TOTPOption {
+	return func(m *GormTOTPManager) {
+		m.issuer = issuer
+	}
+}
+
+// WithTOTPDigits sets the number of digits of codes
+func WithTOTPDigits(digits int) TOTPOption {
+	return func(m *GormTOTPManager) {
+		m.digits = digits
+	}
+}
+
+// WithTOTPPeriod sets how long each code is valid
+func WithTOTPPeriod(period time.Duration) TOTPOption {
+	return func(m *GormTOTPManager) {
+		m.period = period
+	}
+}
+
+// WithTOTPSkew sets how many periods before and after the current one are
+// accepted to tolerate clock drift
+func WithTOTPSkew(steps int) TOTPOption {
+	return func(m *GormTOTPManager) {
+		m.skew = steps
+	}
+}
+
+// WithTOTPLockout sets how many wrong codes lock verification and for how long
+func WithTOTPLockout(maxAttempts int, lockout time.Duration) TOTPOption {
+	return func(m *GormTOTPManager) {
+		m.maxAttempts = maxAttempts
+		m.lockout = lockout
+	}
+}
+
+// NewGormTOTPManager initializes a new TOTPManager encrypting secrets with the cipher
+func NewGormTOTPManager(db *gorm.DB, tableName string, cipher SecretCipher, opts ...TOTPOption) TOTPManager {
+	m := &GormTOTPManager{
+		db:          db,
+		tableName:   tableName,
+		cipher:      cipher,
+		digits:      DefaultTOTPDigits,
+		period:      DefaultTOTPPeriod,
+		skew:        DefaultTOTPSkew,
+		maxAttempts: DefaultTOTPMaxAttempts,
+		lockout:     DefaultTOTPLockout,
+		now:         time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// AutoMigrate creates or updates the database schema for authenticators
+func (m *GormTOTPManager) AutoMigrate() error {
+	return m.db.Table(m.tableName).AutoMigrate(&GormTOTPModel{})
+}
+
+// BeginTOTPEnrollment generates a new secret for the user. The authenticator
+// is not active until ConfirmTOTPEnrollment succeeds; beginning again replaces
+// a pending secret.
+func (m *GormTOTPManager) BeginTOTPEnrollment(userID, accountName string) (*TOTPEnrollment, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	var existing GormTOTPModel
+	err = m.db.Table(m.tableName).Where("user_id = ?", id).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil && existing.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnrolled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := m.cipher.Encrypt([]byte(secret), []byte(id.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(m.tableName).Where("user_id = ? AND confirmed_at IS NULL", id).Delete(&GormTOTPModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(m.tableName).Create(&GormTOTPModel{
+			UserID: id,
+			Secret: encrypted,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    TOTPURI(m.issuer, accountName, secret, m.period, m.digits),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment activates a pending authenticator once the user
+// proves it produces valid codes
+func (m *GormTOTPManager) ConfirmTOTPEnrollment(userID, code string) error {
+	record, err := m.getTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if record.ConfirmedAt != nil {
+		return ErrMFAAlreadyEnrolled
+	}
+
+	step, err := m.matchCode(record, code)
+	if err != nil {
+		return err
+	}
+
+	result := m.db.Table(m.tableName).Where("user_id = ? AND confirmed_at IS NULL", record.UserID).Updates(map[string]interface{}{
+		"confirmed_at":    m.now(),
+		"last_used_step":  step,
+		"failed_attempts": 0,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMFAAlreadyEnrolled
+	}
+
+	return nil
+}
+
+// VerifyTOTP checks a code of an enrolled user. Each code is accepted only
+// once, and repeated failures lock verification for a while.
+func (m *GormTOTPManager) VerifyTOTP(userID, code string) error {
+	record, err := m.getTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if record.ConfirmedAt == nil {
+		return ErrMFANotEnrolled
+	}
+
+	step, err := m.matchCode(record, code)
+	if err != nil {
+		return err
+	}
+
+	// Moving last_used_step forward atomically rejects replays, including
+	// concurrent ones and codes older than the last accepted one
+	result := m.db.Table(m.tableName).Where("user_id = ? AND last_used_step < ?", record.UserID, step).Updates(map[string]interface{}{
+		"last_used_step":  step,
+		"failed_attempts": 0,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+
+	return nil
+}
+
+// matchCode validates a code against the record's secret, counting failures
+func (m *GormTOTPManager) matchCode(record *GormTOTPModel, code string) (int64, error) {
+	now := m.now()
+	if record.LockedUntil != nil && now.Before(*record.LockedUntil) {
+		return 0, ErrTooManyAttempts
+	}
+
+	secret, err := m.cipher.Decrypt(record.Secret, []byte(record.UserID.String()))
+	if err != nil {
+		return 0, err
+	}
+
+	step, ok := MatchTOTP(string(secret), code, now, m.period, m.digits, m.skew)
+	if ok {
+		return step, nil
+	}
+
+	updates := map[string]interface{}{
+		"failed_attempts": gorm.Expr("failed_attempts + 1"),
+	}
+	if m.maxAttempts > 0 && record.FailedAttempts+1 >= m.maxAttempts {
+		updates["failed_attempts"] = 0
+		updates["locked_until"] = now.Add(m.lockout)
+	}
+	if err := m.db.Table(m.tableName).Where("user_id = ?", record.UserID).Updates(updates).Error; err != nil {
+		return 0, err
+	}
+
+	return 0, ErrInvalidCode
+}
+
+// DisableTOTP removes the authenticator of a user, confirmed or pending
+func (m *GormTOTPManager) DisableTOTP(userID string) error {
+	result := m.db.Table(m.tableName).Where("user_id = ?", userID).Delete(&GormTOTPModel{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMFANotEnrolled
+	}
+	return nil
+}
+
+// MFAEnabled reports whether the user has a confirmed authenticator, implementing MFAChecker
+func (m *GormTOTPManager) MFAEnabled(userID string) (bool, error) {
+	var count int64
+	err := m.db.Table(m.tableName).Where("user_id = ? AND confirmed_at IS NOT NULL", userID).Count(&count).Error
+	return count > 0, err
+}
+
+// getTOTP loads the authenticator of a user
+func (m *GormTOTPManager) getTOTP(userID string) (*GormTOTPModel, error) {
+	var record GormTOTPModel
+	if err := m.db.Table(m.tableName).Where("user_id = ?", userID).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, err
+	}
+	return &record, nil
+}
@@ -0,0 +1,115 @@
+package userion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupTOTPManagerGorm creates a TOTPManager registered as the MFA checker of a UserManager
+func setupTOTPManagerGorm(t *testing.T) (*GormTOTPManager, UserManager, *gorm.DB) {
+	userManager, db := setupTestDBGorm(t)
+
+	cipher, err := NewAESGCMCipher(make([]byte, 32))
+	require.NoError(t, err)
+
+	tableName := "totp_test_" + uuid.New().String()[:8]
+	totpManager := NewGormTOTPManager(db, tableName, cipher, WithTOTPIssuer("Userion")).(*GormTOTPManager)
+	err = totpManager.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	userManager.(*GormUserManager).mfaChecker = totpManager
+
+	return totpManager, userManager, db
+}
+
+// totpCode returns the code of a secret for a time
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	code, err := TOTPCodeAt(secret, TOTPStep(at, DefaultTOTPPeriod), DefaultTOTPDigits)
+	require.NoError(t, err)
+	return code
+}
+
+// TestTOTPEnrollment_Gorm tests enrollment and the MFA required login result
+func TestTOTPEnrollment_Gorm(t *testing.T) {
+	totpManager, userManager, db := setupTOTPManagerGorm(t)
+	user := createTestUser(t, userManager)
+	now := time.Now()
+	totpManager.now = func() time.Time { return now }
+
+	enrollment, err := totpManager.BeginTOTPEnrollment(user.ID.String(), user.Email)
+	assert.NoError(t, err, "BeginTOTPEnrollment should not error with valid user ID")
+	assert.Contains(t, enrollment.URI, "otpauth://totp/Userion:")
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	// The secret is encrypted at rest
+	var record GormTOTPModel
+	require.NoError(t, db.Table(totpManager.tableName).Where("user_id = ?", user.ID).First(&record).Error)
+	assert.NotContains(t, string(record.Secret), enrollment.Secret, "Secret should be encrypted")
+
+	// Pending enrollments do not require MFA
+	assert.NoError(t, userManager.VerifyPasswordByUsername(user.Username, "password123"))
+	assert.Equal(t, ErrMFANotEnrolled, totpManager.VerifyTOTP(user.ID.String(), totpCode(t, enrollment.Secret, now)))
+
+	assert.Equal(t, ErrInvalidCode, totpManager.ConfirmTOTPEnrollment(user.ID.String(), "000000"))
+	err = totpManager.ConfirmTOTPEnrollment(user.ID.String(), totpCode(t, enrollment.Secret, now))
+	assert.NoError(t, err, "ConfirmTOTPEnrollment should accept a valid code")
+
+	_, err = totpManager.BeginTOTPEnrollment(user.ID.String(), user.Email)
+	assert.Equal(t, ErrMFAAlreadyEnrolled, err, "Enrolling twice should error")
+
+	// A correct password now requires the second factor
+	err = userManager.VerifyPasswordByUsername(user.Username, "password123")
+	assert.Equal(t, ErrMFARequired, err, "Enrolled users should be asked for MFA")
+	err = userManager.VerifyPasswordByUsername(user.Username, "wrong-password")
+	assert.Equal(t, ErrInvalidPassword, err, "Wrong passwords should still be rejected first")
+
+	// Disabling removes the requirement
+	assert.NoError(t, totpManager.DisableTOTP(user.ID.String()))
+	assert.NoError(t, userManager.VerifyPasswordByUsername(user.Username, "password123"))
+	assert.Equal(t, ErrMFANotEnrolled, totpManager.DisableTOTP(user.ID.String()))
+}
+
+// TestVerifyTOTP_Gorm tests the skew window, replay prevention and lockout
+func TestVerifyTOTP_Gorm(t *testing.T) {
+	totpManager, userManager, _ := setupTOTPManagerGorm(t)
+	user := createTestUser(t, userManager)
+	now := time.Now()
+	totpManager.now = func() time.Time { return now }
+
+	enrollment, err := totpManager.BeginTOTPEnrollment(user.ID.String(), user.Email)
+	require.NoError(t, err)
+	require.NoError(t, totpManager.ConfirmTOTPEnrollment(user.ID.String(), totpCode(t, enrollment.Secret, now)))
+
+	// The enrollment code cannot be used again
+	err = totpManager.VerifyTOTP(user.ID.String(), totpCode(t, enrollment.Secret, now))
+	assert.Equal(t, ErrInvalidCode, err, "Codes should not be accepted twice")
+
+	// The next code is accepted from a slightly slow clock
+	next := now.Add(DefaultTOTPPeriod)
+	err = totpManager.VerifyTOTP(user.ID.String(), totpCode(t, enrollment.Secret, next))
+	assert.NoError(t, err, "Codes within the skew window should be accepted")
+	err = totpManager.VerifyTOTP(user.ID.String(), totpCode(t, enrollment.Secret, next))
+	assert.Equal(t, ErrInvalidCode, err, "Replayed codes should be rejected")
+
+	// Codes far outside the window are rejected
+	err = totpManager.VerifyTOTP(user.ID.String(), totpCode(t, enrollment.Secret, now.Add(10*DefaultTOTPPeriod)))
+	assert.Equal(t, ErrInvalidCode, err, "Codes outside the skew window should be rejected")
+
+	// Repeated failures lock verification; the code above was the first one
+	for i := 1; i < DefaultTOTPMaxAttempts; i++ {
+		require.Equal(t, ErrInvalidCode, totpManager.VerifyTOTP(user.ID.String(), "000000"))
+	}
+	later := now.Add(2 * DefaultTOTPPeriod)
+	totpManager.now = func() time.Time { return later }
+	err = totpManager.VerifyTOTP(user.ID.String(), totpCode(t, enrollment.Secret, later))
+	assert.Equal(t, ErrTooManyAttempts, err, "Verification should be locked after too many failures")
+
+	later = later.Add(DefaultTOTPLockout)
+	err = totpManager.VerifyTOTP(user.ID.String(), totpCode(t, enrollment.Secret, later))
+	assert.NoError(t, err, "Verification should unlock after the lockout")
+}
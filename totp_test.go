@@ -0,0 +1,80 @@
+package userion
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc6238Secret is the SHA1 test key of RFC 6238 Appendix B in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestTOTPCodeAt tests code generation against the RFC 6238 test vectors
+func TestTOTPCodeAt(t *testing.T) {
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+
+	for unix, expected := range vectors {
+		step := TOTPStep(time.Unix(unix, 0), DefaultTOTPPeriod)
+		code, err := TOTPCodeAt(rfc6238Secret, step, 8)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, "Code at %d should match RFC 6238", unix)
+	}
+
+	_, err := TOTPCodeAt("not base32!", 1, 6)
+	assert.Equal(t, ErrInvalidCode, err, "TOTPCodeAt should reject an invalid secret")
+}
+
+// TestMatchTOTP tests the clock-skew window
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	current := TOTPStep(now, DefaultTOTPPeriod)
+
+	previous, err := TOTPCodeAt(rfc6238Secret, current-1, 6)
+	require.NoError(t, err)
+
+	step, ok := MatchTOTP(rfc6238Secret, previous, now, DefaultTOTPPeriod, 6, 1)
+	assert.True(t, ok, "Codes within the skew window should match")
+	assert.Equal(t, current-1, step)
+
+	_, ok = MatchTOTP(rfc6238Secret, previous, now, DefaultTOTPPeriod, 6, 0)
+	assert.False(t, ok, "Codes outside the skew window should not match")
+
+	_, ok = MatchTOTP(strings.ToLower(rfc6238Secret), previous, now, DefaultTOTPPeriod, 6, 1)
+	assert.True(t, ok, "Lower case secrets should be accepted")
+}
+
+// TestTOTPURI tests the otpauth:// URI
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Example Co", "john@example.com", rfc6238Secret, DefaultTOTPPeriod, DefaultTOTPDigits)
+	assert.Equal(t, "otpauth://totp/Example%20Co:john@example.com?algorithm=SHA1&digits=6&issuer=Example+Co&period=30&secret="+rfc6238Secret, uri)
+}
+
+// TestAESGCMCipher tests encryption of secrets
+func TestAESGCMCipher(t *testing.T) {
+	c, err := NewAESGCMCipher(make([]byte, 32))
+	require.NoError(t, err)
+
+	ciphertext, err := c.Encrypt([]byte("secret"), []byte("user-1"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "secret", "Ciphertext should not contain the plaintext")
+
+	plaintext, err := c.Decrypt(ciphertext, []byte("user-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	_, err = c.Decrypt(ciphertext, []byte("user-2"))
+	assert.Equal(t, ErrDecryptionFailed, err, "Decrypt should fail for another owner")
+
+	_, err = NewAESGCMCipher([]byte("short"))
+	assert.Error(t, err, "NewAESGCMCipher should reject invalid key sizes")
+}
@@ -1,8 +1,10 @@
 package userion
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,16 +15,23 @@ import (
 // GormUserModel represents the GORM-specific database model for users
 type GormUserModel struct {
 	ID        uuid.UUID      `gorm:"type:uuid;primaryKey;"`
+	TenantID  string         `gorm:"type:varchar(64);not null;default:''"`
 	Name      string         `gorm:"not null"`
-	Username  string         `gorm:"unique;not null"`
-	Email     string         `gorm:"unique;not null"`
+	Username  string         `gorm:"not null"` // Unique per tenant, see migrateTenantIndexes
+	Email     string         `gorm:"not null"` // Unique per tenant
 	Password  string         `gorm:"not null"`
 	Salt      string         `gorm:"not null"`
-	Phone     string         `gorm:"unique;not null"`
+	Phone     string         `gorm:"not null"` // Unique per tenant
 	CreatedAt time.Time      `gorm:"autoCreateTime"`
 	Enabled   bool           `gorm:"not null;default:true"`
 	Status    UserStatus     `gorm:"type:varchar(10);not null;default:'inactive'"`
 	Data      datatypes.JSON `gorm:"type:json;default:'{}'"` // JSON data for custom extensions
+
+	EmailVerifiedAt *time.Time
+	PhoneVerifiedAt *time.Time
+
+	PasswordChangedAt  *time.Time
+	MustChangePassword bool `gorm:"not null;default:false"`
 }
 
 // ToUser converts a GormUserModel to a User business model
@@ -39,6 +48,7 @@ func (g *GormUserModel) ToUser() *User {
 
 	return &User{
 		ID:        g.ID,
+		TenantID:  g.TenantID,
 		Name:      g.Name,
 		Username:  g.Username,
 		Email:     g.Email,
@@ -49,6 +59,12 @@ func (g *GormUserModel) ToUser() *User {
 		Enabled:   g.Enabled,
 		Status:    g.Status,
 		Data:      data,
+
+		EmailVerifiedAt: g.EmailVerifiedAt,
+		PhoneVerifiedAt: g.PhoneVerifiedAt,
+
+		PasswordChangedAt:  g.PasswordChangedAt,
+		MustChangePassword: g.MustChangePassword,
 	}
 }
 
@@ -70,6 +86,7 @@ func NewGormUserModelFromUser(user *User) *GormUserModel {
 
 	return &GormUserModel{
 		ID:        user.ID,
+		TenantID:  user.TenantID,
 		Name:      user.Name,
 		Username:  user.Username,
 		Email:     user.Email,
@@ -80,89 +97,308 @@ func NewGormUserModelFromUser(user *User) *GormUserModel {
 		Enabled:   user.Enabled,
 		Status:    user.Status,
 		Data:      jsonData,
+
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		PhoneVerifiedAt: user.PhoneVerifiedAt,
+
+		PasswordChangedAt:  user.PasswordChangedAt,
+		MustChangePassword: user.MustChangePassword,
 	}
 }
 
+// Default lifetimes of tokens issued by GormUserManager
+const (
+	DefaultEmailVerificationTTL = 24 * time.Hour
+	DefaultPasswordResetTTL     = time.Hour
+)
+
 // GormUserManager is the concrete implementation using GORM
 type GormUserManager struct {
 	db        *gorm.DB
 	tableName string
+
+	// Set on managers returned by ForTenant
+	tenantID     string
+	tenantScoped bool
+
+	emailVerificationTTL   time.Duration
+	activateOnEmailConfirm bool
+	passwordResetTTL       time.Duration
+	eventHandlers          []EventHandler
+	passwordPolicy         *PasswordPolicy
+	breachChecker          BreachedPasswordChecker
+	mfaChecker             MFAChecker
+	groupResolver          GroupResolver
+
+	now func() time.Time
+}
+
+// GormUserManagerOption configures optional behaviour of a GormUserManager
+type GormUserManagerOption func(*GormUserManager)
+
+// WithEmailVerificationTTL sets how long email verification tokens stay valid
+func WithEmailVerificationTTL(ttl time.Duration) GormUserManagerOption {
+	return func(m *GormUserManager) {
+		m.emailVerificationTTL = ttl
+	}
+}
+
+// WithActivateOnEmailConfirm controls whether confirming the email of an
+// inactive user moves it to UserStatusActive (enabled by default)
+func WithActivateOnEmailConfirm(activate bool) GormUserManagerOption {
+	return func(m *GormUserManager) {
+		m.activateOnEmailConfirm = activate
+	}
+}
+
+// WithPasswordResetTTL sets how long password reset tokens stay valid
+func WithPasswordResetTTL(ttl time.Duration) GormUserManagerOption {
+	return func(m *GormUserManager) {
+		m.passwordResetTTL = ttl
+	}
+}
+
+// WithEventHandler registers a handler for events emitted by the manager
+func WithEventHandler(handler EventHandler) GormUserManagerOption {
+	return func(m *GormUserManager) {
+		m.eventHandlers = append(m.eventHandlers, handler)
+	}
+}
+
+// WithPasswordPolicy enforces a password policy whenever a password is set
+func WithPasswordPolicy(policy *PasswordPolicy) GormUserManagerOption {
+	return func(m *GormUserManager) {
+		m.passwordPolicy = policy
+	}
+}
+
+// WithBreachedPasswordChecker rejects new passwords found in known breaches
+func WithBreachedPasswordChecker(checker BreachedPasswordChecker) GormUserManagerOption {
+	return func(m *GormUserManager) {
+		m.breachChecker = checker
+	}
+}
+
+// WithMFAChecker makes password verification return ErrMFARequired for users
+// enrolled in a second factor, such as a TOTPManager
+func WithMFAChecker(checker MFAChecker) GormUserManagerOption {
+	return func(m *GormUserManager) {
+		m.mfaChecker = checker
+	}
+}
+
+// WithGroupResolver enables the FilterGroup filter of ListUsers, e.g. with a GroupManager
+func WithGroupResolver(resolver GroupResolver) GormUserManagerOption {
+	return func(m *GormUserManager) {
+		m.groupResolver = resolver
+	}
 }
 
 // NewGormUserManager initializes a new UserManager
-func NewGormUserManager(db *gorm.DB, tableName string) UserManager {
-	return &GormUserManager{
-		db:        db,
-		tableName: tableName,
+func NewGormUserManager(db *gorm.DB, tableName string, opts ...GormUserManagerOption) UserManager {
+	m := &GormUserManager{
+		db:                     db,
+		tableName:              tableName,
+		emailVerificationTTL:   DefaultEmailVerificationTTL,
+		activateOnEmailConfirm: true,
+		passwordResetTTL:       DefaultPasswordResetTTL,
+		now:                    time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
 	}
+
+	return m
 }
 
 // AutoMigrate creates or updates the database schema for User model
 func (m *GormUserManager) AutoMigrate() error {
-	return m.db.Table(m.tableName).AutoMigrate(&GormUserModel{})
+	if err := m.db.Table(m.tableName).AutoMigrate(&GormUserModel{}); err != nil {
+		return err
+	}
+	if err := m.migrateTenantIndexes(); err != nil {
+		return err
+	}
+	if err := m.db.Table(m.tokenTableName()).AutoMigrate(&GormUserTokenModel{}); err != nil {
+		return err
+	}
+	return m.db.Table(m.passwordHistoryTableName()).AutoMigrate(&GormPasswordHistoryModel{})
 }
 
-// VerifyPasswordByUsername verifies the password of a user by username
-func (m *GormUserManager) VerifyPasswordByUsername(username, password string) error {
-	var gormUser GormUserModel
-	if err := m.db.Table(m.tableName).Select("password", "salt").Where("username = ?", username).First(&gormUser).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ErrUserNotFound
+// emit delivers an event to all registered handlers
+func (m *GormUserManager) emit(eventType EventType, userID uuid.UUID) {
+	event := Event{
+		Type:   eventType,
+		UserID: userID,
+		Time:   m.now(),
+	}
+
+	for _, handler := range m.eventHandlers {
+		handler(event)
+	}
+}
+
+// checksPasswords reports whether new passwords need to be checked
+func (m *GormUserManager) checksPasswords() bool {
+	return m.passwordPolicy != nil || m.breachChecker != nil
+}
+
+// checkPassword validates a new plain text password against the password
+// policy and the breached password checker. For existing users, whose stored
+// password is passed in user, reuse of recent passwords is rejected as well.
+func (m *GormUserManager) checkPassword(tx *gorm.DB, password string, user *User, existing bool) error {
+	var violations []PasswordViolation
+	if err := m.passwordPolicy.Validate(password, user); err != nil {
+		var policyErr *PasswordPolicyError
+		if !errors.As(err, &policyErr) {
+			return err
 		}
-		return err
+		violations = append(violations, policyErr.Violations...)
 	}
 
-	if gormUser.Password != HashPassword(password, gormUser.Salt) {
-		return ErrInvalidPassword
+	if m.breachChecker != nil && password != "" {
+		breached, err := m.breachChecker.IsBreached(m.passwordPolicy.NormalizePassword(password))
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{
+				Code:    PasswordBreached,
+				Message: "password has appeared in a data breach",
+			})
+		}
+	}
+
+	if existing && m.passwordHistorySize() > 0 {
+		reused, err := m.isPasswordReused(tx, user, password)
+		if err != nil {
+			return err
+		}
+		if reused {
+			violations = append(violations, PasswordViolation{
+				Code:    PasswordReused,
+				Message: fmt.Sprintf("password must differ from the last %d passwords", m.passwordHistorySize()),
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
 	}
 
 	return nil
 }
 
-// VerifyPasswordByEmail verifies the password of a user by email
-func (m *GormUserManager) VerifyPasswordByEmail(email, password string) error {
+// verifyPassword checks the password of the user matching column = value.
+// Users with a second factor get ErrMFARequired for a correct password; the
+// password change check is left to CheckPasswordChangeByID so that it is not
+// disclosed before the second factor has passed. Otherwise a correct password
+// that must be changed yields ErrPasswordChangeRequired or ErrPasswordExpired
+// instead of nil.
+func (m *GormUserManager) verifyPassword(column string, value interface{}, password string) error {
 	var gormUser GormUserModel
-	if err := m.db.Table(m.tableName).Select("password", "salt").Where("email = ?", email).First(&gormUser).Error; err != nil {
+	if err := m.users(m.db).Select("id", "password", "salt", "created_at", "password_changed_at", "must_change_password").Where(column+" = ?", value).First(&gormUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return ErrUserNotFound
 		}
 		return err
 	}
 
-	if gormUser.Password != HashPassword(password, gormUser.Salt) {
+	if !m.passwordMatches(&gormUser, password) {
 		return ErrInvalidPassword
 	}
 
-	return nil
+	if m.mfaChecker != nil {
+		enabled, err := m.mfaChecker.MFAEnabled(gormUser.ID.String())
+		if err != nil {
+			return err
+		}
+		if enabled {
+			return ErrMFARequired
+		}
+	}
+
+	return m.passwordChangeRequired(&gormUser)
 }
 
-// VerifyPasswordByID verifies the password of a user by ID
-func (m *GormUserManager) VerifyPasswordByID(id string, password string) error {
+// CheckPasswordChangeByID returns ErrPasswordChangeRequired or
+// ErrPasswordExpired if the user has to change their password, and nil
+// otherwise. Call it once the second factor of a user for whom password
+// verification returned ErrMFARequired has passed.
+func (m *GormUserManager) CheckPasswordChangeByID(id string) error {
 	var gormUser GormUserModel
-	if err := m.db.Table(m.tableName).Select("password", "salt").Where("id = ?", id).First(&gormUser).Error; err != nil {
+	if err := m.users(m.db).Select("id", "created_at", "password_changed_at", "must_change_password").Where("id = ?", id).First(&gormUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return ErrUserNotFound
 		}
 		return err
 	}
 
-	if gormUser.Password != HashPassword(password, gormUser.Salt) {
-		return ErrInvalidPassword
+	return m.passwordChangeRequired(&gormUser)
+}
+
+// passwordChangeRequired returns the error telling that the password of a
+// user has to be changed, if it has to
+func (m *GormUserManager) passwordChangeRequired(gormUser *GormUserModel) error {
+	if gormUser.MustChangePassword {
+		return ErrPasswordChangeRequired
+	}
+
+	if m.passwordExpired(gormUser) {
+		return ErrPasswordExpired
 	}
 
 	return nil
 }
 
+// passwordExpired reports whether the password is older than the policy's
+// MaxAge. Users without a recorded change are measured from their creation.
+func (m *GormUserManager) passwordExpired(gormUser *GormUserModel) bool {
+	if m.passwordPolicy == nil || m.passwordPolicy.MaxAge <= 0 {
+		return false
+	}
+
+	changedAt := gormUser.CreatedAt
+	if gormUser.PasswordChangedAt != nil {
+		changedAt = *gormUser.PasswordChangedAt
+	}
+
+	return !m.now().Before(changedAt.Add(m.passwordPolicy.MaxAge))
+}
+
+// passwordMatches compares a plain password with the stored hash. Passwords
+// set before normalization was enabled are still accepted in their raw form.
+func (m *GormUserManager) passwordMatches(gormUser *GormUserModel, password string) bool {
+	normalized := m.passwordPolicy.NormalizePassword(password)
+	if subtle.ConstantTimeCompare([]byte(gormUser.Password), []byte(HashPassword(normalized, gormUser.Salt))) == 1 {
+		return true
+	}
+	return normalized != password &&
+		subtle.ConstantTimeCompare([]byte(gormUser.Password), []byte(HashPassword(password, gormUser.Salt))) == 1
+}
+
+// VerifyPasswordByUsername verifies the password of a user by username
+func (m *GormUserManager) VerifyPasswordByUsername(username, password string) error {
+	return m.verifyPassword("username", username, password)
+}
+
+// VerifyPasswordByEmail verifies the password of a user by email
+func (m *GormUserManager) VerifyPasswordByEmail(email, password string) error {
+	return m.verifyPassword("email", email, password)
+}
+
+// VerifyPasswordByID verifies the password of a user by ID
+func (m *GormUserManager) VerifyPasswordByID(id string, password string) error {
+	return m.verifyPassword("id", id, password)
+}
+
 // ListUsers retrieves a list of users with pagination, filtering, and sorting
 func (m *GormUserManager) ListUsers(limit, offset int, filters map[string]interface{}, orderBy string, desc bool) ([]User, error) {
 	var gormUsers []GormUserModel
-	query := m.db.Table(m.tableName)
-
-	// Apply filters if any
-	if filters != nil {
-		for key, value := range filters {
-			query = query.Where(key+" = ?", value)
-		}
+	query, err := m.filterUsers(filters)
+	if err != nil {
+		return nil, err
 	}
 
 	// Apply ordering if specified
@@ -192,6 +428,56 @@ func (m *GormUserManager) ListUsers(limit, offset int, filters map[string]interf
 	return users, nil
 }
 
+// CountUsers returns the number of users matching filters, which take the
+// same form as those of ListUsers
+func (m *GormUserManager) CountUsers(filters map[string]interface{}) (int64, error) {
+	query, err := m.filterUsers(filters)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// filterUsers returns a query of the users matching filters
+func (m *GormUserManager) filterUsers(filters map[string]interface{}) (*gorm.DB, error) {
+	query := m.users(m.db)
+	for key, value := range filters {
+		if key == FilterGroup {
+			memberIDs, err := m.groupMemberIDs(value)
+			if err != nil {
+				return nil, err
+			}
+			query = query.Where("id IN ?", memberIDs)
+			continue
+		}
+		query = query.Where(key+" = ?", value)
+	}
+	return query, nil
+}
+
+// groupMemberIDs resolves the value of a FilterGroup filter to user IDs
+func (m *GormUserManager) groupMemberIDs(value interface{}) ([]uuid.UUID, error) {
+	if m.groupResolver == nil {
+		return nil, fmt.Errorf("filter %q requires a group resolver", FilterGroup)
+	}
+
+	groupID := fmt.Sprint(value)
+	memberIDs, err := m.groupResolver.EffectiveMemberIDs(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	// IN with an empty list is not valid SQL everywhere
+	if len(memberIDs) == 0 {
+		memberIDs = []uuid.UUID{uuid.Nil}
+	}
+	return memberIDs, nil
+}
+
 // CreateUser creates a new user
 func (m *GormUserManager) CreateUser(user *User) error {
 	// Generate UUID for user ID
@@ -204,13 +490,30 @@ func (m *GormUserManager) CreateUser(user *User) error {
 		user.Status = DefaultUserStatus
 	}
 
+	// Enforce the password policy on plain text passwords, including empty ones
+	if m.checksPasswords() && len(user.Password) < 64 {
+		if err := m.checkPassword(m.db, user.Password, user, false); err != nil {
+			return err
+		}
+	}
+
+	// A tenant-scoped manager only creates users in its own tenant
+	if m.tenantScoped {
+		if user.TenantID != "" && user.TenantID != m.tenantID {
+			return ErrCrossTenantAccess
+		}
+		user.TenantID = m.tenantID
+	}
+
 	// Convert User to GormUserModel
 	gormUser := NewGormUserModelFromUser(user)
 
-	// Check if user already exists with the same username or email
-	var count int64
-	m.db.Table(m.tableName).Where("username = ? OR email = ?", user.Username, user.Email).Count(&count)
-	if count > 0 {
+	// Check if user already exists in the tenant with the same username, email or phone
+	exists, err := m.userExists(m.db, user)
+	if err != nil {
+		return err
+	}
+	if exists {
 		return ErrUserAlreadyExists
 	}
 
@@ -224,25 +527,56 @@ func (m *GormUserManager) CreateUser(user *User) error {
 		gormUser.Salt = salt
 	}
 
+	// Remember when the password was set so that it can expire
+	if HasUsablePassword(user) && user.PasswordChangedAt == nil {
+		changedAt := m.now()
+		user.PasswordChangedAt = &changedAt
+		gormUser.PasswordChangedAt = &changedAt
+	}
+
 	// Hash the password if it's provided in plain text
 	if user.Password != "" && len(user.Password) < 64 {
-		hashedPassword := HashPassword(user.Password, user.Salt)
+		hashedPassword := HashPassword(m.passwordPolicy.NormalizePassword(user.Password), user.Salt)
 		user.Password = hashedPassword
 		gormUser.Password = hashedPassword
 	}
 
-	// Create the user
-	if err := m.db.Table(m.tableName).Create(gormUser).Error; err != nil {
+	// Create the user and remember its first password
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(m.tableName).Create(gormUser).Error; err != nil {
+			return err
+		}
+		if !HasUsablePassword(user) {
+			return nil
+		}
+		return m.recordPasswordHistory(tx, gormUser.ID, gormUser.Password, gormUser.Salt)
+	})
+	if err != nil {
+		// A user created concurrently violates the unique indexes instead
+		if exists, existsErr := m.userExists(m.db, user); existsErr == nil && exists {
+			return ErrUserAlreadyExists
+		}
 		return err
 	}
 
 	return nil
 }
 
-// GetUserByID retrieves a user by ID
-func (m *GormUserManager) GetUserByID(id string) (*User, error) {
+// userExists reports whether the tenant of user already has a user with the
+// same username, email or phone number. Users without a phone number do not
+// clash with each other.
+func (m *GormUserManager) userExists(tx *gorm.DB, user *User) (bool, error) {
+	var count int64
+	err := tx.Table(m.tableName).
+		Where("tenant_id = ? AND (username = ? OR email = ? OR (phone <> '' AND phone = ?))", user.TenantID, user.Username, user.Email, user.Phone).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// getUser retrieves the user matching column = value
+func (m *GormUserManager) getUser(column string, value interface{}) (*User, error) {
 	var gormUser GormUserModel
-	if err := m.db.Table(m.tableName).Where("id = ?", id).First(&gormUser).Error; err != nil {
+	if err := m.users(m.db).Where(column+" = ?", value).First(&gormUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrUserNotFound
 		}
@@ -251,43 +585,79 @@ func (m *GormUserManager) GetUserByID(id string) (*User, error) {
 	return gormUser.ToUser(), nil
 }
 
+// GetUserByID retrieves a user by ID
+func (m *GormUserManager) GetUserByID(id string) (*User, error) {
+	return m.getUser("id", id)
+}
+
 // GetUserByUsername retrieves a user by username
 func (m *GormUserManager) GetUserByUsername(username string) (*User, error) {
-	var gormUser GormUserModel
-	if err := m.db.Table(m.tableName).Where("username = ?", username).First(&gormUser).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrUserNotFound
-		}
-		return nil, err
-	}
-	return gormUser.ToUser(), nil
+	return m.getUser("username", username)
 }
 
 // GetUserByEmail retrieves a user by email
 func (m *GormUserManager) GetUserByEmail(email string) (*User, error) {
-	var gormUser GormUserModel
-	if err := m.db.Table(m.tableName).Where("email = ?", email).First(&gormUser).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrUserNotFound
+	return m.getUser("email", email)
+}
+
+// updateUser updates the fields of the user matching column = value
+func (m *GormUserManager) updateUser(column string, value interface{}, updatedData map[string]interface{}) error {
+	// Moving users between tenants is reserved to the unscoped manager
+	if m.tenantScoped {
+		_, field := updatedData["TenantID"]
+		_, column := updatedData["tenant_id"]
+		if field || column {
+			return ErrCrossTenantAccess
 		}
-		return nil, err
 	}
-	return gormUser.ToUser(), nil
-}
 
-// UpdateUserByID updates user fields by ID
-func (m *GormUserManager) UpdateUserByID(id string, updatedData map[string]interface{}) error {
-	// Check if updating password and handle hash
-	if password, ok := updatedData["Password"].(string); ok && len(password) < 64 {
-		// Generate a new salt
-		newSalt, err := GenerateSalt()
+	// User whose password changes, announced once the update succeeds
+	var passwordUserID uuid.UUID
+	// Whether the new password was hashed here and can be remembered in the history
+	var hashed bool
+
+	if password, ok := updatedData["Password"].(string); ok {
+		user, err := m.getUser(column, value)
 		if err != nil {
 			return err
 		}
+		passwordUserID = user.ID
+
+		// Check if updating password and handle hash
+		if len(password) < 64 {
+			// Validate using the identifiers the user will have after the update
+			if m.checksPasswords() {
+				if username, ok := updatedData["Username"].(string); ok {
+					user.Username = username
+				}
+				if email, ok := updatedData["Email"].(string); ok {
+					user.Email = email
+				}
+				if err := m.checkPassword(m.db, password, user, true); err != nil {
+					return err
+				}
+			}
+
+			// Generate a new salt
+			newSalt, err := GenerateSalt()
+			if err != nil {
+				return err
+			}
+
+			// Hash the password with the new salt
+			updatedData["Password"] = HashPassword(m.passwordPolicy.NormalizePassword(password), newSalt)
+			updatedData["Salt"] = newSalt
+			hashed = true
+		}
 
-		// Hash the password with the new salt
-		updatedData["Password"] = HashPassword(password, newSalt)
-		updatedData["Salt"] = newSalt
+		// A new password restarts the expiry clock and, unless an administrator
+		// issues a temporary password, satisfies a pending forced change
+		updatedData["PasswordChangedAt"] = m.now()
+		_, temporary := updatedData["MustChangePassword"]
+		_, temporaryColumn := updatedData["must_change_password"]
+		if !temporary && !temporaryColumn {
+			updatedData["MustChangePassword"] = false
+		}
 	}
 
 	// Check if updating Data field (which is map[string]interface{} in User but JSON in GormUserModel)
@@ -301,91 +671,50 @@ func (m *GormUserManager) UpdateUserByID(id string, updatedData map[string]inter
 		}
 	}
 
-	result := m.db.Table(m.tableName).Where("id = ?", id).Updates(updatedData)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return ErrUserNotFound
-	}
-	return nil
-}
-
-// UpdateUserByUsername updates user fields by username
-func (m *GormUserManager) UpdateUserByUsername(username string, updatedData map[string]interface{}) error {
-	// Check if updating password and handle hash
-	if password, ok := updatedData["Password"].(string); ok && len(password) < 64 {
-		// Generate a new salt
-		newSalt, err := GenerateSalt()
-		if err != nil {
-			return err
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		// The model maps field names such as "MustChangePassword" to their columns
+		result := m.users(tx).Model(&GormUserModel{}).Where(column+" = ?", value).Updates(updatedData)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
 		}
 
-		// Hash the password with the new salt
-		updatedData["Password"] = HashPassword(password, newSalt)
-		updatedData["Salt"] = newSalt
-	}
-
-	// Check if updating Data field (which is map[string]interface{} in User but JSON in GormUserModel)
-	if dataMap, ok := updatedData["Data"].(map[string]interface{}); ok {
-		// Convert map to JSON
-		jsonData, err := json.Marshal(dataMap)
-		if err == nil {
-			updatedData["Data"] = datatypes.JSON(jsonData)
-		} else {
-			delete(updatedData, "Data") // Remove Data key if conversion fails
+		if !hashed {
+			return nil
 		}
+		return m.recordPasswordHistory(tx, passwordUserID, updatedData["Password"].(string), updatedData["Salt"].(string))
+	})
+	if err != nil {
+		return err
 	}
 
-	result := m.db.Table(m.tableName).Where("username = ?", username).Updates(updatedData)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return ErrUserNotFound
+	if passwordUserID != uuid.Nil {
+		m.emit(EventPasswordChanged, passwordUserID)
 	}
+
 	return nil
 }
 
-// UpdateUserByEmail updates user fields by email
-func (m *GormUserManager) UpdateUserByEmail(email string, updatedData map[string]interface{}) error {
-	// Check if updating password and handle hash
-	if password, ok := updatedData["Password"].(string); ok && len(password) < 64 {
-		// Generate a new salt
-		newSalt, err := GenerateSalt()
-		if err != nil {
-			return err
-		}
-
-		// Hash the password with the new salt
-		updatedData["Password"] = HashPassword(password, newSalt)
-		updatedData["Salt"] = newSalt
-	}
+// UpdateUserByID updates user fields by ID
+func (m *GormUserManager) UpdateUserByID(id string, updatedData map[string]interface{}) error {
+	return m.updateUser("id", id, updatedData)
+}
 
-	// Check if updating Data field (which is map[string]interface{} in User but JSON in GormUserModel)
-	if dataMap, ok := updatedData["Data"].(map[string]interface{}); ok {
-		// Convert map to JSON
-		jsonData, err := json.Marshal(dataMap)
-		if err == nil {
-			updatedData["Data"] = datatypes.JSON(jsonData)
-		} else {
-			delete(updatedData, "Data") // Remove Data key if conversion fails
-		}
-	}
+// UpdateUserByUsername updates user fields by username
+func (m *GormUserManager) UpdateUserByUsername(username string, updatedData map[string]interface{}) error {
+	return m.updateUser("username", username, updatedData)
+}
 
-	result := m.db.Table(m.tableName).Where("email = ?", email).Updates(updatedData)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return ErrUserNotFound
-	}
-	return nil
+// UpdateUserByEmail updates user fields by email
+func (m *GormUserManager) UpdateUserByEmail(email string, updatedData map[string]interface{}) error {
+	return m.updateUser("email", email, updatedData)
 }
 
 // DeleteUserByID deletes a user by ID
 func (m *GormUserManager) DeleteUserByID(id string) error {
-	result := m.db.Table(m.tableName).Where("id = ?", id).Delete(&GormUserModel{})
+	result := m.users(m.db).Where("id = ?", id).Delete(&GormUserModel{})
 	if result.Error != nil {
 		return result.Error
 	}
@@ -397,7 +726,7 @@ func (m *GormUserManager) DeleteUserByID(id string) error {
 
 // DeleteUserByUsername deletes a user by username
 func (m *GormUserManager) DeleteUserByUsername(username string) error {
-	result := m.db.Table(m.tableName).Where("username = ?", username).Delete(&GormUserModel{})
+	result := m.users(m.db).Where("username = ?", username).Delete(&GormUserModel{})
 	if result.Error != nil {
 		return result.Error
 	}
@@ -409,7 +738,7 @@ func (m *GormUserManager) DeleteUserByUsername(username string) error {
 
 // DeleteUserByEmail deletes a user by email
 func (m *GormUserManager) DeleteUserByEmail(email string) error {
-	result := m.db.Table(m.tableName).Where("email = ?", email).Delete(&GormUserModel{})
+	result := m.users(m.db).Where("email = ?", email).Delete(&GormUserModel{})
 	if result.Error != nil {
 		return result.Error
 	}
@@ -421,7 +750,7 @@ func (m *GormUserManager) DeleteUserByEmail(email string) error {
 
 // EnableUserByID enables a user by ID
 func (m *GormUserManager) EnableUserByID(id string) error {
-	result := m.db.Table(m.tableName).Where("id = ?", id).Update("enabled", true)
+	result := m.users(m.db).Where("id = ?", id).Update("enabled", true)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -433,19 +762,24 @@ func (m *GormUserManager) EnableUserByID(id string) error {
 
 // DisableUserByID disables a user by ID
 func (m *GormUserManager) DisableUserByID(id string) error {
-	result := m.db.Table(m.tableName).Where("id = ?", id).Update("enabled", false)
+	result := m.users(m.db).Where("id = ?", id).Update("enabled", false)
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
 		return ErrUserNotFound
 	}
+
+	if userID, err := uuid.Parse(id); err == nil {
+		m.emit(EventUserDisabled, userID)
+	}
+
 	return nil
 }
 
 // SetUserStatusByID updates the user status by ID
 func (m *GormUserManager) SetUserStatusByID(id string, status UserStatus) error {
-	result := m.db.Table(m.tableName).Where("id = ?", id).Update("status", status)
+	result := m.users(m.db).Where("id = ?", id).Update("status", status)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -457,7 +791,7 @@ func (m *GormUserManager) SetUserStatusByID(id string, status UserStatus) error
 
 // SetUserStatusByUsername updates the user status by username
 func (m *GormUserManager) SetUserStatusByUsername(username string, status UserStatus) error {
-	result := m.db.Table(m.tableName).Where("username = ?", username).Update("status", status)
+	result := m.users(m.db).Where("username = ?", username).Update("status", status)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -469,7 +803,7 @@ func (m *GormUserManager) SetUserStatusByUsername(username string, status UserSt
 
 // SetUserStatusByEmail updates the user status by email
 func (m *GormUserManager) SetUserStatusByEmail(email string, status UserStatus) error {
-	result := m.db.Table(m.tableName).Where("email = ?", email).Update("status", status)
+	result := m.users(m.db).Where("email = ?", email).Update("status", status)
 	if result.Error != nil {
 		return result.Error
 	}
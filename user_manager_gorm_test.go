@@ -439,6 +439,15 @@ func TestListUsers_Gorm(t *testing.T) {
 	assert.Equal(t, 1, len(users), "ListUsers should filter users")
 	assert.Equal(t, UserStatusInactive, users[0].Status, "Filter should return users with inactive status")
 
+	// Count with and without filters
+	counter := userManager.(UserCounter)
+	count, err := counter.CountUsers(nil)
+	assert.NoError(t, err, "CountUsers should not error")
+	assert.Equal(t, int64(6), count, "CountUsers should count all users")
+	count, err = counter.CountUsers(map[string]interface{}{"status": UserStatusInactive})
+	assert.NoError(t, err, "CountUsers with filters should not error")
+	assert.Equal(t, int64(1), count, "CountUsers should apply filters")
+
 	// Test with ordering
 	users, err = userManager.ListUsers(10, 0, nil, "created_at", true)
 	assert.NoError(t, err, "ListUsers with ordering should not error")
@@ -0,0 +1,104 @@
+package userion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Purposes of the one-time tokens stored by GormUserManager
+const (
+	tokenPurposeEmailVerification = "email_verification"
+	tokenPurposePasswordReset     = "password_reset"
+)
+
+// GormUserTokenModel represents a single-use token issued to a user.
+// Only the hash of the token is stored.
+type GormUserTokenModel struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Purpose   string    `gorm:"type:varchar(32);not null"`
+	TokenHash string    `gorm:"type:varchar(64);unique;not null"`
+	Subject   string    // Value the token was issued for, e.g. the email address being verified
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// tokenTableName returns the name of the table holding user tokens
+func (m *GormUserManager) tokenTableName() string {
+	return m.tableName + "_tokens"
+}
+
+// issueToken invalidates outstanding tokens of the same purpose for the user
+// and stores a new one, returning the plain token
+func (m *GormUserManager) issueToken(tx *gorm.DB, userID uuid.UUID, purpose string, subject string, ttl time.Duration) (string, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := m.now()
+
+	// Invalidate previously issued tokens so that only the latest one works
+	if err := m.invalidateTokens(tx, userID, purpose, now); err != nil {
+		return "", err
+	}
+
+	record := &GormUserTokenModel{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: HashToken(token),
+		Subject:   subject,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+
+	if err := tx.Table(m.tokenTableName()).Create(record).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// invalidateTokens marks all unused tokens of a purpose for the user as used
+func (m *GormUserManager) invalidateTokens(tx *gorm.DB, userID uuid.UUID, purpose string, now time.Time) error {
+	return tx.Table(m.tokenTableName()).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error
+}
+
+// consumeToken validates a plain token and marks it as used
+func (m *GormUserManager) consumeToken(tx *gorm.DB, token string, purpose string) (*GormUserTokenModel, error) {
+	var record GormUserTokenModel
+	if err := tx.Table(m.tokenTableName()).Where("token_hash = ? AND purpose = ?", HashToken(token), purpose).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if record.UsedAt != nil {
+		return nil, ErrInvalidToken
+	}
+
+	now := m.now()
+	if !now.Before(record.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+
+	// Guard against the token being consumed concurrently
+	result := tx.Table(m.tokenTableName()).Where("id = ? AND used_at IS NULL", record.ID).Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	record.UsedAt = &now
+	return &record, nil
+}
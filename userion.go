@@ -30,12 +30,25 @@ const (
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrUserDisabled      = errors.New("user disabled")
+	ErrUserNotActive     = errors.New("user not active")
 	ErrInvalidPassword   = errors.New("invalid password")
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrTokenExpired      = errors.New("token expired")
+	ErrWeakPassword      = errors.New("password does not meet requirements")
+
+	// The password was correct but has to be changed before the user may proceed
+	ErrPasswordExpired        = errors.New("password expired")
+	ErrPasswordChangeRequired = errors.New("password change required")
+
+	// The password was correct but a second factor has to be verified as well
+	ErrMFARequired = errors.New("multi-factor authentication required")
 )
 
 // User represents the business model for user operations
 type User struct {
 	ID        uuid.UUID              `json:"id"`
+	TenantID  string                 `json:"tenant_id,omitempty"` // Empty for the default tenant
 	Name      string                 `json:"name"`
 	Username  string                 `json:"username"`
 	Email     string                 `json:"email"`
@@ -46,6 +59,12 @@ type User struct {
 	Enabled   bool                   `json:"enabled"`
 	Status    UserStatus             `json:"status"`
 	Data      map[string]interface{} `json:"data,omitempty"` // JSON data for custom extensions
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"` // Set once ownership of Email is confirmed
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at,omitempty"` // Set once ownership of Phone is confirmed
+
+	PasswordChangedAt  *time.Time `json:"password_changed_at,omitempty"`
+	MustChangePassword bool       `json:"must_change_password"` // Set for temporary passwords issued by an administrator
 }
 
 // UserManager defines the interface for managing users
@@ -70,4 +89,16 @@ type UserManager interface {
 	SetUserStatusByID(id string, status UserStatus) error
 	SetUserStatusByUsername(username string, status UserStatus) error
 	SetUserStatusByEmail(email string, status UserStatus) error
+	IssueEmailVerification(userID string) (string, error)
+	ConfirmEmail(token string) error
+	RequestPasswordReset(email string) (string, error)
+	ResetPassword(token, newPassword string) error
+}
+
+// UserCounter is implemented by user managers that can count users without
+// loading them
+type UserCounter interface {
+	// CountUsers returns the number of users ListUsers returns for filters
+	// when no limit is applied
+	CountUsers(filters map[string]interface{}) (int64, error)
 }
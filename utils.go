@@ -3,8 +3,11 @@ package userion
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"math/big"
+	"strings"
 )
 
 // GenerateSalt creates a random salt for password hashing
@@ -32,3 +35,59 @@ func HashPassword(password, salt string) string {
 	// Return hex encoded hash
 	return hex.EncodeToString(hash.Sum(nil))
 }
+
+// GenerateToken creates a random URL-safe token suitable for one-time links
+func GenerateToken() (string, error) {
+	// Generate 32 random bytes
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken hashes a token so that only its digest needs to be stored
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// GenerateNumericCode creates a random code of the given number of digits
+func GenerateNumericCode(digits int) (string, error) {
+	code := make([]byte, digits)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate code: %w", err)
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+
+	return string(code), nil
+}
+
+// recoveryCodeAlphabet omits characters that are easily confused when written down
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCode creates a random code of the given length, split into
+// two dash-separated halves for readability
+func GenerateRecoveryCode(length int) (string, error) {
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate code: %w", err)
+		}
+		code[i] = recoveryCodeAlphabet[n.Int64()]
+	}
+
+	half := length / 2
+	return string(code[:half]) + "-" + string(code[half:]), nil
+}
+
+// NormalizeRecoveryCode removes separators and case differences from a typed recovery code
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
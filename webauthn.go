@@ -0,0 +1,392 @@
+package userion
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Common errors returned by the WebAuthnManager
+var (
+	ErrInvalidChallenge     = errors.New("invalid or expired challenge")
+	ErrInvalidAttestation   = errors.New("invalid attestation")
+	ErrInvalidAssertion     = errors.New("invalid assertion")
+	ErrCredentialNotFound   = errors.New("credential not found")
+	ErrCredentialExists     = errors.New("credential already registered")
+	ErrAuthenticatorCloned  = errors.New("authenticator may be cloned")
+	ErrUnsupportedPublicKey = errors.New("unsupported credential public key")
+)
+
+// User verification requirements of WebAuthn ceremonies
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+// COSE algorithm identifiers of the supported credential keys
+const (
+	COSEAlgorithmES256 = -7
+	COSEAlgorithmEdDSA = -8
+	COSEAlgorithmRS256 = -257
+)
+
+// Authenticator data flags
+const (
+	authenticatorFlagUserPresent  = 0x01
+	authenticatorFlagUserVerified = 0x04
+	authenticatorFlagAttestedData = 0x40
+)
+
+// Base64URL is binary data that is base64url encoded in JSON, as used by the
+// WebAuthn browser API
+type Base64URL []byte
+
+// MarshalJSON encodes the data without padding
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON accepts padded and unpadded base64url
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// WebAuthnConfig describes the relying party
+type WebAuthnConfig struct {
+	RPID             string        // Domain the credentials are scoped to, e.g. "example.com"
+	RPName           string        // Name shown by the authenticator
+	Origins          []string      // Allowed origins, e.g. "https://login.example.com"
+	Timeout          time.Duration // How long a ceremony may take
+	UserVerification string        // One of the UserVerification constants
+}
+
+// WebAuthnCredential is a passkey registered by a user
+type WebAuthnCredential struct {
+	ID           uuid.UUID  `json:"id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	CredentialID Base64URL  `json:"credential_id"`
+	PublicKey    []byte     `json:"-"` // COSE encoded
+	Algorithm    int64      `json:"algorithm"`
+	SignCount    uint32     `json:"sign_count"`
+	Transports   []string   `json:"transports,omitempty"`
+	Nickname     string     `json:"nickname"`
+	AAGUID       uuid.UUID  `json:"aaguid"`
+	CloneWarning bool       `json:"clone_warning"` // Set when the sign count went backwards
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+}
+
+// RelyingPartyEntity identifies the relying party in creation options
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity identifies the user in creation options
+type UserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+// CredentialParameter is an acceptable credential type and algorithm
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int64  `json:"alg"`
+}
+
+// CredentialDescriptor refers to an existing credential
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection states requirements on the authenticator
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey,omitempty"`
+	UserVerification string `json:"userVerification,omitempty"`
+}
+
+// CredentialCreationOptions is passed as publicKey to navigator.credentials.create()
+type CredentialCreationOptions struct {
+	Challenge              Base64URL              `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"` // Milliseconds
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation,omitempty"`
+}
+
+// CredentialRequestOptions is passed as publicKey to navigator.credentials.get()
+type CredentialRequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"` // Milliseconds
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification,omitempty"`
+}
+
+// RegistrationResponse is the JSON form of the credential returned by navigator.credentials.create()
+type RegistrationResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AttestationObject Base64URL `json:"attestationObject"`
+		Transports        []string  `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the credential returned by navigator.credentials.get()
+type AssertionResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AuthenticatorData Base64URL `json:"authenticatorData"`
+		Signature         Base64URL `json:"signature"`
+		UserHandle        Base64URL `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// WebAuthnManager defines the interface for passkey registration and login
+type WebAuthnManager interface {
+	LoginMethodChecker
+
+	AutoMigrate() error
+	BeginRegistration(userID string) (*CredentialCreationOptions, error)
+	FinishRegistration(userID string, response *RegistrationResponse, nickname string) (*WebAuthnCredential, error)
+	BeginLogin(userID string) (*CredentialRequestOptions, error)
+	FinishLogin(response *AssertionResponse) (*WebAuthnCredential, error)
+	ListCredentials(userID string) ([]*WebAuthnCredential, error)
+	RenameCredential(id string, nickname string) error
+	DeleteCredential(id string) error
+}
+
+// collectedClientData is the decoded clientDataJSON
+type collectedClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// parseClientData decodes clientDataJSON and checks the ceremony type and origin
+func (c *WebAuthnConfig) parseClientData(raw []byte, ceremony string) (*collectedClientData, error) {
+	var clientData collectedClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, err
+	}
+	if clientData.Type != ceremony {
+		return nil, errors.New("unexpected ceremony type")
+	}
+
+	for _, origin := range c.Origins {
+		if clientData.Origin == origin {
+			return &clientData, nil
+		}
+	}
+	return nil, errors.New("origin not allowed")
+}
+
+// authenticatorData is the decoded authenticator data structure
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte // COSE encoded
+}
+
+// parseAuthenticatorData decodes authenticator data and checks the RP ID hash
+// and the user presence and verification flags
+func (c *WebAuthnConfig) parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+
+	data := &authenticatorData{
+		RPIDHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	rpIDHash := sha256.Sum256([]byte(c.RPID))
+	if !bytes.Equal(data.RPIDHash, rpIDHash[:]) {
+		return nil, errors.New("RP ID hash mismatch")
+	}
+	if data.Flags&authenticatorFlagUserPresent == 0 {
+		return nil, errors.New("user not present")
+	}
+	if c.UserVerification == UserVerificationRequired && data.Flags&authenticatorFlagUserVerified == 0 {
+		return nil, errors.New("user not verified")
+	}
+
+	if data.Flags&authenticatorFlagAttestedData != 0 {
+		rest := raw[37:]
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		data.AAGUID = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLength {
+			return nil, errors.New("credential ID too short")
+		}
+		data.CredentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		data.PublicKey = rest[:n]
+	}
+
+	return data, nil
+}
+
+// parseCOSEKey decodes a COSE public key (RFC 9053) of a supported algorithm
+func parseCOSEKey(raw []byte) (int64, crypto.PublicKey, error) {
+	key, err := cborMap(raw)
+	if err != nil {
+		return 0, nil, ErrUnsupportedPublicKey
+	}
+
+	keyType, _ := key[int64(1)].(int64)
+	algorithm, _ := key[int64(3)].(int64)
+	curve, _ := key[int64(-1)].(int64)
+	x, _ := key[int64(-2)].([]byte)
+	y, _ := key[int64(-3)].([]byte)
+
+	switch {
+	case keyType == 2 && algorithm == COSEAlgorithmES256 && curve == 1:
+		if len(x) != 32 || len(y) != 32 {
+			return 0, nil, ErrUnsupportedPublicKey
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return 0, nil, ErrUnsupportedPublicKey
+		}
+		return algorithm, publicKey, nil
+
+	case keyType == 1 && algorithm == COSEAlgorithmEdDSA && curve == 6:
+		if len(x) != ed25519.PublicKeySize {
+			return 0, nil, ErrUnsupportedPublicKey
+		}
+		return algorithm, ed25519.PublicKey(x), nil
+
+	case keyType == 3 && algorithm == COSEAlgorithmRS256:
+		// RSA keys carry n and e under the labels used for curve and x by EC keys
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, ErrUnsupportedPublicKey
+		}
+		return algorithm, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	default:
+		return 0, nil, ErrUnsupportedPublicKey
+	}
+}
+
+// verifyCOSESignature checks a WebAuthn signature, which is ASN.1 encoded for ECDSA
+func verifyCOSESignature(algorithm int64, key crypto.PublicKey, data, signature []byte) bool {
+	switch algorithm {
+	case COSEAlgorithmES256:
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(publicKey, digest[:], signature)
+
+	case COSEAlgorithmEdDSA:
+		publicKey, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(publicKey, data, signature)
+
+	case COSEAlgorithmRS256:
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+
+	default:
+		return false
+	}
+}
+
+// verifyAttestationStatement checks the "none" and "packed" attestation
+// formats. Packed certificates are checked for the signature only; trust in
+// the authenticator model is not evaluated.
+func verifyAttestationStatement(format string, statement map[interface{}]interface{}, authData, clientDataHash []byte, credentialAlgorithm int64, credentialKey crypto.PublicKey) error {
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return errors.New("unexpected attestation statement")
+		}
+		return nil
+
+	case "packed":
+		algorithm, _ := statement["alg"].(int64)
+		signature, _ := statement["sig"].([]byte)
+		signed := append(append([]byte(nil), authData...), clientDataHash...)
+
+		chain, hasCertificate := statement["x5c"].([]interface{})
+		if !hasCertificate {
+			// Self attestation is signed by the credential itself
+			if algorithm != credentialAlgorithm || !verifyCOSESignature(algorithm, credentialKey, signed, signature) {
+				return errors.New("invalid self attestation signature")
+			}
+			return nil
+		}
+
+		if len(chain) == 0 {
+			return errors.New("empty certificate chain")
+		}
+		leaf, _ := chain[0].([]byte)
+		certificate, err := x509.ParseCertificate(leaf)
+		if err != nil {
+			return err
+		}
+		if !verifyCOSESignature(algorithm, certificate.PublicKey, signed, signature) {
+			return errors.New("invalid attestation signature")
+		}
+		return nil
+
+	default:
+		return errors.New("unsupported attestation format")
+	}
+}
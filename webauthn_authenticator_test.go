@@ -0,0 +1,251 @@
+package userion
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// encodeCBOR encodes the values produced by decodeCBOR
+func encodeCBOR(value interface{}) []byte {
+	return appendCBOR(nil, value)
+}
+
+// appendCBOR appends the encoding of a value
+func appendCBOR(buf []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case int:
+		return appendCBOR(buf, int64(v))
+	case int64:
+		if v < 0 {
+			return appendCBORHeader(buf, 1, uint64(-1-v))
+		}
+		return appendCBORHeader(buf, 0, uint64(v))
+	case []byte:
+		return append(appendCBORHeader(buf, 2, uint64(len(v))), v...)
+	case string:
+		return append(appendCBORHeader(buf, 3, uint64(len(v))), v...)
+	case []interface{}:
+		buf = appendCBORHeader(buf, 4, uint64(len(v)))
+		for _, item := range v {
+			buf = appendCBOR(buf, item)
+		}
+		return buf
+	case map[interface{}]interface{}:
+		buf = appendCBORHeader(buf, 5, uint64(len(v)))
+		for key, item := range v {
+			buf = appendCBOR(appendCBOR(buf, key), item)
+		}
+		return buf
+	case bool:
+		if v {
+			return append(buf, 0xf5)
+		}
+		return append(buf, 0xf4)
+	default:
+		panic("unsupported CBOR value")
+	}
+}
+
+// appendCBORHeader encodes the initial byte and argument of an item
+func appendCBORHeader(buf []byte, major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return append(buf, major<<5|byte(arg))
+	case arg <= math.MaxUint8:
+		return append(buf, major<<5|24, byte(arg))
+	case arg <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, major<<5|25), uint16(arg))
+	case arg <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, major<<5|26), uint32(arg))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, major<<5|27), arg)
+	}
+}
+
+// softAuthenticator is a software WebAuthn authenticator holding a single credential
+type softAuthenticator struct {
+	t            *testing.T
+	origin       string
+	algorithm    int64
+	signer       crypto.Signer
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	attestation  string // "none" or "packed" self attestation
+}
+
+// newSoftAuthenticator creates an authenticator with a new key of the COSE algorithm
+func newSoftAuthenticator(t *testing.T, origin string, algorithm int64) *softAuthenticator {
+	var signer crypto.Signer
+	var err error
+	switch algorithm {
+	case COSEAlgorithmES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case COSEAlgorithmEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case COSEAlgorithmRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	require.NoError(t, err)
+
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	require.NoError(t, err)
+
+	return &softAuthenticator{
+		t:            t,
+		origin:       origin,
+		algorithm:    algorithm,
+		signer:       signer,
+		credentialID: credentialID,
+		attestation:  "none",
+	}
+}
+
+// coseKey encodes the public key as a COSE key
+func (a *softAuthenticator) coseKey() []byte {
+	key := map[interface{}]interface{}{int64(3): a.algorithm}
+	switch publicKey := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		publicKey.X.FillBytes(x)
+		publicKey.Y.FillBytes(y)
+		key[int64(1)] = int64(2)
+		key[int64(-1)] = int64(1)
+		key[int64(-2)] = x
+		key[int64(-3)] = y
+	case ed25519.PublicKey:
+		key[int64(1)] = int64(1)
+		key[int64(-1)] = int64(6)
+		key[int64(-2)] = []byte(publicKey)
+	case *rsa.PublicKey:
+		e := make([]byte, 4)
+		binary.BigEndian.PutUint32(e, uint32(publicKey.E))
+		key[int64(1)] = int64(3)
+		key[int64(-1)] = publicKey.N.Bytes()
+		key[int64(-2)] = e[1:]
+	}
+	return encodeCBOR(key)
+}
+
+// sign signs data the way authenticators do for the algorithm
+func (a *softAuthenticator) sign(data []byte) []byte {
+	var signature []byte
+	var err error
+	switch a.algorithm {
+	case COSEAlgorithmEdDSA:
+		signature, err = a.signer.Sign(rand.Reader, data, crypto.Hash(0))
+	default:
+		digest := sha256.Sum256(data)
+		signature, err = a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	require.NoError(a.t, err)
+	return signature
+}
+
+// authenticatorData builds authenticator data, optionally with the attested credential
+func (a *softAuthenticator) authenticatorData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+
+	flags := byte(authenticatorFlagUserPresent | authenticatorFlagUserVerified)
+	if attested {
+		flags |= authenticatorFlagAttestedData
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+// clientData builds clientDataJSON for a ceremony
+func (a *softAuthenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.origin,
+	})
+	require.NoError(a.t, err)
+	return data
+}
+
+// roundTrip sends a value through JSON as a browser would
+func roundTrip[T any](t *testing.T, value *T) *T {
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	var result T
+	require.NoError(t, json.Unmarshal(data, &result))
+	return &result
+}
+
+// register performs navigator.credentials.create()
+func (a *softAuthenticator) register(options *CredentialCreationOptions) *RegistrationResponse {
+	options = roundTrip(a.t, options)
+	a.userHandle = options.User.ID
+
+	clientDataJSON := a.clientData(webAuthnCeremonyRegistration, options.Challenge)
+	authData := a.authenticatorData(options.RP.ID, true)
+
+	statement := map[interface{}]interface{}{}
+	if a.attestation == "packed" {
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		statement["alg"] = a.algorithm
+		statement["sig"] = a.sign(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	}
+
+	response := &RegistrationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: a.credentialID,
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = clientDataJSON
+	response.Response.AttestationObject = encodeCBOR(map[interface{}]interface{}{
+		"fmt":      a.attestation,
+		"attStmt":  statement,
+		"authData": authData,
+	})
+	response.Response.Transports = []string{"internal"}
+
+	return roundTrip(a.t, response)
+}
+
+// login performs navigator.credentials.get()
+func (a *softAuthenticator) login(options *CredentialRequestOptions) *AssertionResponse {
+	options = roundTrip(a.t, options)
+	a.signCount++
+
+	clientDataJSON := a.clientData(webAuthnCeremonyLogin, options.Challenge)
+	authData := a.authenticatorData(options.RPID, false)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	response := &AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: a.credentialID,
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = clientDataJSON
+	response.Response.AuthenticatorData = authData
+	response.Response.Signature = a.sign(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	response.Response.UserHandle = a.userHandle
+
+	return roundTrip(a.t, response)
+}
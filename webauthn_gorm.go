@@ -0,0 +1,483 @@
+package userion
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Default settings of GormWebAuthnManager
+const (
+	DefaultWebAuthnTimeout = 5 * time.Minute
+)
+
+// Ceremonies a WebAuthn challenge is issued for
+const (
+	webAuthnCeremonyRegistration = "webauthn.create"
+	webAuthnCeremonyLogin        = "webauthn.get"
+)
+
+// GormWebAuthnCredentialModel represents a passkey registered by a user
+type GormWebAuthnCredentialModel struct {
+	ID           uuid.UUID      `gorm:"type:uuid;primaryKey;"`
+	UserID       uuid.UUID      `gorm:"type:uuid;not null;index"`
+	CredentialID []byte         `gorm:"unique;not null"`
+	PublicKey    []byte         `gorm:"not null"`
+	Algorithm    int64          `gorm:"not null"`
+	SignCount    uint32         `gorm:"not null;default:0"`
+	Transports   datatypes.JSON `gorm:"type:json;default:'[]'"`
+	Nickname     string         `gorm:"not null;default:''"`
+	AAGUID       uuid.UUID      `gorm:"type:uuid"`
+	CloneWarning bool           `gorm:"not null;default:false"`
+	CreatedAt    time.Time      `gorm:"autoCreateTime"`
+	LastUsedAt   *time.Time
+}
+
+// ToWebAuthnCredential converts a GormWebAuthnCredentialModel to a WebAuthnCredential
+func (g *GormWebAuthnCredentialModel) ToWebAuthnCredential() *WebAuthnCredential {
+	var transports []string
+	if len(g.Transports) > 0 {
+		_ = json.Unmarshal([]byte(g.Transports), &transports)
+	}
+
+	return &WebAuthnCredential{
+		ID:           g.ID,
+		UserID:       g.UserID,
+		CredentialID: g.CredentialID,
+		PublicKey:    g.PublicKey,
+		Algorithm:    g.Algorithm,
+		SignCount:    g.SignCount,
+		Transports:   transports,
+		Nickname:     g.Nickname,
+		AAGUID:       g.AAGUID,
+		CloneWarning: g.CloneWarning,
+		CreatedAt:    g.CreatedAt,
+		LastUsedAt:   g.LastUsedAt,
+	}
+}
+
+// GormWebAuthnChallengeModel represents an outstanding registration or login
+// ceremony. UserID is empty for logins with discoverable credentials.
+type GormWebAuthnChallengeModel struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey;"`
+	ChallengeHash string     `gorm:"type:varchar(64);unique;not null"`
+	Ceremony      string     `gorm:"type:varchar(16);not null"`
+	UserID        *uuid.UUID `gorm:"type:uuid"`
+	ExpiresAt     time.Time  `gorm:"not null"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+}
+
+// GormWebAuthnManager is the GORM implementation of WebAuthnManager
+type GormWebAuthnManager struct {
+	db          *gorm.DB
+	tableName   string
+	userManager UserManager
+	config      WebAuthnConfig
+
+	now func() time.Time
+}
+
+// NewGormWebAuthnManager initializes a new WebAuthnManager for the relying party
+func NewGormWebAuthnManager(db *gorm.DB, tableName string, userManager UserManager, config WebAuthnConfig) WebAuthnManager {
+	if config.RPName == "" {
+		config.RPName = config.RPID
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultWebAuthnTimeout
+	}
+	if config.UserVerification == "" {
+		config.UserVerification = UserVerificationPreferred
+	}
+
+	return &GormWebAuthnManager{
+		db:          db,
+		tableName:   tableName,
+		userManager: userManager,
+		config:      config,
+		now:         time.Now,
+	}
+}
+
+// challengeTableName returns the name of the table holding outstanding challenges
+func (m *GormWebAuthnManager) challengeTableName() string {
+	return m.tableName + "_challenges"
+}
+
+// AutoMigrate creates or updates the database schema for credentials and challenges
+func (m *GormWebAuthnManager) AutoMigrate() error {
+	if err := m.db.Table(m.tableName).AutoMigrate(&GormWebAuthnCredentialModel{}); err != nil {
+		return err
+	}
+	return m.db.Table(m.challengeTableName()).AutoMigrate(&GormWebAuthnChallengeModel{})
+}
+
+// BeginRegistration starts registering a new passkey for the user. The
+// options are passed to navigator.credentials.create() in the browser.
+func (m *GormWebAuthnManager) BeginRegistration(userID string) (*CredentialCreationOptions, error) {
+	user, err := m.userManager.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := m.issueChallenge(webAuthnCeremonyRegistration, &user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := m.credentialDescriptors(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := user.Name
+	if displayName == "" {
+		displayName = user.Username
+	}
+
+	return &CredentialCreationOptions{
+		Challenge: challenge,
+		RP:        RelyingPartyEntity{ID: m.config.RPID, Name: m.config.RPName},
+		User: UserEntity{
+			ID:          user.ID[:],
+			Name:        user.Username,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Algorithm: COSEAlgorithmEdDSA},
+			{Type: "public-key", Algorithm: COSEAlgorithmES256},
+			{Type: "public-key", Algorithm: COSEAlgorithmRS256},
+		},
+		Timeout:            m.config.Timeout.Milliseconds(),
+		ExcludeCredentials: existing,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: m.config.UserVerification,
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// FinishRegistration verifies the authenticator's response and stores the new credential
+func (m *GormWebAuthnManager) FinishRegistration(userID string, response *RegistrationResponse, nickname string) (*WebAuthnCredential, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	clientData, err := m.config.parseClientData(response.Response.ClientDataJSON, webAuthnCeremonyRegistration)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAttestation, err)
+	}
+	if err := m.consumeChallenge(clientData.Challenge, webAuthnCeremonyRegistration, &id); err != nil {
+		return nil, err
+	}
+
+	attestation, err := cborMap(response.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAttestation, err)
+	}
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attestation["authData"].([]byte)
+
+	authData, err := m.config.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAttestation, err)
+	}
+	if authData.CredentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential", ErrInvalidAttestation)
+	}
+	if len(response.RawID) > 0 && !bytes.Equal(response.RawID, authData.CredentialID) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidAttestation)
+	}
+
+	algorithm, publicKey, err := parseCOSEKey(authData.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	if err := verifyAttestationStatement(format, statement, rawAuthData, clientDataHash[:], algorithm, publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAttestation, err)
+	}
+
+	aaguid, _ := uuid.FromBytes(authData.AAGUID)
+	transports, err := json.Marshal(response.Response.Transports)
+	if err != nil {
+		return nil, err
+	}
+	if response.Response.Transports == nil {
+		transports = []byte("[]")
+	}
+
+	record := &GormWebAuthnCredentialModel{
+		ID:           uuid.New(),
+		UserID:       id,
+		CredentialID: authData.CredentialID,
+		PublicKey:    authData.PublicKey,
+		Algorithm:    algorithm,
+		SignCount:    authData.SignCount,
+		Transports:   datatypes.JSON(transports),
+		Nickname:     nickname,
+		AAGUID:       aaguid,
+		CreatedAt:    m.now(),
+	}
+
+	var count int64
+	if err := m.db.Table(m.tableName).Where("credential_id = ?", record.CredentialID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrCredentialExists
+	}
+
+	if err := m.db.Table(m.tableName).Create(record).Error; err != nil {
+		return nil, err
+	}
+
+	return record.ToWebAuthnCredential(), nil
+}
+
+// BeginLogin starts a passkey login. With a user ID the browser is limited to
+// that user's credentials; with an empty ID any discoverable credential works.
+func (m *GormWebAuthnManager) BeginLogin(userID string) (*CredentialRequestOptions, error) {
+	options := &CredentialRequestOptions{
+		Timeout:          m.config.Timeout.Milliseconds(),
+		RPID:             m.config.RPID,
+		UserVerification: m.config.UserVerification,
+	}
+
+	var owner *uuid.UUID
+	if userID != "" {
+		user, err := m.userManager.GetUserByID(userID)
+		if err != nil {
+			return nil, err
+		}
+
+		options.AllowCredentials, err = m.credentialDescriptors(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(options.AllowCredentials) == 0 {
+			return nil, ErrCredentialNotFound
+		}
+		owner = &user.ID
+	}
+
+	challenge, err := m.issueChallenge(webAuthnCeremonyLogin, owner)
+	if err != nil {
+		return nil, err
+	}
+	options.Challenge = challenge
+
+	return options, nil
+}
+
+// FinishLogin verifies an assertion and returns the credential used, whose
+// UserID identifies the user who logged in
+func (m *GormWebAuthnManager) FinishLogin(response *AssertionResponse) (*WebAuthnCredential, error) {
+	var record GormWebAuthnCredentialModel
+	if err := m.db.Table(m.tableName).Where("credential_id = ?", []byte(response.RawID)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCredentialNotFound
+		}
+		return nil, err
+	}
+
+	clientData, err := m.config.parseClientData(response.Response.ClientDataJSON, webAuthnCeremonyLogin)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAssertion, err)
+	}
+	if err := m.consumeChallenge(clientData.Challenge, webAuthnCeremonyLogin, &record.UserID); err != nil {
+		return nil, err
+	}
+
+	// Discoverable credentials report the user handle they were created for
+	if len(response.Response.UserHandle) > 0 && !bytes.Equal(response.Response.UserHandle, record.UserID[:]) {
+		return nil, fmt.Errorf("%w: user handle mismatch", ErrInvalidAssertion)
+	}
+
+	authData, err := m.config.parseAuthenticatorData(response.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAssertion, err)
+	}
+
+	algorithm, publicKey, err := parseCOSEKey(record.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), response.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !verifyCOSESignature(algorithm, publicKey, signed, response.Response.Signature) {
+		return nil, fmt.Errorf("%w: invalid signature", ErrInvalidAssertion)
+	}
+
+	user, err := m.userManager.GetUserByID(record.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+	if !user.Enabled {
+		return nil, ErrUserDisabled
+	}
+
+	// A counter that does not increase means another copy of the key is in use
+	if (authData.SignCount != 0 || record.SignCount != 0) && authData.SignCount <= record.SignCount {
+		if err := m.db.Table(m.tableName).Where("id = ?", record.ID).Update("clone_warning", true).Error; err != nil {
+			return nil, err
+		}
+		return nil, ErrAuthenticatorCloned
+	}
+
+	now := m.now()
+	result := m.db.Table(m.tableName).Where("id = ? AND sign_count = ?", record.ID, record.SignCount).Updates(map[string]interface{}{
+		"sign_count":   authData.SignCount,
+		"last_used_at": now,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// A concurrent login moved the counter first
+		return nil, ErrAuthenticatorCloned
+	}
+
+	record.SignCount = authData.SignCount
+	record.LastUsedAt = &now
+	return record.ToWebAuthnCredential(), nil
+}
+
+// ListCredentials returns the passkeys of a user, oldest first
+func (m *GormWebAuthnManager) ListCredentials(userID string) ([]*WebAuthnCredential, error) {
+	var records []GormWebAuthnCredentialModel
+	if err := m.db.Table(m.tableName).Where("user_id = ?", userID).Order("created_at").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	credentials := make([]*WebAuthnCredential, len(records))
+	for i := range records {
+		credentials[i] = records[i].ToWebAuthnCredential()
+	}
+	return credentials, nil
+}
+
+// HasLoginMethod reports whether a user has registered a passkey,
+// implementing LoginMethodChecker
+func (m *GormWebAuthnManager) HasLoginMethod(userID string) (bool, error) {
+	var count int64
+	err := m.db.Table(m.tableName).Where("user_id = ?", userID).Count(&count).Error
+	return count > 0, err
+}
+
+// RenameCredential changes the nickname of a passkey
+func (m *GormWebAuthnManager) RenameCredential(id string, nickname string) error {
+	result := m.db.Table(m.tableName).Where("id = ?", id).Update("nickname", nickname)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+// DeleteCredential removes a passkey
+func (m *GormWebAuthnManager) DeleteCredential(id string) error {
+	result := m.db.Table(m.tableName).Where("id = ?", id).Delete(&GormWebAuthnCredentialModel{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+// credentialDescriptors lists the credentials of a user for allow and exclude lists
+func (m *GormWebAuthnManager) credentialDescriptors(userID uuid.UUID) ([]CredentialDescriptor, error) {
+	credentials, err := m.ListCredentials(userID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors := make([]CredentialDescriptor, len(credentials))
+	for i, credential := range credentials {
+		descriptors[i] = CredentialDescriptor{
+			Type:       "public-key",
+			ID:         credential.CredentialID,
+			Transports: credential.Transports,
+		}
+	}
+	return descriptors, nil
+}
+
+// issueChallenge stores the hash of a new random challenge for a ceremony
+func (m *GormWebAuthnManager) issueChallenge(ceremony string, userID *uuid.UUID) (Base64URL, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+
+	// Expired challenges are of no use; clean them up as new ones are issued
+	if err := m.db.Table(m.challengeTableName()).Where("expires_at <= ?", now).Delete(&GormWebAuthnChallengeModel{}).Error; err != nil {
+		return nil, err
+	}
+
+	record := &GormWebAuthnChallengeModel{
+		ID:            uuid.New(),
+		ChallengeHash: HashToken(token),
+		Ceremony:      ceremony,
+		UserID:        userID,
+		ExpiresAt:     now.Add(m.config.Timeout),
+		CreatedAt:     now,
+	}
+	if err := m.db.Table(m.challengeTableName()).Create(record).Error; err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// consumeChallenge deletes an unexpired challenge of the ceremony. Challenges
+// bound to a user only complete ceremonies for that user.
+func (m *GormWebAuthnManager) consumeChallenge(challenge string, ceremony string, userID *uuid.UUID) error {
+	var record GormWebAuthnChallengeModel
+	err := m.db.Table(m.challengeTableName()).Where("challenge_hash = ? AND ceremony = ?", HashToken(strings.TrimRight(challenge, "=")), ceremony).First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidChallenge
+		}
+		return err
+	}
+
+	result := m.db.Table(m.challengeTableName()).Where("id = ?", record.ID).Delete(&GormWebAuthnChallengeModel{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidChallenge
+	}
+
+	if !m.now().Before(record.ExpiresAt) {
+		return ErrInvalidChallenge
+	}
+	if record.UserID != nil && (userID == nil || *record.UserID != *userID) {
+		return ErrInvalidChallenge
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package userion
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://login.example.com"
+)
+
+// setupWebAuthnManagerGorm creates a WebAuthnManager for tests
+func setupWebAuthnManagerGorm(t *testing.T) (*GormWebAuthnManager, UserManager, *gorm.DB) {
+	userManager, db := setupTestDBGorm(t)
+
+	tableName := "webauthn_test_" + uuid.New().String()[:8]
+	webAuthnManager := NewGormWebAuthnManager(db, tableName, userManager, WebAuthnConfig{
+		RPID:    testRPID,
+		RPName:  "Example",
+		Origins: []string{testOrigin},
+	}).(*GormWebAuthnManager)
+	err := webAuthnManager.AutoMigrate()
+	require.NoError(t, err, "Failed to migrate database")
+
+	return webAuthnManager, userManager, db
+}
+
+// registerPasskey runs a registration ceremony with the authenticator
+func registerPasskey(t *testing.T, webAuthnManager *GormWebAuthnManager, user *User, authenticator *softAuthenticator, nickname string) *WebAuthnCredential {
+	options, err := webAuthnManager.BeginRegistration(user.ID.String())
+	require.NoError(t, err)
+	credential, err := webAuthnManager.FinishRegistration(user.ID.String(), authenticator.register(options), nickname)
+	require.NoError(t, err)
+	return credential
+}
+
+// TestWebAuthnRegistrationAndLogin_Gorm tests both ceremonies for every supported algorithm
+func TestWebAuthnRegistrationAndLogin_Gorm(t *testing.T) {
+	for name, algorithm := range map[string]int64{"ES256": COSEAlgorithmES256, "EdDSA": COSEAlgorithmEdDSA, "RS256": COSEAlgorithmRS256} {
+		t.Run(name, func(t *testing.T) {
+			webAuthnManager, userManager, _ := setupWebAuthnManagerGorm(t)
+			user := createTestUser(t, userManager)
+			authenticator := newSoftAuthenticator(t, testOrigin, algorithm)
+
+			options, err := webAuthnManager.BeginRegistration(user.ID.String())
+			require.NoError(t, err, "BeginRegistration should not error with valid user ID")
+			assert.Equal(t, testRPID, options.RP.ID)
+			assert.Equal(t, user.Username, options.User.Name)
+			assert.Equal(t, user.ID[:], []byte(options.User.ID))
+
+			credential, err := webAuthnManager.FinishRegistration(user.ID.String(), authenticator.register(options), "Laptop")
+			require.NoError(t, err, "FinishRegistration should accept a valid attestation")
+			assert.Equal(t, user.ID, credential.UserID)
+			assert.Equal(t, authenticator.credentialID, []byte(credential.CredentialID))
+			assert.Equal(t, algorithm, credential.Algorithm)
+			assert.Equal(t, []string{"internal"}, credential.Transports)
+			assert.Equal(t, "Laptop", credential.Nickname)
+
+			// Login bound to the user
+			loginOptions, err := webAuthnManager.BeginLogin(user.ID.String())
+			require.NoError(t, err)
+			require.Len(t, loginOptions.AllowCredentials, 1)
+			used, err := webAuthnManager.FinishLogin(authenticator.login(loginOptions))
+			assert.NoError(t, err, "FinishLogin should accept a valid assertion")
+			assert.Equal(t, user.ID, used.UserID)
+			assert.Equal(t, uint32(1), used.SignCount)
+			assert.NotNil(t, used.LastUsedAt)
+
+			// Login with a discoverable credential
+			loginOptions, err = webAuthnManager.BeginLogin("")
+			require.NoError(t, err)
+			assert.Empty(t, loginOptions.AllowCredentials)
+			used, err = webAuthnManager.FinishLogin(authenticator.login(loginOptions))
+			assert.NoError(t, err, "FinishLogin should accept a discoverable credential")
+			assert.Equal(t, user.ID, used.UserID)
+		})
+	}
+}
+
+// TestWebAuthnPackedAttestation_Gorm tests packed self attestation
+func TestWebAuthnPackedAttestation_Gorm(t *testing.T) {
+	webAuthnManager, userManager, _ := setupWebAuthnManagerGorm(t)
+	user := createTestUser(t, userManager)
+	authenticator := newSoftAuthenticator(t, testOrigin, COSEAlgorithmES256)
+	authenticator.attestation = "packed"
+
+	registerPasskey(t, webAuthnManager, user, authenticator, "Security key")
+
+	// A statement signed over other data is rejected
+	options, err := webAuthnManager.BeginRegistration(user.ID.String())
+	require.NoError(t, err)
+	other := newSoftAuthenticator(t, testOrigin, COSEAlgorithmES256)
+	other.attestation = "packed"
+	response := other.register(options)
+	attestation, err := cborMap(response.Response.AttestationObject)
+	require.NoError(t, err)
+	attestation["attStmt"].(map[interface{}]interface{})["sig"] = other.sign([]byte("other data"))
+	response.Response.AttestationObject = encodeCBOR(attestation)
+	_, err = webAuthnManager.FinishRegistration(user.ID.String(), response, "")
+	assert.ErrorIs(t, err, ErrInvalidAttestation, "Invalid attestation signatures should be rejected")
+}
+
+// TestWebAuthnCeremonyChecks_Gorm tests rejection of replayed, foreign and tampered responses
+func TestWebAuthnCeremonyChecks_Gorm(t *testing.T) {
+	webAuthnManager, userManager, _ := setupWebAuthnManagerGorm(t)
+	user := createTestUser(t, userManager)
+	authenticator := newSoftAuthenticator(t, testOrigin, COSEAlgorithmES256)
+
+	// Wrong origin
+	options, err := webAuthnManager.BeginRegistration(user.ID.String())
+	require.NoError(t, err)
+	authenticator.origin = "https://evil.example.net"
+	_, err = webAuthnManager.FinishRegistration(user.ID.String(), authenticator.register(options), "")
+	assert.ErrorIs(t, err, ErrInvalidAttestation, "Foreign origins should be rejected")
+	authenticator.origin = testOrigin
+
+	// Challenges are bound to the user they were issued for
+	options, err = webAuthnManager.BeginRegistration(user.ID.String())
+	require.NoError(t, err)
+	_, err = webAuthnManager.FinishRegistration(uuid.New().String(), authenticator.register(options), "")
+	assert.ErrorIs(t, err, ErrInvalidChallenge, "Challenges of another user should be rejected")
+
+	// Registration succeeds once; the same credential cannot be registered twice
+	registerPasskey(t, webAuthnManager, user, authenticator, "")
+	options, err = webAuthnManager.BeginRegistration(user.ID.String())
+	require.NoError(t, err)
+	assert.Len(t, options.ExcludeCredentials, 1, "Existing credentials should be excluded")
+	_, err = webAuthnManager.FinishRegistration(user.ID.String(), authenticator.register(options), "")
+	assert.ErrorIs(t, err, ErrCredentialExists)
+
+	// Replayed assertion
+	loginOptions, err := webAuthnManager.BeginLogin(user.ID.String())
+	require.NoError(t, err)
+	assertion := authenticator.login(loginOptions)
+	_, err = webAuthnManager.FinishLogin(assertion)
+	require.NoError(t, err)
+	_, err = webAuthnManager.FinishLogin(assertion)
+	assert.ErrorIs(t, err, ErrInvalidChallenge, "Replayed assertions should be rejected")
+
+	// Tampered signature
+	loginOptions, err = webAuthnManager.BeginLogin(user.ID.String())
+	require.NoError(t, err)
+	assertion = authenticator.login(loginOptions)
+	assertion.Response.Signature[len(assertion.Response.Signature)-1] ^= 0xff
+	_, err = webAuthnManager.FinishLogin(assertion)
+	assert.ErrorIs(t, err, ErrInvalidAssertion, "Invalid signatures should be rejected")
+
+	// Unknown credential
+	loginOptions, err = webAuthnManager.BeginLogin("")
+	require.NoError(t, err)
+	_, err = webAuthnManager.FinishLogin(newSoftAuthenticator(t, testOrigin, COSEAlgorithmES256).login(loginOptions))
+	assert.ErrorIs(t, err, ErrCredentialNotFound)
+
+	// Disabled users cannot log in
+	require.NoError(t, userManager.DisableUserByID(user.ID.String()))
+	loginOptions, err = webAuthnManager.BeginLogin(user.ID.String())
+	require.NoError(t, err)
+	_, err = webAuthnManager.FinishLogin(authenticator.login(loginOptions))
+	assert.ErrorIs(t, err, ErrUserDisabled)
+}
+
+// TestWebAuthnCloneDetection_Gorm tests sign count regression
+func TestWebAuthnCloneDetection_Gorm(t *testing.T) {
+	webAuthnManager, userManager, _ := setupWebAuthnManagerGorm(t)
+	user := createTestUser(t, userManager)
+	authenticator := newSoftAuthenticator(t, testOrigin, COSEAlgorithmEdDSA)
+	credential := registerPasskey(t, webAuthnManager, user, authenticator, "")
+
+	// A copy of the authenticator keeps its own counter
+	clone := *authenticator
+
+	for i := 0; i < 2; i++ {
+		options, err := webAuthnManager.BeginLogin(user.ID.String())
+		require.NoError(t, err)
+		_, err = webAuthnManager.FinishLogin(authenticator.login(options))
+		require.NoError(t, err)
+	}
+
+	options, err := webAuthnManager.BeginLogin(user.ID.String())
+	require.NoError(t, err)
+	_, err = webAuthnManager.FinishLogin(clone.login(options))
+	assert.ErrorIs(t, err, ErrAuthenticatorCloned, "A sign count regression should be detected")
+
+	credentials, err := webAuthnManager.ListCredentials(user.ID.String())
+	require.NoError(t, err)
+	require.Len(t, credentials, 1)
+	assert.Equal(t, credential.ID, credentials[0].ID)
+	assert.True(t, credentials[0].CloneWarning, "The credential should be flagged")
+}
+
+// TestManageWebAuthnCredentials_Gorm tests listing, renaming and deleting passkeys
+func TestManageWebAuthnCredentials_Gorm(t *testing.T) {
+	webAuthnManager, userManager, _ := setupWebAuthnManagerGorm(t)
+	user := createTestUser(t, userManager)
+
+	_, err := webAuthnManager.BeginLogin(user.ID.String())
+	assert.Equal(t, ErrCredentialNotFound, err, "BeginLogin should error for users without passkeys")
+	hasPasskey, err := webAuthnManager.HasLoginMethod(user.ID.String())
+	require.NoError(t, err)
+	assert.False(t, hasPasskey)
+
+	phone := registerPasskey(t, webAuthnManager, user, newSoftAuthenticator(t, testOrigin, COSEAlgorithmES256), "Phone")
+	registerPasskey(t, webAuthnManager, user, newSoftAuthenticator(t, testOrigin, COSEAlgorithmEdDSA), "Laptop")
+
+	credentials, err := webAuthnManager.ListCredentials(user.ID.String())
+	assert.NoError(t, err)
+	assert.Len(t, credentials, 2, "Users may register several passkeys")
+	hasPasskey, err = webAuthnManager.HasLoginMethod(user.ID.String())
+	require.NoError(t, err)
+	assert.True(t, hasPasskey)
+
+	assert.NoError(t, webAuthnManager.RenameCredential(phone.ID.String(), "Old phone"))
+	credentials, err = webAuthnManager.ListCredentials(user.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "Old phone", credentials[0].Nickname)
+
+	assert.NoError(t, webAuthnManager.DeleteCredential(phone.ID.String()))
+	assert.Equal(t, ErrCredentialNotFound, webAuthnManager.DeleteCredential(phone.ID.String()))
+	assert.Equal(t, ErrCredentialNotFound, webAuthnManager.RenameCredential(phone.ID.String(), "x"))
+
+	credentials, err = webAuthnManager.ListCredentials(user.ID.String())
+	require.NoError(t, err)
+	require.Len(t, credentials, 1)
+	assert.Equal(t, "Laptop", credentials[0].Nickname)
+}